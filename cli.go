@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"claude-api/internal/config"
+	"claude-api/internal/database"
+)
+
+// cliUsage 命令行用法
+const cliUsage = `用法: claude-api [子命令] [参数]
+
+不带子命令或使用 serve 时启动服务器，参数见下方。
+
+管理子命令（服务器运行中时通过管理 API 操作，否则直接操作数据库）:
+  user create -name 名称 [-email 邮箱] [-vip] [-daily-quota N] [-monthly-quota N] [-request-quota N] [-rpm N] [-tpm N] [-notes 备注]
+  user list [-json]
+  user enable|disable 用户ID
+  account import -file 文件 | -sso-cache [-dir 目录] [-dry-run]
+  account list [-json]
+  account refresh -all | 账号ID...
+  backup export [-o 文件]
+  backup import 文件
+  logs cleanup [-days N]
+
+仅在服务器本机直接操作数据库:
+  admin reset-password [-password 新密码]
+  db migrate
+
+管理子命令的通用参数（须写在位置参数之前）:
+  -data-dir 目录   数据目录（与服务器启动参数一致）
+  -server 地址     管理 API 地址（默认探测本机运行中的服务器，管理员密码从数据库读取）
+  -password 密码   配合 -server 使用的管理员密码（默认读取环境变量 CLAUDE_API_ADMIN_PASSWORD）
+  -local           不探测服务器，直接操作数据库
+
+`
+
+// cliCommands 管理子命令：命令组 -> 子命令 -> 处理函数
+var cliCommands = map[string]map[string]func(args []string) error{
+	"user":    {"create": cmdUserCreate, "list": cmdUserList, "enable": cmdUserEnable, "disable": cmdUserDisable},
+	"account": {"import": cmdAccountImport, "list": cmdAccountList, "refresh": cmdAccountRefresh},
+	"admin":   {"reset-password": cmdAdminResetPassword},
+	"backup":  {"export": cmdBackupExport, "import": cmdBackupImport},
+	"db":      {"migrate": cmdDBMigrate},
+	"logs":    {"cleanup": cmdLogsCleanup},
+}
+
+// runCommand 执行管理子命令（第一个参数不以 - 开头时视为子命令）
+// @param args 命令行参数（不含程序名，不含 serve）
+// @return handled 是否为子命令，false 时按服务器启动参数处理
+// @author ygw
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return false, nil
+	}
+	if args[0] == "help" {
+		fmt.Print(cliUsage)
+		return true, nil
+	}
+
+	group, ok := cliCommands[args[0]]
+	if !ok {
+		return true, fmt.Errorf("未知的子命令: %s（使用 help 查看用法）", args[0])
+	}
+	var names []string
+	for name := range group {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) < 2 {
+		return true, fmt.Errorf("%s 需要子命令: %s", args[0], strings.Join(names, ", "))
+	}
+	fn, ok := group[args[1]]
+	if !ok {
+		return true, fmt.Errorf("未知的子命令: %s %s（可用: %s）", args[0], args[1], strings.Join(names, ", "))
+	}
+	return true, fn(args[2:])
+}
+
+// cliOptions 管理子命令的通用参数
+type cliOptions struct {
+	dataDir  string
+	server   string
+	password string
+	local    bool
+}
+
+// newFlagSet 创建带通用参数的子命令参数集
+func newFlagSet(name string) (*flag.FlagSet, *cliOptions) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	o := &cliOptions{}
+	fs.StringVar(&o.dataDir, "data-dir", "", "数据目录路径（与服务器启动参数一致）")
+	fs.StringVar(&o.server, "server", "", "管理 API 地址，默认探测本机运行中的服务器")
+	fs.StringVar(&o.password, "password", "", "配合 -server 使用的管理员密码（默认读取环境变量 CLAUDE_API_ADMIN_PASSWORD）")
+	fs.BoolVar(&o.local, "local", false, "不探测服务器，直接操作数据库")
+	return fs, o
+}
+
+// cliEnv 子命令运行环境：remote 非空时通过管理 API 操作，否则直接操作数据库
+type cliEnv struct {
+	cfg    *config.Config
+	db     *database.DB
+	remote *adminClient
+}
+
+// open 确定运行方式
+// 指定 -server 时只使用管理 API；否则打开本地数据库，并探测本机服务器是否在运行
+func (o *cliOptions) open() (*cliEnv, error) {
+	// 环境变量在解析参数后读取，避免密码出现在参数帮助的默认值中
+	if o.password == "" {
+		o.password = os.Getenv("CLAUDE_API_ADMIN_PASSWORD")
+	}
+	if o.server != "" {
+		if o.local {
+			return nil, fmt.Errorf("-server 与 -local 不能同时使用")
+		}
+		client := newAdminClient(o.server, o.password)
+		if err := client.ping(); err != nil {
+			return nil, fmt.Errorf("无法连接管理 API %s: %w", o.server, err)
+		}
+		return &cliEnv{remote: client}, nil
+	}
+
+	cfg, db, err := openCLIDatabase(o.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	env := &cliEnv{cfg: cfg, db: db}
+	if o.local {
+		return env, nil
+	}
+
+	base := localServerURL(cfg)
+	password := o.password
+	if password == "" {
+		password = cfg.AdminPassword
+	}
+	client := newAdminClient(base, password)
+	if client.ping() == nil {
+		fmt.Fprintf(os.Stderr, "服务器运行中，通过管理 API %s 操作\n", base)
+		env.remote = client
+	}
+	return env, nil
+}
+
+// Close 关闭数据库连接
+func (e *cliEnv) Close() {
+	if e.db != nil {
+		e.db.Close()
+	}
+}
+
+// openCLIDatabase 按服务器相同的方式加载配置并打开数据库（指定 dataDir 时先切换到该目录）
+// 打开数据库时会自动迁移表结构，并从系统设置加载管理员密码和端口
+func openCLIDatabase(dataDir string) (*config.Config, *database.DB, error) {
+	initTimezone()
+	if dataDir != "" {
+		if err := os.Chdir(dataDir); err != nil {
+			return nil, nil, fmt.Errorf("切换到数据目录失败: %w", err)
+		}
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		cfg = config.Load()
+	}
+	if err := cfg.ApplyEnv(); err != nil {
+		return nil, nil, fmt.Errorf("环境变量上游地址无效: %w", err)
+	}
+	filePort := cfg.Server.Port
+
+	// 命令行不初始化日志系统，数据库初始化信息不会混入 -json 等命令输出
+	db, err := database.New(cfg)
+	if err == nil {
+		_, err = db.GetSettings(context.Background())
+		if err != nil {
+			db.Close()
+			err = fmt.Errorf("读取系统设置失败: %w", err)
+		}
+	} else {
+		err = fmt.Errorf("打开数据库失败: %w", err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// 与服务器启动时一致：配置文件端口优先于系统设置中的端口
+	if filePort > 0 && filePort <= 65535 {
+		cfg.Port = filePort
+	}
+	return cfg, db, nil
+}
+
+// localServerURL 本机服务器的管理 API 地址
+func localServerURL(cfg *config.Config) string {
+	host := cfg.Server.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s:%d", host, cfg.Port)
+}
+
+// adminClient 管理 API 客户端
+type adminClient struct {
+	base       string
+	password   string
+	httpClient *http.Client
+}
+
+func newAdminClient(base, password string) *adminClient {
+	return &adminClient{
+		base:       strings.TrimRight(base, "/"),
+		password:   password,
+		httpClient: &http.Client{Timeout: 10 * time.Minute}, // 导入和批量刷新可能较慢
+	}
+}
+
+// ping 检查服务器是否在运行
+func (a *adminClient) ping() error {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(a.base + "/healthz")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("健康检查返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// call 以 JSON 调用管理 API，out 非空时解析响应
+func (a *adminClient) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	data, err := a.send(method, path, "application/json", body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析管理 API 响应失败: %w", err)
+	}
+	return nil
+}
+
+// send 发送请求并返回响应体，非 2xx 响应返回其中的 error 字段
+// 服务器处于测试模式时，敏感操作的操作密码从环境变量 CLAUDE_API_TEST_PASSWORD 读取
+func (a *adminClient) send(method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, a.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.password)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if pw := os.Getenv("CLAUDE_API_TEST_PASSWORD"); pw != "" {
+		req.Header.Set("X-Test-Password", pw)
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("管理 API 返回 %d: %s", resp.StatusCode, e.Error)
+		}
+		return nil, fmt.Errorf("管理 API 返回 %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// printTable 以对齐的表格输出到标准输出
+func printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// printJSON 以缩进 JSON 输出到标准输出
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// deref 取字符串指针的值，nil 时返回空字符串
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/models"
+	"claude-api/internal/ssocache"
+
+	"github.com/google/uuid"
+)
+
+// cmdUserCreate 创建用户并输出完整的 API key
+// @author ygw
+func cmdUserCreate(args []string) error {
+	fs, o := newFlagSet("user create")
+	name := fs.String("name", "", "用户名称（必填）")
+	email := fs.String("email", "", "邮箱")
+	vip := fs.Bool("vip", false, "VIP 用户")
+	dailyQuota := fs.Int("daily-quota", 0, "每日 token 配额，0 表示不限制")
+	monthlyQuota := fs.Int("monthly-quota", 0, "每月 token 配额，0 表示不限制")
+	requestQuota := fs.Int("request-quota", 0, "每日请求次数限制，0 表示不限制")
+	rpm := fs.Int("rpm", 0, "每分钟请求频率限制，0 表示不限制")
+	tpm := fs.Int("tpm", 0, "每分钟 token 限制，0 表示不限制")
+	notes := fs.String("notes", "", "备注")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("请使用 -name 指定用户名称")
+	}
+
+	req := &models.UserCreate{
+		Name:         *name,
+		DailyQuota:   dailyQuota,
+		MonthlyQuota: monthlyQuota,
+		RequestQuota: requestQuota,
+		RateLimitRPM: rpm,
+		RateLimitTPM: tpm,
+		IsVip:        vip,
+	}
+	if *email != "" {
+		req.Email = email
+	}
+	if *notes != "" {
+		req.Notes = notes
+	}
+
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	user := &models.User{}
+	if env.remote != nil {
+		if err := env.remote.call("POST", "/v2/users", req, user); err != nil {
+			return err
+		}
+	} else {
+		apiKey, err := auth.GenerateAPIKey()
+		if err != nil {
+			return fmt.Errorf("生成 API key 失败: %w", err)
+		}
+		user = models.NewUser(uuid.New().String(), apiKey, req)
+		if err := env.db.CreateUser(context.Background(), user); err != nil {
+			return fmt.Errorf("创建用户失败: %w", err)
+		}
+	}
+
+	fmt.Printf("已创建用户 %s (%s)\nAPI key: %s\n", user.Name, user.ID, user.APIKey)
+	return nil
+}
+
+// cmdUserList 列出用户（API key 只显示前缀）
+func cmdUserList(args []string) error {
+	fs, o := newFlagSet("user list")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	var users []*models.User
+	if env.remote != nil {
+		err = env.remote.call("GET", "/v2/users", nil, &users)
+	} else {
+		users, err = env.db.ListUsers(context.Background(), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("获取用户列表失败: %w", err)
+	}
+	for _, u := range users {
+		u.APIKey = maskKey(u.APIKey)
+	}
+
+	if *asJSON {
+		return printJSON(users)
+	}
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, []string{u.ID, u.Name, deref(u.Email), u.APIKey, strconv.FormatBool(u.Enabled), strconv.FormatBool(u.IsVip), strconv.FormatInt(u.TotalRequests, 10), u.CreatedAt})
+	}
+	return printTable([]string{"ID", "名称", "邮箱", "API KEY", "启用", "VIP", "请求数", "创建时间"}, rows)
+}
+
+// cmdUserEnable 启用用户
+func cmdUserEnable(args []string) error {
+	return setUserEnabled("user enable", args, true)
+}
+
+// cmdUserDisable 禁用用户
+func cmdUserDisable(args []string) error {
+	return setUserEnabled("user disable", args, false)
+}
+
+// setUserEnabled 修改一个或多个用户的启用状态
+func setUserEnabled(name string, args []string, enabled bool) error {
+	fs, o := newFlagSet(name)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("请指定用户 ID")
+	}
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	update := &models.UserUpdate{Enabled: &enabled}
+	for _, id := range fs.Args() {
+		if env.remote != nil {
+			err = env.remote.call("PATCH", "/v2/users/"+id, update, nil)
+		} else {
+			err = env.db.UpdateUser(context.Background(), id, update)
+		}
+		if err != nil {
+			return fmt.Errorf("更新用户 %s 失败: %w", id, err)
+		}
+		fmt.Printf("用户 %s 已%s\n", id, map[bool]string{true: "启用", false: "禁用"}[enabled])
+	}
+	return nil
+}
+
+// maskKey 只保留 API key 前缀
+func maskKey(key string) string {
+	if len(key) <= 12 {
+		return key
+	}
+	return key[:12] + "..."
+}
+
+// cmdAccountImport 导入账号
+// -file 读取 Token 导入格式的 JSON 数组（与管理页面的 Token 导入相同），-sso-cache 读取 Kiro / AWS SSO 缓存目录
+// 两种来源都按 SSO 缓存导入流程验证、查重后创建账号
+// @author ygw
+func cmdAccountImport(args []string) error {
+	fs, o := newFlagSet("account import")
+	file := fs.String("file", "", "Token 导入 JSON 文件: [{\"refreshToken\":\"...\",\"clientId\":\"...\",\"clientSecret\":\"...\",\"region\":\"...\"}]")
+	fromCache := fs.Bool("sso-cache", false, "从 SSO 缓存目录导入")
+	dir := fs.String("dir", ssocache.DefaultDir(), "SSO 缓存目录（配合 -sso-cache）")
+	dryRun := fs.Bool("dry-run", false, "只验证和查重，不创建账号")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var files []ssocache.File
+	var err error
+	switch {
+	case *file != "" && *fromCache:
+		return fmt.Errorf("-file 与 -sso-cache 不能同时使用")
+	case *file != "":
+		files, err = readTokenFile(*file)
+	case *fromCache:
+		files, err = ssocache.ReadDir(*dir)
+	default:
+		return fmt.Errorf("请使用 -file 或 -sso-cache 指定导入来源")
+	}
+	if err != nil {
+		return err
+	}
+	creds, skipped := ssocache.Parse(files)
+	for _, sk := range skipped {
+		fmt.Fprintf(os.Stderr, "跳过 %s: %s\n", sk.File, sk.Reason)
+	}
+	if len(creds) == 0 {
+		return fmt.Errorf("没有可导入的令牌")
+	}
+
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	var results []*ssocache.Result
+	if env.remote != nil {
+		results, err = uploadSSOFiles(env.remote, files, *dryRun)
+	} else {
+		importer := &ssocache.Importer{
+			DB:          env.db,
+			Kiro:        auth.NewKiroClient(env.cfg),
+			OIDC:        auth.NewOIDCClient(env.cfg),
+			MaxAccounts: env.cfg.GetMaxAccounts(),
+			DryRun:      *dryRun,
+		}
+		results, err = importer.Import(context.Background(), creds)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		note := r.Error
+		if r.Warning != "" && note != "" {
+			note += "；" + r.Warning
+		} else if r.Warning != "" {
+			note = r.Warning
+		}
+		rows = append(rows, []string{r.Source, r.AuthMethod, r.Status, r.Email, note})
+	}
+	return printTable([]string{"来源", "方式", "状态", "邮箱", "说明"}, rows)
+}
+
+// readTokenFile 将 Token 导入 JSON 数组拆分为单条缓存文件，便于复用 SSO 缓存解析
+// 含 clientId/clientSecret 的条目按 IdC 账号处理，其余按社交登录处理
+func readTokenFile(path string) ([]ssocache.File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取导入文件失败: %w", err)
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("导入文件应为 JSON 数组: %w", err)
+	}
+	base := filepath.Base(path)
+	files := make([]ssocache.File, len(entries))
+	for i, e := range entries {
+		files[i] = ssocache.File{Name: fmt.Sprintf("%s#%04d", base, i+1), Data: e}
+	}
+	return files, nil
+}
+
+// uploadSSOFiles 通过管理 API 的 SSO 缓存导入接口上传文件
+func uploadSSOFiles(client *adminClient, files []ssocache.File, dryRun bool) ([]*ssocache.Result, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range files {
+		part, err := mw.CreateFormFile("files", f.Name)
+		if err != nil {
+			return nil, err
+		}
+		part.Write(f.Data)
+	}
+	mw.WriteField("dryRun", strconv.FormatBool(dryRun))
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	data, err := client.send("POST", "/v2/accounts/import-sso-cache", mw.FormDataContentType(), &buf)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Results []*ssocache.Result `json:"results"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("解析管理 API 响应失败: %w", err)
+	}
+	return resp.Results, nil
+}
+
+// accountRow 账号列表输出项（不含令牌等敏感信息）
+type accountRow struct {
+	ID                string  `json:"id"`
+	Label             *string `json:"label"`
+	Email             *string `json:"email"`
+	Enabled           bool    `json:"enabled"`
+	Status            string  `json:"status"`
+	LastRefreshStatus *string `json:"last_refresh_status"`
+	LastRefreshTime   *string `json:"last_refresh_time"`
+	ErrorCount        int     `json:"error_count"`
+	SuccessCount      int     `json:"success_count"`
+}
+
+// listAccountRows 获取全部账号：管理 API 按最大页大小分页读取，本地直接查询数据库
+func listAccountRows(env *cliEnv) ([]*accountRow, error) {
+	var accounts []*models.Account
+	if env.remote != nil {
+		for page := 1; ; page++ {
+			var resp struct {
+				Accounts   []*models.Account `json:"accounts"`
+				Pagination struct {
+					Pages int `json:"pages"`
+				} `json:"pagination"`
+			}
+			if err := env.remote.call("GET", fmt.Sprintf("/v2/accounts?page=%d&pageSize=500", page), nil, &resp); err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, resp.Accounts...)
+			if page >= resp.Pagination.Pages {
+				break
+			}
+		}
+	} else {
+		var err error
+		if accounts, err = env.db.ListAccounts(context.Background(), nil, "created_at", false); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := make([]*accountRow, len(accounts))
+	for i, acc := range accounts {
+		rows[i] = &accountRow{
+			ID:                acc.ID,
+			Label:             acc.Label,
+			Email:             acc.Email,
+			Enabled:           acc.Enabled,
+			Status:            acc.Status,
+			LastRefreshStatus: acc.LastRefreshStatus,
+			LastRefreshTime:   acc.LastRefreshTime,
+			ErrorCount:        acc.ErrorCount,
+			SuccessCount:      acc.SuccessCount,
+		}
+	}
+	return rows, nil
+}
+
+// cmdAccountList 列出账号
+func cmdAccountList(args []string) error {
+	fs, o := newFlagSet("account list")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	accounts, err := listAccountRows(env)
+	if err != nil {
+		return fmt.Errorf("获取账号列表失败: %w", err)
+	}
+	if *asJSON {
+		return printJSON(accounts)
+	}
+	rows := make([][]string, 0, len(accounts))
+	for _, a := range accounts {
+		rows = append(rows, []string{a.ID, deref(a.Label), deref(a.Email), strconv.FormatBool(a.Enabled), a.Status, deref(a.LastRefreshStatus), deref(a.LastRefreshTime)})
+	}
+	return printTable([]string{"ID", "名称", "邮箱", "启用", "状态", "刷新状态", "刷新时间"}, rows)
+}
+
+// cmdAccountRefresh 刷新账号令牌，-all 刷新全部启用的账号
+// @author ygw
+func cmdAccountRefresh(args []string) error {
+	fs, o := newFlagSet("account refresh")
+	all := fs.Bool("all", false, "刷新全部启用的账号")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *all == (fs.NArg() > 0) {
+		return fmt.Errorf("请指定账号 ID 或使用 -all")
+	}
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	ids := fs.Args()
+	if *all {
+		accounts, err := listAccountRows(env)
+		if err != nil {
+			return fmt.Errorf("获取账号列表失败: %w", err)
+		}
+		for _, a := range accounts {
+			if a.Enabled {
+				ids = append(ids, a.ID)
+			}
+		}
+	}
+
+	var oidc *auth.OIDCClient
+	var kiro *auth.KiroClient
+	if env.remote == nil {
+		oidc, kiro = auth.NewOIDCClient(env.cfg), auth.NewKiroClient(env.cfg)
+	}
+	failed := 0
+	for _, id := range ids {
+		if env.remote != nil {
+			err = env.remote.call("POST", "/v2/accounts/"+id+"/refresh", nil, nil)
+		} else {
+			err = refreshAccountLocal(context.Background(), env, oidc, kiro, id)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("%s\t失败: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("%s\t成功\n", id)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d 个账号刷新失败", failed, len(ids))
+	}
+	return nil
+}
+
+// refreshAccountLocal 直接刷新数据库中账号的令牌，失败时与服务器一样记录失败状态
+func refreshAccountLocal(ctx context.Context, env *cliEnv, oidc *auth.OIDCClient, kiro *auth.KiroClient, id string) error {
+	acc, err := env.db.GetAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+	if acc == nil {
+		return fmt.Errorf("账号不存在")
+	}
+	if acc.RefreshToken == nil || *acc.RefreshToken == "" {
+		return fmt.Errorf("账号缺少 refreshToken，无法刷新令牌")
+	}
+
+	machineId, needsSave := auth.GetOrCreateMachineID(acc.MachineID)
+	if needsSave {
+		if err := env.db.UpdateAccount(ctx, id, &models.AccountUpdate{MachineID: &machineId}); err != nil {
+			return fmt.Errorf("保存账号 machineId 失败: %w", err)
+		}
+	}
+	if !auth.IsSocialClientID(acc.ClientID) && (acc.ClientID == "" || acc.ClientSecret == "") {
+		return fmt.Errorf("账号缺少 clientId 或 clientSecret，无法刷新令牌")
+	}
+
+	accessToken, refreshToken, expiresIn, err := auth.RefreshTokens(ctx, oidc, kiro, auth.RegionOf(acc.Region), acc.ClientID, acc.ClientSecret, *acc.RefreshToken, machineId)
+	if err != nil {
+		_ = env.db.UpdateTokens(ctx, id, "", *acc.RefreshToken, "failed")
+		_ = env.db.UpdateStats(ctx, id, false)
+		return err
+	}
+	var expiresAt int64
+	if expiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
+	}
+	return env.db.UpdateTokensWithExpiry(ctx, id, accessToken, refreshToken, "success", expiresAt)
+}
+
+// cmdAdminResetPassword 重置管理员密码（直接写入数据库，未指定时随机生成）
+// 用于忘记密码无法登录管理 API 的情况，运行中的服务器在系统设置缓存过期后生效
+// @author ygw
+func cmdAdminResetPassword(args []string) error {
+	fs := flag.NewFlagSet("admin reset-password", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", "", "数据目录路径（与服务器启动参数一致）")
+	password := fs.String("password", "", "新密码，默认随机生成")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *password == "" {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("生成随机密码失败: %w", err)
+		}
+		*password = hex.EncodeToString(b)
+	}
+
+	_, db, err := openCLIDatabase(*dataDir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.UpdateSettings(context.Background(), &models.SettingsUpdate{AdminPassword: password}); err != nil {
+		return fmt.Errorf("更新管理员密码失败: %w", err)
+	}
+	fmt.Printf("管理员密码已重置为: %s\n运行中的服务器将在约 30 秒内生效\n", *password)
+	return nil
+}
+
+// cmdBackupExport 导出数据备份，默认输出到标准输出
+func cmdBackupExport(args []string) error {
+	fs, o := newFlagSet("backup export")
+	out := fs.String("o", "", "输出文件，默认输出到标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	var data []byte
+	if env.remote != nil {
+		data, err = env.remote.send("GET", "/v2/backup/export", "", nil)
+	} else {
+		var backup map[string]interface{}
+		if backup, err = env.db.BackupData(context.Background()); err == nil {
+			data, err = json.Marshal(backup)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("导出备份失败: %w", err)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	// 备份包含账号令牌，仅允许当前用户读取
+	if err := os.WriteFile(*out, data, 0600); err != nil {
+		return fmt.Errorf("写入备份文件失败: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "备份已导出到 %s\n", *out)
+	return nil
+}
+
+// cmdBackupImport 从备份文件恢复数据
+func cmdBackupImport(args []string) error {
+	fs, o := newFlagSet("backup import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("请指定一个备份文件")
+	}
+	raw, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("读取备份文件失败: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("备份文件格式无效: %w", err)
+	}
+
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	if env.remote != nil {
+		err = env.remote.call("POST", "/v2/backup/import", data, nil)
+	} else {
+		err = env.db.RestoreData(context.Background(), data)
+	}
+	if err != nil {
+		return fmt.Errorf("导入备份失败: %w", err)
+	}
+	fmt.Println("备份导入成功")
+	return nil
+}
+
+// cmdDBMigrate 执行数据库迁移（打开数据库时自动完成建表和补充字段）
+func cmdDBMigrate(args []string) error {
+	fs := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", "", "数据目录路径（与服务器启动参数一致）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, db, err := openCLIDatabase(*dataDir)
+	if err != nil {
+		return err
+	}
+	db.Close()
+	fmt.Printf("数据库迁移完成 (%s)\n", cfg.Database.Type)
+	return nil
+}
+
+// cmdLogsCleanup 清理旧的请求日志
+func cmdLogsCleanup(args []string) error {
+	fs, o := newFlagSet("logs cleanup")
+	days := fs.Int("days", 30, "保留最近的天数")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *days < 1 {
+		return fmt.Errorf("-days 至少为 1")
+	}
+	env, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	var deleted int64
+	if env.remote != nil {
+		var resp struct {
+			Deleted int64 `json:"deleted"`
+		}
+		err = env.remote.call("POST", "/v2/logs/cleanup", map[string]int{"days_to_keep": *days}, &resp)
+		deleted = resp.Deleted
+	} else {
+		deleted, err = env.db.CleanupOldLogs(context.Background(), *days)
+	}
+	if err != nil {
+		return fmt.Errorf("清理日志失败: %w", err)
+	}
+	fmt.Printf("已清理 %d 条 %d 天前的日志\n", deleted, *days)
+	return nil
+}
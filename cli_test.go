@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRunCommand 测试子命令分发
+func TestRunCommand(t *testing.T) {
+	for _, args := range [][]string{nil, {"-port", "8080"}, {"-data-dir", "x"}} {
+		if handled, err := runCommand(args); handled || err != nil {
+			t.Errorf("%v 应按服务器启动参数处理", args)
+		}
+	}
+	for _, args := range [][]string{{"foo"}, {"import-sso-cache"}, {"user"}, {"user", "delete"}} {
+		if handled, err := runCommand(args); !handled || err == nil {
+			t.Errorf("%v 应返回未知子命令错误", args)
+		}
+	}
+}
+
+// TestAdminClient 测试管理 API 客户端的认证与错误处理
+func TestAdminClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/healthz":
+			w.WriteHeader(200)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":"未授权"}`))
+		default:
+			var body map[string]int
+			json.NewDecoder(r.Body).Decode(&body)
+			json.NewEncoder(w).Encode(map[string]int{"deleted": body["days_to_keep"] * 2})
+		}
+	}))
+	defer ts.Close()
+
+	client := newAdminClient(ts.URL+"/", "secret")
+	if err := client.ping(); err != nil {
+		t.Fatalf("健康检查应成功: %v", err)
+	}
+	var resp struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := client.call("POST", "/v2/logs/cleanup", map[string]int{"days_to_keep": 7}, &resp); err != nil || resp.Deleted != 14 {
+		t.Errorf("调用结果错误: %v %+v", err, resp)
+	}
+
+	err := newAdminClient(ts.URL, "wrong").call("GET", "/v2/users", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "未授权") {
+		t.Errorf("应返回包含状态码和错误信息的错误: %v", err)
+	}
+}
@@ -629,7 +629,7 @@ export const accountsMixin = {
 
         /**
          * 获取有效时间标签（原重置时间）
-         * @author ygw - 优先从账号列表读取 token_expiry
+         * @author ygw - 优先从账号列表读取 trial_expiry
          * @param {string} accountId - 账号ID
          * @returns {string} 有效时间显示文本
          */
@@ -644,11 +644,11 @@ export const accountsMixin = {
             if (quota && quota.error === '已封控') return '-';
             if (quota && quota.isDuplicate) return '⚠️ 重复';
 
-            // 优先从账号列表读取 token_expiry（数据库缓存）
+            // 优先从账号列表读取 trial_expiry（数据库缓存）
             // @author ygw
             let tokenExpiry = null;
-            if (account && account.token_expiry) {
-                tokenExpiry = account.token_expiry;
+            if (account && account.trial_expiry) {
+                tokenExpiry = account.trial_expiry;
             } else if (quota && quota.freeTrialExpiry) {
                 // 兼容：从 quota 缓存读取
                 tokenExpiry = quota.freeTrialExpiry;
@@ -713,7 +713,7 @@ export const accountsMixin = {
 
         /**
          * 检查账号是否即将过期（7天内）
-         * @author ygw - 优先从账号列表读取 token_expiry
+         * @author ygw - 优先从账号列表读取 trial_expiry
          * @param {string} accountId - 账号ID
          * @returns {boolean} 是否即将过期
          */
@@ -721,10 +721,10 @@ export const accountsMixin = {
             const account = this.accounts.find(acc => acc.id === accountId);
             const quota = this.accountQuotas[accountId];
 
-            // 优先从账号列表读取 token_expiry
+            // 优先从账号列表读取 trial_expiry
             let tokenExpiry = null;
-            if (account && account.token_expiry) {
-                tokenExpiry = account.token_expiry;
+            if (account && account.trial_expiry) {
+                tokenExpiry = account.trial_expiry;
             } else if (quota && quota.freeTrialExpiry) {
                 tokenExpiry = quota.freeTrialExpiry;
             }
@@ -740,7 +740,7 @@ export const accountsMixin = {
 
         /**
          * 检查账号是否已过期
-         * @author ygw - 优先从账号列表读取 token_expiry
+         * @author ygw - 优先从账号列表读取 trial_expiry
          * @param {string} accountId - 账号ID
          * @returns {boolean} 是否已过期
          */
@@ -748,10 +748,10 @@ export const accountsMixin = {
             const account = this.accounts.find(acc => acc.id === accountId);
             const quota = this.accountQuotas[accountId];
 
-            // 优先从账号列表读取 token_expiry
+            // 优先从账号列表读取 trial_expiry
             let tokenExpiry = null;
-            if (account && account.token_expiry) {
-                tokenExpiry = account.token_expiry;
+            if (account && account.trial_expiry) {
+                tokenExpiry = account.trial_expiry;
             } else if (quota && quota.freeTrialExpiry) {
                 tokenExpiry = quota.freeTrialExpiry;
             }
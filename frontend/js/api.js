@@ -509,6 +509,7 @@ export async function claudeMessagesConsole(model, messages, thinkModeEnabled, m
  * @param {Object} handlers - 回调集合
  * @param {Function} handlers.onMeta - 收到 meta 事件回调
  * @param {Function} handlers.onThinking - thinking_delta 回调
+ * @param {Function} handlers.onThinkingSignature - thinking_signature 回调（thinking 段落结束）
  * @param {Function} handlers.onAnswer - answer_delta 回调
  * @param {Function} handlers.onDone - done 事件回调
  * @param {Function} handlers.onError - error 事件回调
@@ -578,6 +579,9 @@ export async function consumeSSEStream(response, handlers = {}, options = {}) {
                     case 'thinking_delta':
                         safeCall(handlers.onThinking, parsed.data);
                         break;
+                    case 'thinking_signature':
+                        safeCall(handlers.onThinkingSignature, parsed.data);
+                        break;
                     case 'answer_delta':
                         safeCall(handlers.onAnswer, parsed.data);
                         break;
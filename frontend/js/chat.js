@@ -330,11 +330,17 @@ export const chatMixin = {
                 const chatConfig = await API.getChatConfig();
 
                 // 构建请求（保留最近 10 条上下文，排除占位消息）
+                // 带签名的 thinking 段落随历史回传，服务端校验签名后保留
                 const claudeMessages = session.messages
                     .slice(-10, -1)
                     .map(msg => ({
                         role: msg.role,
-                        content: msg.content
+                        content: msg.thinkingBlocks?.length
+                            ? [
+                                ...msg.thinkingBlocks.map(b => ({ type: 'thinking', thinking: b.thinking, signature: b.signature })),
+                                { type: 'text', text: msg.content }
+                            ]
+                            : msg.content
                     }));
 
                 // 使用实际请求模型（think 模型使用 baseModel）
@@ -347,6 +353,7 @@ export const chatMixin = {
                 const aiMessage = session.messages[session.messages.length - 1];
                 let aiContent = '';
                 let thinkingContent = '';
+                let thinkingSegment = '';
                 let streamFinished = false;
 
                 this.chatAbortController = new AbortController();
@@ -367,9 +374,16 @@ export const chatMixin = {
                         aiMessage.isThinking = true;
                         aiMessage.thinkingExpanded = true;
                         thinkingContent += delta;
+                        thinkingSegment += delta;
                         aiMessage.thinking = thinkingContent;
                         this.$nextTick(() => this.scrollChatToBottom());
                     },
+                    onThinkingSignature: (payload = {}) => {
+                        if (payload.signature && thinkingSegment) {
+                            aiMessage.thinkingBlocks = [...(aiMessage.thinkingBlocks || []), { thinking: thinkingSegment, signature: payload.signature }];
+                        }
+                        thinkingSegment = '';
+                    },
                     onAnswer: (payload = {}) => {
                         const delta = payload.text || '';
                         if (!delta) return;
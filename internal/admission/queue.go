@@ -0,0 +1,244 @@
+// Package admission 提供推理请求的准入队列
+// 容量不足（并发已满或暂无空闲账号）时请求按优先级排队等待，而不是立即失败
+// @author ygw
+package admission
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Priority 请求优先级，数值越小越先获得容量
+type Priority int
+
+const (
+	PriorityVIP    Priority = iota // VIP 用户
+	PriorityNormal                 // 普通用户
+	PriorityBatch                  // 批处理任务
+)
+
+// String 优先级名称（用于统计和日志）
+func (p Priority) String() string {
+	switch p {
+	case PriorityVIP:
+		return "vip"
+	case PriorityBatch:
+		return "batch"
+	default:
+		return "normal"
+	}
+}
+
+var (
+	// ErrQueueFull 排队人数已达上限
+	ErrQueueFull = errors.New("准入队列已满")
+	// ErrWaitTimeout 等待容量超时
+	ErrWaitTimeout = errors.New("等待容量超时")
+)
+
+// pollInterval 有请求排队时重新检查外部容量条件的间隔
+const pollInterval = 250 * time.Millisecond
+
+// Config 准入队列配置
+type Config struct {
+	MaxConcurrent int           // 同时处理的最大请求数，0 表示不限制
+	MaxQueue      int           // 最大排队数，0 表示不排队（容量不足时直接拒绝）
+	MaxWait       time.Duration // 单个请求最长等待时间
+}
+
+// Queue 带优先级的准入队列
+// 同优先级先到先得；容量释放或外部条件满足时按优先级依次放行
+type Queue struct {
+	mu       sync.Mutex
+	cfg      Config
+	ready    func(inFlight int) bool // 额外的容量条件（如账号仍有空闲并发），参数为处理中的请求数，nil 表示总是满足
+	inFlight int
+	waiters  waiterHeap
+	seq      uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// waiter 一个排队中的请求
+type waiter struct {
+	priority Priority
+	seq      uint64
+	index    int
+	granted  bool
+	ch       chan struct{}
+}
+
+// New 创建准入队列
+// @param cfg 队列配置
+// @param ready 额外的容量条件（参数为处理中的请求数），排队期间定期检查
+func New(cfg Config, ready func(inFlight int) bool) *Queue {
+	q := &Queue{cfg: cfg, ready: ready, stop: make(chan struct{})}
+	go q.pollLoop()
+	return q
+}
+
+// Acquire 获取处理容量，容量不足时按优先级排队等待
+// 返回的 release 必须在请求处理结束后调用
+// @return waited 实际排队等待的时间
+func (q *Queue) Acquire(ctx context.Context, priority Priority) (release func(), waited time.Duration, err error) {
+	q.mu.Lock()
+	if len(q.waiters) == 0 && q.hasCapacityLocked() {
+		q.inFlight++
+		q.mu.Unlock()
+		return q.releaseFunc(), 0, nil
+	}
+	if len(q.waiters) >= q.cfg.MaxQueue {
+		q.mu.Unlock()
+		return nil, 0, ErrQueueFull
+	}
+	q.seq++
+	w := &waiter{priority: priority, seq: q.seq, ch: make(chan struct{})}
+	heap.Push(&q.waiters, w)
+	q.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(q.cfg.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case <-w.ch:
+		return q.releaseFunc(), time.Since(start), nil
+	case <-timer.C:
+		err = ErrWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	if w.granted {
+		// 超时与放行同时发生：已占用的容量归还给下一个请求
+		q.inFlight--
+		q.dispatchLocked()
+	} else {
+		heap.Remove(&q.waiters, w.index)
+	}
+	q.mu.Unlock()
+	return nil, time.Since(start), err
+}
+
+// releaseFunc 返回只生效一次的容量释放函数
+func (q *Queue) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			q.inFlight--
+			q.dispatchLocked()
+			q.mu.Unlock()
+		})
+	}
+}
+
+// hasCapacityLocked 是否还有处理容量
+func (q *Queue) hasCapacityLocked() bool {
+	if q.cfg.MaxConcurrent > 0 && q.inFlight >= q.cfg.MaxConcurrent {
+		return false
+	}
+	return q.ready == nil || q.ready(q.inFlight)
+}
+
+// dispatchLocked 按优先级放行排队中的请求，直到容量用完
+func (q *Queue) dispatchLocked() {
+	for len(q.waiters) > 0 && q.hasCapacityLocked() {
+		w := heap.Pop(&q.waiters).(*waiter)
+		w.granted = true
+		q.inFlight++
+		close(w.ch)
+	}
+}
+
+// pollLoop 定期检查外部容量条件（如账号恢复可用）
+func (q *Queue) pollLoop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			if len(q.waiters) > 0 {
+				q.dispatchLocked()
+			}
+			q.mu.Unlock()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// Stop 停止后台检查
+func (q *Queue) Stop() {
+	q.stopOnce.Do(func() { close(q.stop) })
+}
+
+// Stats 队列统计
+type Stats struct {
+	InFlight      int            `json:"in_flight"`        // 处理中的请求数
+	Depth         int            `json:"depth"`            // 排队中的请求数
+	DepthByClass  map[string]int `json:"depth_by_class"`   // 按优先级统计的排队数
+	MaxConcurrent int            `json:"max_concurrent"`   // 最大并发，0 表示不限制
+	MaxQueue      int            `json:"max_queue"`        // 最大排队数
+	MaxWaitSecs   float64        `json:"max_wait_seconds"` // 最长等待时间
+}
+
+// Stats 返回当前队列统计
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	byClass := map[string]int{
+		PriorityVIP.String():    0,
+		PriorityNormal.String(): 0,
+		PriorityBatch.String():  0,
+	}
+	for _, w := range q.waiters {
+		byClass[w.priority.String()]++
+	}
+	return Stats{
+		InFlight:      q.inFlight,
+		Depth:         len(q.waiters),
+		DepthByClass:  byClass,
+		MaxConcurrent: q.cfg.MaxConcurrent,
+		MaxQueue:      q.cfg.MaxQueue,
+		MaxWaitSecs:   q.cfg.MaxWait.Seconds(),
+	}
+}
+
+// waiterHeap 按（优先级，到达顺序）排序的最小堆
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int { return len(h) }
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return w
+}
@@ -0,0 +1,151 @@
+package admission
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestQueue_PriorityOrder 测试容量释放后按优先级、同优先级按到达顺序放行
+func TestQueue_PriorityOrder(t *testing.T) {
+	q := New(Config{MaxConcurrent: 1, MaxQueue: 10, MaxWait: 5 * time.Second}, nil)
+	defer q.Stop()
+
+	release, _, err := q.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("空闲时应立即获得容量: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(name string, p Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _, err := q.Acquire(context.Background(), p)
+			if err != nil {
+				t.Errorf("%s 应获得容量: %v", name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			r()
+		}()
+	}
+	// 每次入队后等待进入队列，保证到达顺序
+	enqueue("batch", PriorityBatch)
+	waitDepth(t, q, 1)
+	enqueue("normal-1", PriorityNormal)
+	waitDepth(t, q, 2)
+	enqueue("vip", PriorityVIP)
+	waitDepth(t, q, 3)
+	enqueue("normal-2", PriorityNormal)
+	waitDepth(t, q, 4)
+
+	if s := q.Stats(); s.Depth != 4 || s.DepthByClass["normal"] != 2 || s.InFlight != 1 {
+		t.Errorf("队列统计错误: %+v", s)
+	}
+
+	release()
+	release() // 重复释放不生效
+	wg.Wait()
+
+	want := []string{"vip", "normal-1", "normal-2", "batch"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("放行顺序应为 %v，实际 %v", want, order)
+		}
+	}
+	if s := q.Stats(); s.InFlight != 0 || s.Depth != 0 {
+		t.Errorf("全部完成后应无占用: %+v", s)
+	}
+}
+
+// countQueued 当前排队数
+func countQueued(q *Queue) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters)
+}
+
+// waitDepth 等待排队数达到 n
+func waitDepth(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for countQueued(q) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("排队数未达到 %d", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestQueue_FullAndTimeout 测试队列满时立即拒绝、等待超时返回错误
+func TestQueue_FullAndTimeout(t *testing.T) {
+	q := New(Config{MaxConcurrent: 1, MaxQueue: 1, MaxWait: 100 * time.Millisecond}, nil)
+	defer q.Stop()
+
+	release, _, _ := q.Acquire(context.Background(), PriorityNormal)
+	defer release()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := q.Acquire(context.Background(), PriorityNormal)
+		errCh <- err
+	}()
+	waitDepth(t, q, 1)
+
+	if _, _, err := q.Acquire(context.Background(), PriorityVIP); err != ErrQueueFull {
+		t.Errorf("队列满时应返回 ErrQueueFull，实际 %v", err)
+	}
+	if err := <-errCh; err != ErrWaitTimeout {
+		t.Errorf("等待超时应返回 ErrWaitTimeout，实际 %v", err)
+	}
+	if n := countQueued(q); n != 0 {
+		t.Errorf("超时的请求应移出队列，实际排队 %d", n)
+	}
+
+	// 客户端断开
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for countQueued(q) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, _, err := q.Acquire(ctx, PriorityNormal); err != context.Canceled {
+		t.Errorf("取消时应返回 context.Canceled，实际 %v", err)
+	}
+}
+
+// TestQueue_ReadyCondition 测试外部条件（如可用账号）恢复后放行排队请求
+func TestQueue_ReadyCondition(t *testing.T) {
+	var ready atomic.Bool
+	q := New(Config{MaxQueue: 10, MaxWait: 5 * time.Second}, func(int) bool { return ready.Load() })
+	defer q.Stop()
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ready.Store(true)
+	}()
+	release, waited, err := q.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("条件满足后应获得容量: %v", err)
+	}
+	release()
+	if waited < 300*time.Millisecond {
+		t.Errorf("应等待到条件满足，实际等待 %v", waited)
+	}
+
+	// 不排队：容量不足时直接拒绝
+	ready.Store(false)
+	q2 := New(Config{MaxQueue: 0, MaxWait: time.Second}, func(int) bool { return ready.Load() })
+	defer q2.Stop()
+	if _, _, err := q2.Acquire(context.Background(), PriorityNormal); err != ErrQueueFull {
+		t.Errorf("MaxQueue=0 时应直接拒绝，实际 %v", err)
+	}
+}
@@ -32,11 +32,10 @@ var streamBufferPool = sync.Pool{
 	},
 }
 
+// Amazon Q / CodeWhisperer Streaming API 端点按账号区域生成，见 auth.AmazonQEndpoint
 const (
-	// 使用正确的 Amazon Q / CodeWhisperer Streaming API 端点
-	AmazonQEndpoint = "https://q.us-east-1.amazonaws.com/"
-	MaxRetries      = 3
-	RetryDelay      = 500 * time.Millisecond
+	MaxRetries = 3
+	RetryDelay = 500 * time.Millisecond
 )
 
 // NonRetriableError 表示不应重试的错误
@@ -237,6 +236,7 @@ type Client struct {
 	cfg           *config.Config
 	proxyPool     *proxypool.ProxyPool // 代理池
 	baseTransport *http.Transport      // 基础 Transport（无代理配置）
+	transports    *transportCache      // 代理池 HTTP 客户端缓存（按派生代理地址）
 }
 
 // NewClient 创建新的 Amazon Q 客户端
@@ -310,18 +310,21 @@ func NewClient(cfg *config.Config) *Client {
 		},
 		cfg:           cfg,
 		baseTransport: baseTransport,
+		transports:    newTransportCache(DefaultTransportCacheSize),
 	}
 }
 
 // SendChatRequest 发送聊天请求到 Amazon Q（带重试逻辑）
 // payload 可以是 map[string]interface{} 或实现了自定义 MarshalJSON 的结构体
+// region: 账号所在区域，决定请求的区域端点
 // machineId: 设备标识，用于构建 User-Agent
 // accountID: 账号ID，用于代理池 Session 派生
 // logTimestamp 用于日志文件配对（可为空）
 // @author ygw
-func (c *Client) SendChatRequest(ctx context.Context, accessToken, machineId, accountID string, payload interface{}, logTimestamp string) (*http.Response, error) {
+func (c *Client) SendChatRequest(ctx context.Context, region, accessToken, machineId, accountID string, payload interface{}, logTimestamp string) (*http.Response, error) {
+	endpoint := auth.AmazonQEndpoint(region)
 	// 获取账号专用的 HTTP 客户端（支持代理池）
-	httpClient := c.GetHTTPClientForAccount(accountID)
+	httpClient, proxyBase := c.clientForAccount(accountID)
 	// 序列化请求一次
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
@@ -345,7 +348,7 @@ func (c *Client) SendChatRequest(ctx context.Context, accessToken, machineId, ac
 	var lastErr error
 	for attempt := 1; attempt <= MaxRetries; attempt++ {
 		// 为每次尝试创建新请求（body 需要可重读）
-		req, err := http.NewRequestWithContext(ctx, "POST", AmazonQEndpoint, bytes.NewReader(reqBody))
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqBody))
 		if err != nil {
 			logger.Error("创建 HTTP 请求失败: %v", err)
 			return nil, fmt.Errorf("failed to create request: %w", err)
@@ -369,11 +372,12 @@ func (c *Client) SendChatRequest(ctx context.Context, accessToken, machineId, ac
 		// 发送请求（使用账号专用客户端，支持代理池）
 		resp, err := httpClient.Do(req)
 		duration := time.Since(startTime)
+		c.reportProxyResult(ctx, proxyBase, err)
 
 		if err != nil {
 			lastErr = err
 			logger.Error("Q HTTP 请求失败 - 尝试: %d/%d, 耗时: %v, 错误: %v, URL: %s, 调用ID: %s",
-				attempt, MaxRetries, duration, err, AmazonQEndpoint, invocationID)
+				attempt, MaxRetries, duration, err, endpoint, invocationID)
 
 			// 检查是否应该重试
 			if attempt < MaxRetries && isRetriableError(err) {
@@ -576,16 +580,17 @@ type EventInfo struct {
 }
 
 // GetUsageLimits 查询用户配额限制
+// region: 账号所在区域（为空时使用默认区域）
 // machineId: 设备标识，用于构建 User-Agent
 // @author ygw
-func (c *Client) GetUsageLimits(ctx context.Context, accessToken, machineId, resourceType string) (map[string]interface{}, error) {
+func (c *Client) GetUsageLimits(ctx context.Context, region, accessToken, machineId, resourceType string) (map[string]interface{}, error) {
 	startTime := time.Now()
 	
 	if resourceType == "" {
 		resourceType = "AGENTIC_REQUEST"
 	}
 
-	url := fmt.Sprintf("%sgetUsageLimits?isEmailRequired=true&origin=AI_EDITOR&resourceType=%s", AmazonQEndpoint, resourceType)
+	url := fmt.Sprintf("%sgetUsageLimits?isEmailRequired=true&origin=AI_EDITOR&resourceType=%s", auth.AmazonQEndpoint(region), resourceType)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -669,28 +674,54 @@ func (c *Client) GetUsageLimits(ctx context.Context, accessToken, machineId, res
 // @param pool 代理池实例
 // @author ygw
 func (c *Client) SetProxyPool(pool *proxypool.ProxyPool) {
+	if c.proxyPool != nil && c.proxyPool != pool {
+		c.proxyPool.OnRemoved(nil)
+		c.transports.clear()
+	}
 	c.proxyPool = pool
 	if pool != nil {
+		// 代理被删除、禁用或修改地址时释放对应的连接
+		pool.OnRemoved(func(urls []string) {
+			if n := c.transports.removeBases(urls); n > 0 {
+				logger.Info("代理池变更 - 已关闭 %d 个代理连接池", n)
+			}
+		})
 		logger.Info("代理池已设置 - 代理数量: %d, 启用数量: %d", pool.Count(), pool.EnabledCount())
 	}
 }
 
+// CloseIdleConnections 关闭默认客户端和全部代理客户端的空闲连接（客户端被替换时调用）
+// @author ygw
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+	c.transports.clear()
+}
+
 // GetHTTPClientForAccount 获取账号专用的 HTTP 客户端
-// 如果启用了代理池，会根据账号 ID 派生代理地址
+// 如果启用了代理池，会根据账号 ID 派生代理地址，同一派生地址复用缓存的客户端和连接
 // @param accountID 账号ID，用于 Session 派生
 // @return *http.Client 配置了代理的 HTTP 客户端
 // @author ygw
 func (c *Client) GetHTTPClientForAccount(accountID string) *http.Client {
+	client, _ := c.clientForAccount(accountID)
+	return client
+}
+
+// clientForAccount 获取账号专用的 HTTP 客户端，同时返回所用代理的原始地址（未使用代理池时为空）
+func (c *Client) clientForAccount(accountID string) (*http.Client, string) {
 	// 如果未启用代理池或代理池为空，返回默认客户端
 	if !c.cfg.ProxyPoolEnabled || c.proxyPool == nil {
-		return c.httpClient
+		return c.httpClient, ""
 	}
 
 	// 从代理池获取代理地址（已经过 Session 派生）
-	proxyURL := c.proxyPool.GetProxy(accountID)
+	baseURL, proxyURL := c.proxyPool.Select(accountID)
 	if proxyURL == "" {
 		// 代理池为空，回退到全局代理或无代理
-		return c.httpClient
+		return c.httpClient, ""
+	}
+	if client := c.transports.get(proxyURL); client != nil {
+		return client, baseURL
 	}
 
 	// 创建带代理的 Transport
@@ -698,7 +729,7 @@ func (c *Client) GetHTTPClientForAccount(accountID string) *http.Client {
 	parsedURL, err := url.Parse(proxyURL)
 	if err != nil {
 		logger.Error("代理 URL 解析失败: %v, 使用默认客户端", err)
-		return c.httpClient
+		return c.httpClient, ""
 	}
 
 	if parsedURL.Scheme == "socks5" {
@@ -706,7 +737,7 @@ func (c *Client) GetHTTPClientForAccount(accountID string) *http.Client {
 		dialer, err := proxy.FromURL(parsedURL, proxy.Direct)
 		if err != nil {
 			logger.Error("SOCKS5 代理配置失败: %v, 使用默认客户端", err)
-			return c.httpClient
+			return c.httpClient, ""
 		}
 		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
 			return dialer.Dial(network, addr)
@@ -716,10 +747,29 @@ func (c *Client) GetHTTPClientForAccount(accountID string) *http.Client {
 		transport.Proxy = http.ProxyURL(parsedURL)
 	}
 
-	logger.Debug("账号 %s 使用代理: %s", accountID, proxyURL)
+	logger.Debug("账号 %s 使用代理: %s（新建连接池）", accountID, proxyURL)
 
-	return &http.Client{
+	return c.transports.add(proxyURL, baseURL, &http.Client{
 		Transport: transport,
 		Timeout:   300 * time.Second,
+	}), baseURL
+}
+
+// reportProxyResult 将请求结果计入代理健康状态（被动检查）
+// 只统计网络层错误；客户端取消的请求不计入，上游返回的 HTTP 错误视为代理正常
+func (c *Client) reportProxyResult(ctx context.Context, base string, err error) {
+	pool := c.proxyPool
+	if base == "" || pool == nil {
+		return
+	}
+	if err == nil {
+		pool.ReportSuccess(base)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if pool.ReportFailure(base, err) {
+		logger.Warn("代理连续失败已暂时摘除: %s - %v", base, err)
 	}
 }
@@ -0,0 +1,129 @@
+package amazonq
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// DefaultTransportCacheSize 代理 Transport 缓存的最大条目数
+// 含 % 占位符的代理按账号派生出不同地址，每个派生地址占一个条目
+const DefaultTransportCacheSize = 256
+
+// transportEntry 缓存条目
+type transportEntry struct {
+	key    string       // 派生后的代理地址
+	base   string       // 代理池中的原始地址（可能包含 % 占位符）
+	client *http.Client // 使用该代理的 HTTP 客户端
+}
+
+// transportCache 按派生代理地址缓存 HTTP 客户端（LRU）
+// 同一代理的请求复用同一个 Transport，避免每次请求都重新建立到代理和上游的 TCP + TLS 连接
+// @author ygw
+type transportCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List               // 最近使用的在前
+	items map[string]*list.Element // key -> 条目
+}
+
+// newTransportCache 创建 Transport 缓存
+func newTransportCache(size int) *transportCache {
+	if size <= 0 {
+		size = DefaultTransportCacheSize
+	}
+	return &transportCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get 获取缓存的客户端，不存在时返回 nil
+func (c *transportCache) get(key string) *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*transportEntry).client
+	}
+	return nil
+}
+
+// add 缓存客户端并返回实际使用的客户端
+// 并发创建同一地址时以先缓存的为准，后来者关闭自己的连接；超出容量时淘汰最久未使用的条目
+func (c *transportCache) add(key, base string, client *http.Client) *http.Client {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		existing := el.Value.(*transportEntry).client
+		c.mu.Unlock()
+		client.CloseIdleConnections()
+		return existing
+	}
+
+	c.items[key] = c.order.PushFront(&transportEntry{key: key, base: base, client: client})
+	var evicted []*transportEntry
+	for c.order.Len() > c.size {
+		evicted = append(evicted, c.removeElement(c.order.Back()))
+	}
+	c.mu.Unlock()
+
+	closeEntries(evicted)
+	return client
+}
+
+// removeBases 移除原始地址属于 bases 的全部条目并关闭其空闲连接，返回移除数量
+func (c *transportCache) removeBases(bases []string) int {
+	match := make(map[string]bool, len(bases))
+	for _, b := range bases {
+		match[b] = true
+	}
+
+	c.mu.Lock()
+	var removed []*transportEntry
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if match[el.Value.(*transportEntry).base] {
+			removed = append(removed, c.removeElement(el))
+		}
+		el = next
+	}
+	c.mu.Unlock()
+
+	closeEntries(removed)
+	return len(removed)
+}
+
+// clear 移除全部条目并关闭空闲连接
+func (c *transportCache) clear() {
+	c.mu.Lock()
+	var removed []*transportEntry
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		removed = append(removed, c.removeElement(el))
+	}
+	c.mu.Unlock()
+
+	closeEntries(removed)
+}
+
+// len 返回缓存条目数
+func (c *transportCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// removeElement 从链表和索引中删除条目（调用方持有锁）
+func (c *transportCache) removeElement(el *list.Element) *transportEntry {
+	entry := c.order.Remove(el).(*transportEntry)
+	delete(c.items, entry.key)
+	return entry
+}
+
+// closeEntries 关闭条目的空闲连接（进行中的请求不受影响，其连接在空闲超时后关闭）
+func closeEntries(entries []*transportEntry) {
+	for _, e := range entries {
+		e.client.CloseIdleConnections()
+	}
+}
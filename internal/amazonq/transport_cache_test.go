@@ -0,0 +1,130 @@
+package amazonq
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"claude-api/internal/config"
+	"claude-api/internal/models"
+	proxypool "claude-api/internal/proxy"
+)
+
+// newCountingProxy 启动一个 HTTP 正向代理（直接应答），统计新建的 TCP 连接数
+func newCountingProxy(tb testing.TB) (*httptest.Server, *int64) {
+	tb.Helper()
+	var conns int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.Start()
+	tb.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+// newPooledClient 创建启用代理池的客户端
+func newPooledClient(proxyURLs ...string) (*Client, *proxypool.ProxyPool) {
+	cfg := config.Load()
+	cfg.ProxyPoolEnabled = true
+	client := NewClient(cfg)
+	pool := proxypool.NewProxyPool("round_robin")
+	var proxies []*models.Proxy
+	for i, u := range proxyURLs {
+		proxies = append(proxies, &models.Proxy{ID: int64(i + 1), URL: u, Enabled: true, Weight: 1})
+	}
+	pool.Reload(proxies)
+	client.SetProxyPool(pool)
+	return client, pool
+}
+
+// doGet 通过客户端请求目标地址并读完响应体
+func doGet(tb testing.TB, client *http.Client) {
+	resp, err := client.Get("http://upstream.invalid/")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// TestTransportCache 测试代理连接复用、LRU 淘汰和代理移除时释放缓存
+func TestTransportCache(t *testing.T) {
+	proxySrv, conns := newCountingProxy(t)
+	client, pool := newPooledClient(proxySrv.URL)
+
+	for i := 0; i < 20; i++ {
+		doGet(t, client.GetHTTPClientForAccount("acc-1"))
+	}
+	if n := atomic.LoadInt64(conns); n != 1 {
+		t.Errorf("同一代理的顺序请求应复用 1 个连接，实际新建 %d 个", n)
+	}
+
+	// 代理地址被修改后，旧地址的客户端应被移除
+	pool.Reload([]*models.Proxy{{ID: 1, URL: proxySrv.URL + "/", Enabled: true, Weight: 1}})
+	if n := client.transports.len(); n != 0 {
+		t.Errorf("代理变更后缓存应清空，实际 %d 个条目", n)
+	}
+
+	// LRU：容量 2，访问 a 后插入 c，应淘汰 b
+	cache := newTransportCache(2)
+	a, b, c := &http.Client{}, &http.Client{}, &http.Client{}
+	cache.add("a", "p", a)
+	cache.add("b", "p", b)
+	cache.get("a")
+	cache.add("c", "p", c)
+	if cache.get("b") != nil || cache.get("a") != a || cache.get("c") != c {
+		t.Error("LRU 应淘汰最久未使用的条目")
+	}
+	if got := cache.add("a", "p", &http.Client{}); got != a {
+		t.Error("重复添加应返回已缓存的客户端")
+	}
+	if n := cache.removeBases([]string{"p"}); n != 2 || cache.len() != 0 {
+		t.Errorf("按原始地址移除错误: %d", n)
+	}
+}
+
+// BenchmarkProxyClient 对比缓存 Transport 与每次请求新建 Transport 的连接数
+// 以 per-account 派生代理地址（% 占位符）模拟 8 个账号轮流请求
+func BenchmarkProxyClient(b *testing.B) {
+	accounts := make([]string, 8)
+	for i := range accounts {
+		accounts[i] = fmt.Sprintf("acc-%d", i)
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		proxySrv, conns := newCountingProxy(b)
+		client, _ := newPooledClient("http://user-%@" + proxySrv.Listener.Addr().String())
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			doGet(b, client.GetHTTPClientForAccount(accounts[i%len(accounts)]))
+		}
+		b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		proxySrv, conns := newCountingProxy(b)
+		client, pool := newPooledClient("http://user-%@" + proxySrv.Listener.Addr().String())
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// 旧实现：每次请求克隆 Transport 并新建客户端
+			proxyURL, _ := url.Parse(pool.GetProxy(accounts[i%len(accounts)]))
+			transport := client.baseTransport.Clone()
+			transport.Proxy = http.ProxyURL(proxyURL)
+			hc := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+			doGet(b, hc)
+			hc.CloseIdleConnections()
+		}
+		b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+	})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-api/internal/admission"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestPriority 请求优先级头，值为 batch 时按批处理任务排队（只能降级，不能提升）
+const HeaderRequestPriority = "X-Request-Priority"
+
+// statusOverloaded 服务过载状态码（与 Anthropic API 一致）
+const statusOverloaded = 529
+
+// initAdmission 初始化准入队列
+// 容量条件为并发未满且账号池中有可选账号；配置了每账号并发时，还需有空闲的并发槽位（可选账号数 × 每账号并发）
+// @author ygw
+func (s *Server) initAdmission() {
+	cfg := s.cfg.Admission
+	maxQueue := cfg.MaxQueue
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	s.admission = admission.New(admission.Config{
+		MaxConcurrent: cfg.MaxConcurrent,
+		MaxQueue:      maxQueue,
+		MaxWait:       time.Duration(cfg.MaxWaitSeconds) * time.Second,
+	}, func(inFlight int) bool {
+		accounts := s.accountPool.SelectableCount()
+		if accounts == 0 {
+			return false
+		}
+		return cfg.MaxPerAccount <= 0 || inFlight < accounts*cfg.MaxPerAccount
+	})
+}
+
+// requestPriority 确定请求优先级：VIP 用户优先，X-Request-Priority: batch 的请求最后
+func requestPriority(c *gin.Context) admission.Priority {
+	if strings.EqualFold(c.GetHeader(HeaderRequestPriority), "batch") {
+		return admission.PriorityBatch
+	}
+	if v, ok := c.Get("user"); ok {
+		if u, ok := v.(*models.User); ok && u != nil && u.IsVip {
+			return admission.PriorityVIP
+		}
+	}
+	return admission.PriorityNormal
+}
+
+// admitRequest 获取处理容量，容量不足时按优先级排队等待
+// 队列已满或等待超时返回 529 overloaded_error；超时且始终无可用账号时保持原有的 503
+// 返回 false 表示请求已被拒绝，成功时调用方需在请求结束后调用 release
+// @author ygw
+func (s *Server) admitRequest(c *gin.Context) (release func(), ok bool) {
+	if consoleMode, exists := c.Get("console_mode"); exists && consoleMode == true {
+		return func() {}, true
+	}
+
+	priority := requestPriority(c)
+	release, waited, err := s.admission.Acquire(c.Request.Context(), priority)
+	if err == nil {
+		if waited > 0 {
+			logger.Ctx(c.Request.Context()).Info("[准入队列] 排队 %v 后放行 - 优先级: %s, 来源: %s", waited.Round(time.Millisecond), priority, c.ClientIP())
+		}
+		return release, true
+	}
+
+	switch {
+	case errors.Is(err, admission.ErrQueueFull):
+		logger.Ctx(c.Request.Context()).Warn("[准入队列] 队列已满 - 优先级: %s, 来源: %s", priority, c.ClientIP())
+		abortOverloaded(c, "服务繁忙，排队人数已满，请稍后重试")
+	case errors.Is(err, admission.ErrWaitTimeout) && s.accountPool.SelectableCount() == 0:
+		logger.Ctx(c.Request.Context()).Warn("[准入队列] 等待 %v 后仍无可用账号 - 来源: %s", waited.Round(time.Millisecond), c.ClientIP())
+		c.Set("error_message", "无可用账号，请先添加并配置账号")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "无可用账号，请先添加并配置账号"})
+	case errors.Is(err, admission.ErrWaitTimeout):
+		logger.Ctx(c.Request.Context()).Warn("[准入队列] 等待超时 %v - 优先级: %s, 来源: %s", waited.Round(time.Millisecond), priority, c.ClientIP())
+		abortOverloaded(c, "服务繁忙，排队等待超时，请稍后重试")
+	default:
+		// 客户端在排队期间断开
+		c.Set("error_message", "客户端在排队期间断开")
+		c.Abort()
+	}
+	return nil, false
+}
+
+// abortOverloaded 返回 529 overloaded_error，按接口格式返回错误体
+func abortOverloaded(c *gin.Context, message string) {
+	c.Header("retry-after", strconv.Itoa(1))
+	c.Set("error_message", message)
+	if isOpenAIPath(c) {
+		c.AbortWithStatusJSON(statusOverloaded, gin.H{"error": gin.H{
+			"message": message,
+			"type":    "overloaded_error",
+			"code":    "overloaded",
+		}})
+		return
+	}
+	c.AbortWithStatusJSON(statusOverloaded, gin.H{"type": "error", "error": gin.H{
+		"type":    "overloaded_error",
+		"message": message,
+	}})
+}
+
+// handleGetQueueStats 获取准入队列状态（处理中、排队深度及按优先级分布）
+// @author ygw
+func (s *Server) handleGetQueueStats(c *gin.Context) {
+	c.JSON(200, s.admission.Stats())
+}
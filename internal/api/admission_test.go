@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"claude-api/internal/admission"
+	"claude-api/internal/config"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAdmitRequest_Overloaded 测试队列满返回 529、超时无账号返回 503 以及优先级判定
+func TestAdmitRequest_Overloaded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{
+		cfg:         &config.Config{Admission: config.AdmissionConfig{MaxConcurrent: 1, MaxQueue: -1, MaxWaitSeconds: 1}},
+		accountPool: &AccountPool{accounts: []*models.Account{{ID: "acc-1", Enabled: true}}},
+	}
+	s.initAdmission()
+	defer s.admission.Stop()
+
+	c, _ := newTPMTestContext("/v1/messages", &models.User{ID: "u1", IsVip: true})
+	if p := requestPriority(c); p != admission.PriorityVIP {
+		t.Errorf("VIP 用户应为 vip 优先级，实际 %s", p)
+	}
+	c.Request.Header.Set(HeaderRequestPriority, "batch")
+	if p := requestPriority(c); p != admission.PriorityBatch {
+		t.Errorf("batch 请求头应降级为 batch，实际 %s", p)
+	}
+
+	release, ok := s.admitRequest(c)
+	if !ok {
+		t.Fatal("有容量时应放行")
+	}
+	defer release()
+
+	// 并发已满且不排队：Claude 格式 529
+	c, w := newTPMTestContext("/v1/messages", nil)
+	if _, ok := s.admitRequest(c); ok || w.Code != statusOverloaded {
+		t.Fatalf("容量已满应返回 529，实际 %d", w.Code)
+	}
+	var claudeBody struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &claudeBody); err != nil || claudeBody.Error.Type != "overloaded_error" {
+		t.Errorf("应返回 overloaded_error: %s", w.Body.String())
+	}
+	if w.Header().Get("retry-after") == "" {
+		t.Error("应设置 retry-after")
+	}
+
+	// OpenAI 格式
+	c, w = newTPMTestContext("/v1/chat/completions", nil)
+	s.admitRequest(c)
+	var openAIBody struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &openAIBody); err != nil || openAIBody.Error.Type != "overloaded_error" || openAIBody.Error.Code != "overloaded" {
+		t.Errorf("OpenAI 格式错误体不正确: %s", w.Body.String())
+	}
+
+	// 排队等待超时且无可用账号：保持 503
+	s2 := &Server{
+		cfg:         &config.Config{Admission: config.AdmissionConfig{MaxQueue: 10, MaxWaitSeconds: 1}},
+		accountPool: &AccountPool{},
+	}
+	s2.initAdmission()
+	defer s2.admission.Stop()
+	start := time.Now()
+	c, w = newTPMTestContext("/v1/messages", nil)
+	if _, ok := s2.admitRequest(c); ok || w.Code != 503 {
+		t.Errorf("无可用账号超时应返回 503，实际 %d", w.Code)
+	}
+	if time.Since(start) < time.Second {
+		t.Error("应排队等待到超时")
+	}
+}
+
+// TestAdmitRequest_AccountSlots 测试未配置总并发时，可用账号的并发占满后请求进入队列
+func TestAdmitRequest_AccountSlots(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{
+		cfg:         &config.Config{Admission: config.AdmissionConfig{MaxPerAccount: 2, MaxQueue: -1, MaxWaitSeconds: 1}},
+		accountPool: &AccountPool{accounts: []*models.Account{{ID: "acc-1", Enabled: true}}},
+	}
+	s.initAdmission()
+	defer s.admission.Stop()
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		c, _ := newTPMTestContext("/v1/messages", nil)
+		release, ok := s.admitRequest(c)
+		if !ok {
+			t.Fatalf("账号仍有空闲并发时应放行（第 %d 个请求）", i+1)
+		}
+		releases = append(releases, release)
+	}
+
+	c, w := newTPMTestContext("/v1/messages", nil)
+	if _, ok := s.admitRequest(c); ok || w.Code != statusOverloaded {
+		t.Fatalf("账号并发占满后应进入队列（不排队时返回 529），实际 %d", w.Code)
+	}
+
+	releases[0]()
+	c, _ = newTPMTestContext("/v1/messages", nil)
+	release, ok := s.admitRequest(c)
+	if !ok {
+		t.Fatal("释放并发后应放行")
+	}
+	release()
+	releases[1]()
+}
+
+// TestAccountPool_SelectableCount 测试准入容量只统计可被选中的账号
+func TestAccountPool_SelectableCount(t *testing.T) {
+	accounts := []*models.Account{{ID: "acc-1", Enabled: true}, {ID: "acc-2", Enabled: true}, {ID: "acc-3"}}
+	pool := &AccountPool{accounts: accounts}
+	pool.cfg.selectionMode = models.AccountSelectionRoundRobin
+	if n := pool.SelectableCount(); n != 2 {
+		t.Errorf("轮询模式应统计已启用账号，期望 2，实际 %d", n)
+	}
+	pool.cfg.selectionMode = models.AccountSelectionSequential
+	if n := pool.SelectableCount(); n != 1 {
+		t.Errorf("顺序模式只会选中首个账号，期望 1，实际 %d", n)
+	}
+	pool.accounts = []*models.Account{{ID: "acc-3"}}
+	if n := pool.SelectableCount(); n != 0 {
+		t.Errorf("全部禁用时应为 0，实际 %d", n)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"math/rand"
+	"claude-api/internal/coord"
 	"claude-api/internal/database"
 	"claude-api/internal/logger"
 	"claude-api/internal/models"
@@ -24,8 +25,14 @@ type AccountPool struct {
 	cfg             accountPoolConfig // 配置
 	refreshing      atomic.Bool       // 是否正在刷新
 	roundRobinIndex uint32            // 轮询索引（用于 round_robin 模式）
+	shared          coord.Backend     // 多实例共享轮询索引（nil 表示使用本地索引）
+	rrMu            sync.Mutex        // 保护共享轮询索引的本地批次
+	rrNext, rrEnd   int64             // 本地批次中下一个可用索引和批次上界（不含）
 }
 
+// roundRobinBatch 每次从共享计数器预占的轮询索引数量（避免每个请求一次远程往返）
+const roundRobinBatch = 16
+
 // accountPoolConfig 账号池配置
 type accountPoolConfig struct {
 	lazyEnabled   bool   // 是否启用懒加载模式
@@ -150,6 +157,40 @@ func (p *AccountPool) GetAccount() *models.Account {
 	return p.selectAccount(accounts, mode)
 }
 
+// SetShared 设置多实例协调后端（round_robin 模式下各实例按批次共用轮询索引）
+// @author ygw
+func (p *AccountPool) SetShared(backend coord.Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shared = backend
+}
+
+// nextRoundRobinIndex 获取下一个轮询索引（共享索引不可用时回退到本地索引）
+// 共享模式下每次从协调后端预占 roundRobinBatch 个连续索引，用完再取下一批
+func (p *AccountPool) nextRoundRobinIndex() uint32 {
+	p.mu.RLock()
+	shared := p.shared
+	p.mu.RUnlock()
+	if shared != nil {
+		p.rrMu.Lock()
+		defer p.rrMu.Unlock()
+		if p.rrNext >= p.rrEnd {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			n, err := shared.IncrBy(ctx, "account_pool:round_robin", roundRobinBatch, 0)
+			cancel()
+			if err != nil {
+				logger.Warn("共享轮询索引不可用，回退到本地索引: %v", err)
+				return atomic.AddUint32(&p.roundRobinIndex, 1) - 1
+			}
+			p.rrNext, p.rrEnd = n-roundRobinBatch, n
+		}
+		idx := p.rrNext
+		p.rrNext++
+		return uint32(idx)
+	}
+	return atomic.AddUint32(&p.roundRobinIndex, 1) - 1
+}
+
 // selectAccount 根据选择模式选择账号
 func (p *AccountPool) selectAccount(accounts []*models.Account, mode string) *models.Account {
 	if len(accounts) == 0 {
@@ -167,7 +208,7 @@ func (p *AccountPool) selectAccount(accounts []*models.Account, mode string) *mo
 
 	case models.AccountSelectionRoundRobin:
 		// 轮询选择
-		idx := atomic.AddUint32(&p.roundRobinIndex, 1) - 1
+		idx := p.nextRoundRobinIndex()
 		return accounts[idx%uint32(len(accounts))]
 
 	default: // sequential 或其他
@@ -386,6 +427,27 @@ func (p *AccountPool) Count() int {
 	return len(p.accounts)
 }
 
+// SelectableCount 返回可被选中的账号数量（已启用；顺序选择模式下请求只会分配到首个账号）
+// @author ygw
+func (p *AccountPool) SelectableCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n := 0
+	for _, acc := range p.accounts {
+		if acc.Enabled {
+			n++
+		}
+	}
+	switch p.cfg.selectionMode {
+	case models.AccountSelectionRandom, models.AccountSelectionWeightedRandom, models.AccountSelectionRoundRobin:
+		return n
+	}
+	if n > 0 {
+		return 1
+	}
+	return 0
+}
+
 // GetAll 获取所有缓存的账号（用于兼容需要完整列表的场景）
 func (p *AccountPool) GetAll() []*models.Account {
 	p.mu.RLock()
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"claude-api/internal/capture"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestFinishCapture_ServerID 测试采集 ID 由服务端生成，并通过 log_id 关联请求日志
+func TestFinishCapture_ServerID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{dbWriteChan: make(chan dbWriteOp, 2)}
+	for _, logID := range []string{"log-1", "log-2"} {
+		c, _ := newTPMTestContext("/v1/messages", nil)
+		c.Set("request_id", "fixed-id") // 客户端重复传入的 x-request-id 不影响采集主键
+		c.Set("log_id", logID)
+		rec := capture.NewRecorder(capture.NewRedactor(nil, true), "sampled")
+		rec.SetInbound([]byte(`{"model":"claude-sonnet-4"}`))
+		c.Set("capture", rec)
+		s.finishCapture(c)
+	}
+
+	first := (<-s.dbWriteChan).data.(*models.PayloadCapture)
+	second := (<-s.dbWriteChan).data.(*models.PayloadCapture)
+	if first.LogID != "log-1" || second.LogID != "log-2" {
+		t.Errorf("采集应关联请求日志 ID: %s, %s", first.LogID, second.LogID)
+	}
+	if first.ID == "" || first.ID == second.ID || first.ID == "fixed-id" || first.ID == first.LogID {
+		t.Errorf("采集 ID 应由服务端单独生成: %s, %s", first.ID, second.ID)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-api/internal/compressor"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestResolveCompressionStrategies 测试压缩策略链的优先级
+func TestResolveCompressionStrategies(t *testing.T) {
+	settings := &models.Settings{
+		CompressionStrategies: []string{compressor.StrategyToolResults, compressor.StrategySummarize},
+		CompressionModelStrategies: map[string][]string{
+			"sonnet":       {compressor.StrategyImages},
+			"sonnet-4.5":   {compressor.StrategySlidingWindow},
+			"haiku-custom": {},
+		},
+	}
+	tests := []struct {
+		name  string
+		user  *models.User
+		model string
+		want  string
+	}{
+		{"用户设置优先", &models.User{CompressionStrategies: "dedup_reads"}, "claude-sonnet-4.5", "dedup_reads"},
+		{"最长模型匹配", nil, "claude-Sonnet-4.5", "sliding_window"},
+		{"模型匹配", nil, "claude-sonnet-4", "images"},
+		{"全局设置", &models.User{}, "claude-opus-4.5", "tool_results,summarize"},
+		{"空模型链回退全局", nil, "claude-haiku-custom", "tool_results,summarize"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(resolveCompressionStrategies(tt.user, tt.model, settings), ","); got != tt.want {
+			t.Errorf("%s: 期望 %s，实际 %s", tt.name, tt.want, got)
+		}
+	}
+
+	if got := resolveCompressionStrategies(nil, "any", &models.Settings{}); strings.Join(got, ",") != compressor.StrategySummarize {
+		t.Errorf("未配置时应使用默认策略，实际 %v", got)
+	}
+}
+
+// TestCompressionHeaders 测试压缩结果响应头与跳过压缩请求头
+func TestCompressionHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	report := &compressor.Report{TokensBefore: 200000, TokensAfter: 40000, SummaryBlocks: 2, CacheHit: true,
+		Steps: []compressor.StepReport{{Strategy: "tool_results"}, {Strategy: "summarize", Applied: true}}}
+	setCompressionHeaders(c, true, report)
+
+	want := map[string]string{
+		HeaderCompressionApplied:        "true",
+		HeaderCompressionOriginalTokens: "200000",
+		HeaderCompressionTokens:         "40000",
+		HeaderCompressionSummaryBlocks:  "2",
+		HeaderCompressionCacheHit:       "true",
+		HeaderCompressionStrategies:     "summarize",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s: 期望 %s，实际 %s", k, v, got)
+		}
+	}
+	if v, ok := c.Get("compression"); !ok || v != report {
+		t.Error("压缩结果应写入上下文供请求日志使用")
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	c.Request.Header.Set(HeaderSkipCompression, "true")
+	s := &Server{compressor: compressor.New(&compressor.CompressConfig{TokenThreshold: 1})}
+	out, err := s.compressClaudeRequest(c, &models.ClaudeRequest{}, &models.Settings{CompressionEnabled: true})
+	if out != nil || err != nil || w.Header().Get(HeaderCompressionApplied) != "bypassed" {
+		t.Errorf("带 %s 头时应跳过压缩", HeaderSkipCompression)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"claude-api/internal/coord"
+	"claude-api/internal/logger"
+)
+
+// 令牌刷新分布式锁参数
+const (
+	refreshLockTTL  = 2 * time.Minute  // 锁过期时间（持有者异常退出后自动释放）
+	refreshLockWait = 30 * time.Second // 等待其他实例刷新完成的最长时间
+)
+
+// initCoordination 按配置初始化多实例协调后端（默认内存模式，不创建后端）
+// 启用后共享：API Key / IP 限流计数、token 限流计数、round_robin 轮询索引、令牌刷新锁、在线 IP 统计
+// @author ygw
+func (s *Server) initCoordination() {
+	switch s.cfg.Coordination.Backend {
+	case "", coord.BackendMemory:
+		return
+	case coord.BackendDatabase:
+		s.coord = coord.NewDBBackend(s.db.GetGormDB())
+	case coord.BackendRedis:
+		if s.redis == nil {
+			logger.Warn("协调后端配置为 redis 但未配置 redis.url，使用单实例内存模式")
+			return
+		}
+		s.coord = coord.NewRedisBackend(s.redis, s.cfg.Redis.KeyPrefix)
+	default:
+		logger.Warn("未知的协调后端 %q，使用单实例内存模式", s.cfg.Coordination.Backend)
+		return
+	}
+
+	s.rateLimiter.SetShared(
+		coord.NewWindow(s.coord, "ratelimit:ip:", time.Minute),
+		coord.NewWindow(s.coord, "ratelimit:apikey:", time.Minute),
+	)
+	s.tokenLimiter.SetShared(coord.NewWindow(s.coord, "ratelimit:tpm:", time.Minute))
+	s.accountPool.SetShared(s.coord)
+	s.onlineTracker.shared = s.coord
+	logger.Info("多实例协调后端已启用: %s", s.coord.Name())
+}
+
+// withRefreshLock 在分布式锁内刷新账号令牌，避免多个实例同时刷新同一账号
+// 锁被其他实例持有时等待其完成；若期间对方已成功刷新则直接复用结果
+// @author ygw
+func (s *Server) withRefreshLock(ctx context.Context, accountID string, refresh func() error) error {
+	if s.coord == nil {
+		return refresh()
+	}
+
+	before := s.lastRefreshTime(ctx, accountID)
+	release, waited, err := coord.Lock(ctx, s.coord, "refresh:"+accountID, refreshLockTTL, refreshLockWait)
+	if errors.Is(err, coord.ErrLockTimeout) {
+		logger.Warn("等待其他实例刷新账号 %s 超时", accountID)
+		return err
+	}
+	if err != nil {
+		// 协调后端不可用时不阻塞刷新
+		logger.Warn("获取令牌刷新锁失败，直接刷新 - 账号: %s, 错误: %v", accountID, err)
+		return refresh()
+	}
+	defer release()
+
+	if waited {
+		acc, err := s.db.GetAccount(ctx, accountID)
+		if err == nil && acc != nil && acc.LastRefreshTime != nil && *acc.LastRefreshTime != before &&
+			acc.LastRefreshStatus != nil && *acc.LastRefreshStatus == "success" {
+			logger.Debug("账号 %s 已由其他实例刷新，跳过", accountID)
+			return nil
+		}
+	}
+	return refresh()
+}
+
+// lastRefreshTime 读取账号最近一次刷新时间（用于判断等待期间是否已被其他实例刷新）
+func (s *Server) lastRefreshTime(ctx context.Context, accountID string) string {
+	acc, err := s.db.GetAccount(ctx, accountID)
+	if err != nil || acc == nil || acc.LastRefreshTime == nil {
+		return ""
+	}
+	return *acc.LastRefreshTime
+}
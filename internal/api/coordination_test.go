@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/config"
+	"claude-api/internal/coord"
+	"claude-api/internal/database"
+	"claude-api/internal/models"
+	"claude-api/internal/redis/redistest"
+)
+
+// TestCoordination_SharedRoundRobinAndOnline 测试两个实例共用轮询索引和在线 IP 统计
+func TestCoordination_SharedRoundRobinAndOnline(t *testing.T) {
+	srv := redistest.NewServer(t, "")
+	backend := coord.NewRedisBackend(srv.Client(t), "test:")
+
+	accounts := []*models.Account{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	newPool := func() *AccountPool {
+		p := NewAccountPool(nil, time.Minute)
+		p.accounts = accounts
+		p.SetConfig(false, 0, "", false, models.AccountSelectionRoundRobin)
+		p.SetShared(backend)
+		return p
+	}
+	p1, p2 := newPool(), newPool()
+
+	// 两个实例交替取号，各自按批次预占共享索引，合计应均匀轮转而不是各自从头开始
+	counts := make(map[string]int)
+	for i := 0; i < 2*roundRobinBatch; i++ {
+		p := p1
+		if i%2 == 1 {
+			p = p2
+		}
+		counts[p.GetAccount().ID]++
+	}
+	for _, acc := range accounts {
+		if n := counts[acc.ID]; n < 2*roundRobinBatch/len(accounts) || n > 2*roundRobinBatch/len(accounts)+1 {
+			t.Errorf("共享轮询应均匀分配，账号 %s 被选中 %d 次: %v", acc.ID, n, counts)
+		}
+	}
+	if n, err := backend.Get(t.Context(), "account_pool:round_robin"); err != nil || n != 2*roundRobinBatch {
+		t.Errorf("两个实例各预占一批索引，共享计数应为 %d，实际 %d (%v)", 2*roundRobinBatch, n, err)
+	}
+
+	o1 := &OnlineTracker{shared: backend}
+	o2 := &OnlineTracker{shared: backend}
+	o1.RecordIP("1.1.1.1")
+	o2.RecordIP("2.2.2.2")
+	o2.RecordIP("1.1.1.1")
+	deadline := time.Now().Add(2 * time.Second)
+	for o1.GetOnlineCount() != 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond) // 共享写入是异步的
+	}
+	if n := o1.GetOnlineCount(); n != 2 {
+		t.Errorf("两个实例合计应有 2 个在线 IP，实际 %d", n)
+	}
+}
+
+// TestCoordination_ScheduledTokenRefresh 测试多实例为同一账号排期时，令牌只由先到期的实例刷新，其他实例读取新的过期时间后重新排期
+func TestCoordination_ScheduledTokenRefresh(t *testing.T) {
+	cfg := &config.Config{Database: config.DatabaseConfig{Type: config.DatabaseTypeSQLite, SQLite: config.SQLiteConfig{Path: ":memory:"}}}
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	var refreshes int32
+	oidc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accessToken":"at-new","refreshToken":"rt-new","expiresIn":3600}`))
+	}))
+	defer oidc.Close()
+	upstream := config.DefaultUpstream()
+	upstream.OIDCURL = oidc.URL
+	auth.SetUpstream(upstream)
+	defer auth.SetUpstream(config.DefaultUpstream())
+
+	expiresSoon := time.Now().Add(2 * time.Minute).Unix()
+	acc := &models.Account{
+		ID:           "acc-1",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AccessToken:  strPtr("at-old"),
+		RefreshToken: strPtr("rt-old"),
+		TokenExpiry:  &expiresSoon,
+		Enabled:      true,
+		CreatedAt:    models.CurrentTime(),
+		UpdatedAt:    models.CurrentTime(),
+	}
+	if err := db.CreateAccount(ctx, acc); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := coord.NewRedisBackend(redistest.NewServer(t, "").Client(t), "test:")
+	newInstance := func() *Server {
+		s := &Server{cfg: cfg, db: db, coord: backend, oidcClient: auth.NewOIDCClient(cfg), tokenRefresher: NewTokenRefresher()}
+		s.initTokenScheduler()
+		return s
+	}
+	s1, s2 := newInstance(), newInstance()
+
+	first, err := s1.refreshScheduledToken(ctx, acc.ID)
+	if err != nil || atomic.LoadInt32(&refreshes) != 1 {
+		t.Fatalf("到期的令牌应被刷新: 刷新 %d 次 (%v)", refreshes, err)
+	}
+	if time.Until(first) < 50*time.Minute {
+		t.Errorf("应按刷新响应的 expiresIn 排期: %v", first)
+	}
+	stored, err := db.GetAccount(ctx, acc.ID)
+	if err != nil || stored.TokenExpiry == nil || *stored.TokenExpiry != first.Unix() {
+		t.Fatalf("刷新后应写入 token_expiry: %+v (%v)", stored, err)
+	}
+
+	second, err := s2.refreshScheduledToken(ctx, acc.ID)
+	if err != nil || atomic.LoadInt32(&refreshes) != 1 {
+		t.Errorf("其他实例已刷新时不应再次刷新: 刷新 %d 次 (%v)", refreshes, err)
+	}
+	if !second.Equal(first) {
+		t.Errorf("应按已存储的过期时间重新排期: %v != %v", second, first)
+	}
+}
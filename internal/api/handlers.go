@@ -12,13 +12,16 @@ import (
 	"claude-api/internal/amazonq"
 	"claude-api/internal/auth"
 	"claude-api/internal/claude"
+	"claude-api/internal/compressor"
 	"claude-api/internal/database"
 	"claude-api/internal/logger"
 	"claude-api/internal/models"
 	proxypool "claude-api/internal/proxy"
 	"claude-api/internal/stream"
 	"claude-api/internal/sync"
+	"claude-api/internal/thinking"
 	"claude-api/internal/tokenizer"
+	"claude-api/internal/tracing"
 	"strconv"
 	"strings"
 	"time"
@@ -68,7 +71,7 @@ func (s *Server) checkAccountSuspendedFromAPI(ctx context.Context, accountID str
 
 	// 尝试获取账号配额来判断是否被封控
 	machineId := s.ensureAccountMachineID(ctx, acc)
-	_, err = s.aqClient.GetUsageLimits(ctx, *acc.AccessToken, machineId, "AGENTIC_REQUEST")
+	_, err = s.aqClient.GetUsageLimits(ctx, auth.RegionOf(acc.Region), *acc.AccessToken, machineId, "AGENTIC_REQUEST")
 	if err != nil {
 		// 如果是 suspended 错误，返回 true
 		if amazonq.IsSuspendedError(err) {
@@ -78,15 +81,13 @@ func (s *Server) checkAccountSuspendedFromAPI(ctx context.Context, accountID str
 	return false
 }
 
-// countValidAccounts 统计有效（未封控）账号数量
+// countValidAccounts 统计有效（状态正常）账号数量
 // @author ygw
 func (s *Server) countValidAccounts(ctx context.Context) (int, error) {
-	accounts, err := s.db.ListAccounts(ctx, nil, "created_at", false)
+	accounts, err := s.db.ListAccountsByStatus(ctx, models.AccountStatusNormal, "created_at", false)
 	if err != nil {
 		return 0, err
 	}
-
-	// 直接返回账号总数
 	return len(accounts), nil
 }
 
@@ -134,6 +135,8 @@ func (s *Server) handleCreateAccount(c *gin.Context) {
 		Enabled      *bool   `json:"enabled"`
 		ErrorCount   *int    `json:"errorCount"`
 		SuccessCount *int    `json:"successCount"`
+		Region       *string `json:"region"`
+		StartURL     *string `json:"startUrl"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -147,6 +150,10 @@ func (s *Server) handleCreateAccount(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "clientId 和 clientSecret 是必需的"})
 		return
 	}
+	if req.Region != nil && !auth.ValidRegion(*req.Region) {
+		c.JSON(400, gin.H{"error": "无效的区域: " + *req.Region})
+		return
+	}
 
 	// 检查账号数量限制
 	maxAccounts := s.cfg.GetMaxAccounts()
@@ -194,6 +201,8 @@ func (s *Server) handleCreateAccount(c *gin.Context) {
 		Enabled:           enabled,
 		ErrorCount:        errorCount,
 		SuccessCount:      successCount,
+		Region:            strPtr(auth.RegionOf(req.Region)),
+		StartURL:          req.StartURL,
 	}
 
 	logger.Info("正在创建账号 - ID: %s, 标签: %v, 启用: %v", account.ID, account.Label, enabled)
@@ -355,7 +364,13 @@ func (s *Server) handleListAccounts(c *gin.Context) {
 
 	// 只返回展示所需的基本信息，不返回敏感数据
 	simplifiedAccounts := make([]map[string]interface{}, len(accounts))
+	pool := s.proxyPool
 	for i, acc := range accounts {
+		// 账号固定使用的代理（显式绑定或粘性策略），0 表示按请求轮换
+		var assignedProxyID int64
+		if pool != nil {
+			assignedProxyID = pool.Assigned(acc.ID)
+		}
 		simplifiedAccounts[i] = map[string]interface{}{
 			"id":                  acc.ID,
 			"label":               acc.Label,
@@ -375,7 +390,11 @@ func (s *Server) handleListAccounts(c *gin.Context) {
 			"usage_limit":        acc.UsageLimit,
 			"subscription_type":  acc.SubscriptionType,
 			"quota_refreshed_at": acc.QuotaRefreshedAt,
-			"token_expiry":       acc.TokenExpiry, // 有效时间 @author ygw
+			"token_expiry":       acc.TokenExpiry, // 访问令牌过期时间 @author ygw
+			"trial_expiry":       acc.TrialExpiry, // 试用到期时间
+			// 代理绑定
+			"proxy_id":          acc.ProxyID,
+			"assigned_proxy_id": assignedProxyID,
 		}
 	}
 
@@ -583,7 +602,8 @@ func (s *Server) handleDirectImportAccounts(c *gin.Context) {
 			SuccessCount:      0,
 			Email:             acc.Email,
 			AuthMethod:        &authMethod,
-			Region:            strPtr("us-east-1"),
+			Region:            strPtr(auth.RegionOf(acc.Region)),
+			StartURL:          acc.StartURL,
 			Password:          acc.Password,
 			Username:          acc.Username,
 		}
@@ -803,7 +823,7 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 
 	// 解析请求体 - 支持两种格式:
 	// 1. 社交登录: [{"refreshToken": "xxx"}]
-	// 2. IdC 格式: [{"clientId":"xxx","clientSecret":"xxx","refreshToken":"xxx","accessToken":"xxx","email":"xxx","machineId":"xxx"}]
+	// 2. IdC 格式: [{"clientId":"xxx","clientSecret":"xxx","refreshToken":"xxx","accessToken":"xxx","email":"xxx","machineId":"xxx","region":"eu-central-1","startUrl":"xxx"}]
 	// 只保留数据库中存在的字段，其他字段自动丢弃
 	var importData []struct {
 		ClientID     string `json:"clientId"`
@@ -812,6 +832,8 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 		AccessToken  string `json:"accessToken"`
 		Email        string `json:"email"`
 		MachineID    string `json:"machineId"`
+		Region       string `json:"region"`
+		StartURL     string `json:"startUrl"`
 	}
 
 	if err := c.ShouldBindJSON(&importData); err != nil {
@@ -887,6 +909,17 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 			continue
 		}
 
+		if !auth.ValidRegion(item.Region) {
+			results = append(results, map[string]interface{}{
+				"index":   i,
+				"success": false,
+				"error":   "无效的区域: " + item.Region,
+			})
+			failedCount++
+			continue
+		}
+		region := auth.NormalizeRegion(item.Region)
+
 		// 生成 machineId（优先使用导入数据中的，否则生成新的）
 		machineId := item.MachineID
 		if machineId == "" {
@@ -899,7 +932,7 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 			// 有完整凭证，走 IdC 刷新逻辑
 			logger.Debug("Token导入: 使用 IdC 刷新 - 索引: %d", i)
 			oidcClient := auth.NewOIDCClient(s.cfg)
-			accessToken, newRefreshToken, err := oidcClient.RefreshAccessToken(c.Request.Context(), item.ClientID, item.ClientSecret, item.RefreshToken, machineId)
+			accessToken, newRefreshToken, err := oidcClient.RefreshAccessToken(c.Request.Context(), region, item.ClientID, item.ClientSecret, item.RefreshToken, machineId)
 			if err != nil {
 				logger.Warn("Token导入: IdC 刷新失败 - 索引: %d, 错误: %v", i, err)
 				results = append(results, map[string]interface{}{
@@ -911,7 +944,7 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 				continue
 			}
 			// 使用 accessToken 获取用户信息
-			userInfo, _ := kiroClient.GetUserInfo(c.Request.Context(), accessToken, machineId)
+			userInfo, _ := kiroClient.GetUserInfo(c.Request.Context(), region, accessToken, machineId)
 			verifyResult = &auth.VerifyTokenResult{
 				Success:      true,
 				AccessToken:  accessToken,
@@ -922,7 +955,7 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 			// 无完整凭证，走社交登录刷新逻辑
 			logger.Debug("Token导入: 使用社交登录刷新 - 索引: %d", i)
 			var err error
-			verifyResult, err = kiroClient.VerifyAndGetUserInfo(c.Request.Context(), item.RefreshToken, machineId)
+			verifyResult, err = kiroClient.VerifyAndGetUserInfo(c.Request.Context(), region, item.RefreshToken, machineId)
 			if err != nil {
 				logger.Error("Token导入: 验证失败 - 索引: %d, 错误: %v", i, err)
 				results = append(results, map[string]interface{}{
@@ -1020,9 +1053,12 @@ func (s *Server) handleImportByToken(c *gin.Context) {
 			QUserID:           strPtr(userID),
 			Email:             strPtr(email),
 			AuthMethod:        strPtr(authMethod),
-			Region:            strPtr("us-east-1"),
+			Region:            strPtr(region),
 			MachineID:         &machineId,
 		}
+		if item.StartURL != "" {
+			account.StartURL = strPtr(item.StartURL)
+		}
 
 		if err := s.db.CreateAccount(c.Request.Context(), account); err != nil {
 			logger.Error("Token导入: 保存账号失败 - 索引: %d, 错误: %v", i, err)
@@ -1172,7 +1208,7 @@ func (s *Server) handleSyncAccountEmails(c *gin.Context) {
 
 		// 使用 KiroClient 获取用户信息
 		machineId := s.ensureAccountMachineID(c.Request.Context(), acc)
-		userInfo, err := s.kiroClient.GetUserInfo(c.Request.Context(), *acc.AccessToken, machineId)
+		userInfo, err := s.kiroClient.GetUserInfo(c.Request.Context(), auth.RegionOf(acc.Region), *acc.AccessToken, machineId)
 		if err != nil {
 			logger.Warn("同步邮箱: 获取用户信息失败 - ID: %s, 错误: %v", acc.ID, err)
 			results = append(results, map[string]interface{}{
@@ -1326,6 +1362,33 @@ func (s *Server) handleUpdateAccount(c *gin.Context) {
 			updates.Enabled = &enabledBool
 		}
 	}
+	if region, ok := req["region"]; ok {
+		if regionStr, ok := region.(string); ok {
+			if !auth.ValidRegion(regionStr) {
+				c.JSON(400, gin.H{"error": "无效的区域: " + regionStr})
+				return
+			}
+			regionStr = auth.NormalizeRegion(regionStr)
+			updates.Region = &regionStr
+		}
+	}
+	if startURL, ok := req["startUrl"]; ok {
+		if startURLStr, ok := startURL.(string); ok {
+			updates.StartURL = &startURLStr
+		}
+	}
+	// proxyId: 绑定到指定代理，0 或 null 解除绑定
+	if proxyID, ok := req["proxyId"]; ok {
+		var id int64
+		if proxyIDNum, ok := proxyID.(float64); ok && proxyIDNum > 0 {
+			id = int64(proxyIDNum)
+			if _, err := s.db.GetProxyByID(c.Request.Context(), id); err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("代理不存在: %d", id)})
+				return
+			}
+		}
+		updates.ProxyID = &id
+	}
 
 	logger.Info("正在更新账号 %s - 字段: %v", accountID, req)
 
@@ -1337,6 +1400,9 @@ func (s *Server) handleUpdateAccount(c *gin.Context) {
 
 	// 使账号缓存失效
 	s.InvalidateAccountCache(c.Request.Context())
+	if updates.ProxyID != nil && s.proxyPool != nil {
+		s.proxyPool.Bind(accountID, *updates.ProxyID)
+	}
 
 	logger.Info("账号更新成功 - ID: %s", accountID)
 	account, _ := s.db.GetAccount(c.Request.Context(), accountID)
@@ -1531,7 +1597,7 @@ func (s *Server) handleGetAccountQuota(c *gin.Context) {
 	}
 
 	machineId := s.ensureAccountMachineID(c.Request.Context(), account)
-	quota, err := s.aqClient.GetUsageLimits(c.Request.Context(), *account.AccessToken, machineId, resourceType)
+	quota, err := s.aqClient.GetUsageLimits(c.Request.Context(), auth.RegionOf(account.Region), *account.AccessToken, machineId, resourceType)
 	if err != nil {
 		// 使用错误码判断
 		if apiErr := amazonq.GetAPIError(err); apiErr != nil {
@@ -1627,7 +1693,7 @@ func (s *Server) handleGetAccountQuota(c *gin.Context) {
 	// @author ygw - 修正配额计算逻辑，合并免费试用和付费配额
 	var usageCurrent, usageLimit float64
 	var subscriptionType string
-	var tokenExpiry *int64 // 有效时间（Unix时间戳）@author ygw
+	var trialExpiry *int64 // 试用到期时间（Unix时间戳）@author ygw
 
 	// 提取订阅类型
 	if subInfo, ok := quota["subscriptionInfo"].(map[string]interface{}); ok {
@@ -1669,7 +1735,7 @@ func (s *Server) handleGetAccountQuota(c *gin.Context) {
 					// 提取并保存到数据库
 					if expiryVal, ok := expiry.(float64); ok {
 						expiryInt := int64(expiryVal)
-						tokenExpiry = &expiryInt
+						trialExpiry = &expiryInt
 					}
 				}
 				// 返回试用状态
@@ -1692,9 +1758,9 @@ func (s *Server) handleGetAccountQuota(c *gin.Context) {
 		}
 	}
 
-	// 更新数据库中的配额信息（包含有效时间）
+	// 更新数据库中的配额信息（包含试用到期时间）
 	// @author ygw
-	if err := s.db.UpdateAccountQuota(c.Request.Context(), accountID, usageCurrent, usageLimit, subscriptionType, tokenExpiry); err != nil {
+	if err := s.db.UpdateAccountQuota(c.Request.Context(), accountID, usageCurrent, usageLimit, subscriptionType, trialExpiry); err != nil {
 		logger.Warn("更新账号配额信息失败 - ID: %s, 错误: %v", accountID, err)
 	}
 
@@ -1798,9 +1864,12 @@ func (s *Server) handleGetSettings(c *gin.Context) {
 		// 代理配置
 		"httpProxy": settings.HTTPProxy,
 		// 智能压缩配置
-		"compressionEnabled":         settings.CompressionEnabled,
-		"compressionModel":           compressionModel,
-		"supportedCompressionModels": models.SupportedCompressionModels,
+		"compressionEnabled":             settings.CompressionEnabled,
+		"compressionModel":               compressionModel,
+		"supportedCompressionModels":     models.SupportedCompressionModels,
+		"compressionStrategies":          settings.CompressionStrategies,
+		"compressionModelStrategies":     settings.CompressionModelStrategies,
+		"supportedCompressionStrategies": compressor.StrategyNames(),
 		// 公告配置
 		"announcementEnabled": settings.AnnouncementEnabled,
 		"announcementText":    settings.AnnouncementText,
@@ -1811,6 +1880,14 @@ func (s *Server) handleGetSettings(c *gin.Context) {
 		// 性能优化配置（合并了配额刷新和状态检查）
 		"quotaRefreshConcurrency": settings.QuotaRefreshConcurrency,
 		"quotaRefreshInterval":    settings.QuotaRefreshInterval,
+		// 载荷采集配置
+		"captureSampleRate":   settings.CaptureSampleRate,
+		"captureRedactImages": settings.CaptureRedactImages,
+		"captureRedactKeys":   settings.CaptureRedactKeys,
+		// 通知配置
+		"notifyMinValidAccounts": settings.NotifyMinValidAccounts,
+		"notifyDedupMinutes":     settings.NotifyDedupMinutes,
+		"globalRateLimitTPM":     settings.GlobalRateLimitTPM,
 		// 版本信息
 		"edition":             "ultra",
 		"maxAccounts":         s.cfg.GetMaxAccounts(),
@@ -1855,6 +1932,22 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 		return
 	}
 
+	if err := validateCompressionStrategies(&updates); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 封禁列表整体替换前记录已封禁的 IP，用于通知新增的封禁
+	var previousBlocked map[string]bool
+	if updates.BlockedIPs != nil {
+		previousBlocked = make(map[string]bool)
+		if ips, err := s.db.GetBlockedIPs(c.Request.Context()); err == nil {
+			for _, ip := range ips {
+				previousBlocked[ip.IP] = true
+			}
+		}
+	}
+
 	if err := s.db.UpdateSettings(c.Request.Context(), &updates); err != nil {
 		logger.Error("更新系统设置失败: %v", err)
 		c.JSON(500, gin.H{"error": "更新系统设置失败"})
@@ -1864,6 +1957,15 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 	// 使设置缓存失效
 	s.InvalidateSettingsCache()
 
+	if updates.BlockedIPs != nil {
+		for _, ip := range *updates.BlockedIPs {
+			if !previousBlocked[ip] {
+				previousBlocked[ip] = true
+				s.notifyIPBlocked(ip, "手动封禁")
+			}
+		}
+	}
+
 	// 动态更新服务器配置
 	if updates.APIKey != nil {
 		if *updates.APIKey != "" {
@@ -1917,7 +2019,7 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 func (s *Server) handleClaudeMessages(c *gin.Context) {
 	clientIP := c.ClientIP()
 	startTime := time.Now()
-	logger.Debug("处理 Claude Messages 请求 - 来源: %s", clientIP)
+	logger.Ctx(c.Request.Context()).Debug("处理 Claude Messages 请求 - 来源: %s", clientIP)
 
 	// 检查是否为控制台模式
 	consoleMode, _ := c.Get("console_mode")
@@ -1932,77 +2034,25 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 		if apiKey != "" {
 			if user, err := s.db.GetUserByAPIKey(c.Request.Context(), apiKey); err == nil && user != nil {
 				if !user.Enabled {
-					logger.Warn("Claude Messages API key 验证失败 - 用户已禁用 - 用户: %s (%s) - 来源: %s", user.Name, user.ID, clientIP)
+					logger.Ctx(c.Request.Context()).Warn("Claude Messages API key 验证失败 - 用户已禁用 - 用户: %s (%s) - 来源: %s", user.Name, user.ID, clientIP)
 					c.Set("error_message", "用户已禁用")
 					c.JSON(401, gin.H{"error": "用户已禁用"})
 					return
 				}
 
-				// 每日请求限制检查：指定IP每日限制 > 用户每日请求限制 @author ygw
-				ipDailyAllowed, ipDailyReason := s.checkDailyRequestLimit(c.Request.Context(), clientIP, user)
-				if !ipDailyAllowed {
-					logger.Warn("IP每日请求限制触发 - IP: %s - 原因: %s", clientIP, ipDailyReason)
-					c.Set("error_message", ipDailyReason)
-					c.JSON(429, gin.H{"error": ipDailyReason})
-					return
-				}
-
-				// 用户配额检查（包含用户每日请求限制、每日token配额、月度token配额）
-				allowed, reason, err := s.db.CheckUserQuota(c.Request.Context(), user.ID)
-				if err != nil {
-					logger.Error("检查用户配额失败: %v - 用户: %s", err, user.ID)
-					c.JSON(500, gin.H{"error": "内部服务器错误"})
-					return
-				}
-				if !allowed {
-					logger.Warn("用户配额已用尽 - 用户: %s (%s) - 原因: %s - 来源: %s", user.Name, user.ID, reason, clientIP)
-					c.Set("error_message", "配额已用尽: "+reason)
-					c.JSON(429, gin.H{"error": "配额已用尽: " + reason})
+				// 每日请求限制和用户配额检查（指定IP每日限制、用户每日请求次数、每日/月度 token 配额）
+				if !s.checkUserQuota(c, user) {
 					return
 				}
 
 				// 用户校验通过，写入上下文
 				c.Set("user", user)
+				logger.AddFields(c.Request.Context(), logger.Fields{UserID: user.ID})
+				tracing.SetAttributes(c.Request.Context(), tracing.AttrUserID.String(user.ID))
 				c.Set("api_key_prefix", auth.GetAPIKeyPrefix(apiKey))
 
 				// 频率限制检查：指定IP单独设置 > 用户单独设置 > 系统统一IP设置 @author ygw
-				// 1. 最高优先级：检查指定IP是否有单独设置
-				ipConfig, err := s.ipConfigCache.Get(c.Request.Context(), clientIP)
-				if err == nil && ipConfig != nil && ipConfig.RateLimitRPM > 0 {
-					result := s.rateLimiter.CheckIP(clientIP, ipConfig.RateLimitRPM)
-					if !result.Allowed {
-						logger.Warn("指定IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-						c.Set("error_message", fmt.Sprintf("请求过于频繁（指定IP限制：%d 次/分钟）", result.Limit))
-						c.JSON(429, gin.H{
-							"error": fmt.Sprintf("请求过于频繁，请稍后重试（指定IP限制：%d 次/分钟）", result.Limit),
-							"code":  "IP_RATE_LIMIT_EXCEEDED",
-							"type":  "rate_limit_error",
-						})
-						return
-					}
-					// 指定IP有设置且通过，跳过后续限制检查
-				} else if user.RateLimitRPM > 0 {
-					// 2. 次优先级：用户设置了单独的频率限制
-					result := s.rateLimiter.CheckAPIKey(user.APIKey, user.RateLimitRPM)
-					if !result.Allowed {
-						logger.Warn("API Key 限流触发 - 用户: %s (%s), 请求数: %d, 限制: %d/分钟", user.Name, user.ID, result.Count, result.Limit)
-						c.Set("error_message", fmt.Sprintf("请求过于频繁（API Key限制：%d 次/分钟）", result.Limit))
-						c.JSON(429, gin.H{
-							"error": fmt.Sprintf("请求过于频繁，请稍后重试（API Key限制：%d 次/分钟）", result.Limit),
-							"code":  "APIKEY_RATE_LIMIT_EXCEEDED",
-							"type":  "rate_limit_error",
-						})
-						return
-					}
-					// 用户有设置且通过，跳过系统统一IP限制
-				} else if rateLimited := s.checkIPRateLimit(c.Request.Context(), clientIP); rateLimited {
-					// 3. 最低优先级：检查系统统一IP设置
-					c.Set("error_message", "请求过于频繁")
-					c.JSON(429, gin.H{
-						"error": "请求过于频繁，请稍后重试",
-						"code":  "IP_RATE_LIMIT_EXCEEDED",
-						"type":  "rate_limit_error",
-					})
+				if !s.checkRequestRateLimit(c, user) {
 					return
 				}
 			} else if len(s.cfg.OpenAIKeys) > 0 {
@@ -2015,26 +2065,20 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 					}
 				}
 				if !found {
-					logger.Warn("Claude Messages API key 验证失败 - 无效的 API key - 来源: %s", clientIP)
+					logger.Ctx(c.Request.Context()).Warn("Claude Messages API key 验证失败 - 无效的 API key - 来源: %s", clientIP)
 					c.Set("error_message", "无效的 API key")
 					c.JSON(401, gin.H{"error": "无效的 API key"})
 					return
 				}
 				// 系统 API Key 没有用户设置，检查指定IP设置和系统统一IP设置 @author ygw
-				if rateLimited := s.checkIPRateLimit(c.Request.Context(), clientIP); rateLimited {
-					c.Set("error_message", "请求过于频繁")
-					c.JSON(429, gin.H{
-						"error": "请求过于频繁，请稍后重试",
-						"code":  "IP_RATE_LIMIT_EXCEEDED",
-						"type":  "rate_limit_error",
-					})
+				if !s.checkRequestRateLimit(c, nil) {
 					return
 				}
 			}
 			// 如果系统没有配置 API key 且用户 API key 不匹配，跳过验证（开发模式）
 		} else if len(s.cfg.OpenAIKeys) > 0 {
 			// 系统配置了 API key 但客户端未提供
-			logger.Warn("Claude Messages API key 验证失败 - 未提供 API key - 来源: %s", clientIP)
+			logger.Ctx(c.Request.Context()).Warn("Claude Messages API key 验证失败 - 未提供 API key - 来源: %s", clientIP)
 			c.Set("error_message", "缺少 API key")
 			c.JSON(401, gin.H{"error": "缺少 API key"})
 			return
@@ -2057,6 +2101,9 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 	// 保存接收到的请求到 in.log（仅调试模式）
 	saveInLog(body, logTimestamp)
 
+	// 载荷采集（按用户开关或采样率）
+	s.startCapture(c, body)
+
 	// 解析请求
 	var req models.ClaudeRequest
 	if err := json.Unmarshal(body, &req); err != nil {
@@ -2065,6 +2112,11 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 		return
 	}
 
+	// 校验历史 thinking 块签名，移除 redacted_thinking 块
+	if !s.prepareThinkingHistory(c, &req) {
+		return
+	}
+
 	// opus 模型桥接：如果模型名包含 opus，转发到 localhost:3003 服务（已禁用，直接在本服务处理）
 	// if strings.Contains(strings.ToLower(req.Model), "opus") {
 	// 	logger.Info("[Opus 桥接] 检测到 opus 模型: %s, 转发至 localhost:3003 - 来源: %s", req.Model, clientIP)
@@ -2081,18 +2133,20 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 		if !strings.Contains(modelLower, "haiku") {
 			originalModel = req.Model
 			req.Model = settings.ForceModel
-			logger.Info("[强制模型] 已替换模型: %s -> %s", originalModel, req.Model)
+			logger.Ctx(c.Request.Context()).Info("[强制模型] 已替换模型: %s -> %s", originalModel, req.Model)
 			c.Set("original_model", originalModel)
 		} else {
-			logger.Debug("[强制模型] haiku模型不替换: %s", req.Model)
+			logger.Ctx(c.Request.Context()).Debug("[强制模型] haiku模型不替换: %s", req.Model)
 		}
 	}
 
+	logger.AddFields(c.Request.Context(), logger.Fields{Model: req.Model})
+
 	// 调试模式：打印请求摘要
 	if originalModel != "" {
-		logger.Debug("[Claude 请求] 消息数: %d, 原始模型: %s, 实际模型: %s, 流式: %v", len(req.Messages), originalModel, req.Model, req.Stream)
+		logger.Ctx(c.Request.Context()).Debug("[Claude 请求] 消息数: %d, 原始模型: %s, 实际模型: %s, 流式: %v", len(req.Messages), originalModel, req.Model, req.Stream)
 	} else {
-		logger.Debug("[Claude 请求] 消息数: %d, 模型: %s, 流式: %v", len(req.Messages), req.Model, req.Stream)
+		logger.Ctx(c.Request.Context()).Debug("[Claude 请求] 消息数: %d, 模型: %s, 流式: %v", len(req.Messages), req.Model, req.Stream)
 	}
 	for i, msg := range req.Messages {
 		contentPreview := ""
@@ -2105,7 +2159,7 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 		} else {
 			contentPreview = fmt.Sprintf("(复杂内容 %T)", msg.Content)
 		}
-		logger.Debug("[Claude 请求] 消息[%d] role=%s content=%s", i, msg.Role, contentPreview)
+		logger.Ctx(c.Request.Context()).Debug("[Claude 请求] 消息[%d] role=%s content=%s", i, msg.Role, contentPreview)
 	}
 
 	// 获取 conversation_id：优先使用请求体中的，其次使用 header 中的，最后生成新的
@@ -2123,29 +2177,32 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 	// 预估输入 tokens，便于日志与 SSE 元数据
 	inputTokens := countClaudeInputTokens(&req)
 
-	// 上下文压缩检查（从数据库读取设置）
+	// TPM 限流：按压缩前的预估输入 token 预占额度（在压缩前检查，避免为被拒绝的请求调用摘要），响应结束后按实际用量修正
+	if !s.admitTokens(c, inputTokens) {
+		return
+	}
+	defer s.reconcileTokens(c)
+
+	// 上下文压缩检查（从数据库读取设置，按用户/模型选择策略链）
 	if s.compressor != nil {
-		// 获取设置以决定是否启用压缩和使用什么模型
 		settings, _ := s.db.GetSettings(c.Request.Context())
-		if settings != nil && settings.CompressionEnabled {
-			// 更新压缩器使用的模型
-			if settings.CompressionModel != "" {
-				s.compressor.SetSummaryModel(settings.CompressionModel)
-			}
-
-			compressedReq, compressErr := s.compressor.CompressIfNeeded(c.Request.Context(), &req,
-				func(ctx context.Context, content, model string) (string, error) {
-					return s.callSummaryAPI(ctx, content, model)
-				})
-			if compressErr != nil {
-				logger.Warn("[智能压缩] 压缩失败: %v", compressErr)
-			} else if compressedReq != nil {
-				req = *compressedReq
-				inputTokens = countClaudeInputTokens(&req)
-				logger.Info("[智能压缩] 完成 - Token: %d, 消息数: %d", inputTokens, len(req.Messages))
-			}
+		compressedReq, compressErr := s.compressClaudeRequest(c, &req, settings)
+		if compressErr != nil {
+			logger.Ctx(c.Request.Context()).Warn("[智能压缩] 压缩失败: %v", compressErr)
 		}
+		if compressedReq != nil {
+			req = *compressedReq
+			inputTokens = countClaudeInputTokens(&req)
+			logger.Ctx(c.Request.Context()).Info("[智能压缩] 完成 - Token: %d, 消息数: %d", inputTokens, len(req.Messages))
+		}
+	}
+
+	// 准入控制：容量不足时按优先级排队，队列满或超时返回 529
+	release, ok := s.admitRequest(c)
+	if !ok {
+		return
 	}
+	defer release()
 
 	// 带重试的账号选择和请求
 	var acc *models.Account
@@ -2156,52 +2213,69 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 	maxRetries := 3
 	for retry := 0; retry <= maxRetries; retry++ {
 		// 选择账号（排除已尝试的）
+		_, selectSpan := tracing.Start(c.Request.Context(), tracing.SpanAccountSelect, tracing.AttrRetry.Int(retry))
 		acc, err = s.selectAccountExcluding(c.Request.Context(), triedIDs)
+		if acc != nil {
+			selectSpan.SetAttributes(tracing.AttrAccountID.String(acc.ID))
+		}
+		tracing.End(selectSpan, err)
 		if err != nil || acc == nil {
-			logger.Warn("无可用账号 - 来源: %s, 已尝试: %d", clientIP, len(triedIDs))
+			logger.Ctx(c.Request.Context()).Warn("无可用账号 - 来源: %s, 已尝试: %d", clientIP, len(triedIDs))
 			c.Set("error_message", "无可用账号，请先添加并配置账号")
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "无可用账号，请先添加并配置账号"})
 			return
 		}
 		triedIDs = append(triedIDs, acc.ID)
+		logger.AddFields(c.Request.Context(), logger.Fields{AccountID: acc.ID})
 
 		// 被动刷新策略：确保账号可用（刷新令牌和配额）
 		// 执行流程：检查令牌 -> 刷新配额 -> 配额错误时刷新令牌 -> 重试
 		// 整个过程对用户透明无感知
-		acc, err = s.EnsureAccountReady(c.Request.Context(), acc)
+		readyCtx, readySpan := tracing.Start(c.Request.Context(), tracing.SpanAccountReady,
+			tracing.AttrAccountID.String(acc.ID), tracing.AttrRetry.Int(retry))
+		acc, err = s.EnsureAccountReady(readyCtx, acc)
+		tracing.End(readySpan, err)
 		if err != nil {
-			logger.Warn("账号 %s 被动刷新失败: %v，尝试换号", triedIDs[len(triedIDs)-1], err)
+			logger.Ctx(c.Request.Context()).Warn("账号 %s 被动刷新失败: %v，尝试换号", triedIDs[len(triedIDs)-1], err)
 			continue
 		}
 
 		// 确保有访问令牌
 		if acc == nil || acc.AccessToken == nil || *acc.AccessToken == "" {
-			logger.Warn("账号被动刷新后仍无访问令牌")
+			logger.Ctx(c.Request.Context()).Warn("账号被动刷新后仍无访问令牌")
 			continue
 		}
 
 		// 转换并发送请求
 		aqPayload, convErr := claude.ConvertClaudeToAmazonQ(&req, conversationID, false)
 		if convErr != nil {
-			logger.Error("请求转换失败 - 错误: %v", convErr)
+			logger.Ctx(c.Request.Context()).Error("请求转换失败 - 错误: %v", convErr)
 			c.Set("error_message", convErr.Error())
 			c.JSON(400, gin.H{"error": convErr.Error()})
 			return
 		}
 
+		if rec := getCapture(c); rec != nil {
+			rec.SetAmazonQPayload(aqPayload)
+		}
+
 		// 调试模式：打印转换后的 Amazon Q 请求体
 		if aqPayloadJSON, err := json.MarshalIndent(aqPayload, "", "  "); err == nil {
-			logger.Debug("[Claude->AmazonQ] 转换后请求体: %s", string(aqPayloadJSON))
+			logger.Ctx(c.Request.Context()).Debug("[Claude->AmazonQ] 转换后请求体: %s", string(aqPayloadJSON))
 		}
 
 		machineId := s.ensureAccountMachineID(c.Request.Context(), acc)
-		resp, err = s.aqClient.SendChatRequest(c.Request.Context(), *acc.AccessToken, machineId, acc.ID, aqPayload, logTimestamp)
+		sendCtx, sendSpan := tracing.Start(c.Request.Context(), tracing.SpanUpstream,
+			tracing.AttrAccountID.String(acc.ID), tracing.AttrModel.String(req.Model),
+			tracing.AttrRetry.Int(retry), tracing.AttrInputTokens.Int(inputTokens))
+		resp, err = s.aqClient.SendChatRequest(sendCtx, auth.RegionOf(acc.Region), *acc.AccessToken, machineId, acc.ID, aqPayload, logTimestamp)
+		tracing.End(sendSpan, err)
 		if err != nil {
 			lastErr = err
 
 			// 检查是否为客户端主动取消，不触发重试
 			if c.Request.Context().Err() == context.Canceled {
-				logger.Info("请求被客户端取消，终止重试")
+				logger.Ctx(c.Request.Context()).Info("请求被客户端取消，终止重试")
 				return
 			}
 
@@ -2213,9 +2287,9 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 						// 如果是上下文超出错误，打印具体的 token 数量
 						if nrErr.Code == "CONTENT_LENGTH_EXCEEDS_THRESHOLD" || nrErr.Code == "INPUT_TOO_LONG" {
 							inputTokens := countClaudeInputTokens(&req)
-							logger.Error("【上下文超出】输入 Token: %d, 消息数: %d, 模型: %s", inputTokens, len(req.Messages), req.Model)
+							logger.Ctx(c.Request.Context()).Error("【上下文超出】输入 Token: %d, 消息数: %d, 模型: %s", inputTokens, len(req.Messages), req.Model)
 						}
-						logger.Warn("检测到请求错误，终止重试 - 错误: %s, 提示: %s", nrErr.Message, nrErr.Hint)
+						logger.Ctx(c.Request.Context()).Warn("检测到请求错误，终止重试 - 错误: %s, 提示: %s", nrErr.Message, nrErr.Hint)
 						c.Set("error_message", nrErr.Message)
 						c.JSON(http.StatusBadRequest, gin.H{
 							"error": nrErr.Message,
@@ -2225,13 +2299,13 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 						return
 					}
 					// 账号相关错误，更新统计并尝试换号
-					logger.Warn("检测到账号错误: %s - %s，尝试换号", nrErr.Code, nrErr.Message)
+					logger.Ctx(c.Request.Context()).Warn("检测到账号错误: %s - %s，尝试换号", nrErr.Code, nrErr.Message)
 					s.QueueStatsUpdate(acc.ID, false)
 					s.LogFailedRequest(c, acc, req.Model, req.Stream, nrErr.Message, startTime)
 					// 根据错误码更新账号状态
 					s.handleAccountStatusByError(c.Request.Context(), acc.ID, nrErr.Code)
 					if retry < maxRetries {
-						logger.Info("账号 %s 请求失败，换号重试 - 重试次数: %d", acc.ID, retry+1)
+						logger.Ctx(c.Request.Context()).Info("账号 %s 请求失败，换号重试 - 重试次数: %d", acc.ID, retry+1)
 					}
 					continue
 				}
@@ -2241,7 +2315,7 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 			s.QueueStatsUpdate(acc.ID, false)
 			s.LogFailedRequest(c, acc, req.Model, req.Stream, err.Error(), startTime)
 			if retry < maxRetries {
-				logger.Info("账号 %s 请求失败，换号重试 - 重试次数: %d", acc.ID, retry+1)
+				logger.Ctx(c.Request.Context()).Info("账号 %s 请求失败，换号重试 - 重试次数: %d", acc.ID, retry+1)
 			}
 			continue
 		}
@@ -2254,9 +2328,14 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 	if acc != nil {
 		c.Set("account", acc)
 	}
+	tracing.SetAttributes(c.Request.Context(), tracing.AttrModel.String(req.Model),
+		tracing.AttrStream.Bool(req.Stream), tracing.AttrInputTokens.Int(inputTokens))
+	if acc != nil {
+		tracing.SetAttributes(c.Request.Context(), tracing.AttrAccountID.String(acc.ID))
+	}
 
 	if resp == nil {
-		logger.Error("所有账号均失败 - 来源: %s, 模型: %s, 错误: %v", clientIP, req.Model, lastErr)
+		logger.Ctx(c.Request.Context()).Error("所有账号均失败 - 来源: %s, 模型: %s, 错误: %v", clientIP, req.Model, lastErr)
 		if lastErr != nil {
 			c.Set("error_message", lastErr.Error())
 		}
@@ -2264,29 +2343,41 @@ func (s *Server) handleClaudeMessages(c *gin.Context) {
 		return
 	}
 	defer resp.Body.Close()
+	if rec := getCapture(c); rec != nil {
+		resp.Body = rec.WrapUpstream(resp.Body)
+	}
 
+	isThinking := req.Thinking != nil
+	thinkingBudget := thinking.ParseBudget(req.Thinking)
 	if req.Stream {
 		// 控制台模式使用 UnifiedStreamHandler（前端期望的格式）
 		// 标准 Claude API 使用 ClaudeStreamHandler（标准 Claude SSE 格式）
-		isThinking := req.Thinking != nil
 		if isConsoleMode {
 			s.handleConsoleStreamResponse(c, resp, req.Model, conversationID, clientIP, startTime, len(req.Messages), acc, inputTokens, isThinking)
 		} else {
-			s.handleClaudeStreamResponse(c, resp, req.Model, conversationID, clientIP, startTime, len(req.Messages), acc, inputTokens, isThinking)
+			s.handleClaudeStreamResponse(c, resp, req.Model, conversationID, clientIP, startTime, len(req.Messages), acc, inputTokens, isThinking, thinkingBudget)
 		}
 	} else {
-		s.handleClaudeNonStreamResponse(c, resp, req.Model, conversationID, clientIP, startTime, acc, len(req.Messages), inputTokens)
+		s.handleClaudeNonStreamResponse(c, resp, req.Model, conversationID, clientIP, startTime, acc, len(req.Messages), inputTokens, isThinking, thinkingBudget)
 	}
 }
 
 // handleConsoleStreamResponse 处理控制台流式响应（使用前端期望的自定义 SSE 格式）
 func (s *Server) handleConsoleStreamResponse(c *gin.Context, resp *http.Response, model, conversationID, clientIP string, startTime time.Time, msgCount int, acc *models.Account, inputTokens int, isThinking bool) {
+	// 上游事件流转换 Span
+	_, convertSpan := tracing.Start(c.Request.Context(), tracing.SpanStreamConvert,
+		tracing.AttrAccountID.String(acc.ID), tracing.AttrModel.String(model), tracing.AttrInputTokens.Int(inputTokens))
+	defer convertSpan.End()
+
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
 	// 使用 UnifiedStreamHandler 输出前端期望的 SSE 格式（meta, answer_delta, thinking_delta, done）
 	handler := stream.NewUnifiedStreamHandler(model, conversationID, inputTokens)
+	if isThinking {
+		handler.Signer = s.thinkSigner
+	}
 	parser := stream.NewEventStreamParser()
 
 	reader := bufio.NewReader(resp.Body)
@@ -2296,7 +2387,7 @@ func (s *Server) handleConsoleStreamResponse(c *gin.Context, resp *http.Response
 		n, err := reader.Read(buf)
 		if err != nil {
 			if err != io.EOF {
-				logger.Info("读取流错误 - 来源: %s, 错误: %v", clientIP, err)
+				logger.Ctx(c.Request.Context()).Info("读取流错误 - 来源: %s, 错误: %v", clientIP, err)
 				w.Write([]byte(handler.Error(fmt.Sprintf("流读取错误: %v", err))))
 			}
 
@@ -2312,18 +2403,20 @@ func (s *Server) handleConsoleStreamResponse(c *gin.Context, resp *http.Response
 			outputTokens := handler.OutputTokens()
 			c.Set("input_tokens", inputTokens)
 			c.Set("output_tokens", outputTokens)
+			convertSpan.SetAttributes(tracing.AttrOutputTokens.Int(outputTokens))
+			tracing.SetAttributes(c.Request.Context(), tracing.AttrOutputTokens.Int(outputTokens))
 
 			modelDisplay := model
 			if isThinking {
 				modelDisplay = model + "-thinking"
 			}
-			logger.Info("控制台流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, modelDisplay, msgCount, inputTokens, outputTokens, duration.Milliseconds())
+			logger.Ctx(c.Request.Context()).Info("控制台流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, modelDisplay, msgCount, inputTokens, outputTokens, duration.Milliseconds())
 			return false
 		}
 
 		events, err := parser.Feed(buf[:n])
 		if err != nil {
-			logger.Info("解析错误 - 来源: %s, 错误: %v", clientIP, err)
+			logger.Ctx(c.Request.Context()).Info("解析错误 - 来源: %s, 错误: %v", clientIP, err)
 			w.Write([]byte(handler.Error(fmt.Sprintf("解析错误: %v", err))))
 			return false
 		}
@@ -2337,7 +2430,7 @@ func (s *Server) handleConsoleStreamResponse(c *gin.Context, resp *http.Response
 			var payload map[string]interface{}
 			if len(event.Payload) > 0 {
 				if err := json.Unmarshal(event.Payload, &payload); err != nil {
-					logger.Warn("解析事件 payload 失败: %v", err)
+					logger.Ctx(c.Request.Context()).Warn("解析事件 payload 失败: %v", err)
 				}
 			}
 
@@ -2351,7 +2444,12 @@ func (s *Server) handleConsoleStreamResponse(c *gin.Context, resp *http.Response
 	})
 }
 
-func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response, model, conversationID, clientIP string, startTime time.Time, msgCount int, acc *models.Account, inputTokens int, isThinking bool) {
+func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response, model, conversationID, clientIP string, startTime time.Time, msgCount int, acc *models.Account, inputTokens int, isThinking bool, thinkingBudget int) {
+	// 上游事件流转换 Span
+	_, convertSpan := tracing.Start(c.Request.Context(), tracing.SpanStreamConvert,
+		tracing.AttrAccountID.String(acc.ID), tracing.AttrModel.String(model), tracing.AttrInputTokens.Int(inputTokens))
+	defer convertSpan.End()
+
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
@@ -2360,6 +2458,11 @@ func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response,
 	// 使用 ClaudeStreamHandler 输出标准 Claude SSE 格式
 	handler := stream.NewClaudeStreamHandler(model, inputTokens)
 	handler.ConversationID = conversationID
+	if isThinking {
+		// thinking 块按 budget_tokens 截断并签名
+		handler.Thinking = thinking.NewSession(thinkingBudget)
+		handler.Signer = s.thinkSigner
+	}
 	parser := stream.NewEventStreamParser()
 
 	reader := bufio.NewReader(resp.Body)
@@ -2369,7 +2472,7 @@ func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response,
 		n, err := reader.Read(buf)
 		if err != nil {
 			if err != io.EOF {
-				logger.Info("读取流错误 - 来源: %s, 错误: %v", clientIP, err)
+				logger.Ctx(c.Request.Context()).Info("读取流错误 - 来源: %s, 错误: %v", clientIP, err)
 				w.Write([]byte(handler.Error(fmt.Sprintf("流读取错误: %v", err))))
 			}
 
@@ -2386,18 +2489,20 @@ func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response,
 			outputTokens := handler.OutputTokens()
 			c.Set("input_tokens", inputTokens)
 			c.Set("output_tokens", outputTokens)
+			convertSpan.SetAttributes(tracing.AttrOutputTokens.Int(outputTokens))
+			tracing.SetAttributes(c.Request.Context(), tracing.AttrOutputTokens.Int(outputTokens))
 
 			modelDisplay := model
 			if isThinking {
 				modelDisplay = model + "-thinking"
 			}
-			logger.Info("Claude 流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, modelDisplay, msgCount, inputTokens, outputTokens, duration.Milliseconds())
+			logger.Ctx(c.Request.Context()).Info("Claude 流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, modelDisplay, msgCount, inputTokens, outputTokens, duration.Milliseconds())
 			return false
 		}
 
 		events, err := parser.Feed(buf[:n])
 		if err != nil {
-			logger.Info("解析错误 - 来源: %s, 错误: %v", clientIP, err)
+			logger.Ctx(c.Request.Context()).Info("解析错误 - 来源: %s, 错误: %v", clientIP, err)
 			w.Write([]byte(handler.Error(fmt.Sprintf("解析错误: %v", err))))
 			return false
 		}
@@ -2411,7 +2516,7 @@ func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response,
 			var payload map[string]interface{}
 			if len(event.Payload) > 0 {
 				if err := json.Unmarshal(event.Payload, &payload); err != nil {
-					logger.Warn("解析事件 payload 失败: %v", err)
+					logger.Ctx(c.Request.Context()).Warn("解析事件 payload 失败: %v", err)
 				}
 			}
 
@@ -2430,7 +2535,12 @@ func (s *Server) handleClaudeStreamResponse(c *gin.Context, resp *http.Response,
 	})
 }
 
-func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Response, model, conversationID, clientIP string, startTime time.Time, acc *models.Account, msgCount int, inputTokens int) {
+func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Response, model, conversationID, clientIP string, startTime time.Time, acc *models.Account, msgCount int, inputTokens int, isThinking bool, thinkingBudget int) {
+	// 上游事件流转换 Span
+	_, convertSpan := tracing.Start(c.Request.Context(), tracing.SpanStreamConvert,
+		tracing.AttrAccountID.String(acc.ID), tracing.AttrModel.String(model), tracing.AttrInputTokens.Int(inputTokens))
+	defer convertSpan.End()
+
 	// 确保响应体被关闭
 	defer resp.Body.Close()
 
@@ -2452,13 +2562,13 @@ func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Respon
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("读取响应体失败: %v", err)
+		logger.Ctx(c.Request.Context()).Error("读取响应体失败: %v", err)
 		c.JSON(500, gin.H{"error": "读取响应失败"})
 		return
 	}
 	events, err := parser.Feed(body)
 	if err != nil {
-		logger.Error("解析响应事件失败: %v", err)
+		logger.Ctx(c.Request.Context()).Error("解析响应事件失败: %v", err)
 		c.JSON(500, gin.H{"error": "解析响应失败"})
 		return
 	}
@@ -2472,7 +2582,7 @@ func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Respon
 		var payload map[string]interface{}
 		if len(event.Payload) > 0 {
 			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				logger.Warn("解析事件 payload 失败: %v", err)
+				logger.Ctx(c.Request.Context()).Warn("解析事件 payload 失败: %v", err)
 			}
 		}
 
@@ -2527,6 +2637,16 @@ func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Respon
 
 	// 构建最终响应内容
 	content := []interface{}{}
+	thinkingTokens := 0
+	if isThinking {
+		// thinking 模式：拆出 <thinking> 段落作为带签名的 thinking 块
+		var thinkingBlocks []map[string]interface{}
+		thinkingBlocks, fullContent = s.buildThinkingContent(fullContent, thinkingBudget)
+		for _, b := range thinkingBlocks {
+			thinkingTokens += estimateTokens(b["thinking"].(string))
+			content = append(content, b)
+		}
+	}
 	if fullContent != "" {
 		content = append(content, map[string]interface{}{"type": "text", "text": fullContent})
 	}
@@ -2577,7 +2697,7 @@ func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Respon
 
 	// 非流式响应无法使用 delta 计数，使用 tiktoken 估算
 	// 注意：tiktoken 使用 OpenAI 的 cl100k_base 编码，与 Claude 的 tokenizer 存在差异
-	outputTokens := estimateTokens(fullContent)
+	outputTokens := estimateTokens(fullContent) + thinkingTokens
 
 	response := map[string]interface{}{
 		"id":              conversationID,
@@ -2604,8 +2724,10 @@ func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Respon
 	// 设置 token 数量用于日志记录
 	c.Set("input_tokens", inputTokens)
 	c.Set("output_tokens", outputTokens)
+	convertSpan.SetAttributes(tracing.AttrOutputTokens.Int(outputTokens))
+	tracing.SetAttributes(c.Request.Context(), tracing.AttrOutputTokens.Int(outputTokens))
 
-	logger.Info("Claude 非流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, model, msgCount, inputTokens, outputTokens, duration.Milliseconds())
+	logger.Ctx(c.Request.Context()).Info("Claude 非流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, model, msgCount, inputTokens, outputTokens, duration.Milliseconds())
 
 	c.JSON(http.StatusOK, response)
 }
@@ -2614,15 +2736,7 @@ func (s *Server) handleClaudeNonStreamResponse(c *gin.Context, resp *http.Respon
 func (s *Server) handleChatCompletions(c *gin.Context) {
 	clientIP := c.ClientIP()
 	startTime := time.Now()
-	logger.Debug("处理 Chat Completions 请求 - 来源: %s", clientIP)
-
-	// 从上下文获取账号
-	account := getAccount(c)
-	if account == nil {
-		logger.Error("上下文中未找到账号 - Chat Completions 请求")
-		c.JSON(500, gin.H{"error": "上下文中未找到账号"})
-		return
-	}
+	logger.Ctx(c.Request.Context()).Debug("处理 Chat Completions 请求 - 来源: %s", clientIP)
 
 	// 读取请求体并保存到 in.log
 	body, err := io.ReadAll(c.Request.Body)
@@ -2635,11 +2749,12 @@ func (s *Server) handleChatCompletions(c *gin.Context) {
 	logTimestamp := time.Now().Format("20060102_150405")
 	c.Set("log_timestamp", logTimestamp)
 	saveInLog(body, logTimestamp)
+	s.startCapture(c, body)
 
 	// 解析请求
 	var req models.ChatCompletionRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		logger.Warn("无效的 Chat Completions 请求格式: %v", err)
+		logger.Ctx(c.Request.Context()).Warn("无效的 Chat Completions 请求格式: %v", err)
 		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
 		return
 	}
@@ -2653,58 +2768,74 @@ func (s *Server) handleChatCompletions(c *gin.Context) {
 		if !strings.Contains(modelLowerOpenAI, "haiku") {
 			originalModelOpenAI = req.Model
 			req.Model = settingsOpenAI.ForceModel
-			logger.Info("[强制模型] OpenAI格式已替换模型: %s -> %s", originalModelOpenAI, req.Model)
+			logger.Ctx(c.Request.Context()).Info("[强制模型] OpenAI格式已替换模型: %s -> %s", originalModelOpenAI, req.Model)
 			c.Set("original_model", originalModelOpenAI)
 		} else {
-			logger.Debug("[强制模型] OpenAI格式haiku模型不替换: %s", req.Model)
+			logger.Ctx(c.Request.Context()).Debug("[强制模型] OpenAI格式haiku模型不替换: %s", req.Model)
 		}
 	}
 
+	logger.AddFields(c.Request.Context(), logger.Fields{Model: req.Model})
+
 	// 生成或获取 conversation_id（用于压缩缓存匹配）
 	conversationID := uuid.New().String()
 
 	inputTokens := countOpenAIInputTokens(&req)
 
+	// TPM 限流：按压缩前的预估输入 token 预占额度（在压缩前检查，避免为被拒绝的请求调用摘要），响应结束后按实际用量修正
+	if !s.admitTokens(c, inputTokens) {
+		return
+	}
+	defer s.reconcileTokens(c)
+
 	// 上下文压缩检查（OpenAI 格式，从数据库读取设置）
 	if s.compressor != nil {
 		settings, _ := s.db.GetSettings(c.Request.Context())
 		if settings != nil && settings.CompressionEnabled {
-			// 更新压缩器使用的模型
-			if settings.CompressionModel != "" {
-				s.compressor.SetSummaryModel(settings.CompressionModel)
-			}
-
 			// 先转换为 Claude 格式进行压缩检查
 			claudeReqForCheck := convertOpenAIToClaude(&req)
-			compressedReq, compressErr := s.compressor.CompressIfNeeded(c.Request.Context(), claudeReqForCheck,
-				func(ctx context.Context, content, model string) (string, error) {
-					return s.callSummaryAPI(ctx, content, model)
-				})
+			compressedReq, compressErr := s.compressClaudeRequest(c, claudeReqForCheck, settings)
 			if compressErr != nil {
-				logger.Warn("[智能压缩] OpenAI格式压缩失败: %v", compressErr)
-			} else if compressedReq != nil {
+				logger.Ctx(c.Request.Context()).Warn("[智能压缩] OpenAI格式压缩失败: %v", compressErr)
+			}
+			if compressedReq != nil {
 				// 将压缩后的 Claude 消息转换回 OpenAI 格式
 				req.Messages = convertClaudeMessagesToOpenAI(compressedReq.Messages)
 				inputTokens = countOpenAIInputTokens(&req)
-				logger.Info("[智能压缩] OpenAI完成 - Token: %d, 消息数: %d", inputTokens, len(req.Messages))
+				logger.Ctx(c.Request.Context()).Info("[智能压缩] OpenAI完成 - Token: %d, 消息数: %d", inputTokens, len(req.Messages))
 			}
 		}
 	}
 
-	logger.Info("Chat Completions 请求 - 模型: %s, 流式: %v, 消息数: %d, 工具数: %d", req.Model, req.Stream, len(req.Messages), len(req.Tools))
+	// 准入控制：在限流检查之后排队，容量不足时按优先级等待，队列满或超时返回 529
+	release, ok := s.admitRequest(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// 通过准入控制后再选择账号，避免排队期间因暂时无可用账号直接返回 503
+	account := s.acquireAccount(c)
+	if account == nil {
+		return
+	}
+
+	logger.Ctx(c.Request.Context()).Info("Chat Completions 请求 - 模型: %s, 流式: %v, 消息数: %d, 工具数: %d", req.Model, req.Stream, len(req.Messages), len(req.Tools))
 
 	// 被动刷新策略：确保账号可用（刷新令牌和配额）
 	// 执行流程：检查令牌 -> 刷新配额 -> 配额错误时刷新令牌 -> 重试
 	// 整个过程对用户透明无感知
-	account, err = s.EnsureAccountReady(c.Request.Context(), account)
+	readyCtx, readySpan := tracing.Start(c.Request.Context(), tracing.SpanAccountReady, tracing.AttrAccountID.String(account.ID))
+	account, err = s.EnsureAccountReady(readyCtx, account)
+	tracing.End(readySpan, err)
 	if err != nil {
-		logger.Error("账号被动刷新失败: %v", err)
+		logger.Ctx(c.Request.Context()).Error("账号被动刷新失败: %v", err)
 		c.Set("error_message", "账号准备失败: "+err.Error())
 		c.JSON(502, gin.H{"error": "账号准备失败，请稍后重试"})
 		return
 	}
 	if account == nil || account.AccessToken == nil || *account.AccessToken == "" {
-		logger.Error("账号被动刷新后仍无访问令牌")
+		logger.Ctx(c.Request.Context()).Error("账号被动刷新后仍无访问令牌")
 		c.Set("error_message", "账号没有访问令牌，请确保账号有有效的刷新令牌")
 		c.JSON(503, gin.H{"error": "账号没有访问令牌，请确保账号有有效的刷新令牌"})
 		return
@@ -2714,28 +2845,37 @@ func (s *Server) handleChatCompletions(c *gin.Context) {
 	claudeReq := convertOpenAIToClaude(&req)
 	aqPayload, convErr := claude.ConvertClaudeToAmazonQ(claudeReq, conversationID, false)
 	if convErr != nil {
-		logger.Error("请求转换失败 - 错误: %v", convErr)
+		logger.Ctx(c.Request.Context()).Error("请求转换失败 - 错误: %v", convErr)
 		c.Set("error_message", convErr.Error())
 		c.JSON(400, gin.H{"error": convErr.Error()})
 		return
 	}
 
+	if rec := getCapture(c); rec != nil {
+		rec.SetAmazonQPayload(aqPayload)
+	}
+
 	// 设置日志记录所需的信息
 	c.Set("model", req.Model)
 	c.Set("is_stream", req.Stream)
+	tracing.SetAttributes(c.Request.Context(), tracing.AttrModel.String(req.Model), tracing.AttrAccountID.String(account.ID),
+		tracing.AttrStream.Bool(req.Stream), tracing.AttrInputTokens.Int(inputTokens))
 
 	responseID := "chatcmpl-" + uuid.New().String()[:8]
 	machineId := s.ensureAccountMachineID(c.Request.Context(), account)
-	resp, err := s.aqClient.SendChatRequest(c.Request.Context(), *account.AccessToken, machineId, account.ID, aqPayload, logTimestamp)
+	sendCtx, sendSpan := tracing.Start(c.Request.Context(), tracing.SpanUpstream,
+		tracing.AttrAccountID.String(account.ID), tracing.AttrModel.String(req.Model), tracing.AttrInputTokens.Int(inputTokens))
+	resp, err := s.aqClient.SendChatRequest(sendCtx, auth.RegionOf(account.Region), *account.AccessToken, machineId, account.ID, aqPayload, logTimestamp)
+	tracing.End(sendSpan, err)
 	if err != nil {
-		logger.Error("OpenAI 请求失败 - 账号: %s, 错误: %v", account.ID, err)
+		logger.Ctx(c.Request.Context()).Error("OpenAI 请求失败 - 账号: %s, 错误: %v", account.ID, err)
 
 		// 检查是否为不可重试错误
 		if amazonq.IsNonRetriable(err) {
 			if nrErr, ok := err.(*amazonq.NonRetriableError); ok {
 				// 如果是上下文超出错误，打印具体的 token 数量
 				if nrErr.Code == "CONTENT_LENGTH_EXCEEDS_THRESHOLD" || nrErr.Code == "INPUT_TOO_LONG" {
-					logger.Error("【上下文超出】输入 Token: %d, 消息数: %d, 模型: %s", inputTokens, len(req.Messages), req.Model)
+					logger.Ctx(c.Request.Context()).Error("【上下文超出】输入 Token: %d, 消息数: %d, 模型: %s", inputTokens, len(req.Messages), req.Model)
 				}
 				// 请求错误不计入账号统计
 				if !nrErr.IsRequestErr {
@@ -2761,6 +2901,9 @@ func (s *Server) handleChatCompletions(c *gin.Context) {
 		return
 	}
 	defer resp.Body.Close()
+	if rec := getCapture(c); rec != nil {
+		resp.Body = rec.WrapUpstream(resp.Body)
+	}
 
 	if req.Stream {
 		s.handleOpenAIStreamResponse(c, resp, req.Model, responseID, clientIP, startTime, len(req.Messages), account, inputTokens)
@@ -2770,6 +2913,11 @@ func (s *Server) handleChatCompletions(c *gin.Context) {
 }
 
 func (s *Server) handleOpenAIStreamResponse(c *gin.Context, resp *http.Response, model, responseID, clientIP string, startTime time.Time, msgCount int, acc *models.Account, inputTokens int) {
+	// 上游事件流转换 Span
+	_, convertSpan := tracing.Start(c.Request.Context(), tracing.SpanStreamConvert,
+		tracing.AttrAccountID.String(acc.ID), tracing.AttrModel.String(model), tracing.AttrInputTokens.Int(inputTokens))
+	defer convertSpan.End()
+
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
@@ -2784,7 +2932,7 @@ func (s *Server) handleOpenAIStreamResponse(c *gin.Context, resp *http.Response,
 		n, err := reader.Read(buf)
 		if err != nil {
 			if err != io.EOF {
-				logger.Info("读取流错误 - 来源: %s, 错误: %v", clientIP, err)
+				logger.Ctx(c.Request.Context()).Info("读取流错误 - 来源: %s, 错误: %v", clientIP, err)
 			}
 			doneEvent := handler.Finish()
 			if doneEvent != "" {
@@ -2798,14 +2946,16 @@ func (s *Server) handleOpenAIStreamResponse(c *gin.Context, resp *http.Response,
 			outputTokens := handler.OutputTokens()
 			c.Set("input_tokens", inputTokens)
 			c.Set("output_tokens", outputTokens)
+			convertSpan.SetAttributes(tracing.AttrOutputTokens.Int(outputTokens))
+			tracing.SetAttributes(c.Request.Context(), tracing.AttrOutputTokens.Int(outputTokens))
 
-			logger.Info("OpenAI 流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, model, msgCount, inputTokens, outputTokens, duration.Milliseconds())
+			logger.Ctx(c.Request.Context()).Info("OpenAI 流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, model, msgCount, inputTokens, outputTokens, duration.Milliseconds())
 			return false
 		}
 
 		events, err := parser.Feed(buf[:n])
 		if err != nil {
-			logger.Info("解析错误 - 来源: %s, 错误: %v", clientIP, err)
+			logger.Ctx(c.Request.Context()).Info("解析错误 - 来源: %s, 错误: %v", clientIP, err)
 			return false
 		}
 
@@ -2818,7 +2968,7 @@ func (s *Server) handleOpenAIStreamResponse(c *gin.Context, resp *http.Response,
 			var payload map[string]interface{}
 			if len(event.Payload) > 0 {
 				if err := json.Unmarshal(event.Payload, &payload); err != nil {
-					logger.Warn("解析事件 payload 失败: %v", err)
+					logger.Ctx(c.Request.Context()).Warn("解析事件 payload 失败: %v", err)
 				}
 			}
 
@@ -2833,6 +2983,11 @@ func (s *Server) handleOpenAIStreamResponse(c *gin.Context, resp *http.Response,
 }
 
 func (s *Server) handleOpenAINonStreamResponse(c *gin.Context, resp *http.Response, model, responseID, clientIP string, startTime time.Time, acc *models.Account, msgCount int, inputTokens int) {
+	// 上游事件流转换 Span
+	_, convertSpan := tracing.Start(c.Request.Context(), tracing.SpanStreamConvert,
+		tracing.AttrAccountID.String(acc.ID), tracing.AttrModel.String(model), tracing.AttrInputTokens.Int(inputTokens))
+	defer convertSpan.End()
+
 	// 确保响应体被关闭
 	defer resp.Body.Close()
 
@@ -2842,7 +2997,7 @@ func (s *Server) handleOpenAINonStreamResponse(c *gin.Context, resp *http.Respon
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("读取响应体失败: %v", err)
+		logger.Ctx(c.Request.Context()).Error("读取响应体失败: %v", err)
 		c.JSON(500, gin.H{"error": map[string]interface{}{
 			"message": "读取响应失败",
 			"type":    "server_error",
@@ -2851,7 +3006,7 @@ func (s *Server) handleOpenAINonStreamResponse(c *gin.Context, resp *http.Respon
 	}
 	events, err := parser.Feed(body)
 	if err != nil {
-		logger.Error("解析响应事件失败: %v", err)
+		logger.Ctx(c.Request.Context()).Error("解析响应事件失败: %v", err)
 		c.JSON(500, gin.H{"error": map[string]interface{}{
 			"message": "解析响应失败",
 			"type":    "server_error",
@@ -2868,7 +3023,7 @@ func (s *Server) handleOpenAINonStreamResponse(c *gin.Context, resp *http.Respon
 		var payload map[string]interface{}
 		if len(event.Payload) > 0 {
 			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				logger.Warn("解析事件 payload 失败: %v", err)
+				logger.Ctx(c.Request.Context()).Warn("解析事件 payload 失败: %v", err)
 			}
 		}
 
@@ -2941,8 +3096,10 @@ func (s *Server) handleOpenAINonStreamResponse(c *gin.Context, resp *http.Respon
 	// 设置 token 数量用于日志记录
 	c.Set("input_tokens", promptTokens)
 	c.Set("output_tokens", completionTokens)
+	convertSpan.SetAttributes(tracing.AttrOutputTokens.Int(completionTokens))
+	tracing.SetAttributes(c.Request.Context(), tracing.AttrOutputTokens.Int(completionTokens))
 
-	logger.Info("OpenAI 非流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, model, msgCount, promptTokens, completionTokens, duration.Milliseconds())
+	logger.Ctx(c.Request.Context()).Info("OpenAI 非流式响应完成 - 来源: %s, 模型: %s, 消息数: %d, 输入token: %d, 输出token: %d, 耗时: %dms", clientIP, model, msgCount, promptTokens, completionTokens, duration.Milliseconds())
 
 	c.JSON(http.StatusOK, response)
 }
@@ -3207,12 +3364,20 @@ func extractTextFromClaudeContent(content interface{}) string {
 
 // callSummaryAPI 调用 API 生成摘要（用于上下文压缩）
 // @author ygw
-func (s *Server) callSummaryAPI(ctx context.Context, content, model string) (string, error) {
+func (s *Server) callSummaryAPI(ctx context.Context, content, model string) (summary string, err error) {
+	ctx, span := tracing.Start(ctx, tracing.SpanSummary,
+		tracing.AttrModel.String(model), tracing.AttrInputTokens.Int(estimateTokens(content)))
+	defer func() {
+		span.SetAttributes(tracing.AttrOutputTokens.Int(estimateTokens(summary)))
+		tracing.End(span, err)
+	}()
+
 	// 选择一个可用账号
 	acc, err := s.selectAccountExcluding(ctx, nil)
 	if err != nil || acc == nil {
 		return "", fmt.Errorf("无可用账号生成摘要")
 	}
+	span.SetAttributes(tracing.AttrAccountID.String(acc.ID))
 
 	// 确保有访问令牌
 	if acc.AccessToken == nil || *acc.AccessToken == "" {
@@ -3241,7 +3406,7 @@ func (s *Server) callSummaryAPI(ctx context.Context, content, model string) (str
 
 	// 发送请求
 	machineId := s.ensureAccountMachineID(ctx, acc)
-	resp, err := s.aqClient.SendChatRequest(ctx, *acc.AccessToken, machineId, acc.ID, aqPayload, "")
+	resp, err := s.aqClient.SendChatRequest(ctx, auth.RegionOf(acc.Region), *acc.AccessToken, machineId, acc.ID, aqPayload, "")
 	if err != nil {
 		return "", fmt.Errorf("发送请求失败: %w", err)
 	}
@@ -3353,10 +3518,18 @@ func (s *Server) handleGetLogs(c *gin.Context) {
 		}
 	}
 
+	// 查询哪些日志有载荷采集
+	logIDs := make([]string, 0, len(logs))
+	for _, log := range logs {
+		logIDs = append(logIDs, log.ID)
+	}
+	capturedIDs, _ := s.db.GetCapturedLogIDs(c.Request.Context(), logIDs)
+
 	// 为每条日志计算美元成本和用户归属信息
 	// @author ygw
 	for i := range logs {
 		logs[i].CostUSD = logs[i].CalculateCost()
+		logs[i].HasCapture = capturedIDs[logs[i].ID]
 
 		// 填充用户归属信息
 		if logs[i].UserID != nil {
@@ -3522,6 +3695,7 @@ func (s *Server) handleBlockIP(c *gin.Context) {
 
 	// 立即更新缓存
 	s.blockedIPCache.Store(req.IP, true)
+	s.notifyIPBlocked(req.IP, reason)
 
 	logger.Info("IP封禁成功 - IP: %s, 原因: %s", req.IP, reason)
 	c.JSON(200, gin.H{"message": "IP封禁成功", "ip": req.IP})
@@ -3588,6 +3762,7 @@ func (s *Server) handleGetIPConfig(c *gin.Context) {
 			"ip":                  ip,
 			"notes":               nil,
 			"rate_limit_rpm":      0,
+			"rate_limit_tpm":      0,
 			"daily_request_limit": 0,
 		})
 		return
@@ -3969,63 +4144,100 @@ func (s *Server) handleGetOnlineStats(c *gin.Context) {
 	})
 }
 
-// handleAwsLatency 检测服务器到 AWS 的网络延迟
-// 使用 HEAD 请求测量到 Amazon Q 端点的往返时间
+// handleAwsLatency 检测服务器到 AWS 各区域的网络延迟
+// 使用 HEAD 请求测量到各区域 CodeWhisperer 端点的往返时间
 // @author ygw
 func (s *Server) handleAwsLatency(c *gin.Context) {
-	// AWS CodeWhisperer/Amazon Q 端点
-	endpoint := "https://codewhisperer.us-east-1.amazonaws.com"
-	timeout := 10 * time.Second
+	// 待检测区域：已知区域 + 现有账号使用的区域；指定 region 参数时只检测该区域
+	var regions []string
+	if r := c.Query("region"); r != "" {
+		if !auth.ValidRegion(r) {
+			c.JSON(400, gin.H{"error": "无效的区域: " + r})
+			return
+		}
+		regions = []string{auth.NormalizeRegion(r)}
+	} else {
+		regions = s.latencyRegions(c.Request.Context())
+	}
 
 	// 创建带超时的 HTTP 客户端
 	client := &http.Client{
-		Timeout: timeout,
+		Timeout: 10 * time.Second,
 		Transport: &http.Transport{
 			DisableKeepAlives: true, // 每次都建立新连接，测量真实延迟
 		},
 	}
 
-	// 测量延迟
-	startTime := time.Now()
-	req, err := http.NewRequestWithContext(c.Request.Context(), "HEAD", endpoint, nil)
+	// 各区域并发检测
+	results := make([]gin.H, len(regions))
+	done := make(chan struct{}, len(regions))
+	for i, region := range regions {
+		go func(i int, region string) {
+			latency, status := probeLatency(c.Request.Context(), client, auth.CodeWhispererEndpoint(region))
+			results[i] = gin.H{"region": region, "latency": latency, "status": status}
+			done <- struct{}{}
+		}(i, region)
+	}
+	for range regions {
+		<-done
+	}
+
+	// 顶层字段保持为第一个区域（默认区域）的结果，兼容旧版前端
+	c.JSON(200, gin.H{
+		"latency":   results[0]["latency"],
+		"status":    results[0]["status"],
+		"region":    results[0]["region"],
+		"regions":   results,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// latencyRegions 返回需要检测延迟的区域（默认区域排在最前，去重）
+func (s *Server) latencyRegions(ctx context.Context) []string {
+	seen := map[string]bool{auth.DefaultRegion: true}
+	regions := []string{auth.DefaultRegion}
+	add := func(r string) {
+		if !seen[r] {
+			seen[r] = true
+			regions = append(regions, r)
+		}
+	}
+	for _, r := range auth.KnownRegions {
+		add(r)
+	}
+	if accounts, err := s.db.ListAccounts(ctx, nil, "created_at", false); err == nil {
+		for _, acc := range accounts {
+			add(auth.RegionOf(acc.Region))
+		}
+	}
+	return regions
+}
+
+// probeLatency 对端点发起 HEAD 请求测量延迟，失败时延迟为 -1、状态为 error
+func probeLatency(ctx context.Context, client *http.Client, endpoint string) (int64, string) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", endpoint, nil)
 	if err != nil {
-		c.JSON(500, gin.H{
-			"error":   "创建请求失败",
-			"latency": -1,
-			"status":  "error",
-		})
-		return
+		return -1, "error"
 	}
 
+	startTime := time.Now()
 	resp, err := client.Do(req)
 	latency := time.Since(startTime).Milliseconds()
-
 	if err != nil {
 		// 超时或网络错误
-		c.JSON(200, gin.H{
-			"latency": -1,
-			"status":  "error",
-			"message": "连接超时或网络错误",
-		})
-		return
+		return -1, "error"
 	}
-	defer resp.Body.Close()
+	resp.Body.Close()
 
 	// 根据延迟判断状态
-	var status string
-	if latency < 200 {
-		status = "good"
-	} else if latency < 500 {
-		status = "medium"
-	} else {
-		status = "poor"
+	switch {
+	case latency < 200:
+		return latency, "good"
+	case latency < 500:
+		return latency, "medium"
+	default:
+		return latency, "poor"
 	}
-
-	c.JSON(200, gin.H{
-		"latency":   latency,
-		"status":    status,
-		"timestamp": time.Now().Unix(),
-	})
 }
 
 // ==================== 代理池管理 ====================
@@ -4042,7 +4254,18 @@ func (s *Server) handleListProxies(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, gin.H{"proxies": proxies, "total": len(proxies)})
+	// 附带代理池中的运行时健康状态（延迟、摘除状态）
+	items := make([]proxyWithHealth, 0, len(proxies))
+	pool := s.proxyPool
+	for _, p := range proxies {
+		item := proxyWithHealth{Proxy: p}
+		if pool != nil {
+			item.Health = pool.Health(p.URL)
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(200, gin.H{"proxies": items, "total": len(proxies)})
 }
 
 // handleCreateProxy 创建代理
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/capture"
+	"claude-api/internal/claude"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	"claude-api/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// startCapture 判断是否需要采集本次请求，需要则创建采集器并记录入站请求体
+// 用户开启 capture_payloads 时必采；否则按系统设置的采样率采集
+// 采集记录关联请求日志，未开启请求日志时不采集
+// @param c gin 上下文
+// @param body 入站请求体
+// @author ygw
+func (s *Server) startCapture(c *gin.Context, body []byte) {
+	settings, _ := s.settingsCache.Get(c.Request.Context())
+	if settings == nil || !settings.EnableRequestLog {
+		return
+	}
+
+	userOptIn := false
+	if u, ok := c.Get("user"); ok {
+		if user, ok := u.(*models.User); ok && user != nil {
+			userOptIn = user.CapturePayloads
+		}
+	}
+
+	reason := capture.ShouldCapture(userOptIn, settings.CaptureSampleRate)
+	if reason == "" {
+		return
+	}
+
+	rec := capture.NewRecorder(capture.NewRedactor(settings.CaptureRedactKeys, settings.CaptureRedactImages), reason)
+	rec.SetInbound(body)
+	c.Set("capture", rec)
+}
+
+// getCapture 获取当前请求的采集器（未采集返回 nil）
+func getCapture(c *gin.Context) *capture.Recorder {
+	if v, ok := c.Get("capture"); ok {
+		if rec, ok := v.(*capture.Recorder); ok {
+			return rec
+		}
+	}
+	return nil
+}
+
+// finishCapture 请求结束后压缩采集内容并异步写库（采集 ID 由服务端生成，通过 log_id 关联请求日志）
+// @author ygw
+func (s *Server) finishCapture(c *gin.Context) {
+	rec := getCapture(c)
+	if rec == nil {
+		return
+	}
+	logID := c.GetString("log_id")
+	if logID == "" {
+		return
+	}
+
+	snap := rec.Snapshot()
+	record := &models.PayloadCapture{
+		ID:                uuid.New().String(),
+		LogID:             logID,
+		CreatedAt:         models.CurrentTime(),
+		Path:              c.Request.URL.Path,
+		Reason:            rec.Reason(),
+		OriginalSize:      int64(len(snap.Inbound) + len(snap.AmazonQ) + len(snap.Upstream)),
+		UpstreamTruncated: snap.Truncated,
+	}
+	if u, ok := c.Get("user"); ok {
+		if user, ok := u.(*models.User); ok && user != nil {
+			record.UserID = &user.ID
+		}
+	}
+	if a, ok := c.Get("account"); ok {
+		if acc, ok := a.(*models.Account); ok && acc != nil {
+			record.AccountID = &acc.ID
+		}
+	}
+	if m := c.GetString("model"); m != "" {
+		record.Model = &m
+	}
+
+	var err error
+	if record.InboundRequest, err = capture.Compress(snap.Inbound); err != nil {
+		logger.Warn("载荷采集压缩失败: %v", err)
+		return
+	}
+	if record.AmazonQPayload, err = capture.Compress(snap.AmazonQ); err != nil {
+		logger.Warn("载荷采集压缩失败: %v", err)
+		return
+	}
+	if record.UpstreamEvents, err = capture.Compress(snap.Upstream); err != nil {
+		logger.Warn("载荷采集压缩失败: %v", err)
+		return
+	}
+	record.CompressedSize = int64(len(record.InboundRequest) + len(record.AmazonQPayload) + len(record.UpstreamEvents))
+
+	if s.closing.Load() {
+		return
+	}
+	select {
+	case s.dbWriteChan <- dbWriteOp{opType: "capture", data: record}:
+	default:
+		logger.Warn("数据库写队列已满，丢弃载荷采集")
+	}
+}
+
+// decodeUpstreamEvents 解码原始事件流为 [{event_type, payload}] 列表（载荷脱敏）
+func decodeUpstreamEvents(raw []byte, redactor *capture.Redactor) []gin.H {
+	events := make([]gin.H, 0)
+	if len(raw) == 0 {
+		return events
+	}
+	parsed, err := stream.NewEventStreamParser().Feed(raw)
+	if err != nil {
+		logger.Debug("解析采集的上游事件流失败: %v", err)
+	}
+	for _, ev := range parsed {
+		eventType := ev.Headers[":event-type"]
+		if eventType == "" {
+			eventType = ev.Headers["event-type"]
+		}
+		var payload interface{}
+		if err := json.Unmarshal(ev.Payload, &payload); err != nil {
+			payload = string(redactor.RedactText(ev.Payload))
+		} else {
+			payload = redactor.RedactValue(payload)
+		}
+		events = append(events, gin.H{"event_type": eventType, "payload": payload})
+	}
+	return events
+}
+
+// rawJSON 将采集的 JSON 内容原样输出，非法 JSON 时按字符串输出
+func rawJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return string(data)
+}
+
+// captureRedactor 根据当前设置创建脱敏器
+func (s *Server) captureRedactor(ctx context.Context) *capture.Redactor {
+	settings, _ := s.settingsCache.Get(ctx)
+	if settings == nil {
+		return capture.NewRedactor(nil, true)
+	}
+	return capture.NewRedactor(settings.CaptureRedactKeys, settings.CaptureRedactImages)
+}
+
+// handleGetLogCapture 查看请求日志关联的载荷采集
+// GET /v2/logs/:id/capture
+// @author ygw
+func (s *Server) handleGetLogCapture(c *gin.Context) {
+	id := c.Param("id")
+	record, err := s.db.GetPayloadCapture(c.Request.Context(), id)
+	if err != nil {
+		logger.Error("获取载荷采集失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取载荷采集失败"})
+		return
+	}
+	if record == nil {
+		c.JSON(404, gin.H{"error": "该请求没有载荷采集"})
+		return
+	}
+
+	inbound, err1 := capture.Decompress(record.InboundRequest)
+	aqPayload, err2 := capture.Decompress(record.AmazonQPayload)
+	upstream, err3 := capture.Decompress(record.UpstreamEvents)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(500, gin.H{"error": "载荷采集数据已损坏"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"capture":         record,
+		"inbound_request": rawJSON(inbound),
+		"amazonq_payload": rawJSON(aqPayload),
+		"upstream_events": decodeUpstreamEvents(upstream, s.captureRedactor(c.Request.Context())),
+	})
+}
+
+// handleReplayLog 使用指定账号重放采集的请求
+// POST /v2/logs/:id/replay  {"account_id": "...", "dry_run": false}
+// dry_run 只重新执行请求转换并与采集时的 Amazon Q 载荷比对，不发送上游
+// 注意：采集内容已脱敏，图片被替换为占位符时重放结果可能与原请求不同
+// @author ygw
+func (s *Server) handleReplayLog(c *gin.Context) {
+	var body struct {
+		AccountID string `json:"account_id"`
+		DryRun    bool   `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": "无效的请求格式"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	record, err := s.db.GetPayloadCapture(ctx, c.Param("id"))
+	if err != nil {
+		logger.Error("获取载荷采集失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取载荷采集失败"})
+		return
+	}
+	if record == nil {
+		c.JSON(404, gin.H{"error": "该请求没有载荷采集"})
+		return
+	}
+
+	inbound, err := capture.Decompress(record.InboundRequest)
+	if err != nil || len(inbound) == 0 {
+		c.JSON(400, gin.H{"error": "采集中没有可重放的入站请求"})
+		return
+	}
+	originalPayload, _ := capture.Decompress(record.AmazonQPayload)
+
+	// 还原为 Claude 请求
+	var claudeReq *models.ClaudeRequest
+	if record.Path == "/v1/chat/completions" {
+		var openaiReq models.ChatCompletionRequest
+		if err := json.Unmarshal(inbound, &openaiReq); err != nil {
+			c.JSON(400, gin.H{"error": "采集的请求无法解析: " + err.Error()})
+			return
+		}
+		claudeReq = convertOpenAIToClaude(&openaiReq)
+	} else {
+		var req models.ClaudeRequest
+		if err := json.Unmarshal(inbound, &req); err != nil {
+			c.JSON(400, gin.H{"error": "采集的请求无法解析: " + err.Error()})
+			return
+		}
+		claudeReq = &req
+	}
+
+	// 沿用原 conversationId，便于比对转换结果
+	conversationID := ""
+	var original models.AmazonQRequest
+	if json.Unmarshal(originalPayload, &original) == nil {
+		conversationID = original.ConversationState.ConversationID
+	}
+	if conversationID == "" {
+		conversationID = uuid.New().String()
+	}
+
+	aqPayload, err := claude.ConvertClaudeToAmazonQ(claudeReq, conversationID, false)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "请求转换失败: " + err.Error()})
+		return
+	}
+
+	redactor := s.captureRedactor(ctx)
+	newPayloadJSON, _ := json.Marshal(aqPayload)
+	redactedNew := redactor.RedactJSON(newPayloadJSON)
+	result := gin.H{
+		"id":              record.ID,
+		"amazonq_payload": json.RawMessage(redactedNew),
+		"payload_matches": len(originalPayload) > 0 && string(redactedNew) == string(originalPayload),
+	}
+
+	if body.DryRun {
+		c.JSON(200, result)
+		return
+	}
+
+	// 选择账号：指定账号优先，否则按账号池规则选择
+	var acc *models.Account
+	if body.AccountID != "" {
+		acc, err = s.db.GetAccount(ctx, body.AccountID)
+	} else {
+		acc, err = s.selectAccount(ctx)
+	}
+	if err != nil || acc == nil {
+		c.JSON(404, gin.H{"error": "账号不存在或无可用账号"})
+		return
+	}
+	acc, err = s.EnsureAccountReady(ctx, acc)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "账号准备失败: " + err.Error()})
+		return
+	}
+
+	logger.Info("重放请求 - 日志: %s, 账号: %s, 模型: %s", record.ID, acc.ID, claudeReq.Model)
+	startTime := time.Now()
+	machineId := s.ensureAccountMachineID(ctx, acc)
+	resp, err := s.aqClient.SendChatRequest(ctx, auth.RegionOf(acc.Region), *acc.AccessToken, machineId, acc.ID, aqPayload, "")
+	if err != nil {
+		result["account_id"] = acc.ID
+		result["error"] = err.Error()
+		c.JSON(http.StatusBadGateway, result)
+		return
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "读取上游响应失败: " + err.Error()})
+		return
+	}
+
+	events := decodeUpstreamEvents(raw, redactor)
+	text := ""
+	for _, ev := range events {
+		if ev["event_type"] == "assistantResponseEvent" {
+			if p, ok := ev["payload"].(map[string]interface{}); ok {
+				if content, ok := p["content"].(string); ok {
+					text += content
+				}
+			}
+		}
+	}
+
+	result["account_id"] = acc.ID
+	result["duration_ms"] = time.Since(startTime).Milliseconds()
+	result["events"] = events
+	result["text"] = text
+	c.JSON(200, result)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-api/internal/compressor"
+	"claude-api/internal/config"
+	"claude-api/internal/database"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	"claude-api/internal/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 压缩透明度相关请求/响应头
+const (
+	// HeaderSkipCompression 请求头：为 true/1 时本次请求跳过压缩
+	HeaderSkipCompression = "X-Skip-Compression"
+
+	HeaderCompressionApplied        = "X-Compression-Applied" // true / false / bypassed
+	HeaderCompressionOriginalTokens = "X-Compression-Original-Tokens"
+	HeaderCompressionTokens         = "X-Compression-Compressed-Tokens"
+	HeaderCompressionSummaryBlocks  = "X-Compression-Summary-Blocks"
+	HeaderCompressionCacheHit       = "X-Compression-Cache-Hit"
+	HeaderCompressionStrategies     = "X-Compression-Strategies"
+)
+
+// validateCompressionStrategies 校验并规范化设置中的压缩策略链
+func validateCompressionStrategies(updates *models.SettingsUpdate) error {
+	if updates.CompressionStrategies != nil {
+		names, err := compressor.ParseStrategies(strings.Join(*updates.CompressionStrategies, ","))
+		if err != nil {
+			return err
+		}
+		updates.CompressionStrategies = &names
+	}
+	if updates.CompressionModelStrategies != nil {
+		normalized := make(map[string][]string, len(*updates.CompressionModelStrategies))
+		for model, chain := range *updates.CompressionModelStrategies {
+			model = strings.ToLower(strings.TrimSpace(model))
+			if model == "" {
+				continue
+			}
+			names, err := compressor.ParseStrategies(strings.Join(chain, ","))
+			if err != nil {
+				return err
+			}
+			normalized[model] = names
+		}
+		updates.CompressionModelStrategies = &normalized
+	}
+	return nil
+}
+
+// resolveCompressionStrategies 确定本次请求使用的压缩策略链
+// 优先级：用户设置 > 按模型设置（最长匹配的模型名子串）> 全局设置 > 默认（LLM 摘要）
+// @author ygw
+func resolveCompressionStrategies(user *models.User, model string, settings *models.Settings) []string {
+	if user != nil && user.CompressionStrategies != "" {
+		if names, err := compressor.ParseStrategies(user.CompressionStrategies); err == nil && len(names) > 0 {
+			return names
+		}
+	}
+
+	model = strings.ToLower(model)
+	var matched string
+	for key := range settings.CompressionModelStrategies {
+		if strings.Contains(model, key) && len(key) > len(matched) {
+			matched = key
+		}
+	}
+	if matched != "" && len(settings.CompressionModelStrategies[matched]) > 0 {
+		return settings.CompressionModelStrategies[matched]
+	}
+
+	if len(settings.CompressionStrategies) > 0 {
+		return settings.CompressionStrategies
+	}
+	return compressor.DefaultStrategies
+}
+
+// compressClaudeRequest 按策略链压缩请求（未启用压缩、调用方跳过或无需压缩时返回 nil）
+// 策略失败时返回失败前已完成的结果；压缩结果通过 X-Compression-* 响应头返回给客户端，并记录到请求日志
+// @author ygw
+func (s *Server) compressClaudeRequest(c *gin.Context, req *models.ClaudeRequest, settings *models.Settings) (*models.ClaudeRequest, error) {
+	if s.compressor == nil || settings == nil || !settings.CompressionEnabled {
+		return nil, nil
+	}
+	if skipCompression(c) {
+		c.Header(HeaderCompressionApplied, "bypassed")
+		return nil, nil
+	}
+	// 更新压缩器使用的模型
+	if settings.CompressionModel != "" {
+		s.compressor.SetSummaryModel(settings.CompressionModel)
+	}
+
+	var user *models.User
+	if u, ok := c.Get("user"); ok {
+		user, _ = u.(*models.User)
+	}
+	names := resolveCompressionStrategies(user, req.Model, settings)
+
+	compressed, report, err := s.compressor.Run(c.Request.Context(), req, names,
+		func(ctx context.Context, content, model string) (string, error) {
+			return s.callSummaryAPI(ctx, content, model)
+		})
+	if report != nil && compressed != nil {
+		logger.Ctx(c.Request.Context()).Info("[智能压缩] 策略 %s - Token: %d→%d",
+			strings.Join(names, ","), report.TokensBefore, report.TokensAfter)
+	}
+	setCompressionHeaders(c, compressed != nil, report)
+	return compressed, err
+}
+
+// skipCompression 调用方是否通过请求头要求跳过压缩
+func skipCompression(c *gin.Context) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(c.GetHeader(HeaderSkipCompression)))
+	return err == nil && v
+}
+
+// setCompressionHeaders 设置压缩结果响应头（须在写入响应体之前调用），压缩生效时同时写入 gin 上下文供请求日志使用
+func setCompressionHeaders(c *gin.Context, applied bool, report *compressor.Report) {
+	if !applied || report == nil {
+		c.Header(HeaderCompressionApplied, "false")
+		return
+	}
+	c.Header(HeaderCompressionApplied, "true")
+	c.Header(HeaderCompressionOriginalTokens, strconv.Itoa(report.TokensBefore))
+	c.Header(HeaderCompressionTokens, strconv.Itoa(report.TokensAfter))
+	c.Header(HeaderCompressionSummaryBlocks, strconv.Itoa(report.SummaryBlocks))
+	c.Header(HeaderCompressionCacheHit, strconv.FormatBool(report.CacheHit))
+	c.Header(HeaderCompressionStrategies, strings.Join(report.Applied(), ","))
+	c.Set("compression", report)
+}
+
+// newRedisClient 根据配置创建 Redis 客户端（未配置或地址无效时返回 nil）
+func newRedisClient(cfg *config.Config) *redis.Client {
+	if cfg.Redis.URL == "" {
+		return nil
+	}
+	client, err := redis.NewClient(cfg.Redis.URL)
+	if err != nil {
+		logger.Error("创建 Redis 客户端失败: %v", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		logger.Warn("Redis 连接检查失败（将在使用时重试）: %v", err)
+	}
+	return client
+}
+
+// newSummaryCacheStore 根据配置创建压缩摘要缓存存储（配置无效时回退到本地文件存储）
+// @author ygw
+func newSummaryCacheStore(cfg *config.Config, db *database.DB, rdb *redis.Client, compressCfg *compressor.CompressConfig) compressor.CacheStore {
+	switch cfg.SummaryCache.Store {
+	case compressor.StoreDatabase:
+		if db != nil {
+			logger.Info("[智能压缩] 摘要缓存使用数据库存储")
+			return compressor.NewDBStore(db.GetGormDB())
+		}
+	case compressor.StoreRedis:
+		if rdb != nil {
+			logger.Info("[智能压缩] 摘要缓存使用 Redis 存储: %s", rdb.Addr())
+			return compressor.NewRedisStore(rdb, cfg.Redis.KeyPrefix, compressCfg.CacheTTL)
+		}
+		logger.Warn("[智能压缩] 摘要缓存配置为 redis 但未配置 redis.url，使用本地文件存储")
+	case "", compressor.StoreFile:
+	default:
+		logger.Warn("[智能压缩] 未知的摘要缓存存储 %q，使用本地文件存储", cfg.SummaryCache.Store)
+	}
+	return compressor.NewFileStore(compressCfg.CacheDir)
+}
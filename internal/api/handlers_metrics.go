@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/metrics"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 账号指标落库参数
+const (
+	metricsFlushInterval = time.Minute // 内存聚合落库间隔
+	metricsRetentionDays = 90          // 小时快照保留天数
+)
+
+// startMetricsWorker 启动账号指标落库协程（定期把内存聚合结果写入数据库写队列，每天清理一次过期快照）
+// @author ygw
+func (s *Server) startMetricsWorker() {
+	s.metricsDone = make(chan struct{})
+	s.metricsWg.Add(1)
+	go func() {
+		defer s.metricsWg.Done()
+		ticker := time.NewTicker(metricsFlushInterval)
+		defer ticker.Stop()
+		lastCleanup := time.Now()
+
+		for {
+			select {
+			case <-s.metricsDone:
+				return
+			case <-ticker.C:
+				if batch := s.metrics.Drain(); len(batch) > 0 {
+					select {
+					case s.dbWriteChan <- dbWriteOp{opType: "metrics", data: batch}:
+					default:
+						logger.Warn("数据库写队列已满，丢弃账号指标 %d 条", len(batch))
+					}
+				}
+				if time.Since(lastCleanup) >= 24*time.Hour {
+					lastCleanup = time.Now()
+					if n, err := s.db.CleanupOldAccountMetrics(context.Background(), metricsRetentionDays); err != nil {
+						logger.Warn("清理账号指标失败: %v", err)
+					} else if n > 0 {
+						logger.Info("已清理 %d 条过期账号指标", n)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// stopMetricsWorker 停止落库协程并同步写入剩余指标
+func (s *Server) stopMetricsWorker() {
+	if s.metricsDone == nil {
+		return
+	}
+	close(s.metricsDone)
+	s.metricsWg.Wait()
+	if batch := s.metrics.Drain(); len(batch) > 0 {
+		if err := s.db.SaveAccountMetrics(context.Background(), batch); err != nil {
+			logger.Warn("保存账号指标失败: %v", err)
+		}
+	}
+}
+
+// recordRequestMetrics 请求完成时记录账号指标
+// @author ygw
+func (s *Server) recordRequestMetrics(c *gin.Context, duration time.Duration) {
+	v, ok := c.Get("account")
+	if !ok {
+		return
+	}
+	acc, ok := v.(*models.Account)
+	if !ok || acc == nil {
+		return
+	}
+	status := c.Writer.Status()
+	s.metrics.RecordRequest(acc.ID, time.Now(), status >= 200 && status < 300, duration, c.GetInt("input_tokens"), c.GetInt("output_tokens"))
+}
+
+// parseHistoryRange 解析 range（如 24h、7d）和 bucket（1h、6h、1d）查询参数
+func parseHistoryRange(c *gin.Context) (since time.Time, bucket time.Duration) {
+	rng := parseDurationParam(c.DefaultQuery("range", "7d"), 7*24*time.Hour)
+	if rng > metricsRetentionDays*24*time.Hour {
+		rng = metricsRetentionDays * 24 * time.Hour
+	}
+	bucket = parseDurationParam(c.DefaultQuery("bucket", ""), 0)
+	if bucket <= 0 {
+		// 默认粒度：2 天内按小时，更长按天
+		bucket = time.Hour
+		if rng > 48*time.Hour {
+			bucket = 24 * time.Hour
+		}
+	}
+	return time.Now().Add(-rng), bucket
+}
+
+// parseDurationParam 解析时长参数，额外支持 "d" 天单位
+func parseDurationParam(v string, def time.Duration) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return def
+	}
+	if strings.HasSuffix(v, "d") {
+		if d, err := time.ParseDuration(strings.TrimSuffix(v, "d") + "h"); err == nil && d > 0 {
+			return d * 24
+		}
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// handleGetAccountHistory 获取单个账号的指标历史
+// GET /v2/accounts/:id/history?range=7d&bucket=1d
+// @author ygw
+func (s *Server) handleGetAccountHistory(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	acc, err := s.db.GetAccount(ctx, id)
+	if err != nil || acc == nil {
+		c.JSON(404, gin.H{"error": "账号不存在"})
+		return
+	}
+
+	since, bucket := parseHistoryRange(c)
+	rows, err := s.db.GetAccountMetrics(ctx, id, metrics.BucketStart(since))
+	if err != nil {
+		logger.Error("获取账号指标失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取账号指标失败"})
+		return
+	}
+	rows = append(rows, s.pendingMetrics(id)...)
+
+	c.JSON(200, gin.H{
+		"account_id": id,
+		"since":      since.Unix(),
+		"bucket":     int64(bucket / time.Second),
+		"series":     metrics.Series(rows, bucket),
+		"current": gin.H{
+			"status":        acc.Status,
+			"success_count": acc.SuccessCount,
+			"error_count":   acc.ErrorCount,
+			"usage_current": acc.UsageCurrent,
+			"usage_limit":   acc.UsageLimit,
+		},
+	})
+}
+
+// handleGetPoolHistory 获取账号池整体指标历史及耗尽预测
+// GET /v2/accounts/history?range=7d&bucket=1d
+// 预测基于观察窗口内正常账号的配额增长速度，剩余量为正常账号的 limit-current 之和
+// @author ygw
+func (s *Server) handleGetPoolHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	since, bucket := parseHistoryRange(c)
+
+	rows, err := s.db.GetAccountMetrics(ctx, "", metrics.BucketStart(since))
+	if err != nil {
+		logger.Error("获取账号指标失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取账号指标失败"})
+		return
+	}
+	rows = append(rows, s.pendingMetrics("")...)
+
+	accounts, err := s.db.ListAccountsByStatus(ctx, models.AccountStatusNormal, "created_at", false)
+	if err != nil {
+		logger.Error("获取账号列表失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取账号列表失败"})
+		return
+	}
+	normal := make(map[string]bool, len(accounts))
+	quotas := make([]metrics.Quota, 0, len(accounts))
+	for _, acc := range accounts {
+		normal[acc.ID] = true
+		if acc.UsageLimit > 0 {
+			quotas = append(quotas, metrics.Quota{AccountID: acc.ID, UsageCurrent: acc.UsageCurrent, UsageLimit: acc.UsageLimit})
+		}
+	}
+	normalRows := make([]*models.AccountMetric, 0, len(rows))
+	for _, r := range rows {
+		if normal[r.AccountID] {
+			normalRows = append(normalRows, r)
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"since":          since.Unix(),
+		"bucket":         int64(bucket / time.Second),
+		"series":         metrics.Series(rows, bucket),
+		"valid_accounts": len(accounts),
+		"forecast":       metrics.ForecastExhaustion(normalRows, quotas, time.Now()),
+	})
+}
+
+// pendingMetrics 尚未落库的内存指标（只读副本，accountID 为空时返回全部）
+func (s *Server) pendingMetrics(accountID string) []*models.AccountMetric {
+	all := s.metrics.Snapshot()
+	if accountID == "" {
+		return all
+	}
+	out := make([]*models.AccountMetric, 0)
+	for _, m := range all {
+		if m.AccountID == accountID {
+			out = append(out, m)
+		}
+	}
+	return out
+}
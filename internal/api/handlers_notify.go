@@ -0,0 +1,366 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	"claude-api/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// initNotifier 创建通知器、加载渠道并注册账号状态变更回调
+// @author ygw
+func (s *Server) initNotifier() {
+	s.notifier = notify.New(notify.DefaultOptions())
+	s.reloadNotifyChannels()
+	s.db.SetAccountStatusListener(s.onAccountStatusChanged)
+}
+
+// reloadNotifyChannels 重新加载通知渠道
+func (s *Server) reloadNotifyChannels() {
+	channels, err := s.db.GetNotifyChannels(context.Background())
+	if err != nil {
+		logger.Warn("加载通知渠道失败: %v", err)
+		return
+	}
+	s.notifier.SetChannels(channels)
+}
+
+// notify 提交通知事件（去重窗口取自系统设置）
+func (s *Server) notify(ev notify.Event) {
+	if s.notifier == nil {
+		return
+	}
+	if settings, _ := s.settingsCache.Get(context.Background()); settings != nil {
+		s.notifier.SetDedupWindow(time.Duration(settings.NotifyDedupMinutes) * time.Minute)
+	}
+	s.notifier.Notify(ev)
+}
+
+// onAccountStatusChanged 账号状态变更回调：发送状态变更通知并检查账号池水位
+// @author ygw
+func (s *Server) onAccountStatusChanged(id, from, to, reason string) {
+	level := notify.LevelWarning
+	if to == models.AccountStatusNormal {
+		level = notify.LevelInfo
+	}
+	s.notify(notify.Event{
+		Type:     notify.EventAccountStatusChanged,
+		Level:    level,
+		Title:    "账号状态变更",
+		Message:  fmt.Sprintf("账号 %s 状态由 %s 变为 %s", id, from, to),
+		Fields:   map[string]string{"account_id": id, "from": from, "to": to, "reason": reason},
+		DedupKey: id + "|" + to,
+	})
+
+	if to != models.AccountStatusNormal {
+		go s.checkPoolHealth(context.Background())
+	}
+}
+
+// checkPoolHealth 正常账号数低于设置的阈值时发送告警
+// @author ygw
+func (s *Server) checkPoolHealth(ctx context.Context) {
+	settings, _ := s.settingsCache.Get(ctx)
+	if settings == nil || settings.NotifyMinValidAccounts <= 0 {
+		return
+	}
+	count, err := s.countValidAccounts(ctx)
+	if err != nil {
+		logger.Warn("统计有效账号失败: %v", err)
+		return
+	}
+	if count >= settings.NotifyMinValidAccounts {
+		return
+	}
+	s.notify(notify.Event{
+		Type:     notify.EventPoolLowAccounts,
+		Level:    notify.LevelCritical,
+		Title:    "可用账号不足",
+		Message:  fmt.Sprintf("正常状态账号仅剩 %d 个，低于阈值 %d", count, settings.NotifyMinValidAccounts),
+		Fields:   map[string]string{"valid_accounts": fmt.Sprintf("%d", count), "threshold": fmt.Sprintf("%d", settings.NotifyMinValidAccounts)},
+		DedupKey: "pool",
+	})
+}
+
+// notifyRefreshFailed 令牌刷新失败通知
+func (s *Server) notifyRefreshFailed(accountID string, err error) {
+	s.notify(notify.Event{
+		Type:     notify.EventAccountRefreshFailed,
+		Level:    notify.LevelWarning,
+		Title:    "令牌刷新失败",
+		Message:  fmt.Sprintf("账号 %s 刷新令牌失败: %v", accountID, err),
+		Fields:   map[string]string{"account_id": accountID},
+		DedupKey: accountID,
+	})
+}
+
+// notifyQuotaExceeded 用户配额用尽通知
+func (s *Server) notifyQuotaExceeded(user *models.User, reason string) {
+	s.notify(notify.Event{
+		Type:     notify.EventUserQuotaExceeded,
+		Level:    notify.LevelInfo,
+		Title:    "用户配额已用尽",
+		Message:  fmt.Sprintf("用户 %s 配额已用尽: %s", user.Name, reason),
+		Fields:   map[string]string{"user_id": user.ID, "user_name": user.Name, "reason": reason},
+		DedupKey: user.ID + "|" + reason,
+	})
+}
+
+// notifyBudgetWarning 用户消费超过预算预警阈值通知（每个用户每个预算周期只通知一次，记录在消费累计的 warned_at 上）
+func (s *Server) notifyBudgetWarning(ctx context.Context, user *models.User, b budgetStatus) {
+	if s.notifier == nil {
+		return
+	}
+	first, err := s.db.MarkBudgetWarned(ctx, user.ID, b.period, b.start)
+	if err != nil {
+		logger.Ctx(ctx).Warn("标记预算预警失败 - 用户: %s, 错误: %v", user.ID, err)
+		return
+	}
+	if !first {
+		return
+	}
+	key := user.ID + "|" + b.period + "|" + b.start.Format("2006-01-02")
+	s.notify(notify.Event{
+		Type:    notify.EventUserBudgetWarning,
+		Level:   notify.LevelWarning,
+		Title:   "用户消费预算预警",
+		Message: fmt.Sprintf("用户 %s %s消费已达 $%.2f，预算 $%.2f（%.0f%%）", user.Name, b.label, b.spent, b.budget, b.spent/b.budget*100),
+		Fields: map[string]string{
+			"user_id":      user.ID,
+			"user_name":    user.Name,
+			"period":       b.period,
+			"period_start": b.start.Format("2006-01-02"),
+			"spent_usd":    fmt.Sprintf("%.2f", b.spent),
+			"budget_usd":   fmt.Sprintf("%.2f", b.budget),
+		},
+		DedupKey: key,
+	})
+}
+
+// notifyIPBlocked IP 封禁通知
+func (s *Server) notifyIPBlocked(ip, reason string) {
+	s.notify(notify.Event{
+		Type:     notify.EventIPBlocked,
+		Level:    notify.LevelWarning,
+		Title:    "IP 已封禁",
+		Message:  fmt.Sprintf("IP %s 已被封禁: %s", ip, reason),
+		Fields:   map[string]string{"ip": ip, "reason": reason},
+		DedupKey: ip,
+	})
+}
+
+// ==================== 通知渠道管理 ====================
+
+// maskNotifyChannel 返回密钥打码后的渠道副本
+func maskNotifyChannel(ch *models.NotifyChannel) *models.NotifyChannel {
+	masked := *ch
+	if len(masked.Secret) > 6 {
+		masked.Secret = masked.Secret[:3] + "****"
+	} else if masked.Secret != "" {
+		masked.Secret = "****"
+	}
+	return &masked
+}
+
+// validateNotifyChannel 校验渠道配置
+func validateNotifyChannel(ch *models.NotifyChannel) error {
+	if !notify.ValidChannelType(ch.Type) {
+		return fmt.Errorf("不支持的渠道类型: %s", ch.Type)
+	}
+	if ch.Type == notify.ChannelTelegram {
+		if ch.Secret == "" || ch.ChatID == "" {
+			return fmt.Errorf("telegram 渠道需要 secret（bot token）和 chat_id")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(ch.URL, "http://") && !strings.HasPrefix(ch.URL, "https://") {
+		return fmt.Errorf("渠道地址必须以 http:// 或 https:// 开头")
+	}
+	return nil
+}
+
+// handleListNotifyChannels 获取通知渠道列表
+// @author ygw
+func (s *Server) handleListNotifyChannels(c *gin.Context) {
+	channels, err := s.db.GetNotifyChannels(c.Request.Context())
+	if err != nil {
+		logger.Error("获取通知渠道失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取通知渠道失败"})
+		return
+	}
+
+	masked := make([]*models.NotifyChannel, 0, len(channels))
+	for _, ch := range channels {
+		masked = append(masked, maskNotifyChannel(ch))
+	}
+	c.JSON(200, gin.H{
+		"channels":        masked,
+		"total":           len(masked),
+		"supported_types": []string{notify.ChannelWebhook, notify.ChannelSlack, notify.ChannelDingTalk, notify.ChannelFeishu, notify.ChannelTelegram},
+		"event_types": []notify.EventType{
+			notify.EventAccountStatusChanged,
+			notify.EventAccountRefreshFailed,
+			notify.EventPoolLowAccounts,
+			notify.EventUserQuotaExceeded,
+			notify.EventUserBudgetWarning,
+			notify.EventIPBlocked,
+		},
+	})
+}
+
+// handleCreateNotifyChannel 创建通知渠道
+// @author ygw
+func (s *Server) handleCreateNotifyChannel(c *gin.Context) {
+	logger.Info("创建通知渠道 - 来源: %s", c.ClientIP())
+
+	var req models.NotifyChannelCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	ch := &models.NotifyChannel{
+		Name:    req.Name,
+		Type:    strings.ToLower(req.Type),
+		URL:     strings.TrimSpace(req.URL),
+		Secret:  req.Secret,
+		ChatID:  req.ChatID,
+		Events:  strings.Join(req.Events, ","),
+		Enabled: true,
+	}
+	if req.Enabled != nil {
+		ch.Enabled = *req.Enabled
+	}
+	if err := validateNotifyChannel(ch); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.CreateNotifyChannel(c.Request.Context(), ch); err != nil {
+		logger.Error("创建通知渠道失败: %v", err)
+		c.JSON(500, gin.H{"error": "创建通知渠道失败"})
+		return
+	}
+	s.reloadNotifyChannels()
+
+	logger.Info("通知渠道创建成功 - ID: %d, 类型: %s", ch.ID, ch.Type)
+	c.JSON(200, gin.H{"message": "通知渠道创建成功", "channel": maskNotifyChannel(ch)})
+}
+
+// handleUpdateNotifyChannel 更新通知渠道
+// @author ygw
+func (s *Server) handleUpdateNotifyChannel(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req models.NotifyChannelUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	ch, err := s.db.GetNotifyChannelByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "通知渠道不存在"})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		ch.Name = *req.Name
+		updates["name"] = ch.Name
+	}
+	if req.Type != nil {
+		ch.Type = strings.ToLower(*req.Type)
+		updates["type"] = ch.Type
+	}
+	if req.URL != nil {
+		ch.URL = strings.TrimSpace(*req.URL)
+		updates["url"] = ch.URL
+	}
+	if req.Secret != nil {
+		ch.Secret = *req.Secret
+		updates["secret"] = ch.Secret
+	}
+	if req.ChatID != nil {
+		ch.ChatID = *req.ChatID
+		updates["chat_id"] = ch.ChatID
+	}
+	if req.Events != nil {
+		ch.Events = strings.Join(*req.Events, ",")
+		updates["events"] = ch.Events
+	}
+	if req.Enabled != nil {
+		ch.Enabled = *req.Enabled
+		updates["enabled"] = ch.Enabled
+	}
+
+	if len(updates) == 0 {
+		c.JSON(400, gin.H{"error": "没有要更新的字段"})
+		return
+	}
+	if err := validateNotifyChannel(ch); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.UpdateNotifyChannel(c.Request.Context(), id, updates); err != nil {
+		logger.Error("更新通知渠道失败 - ID: %d, 错误: %v", id, err)
+		c.JSON(500, gin.H{"error": "更新通知渠道失败"})
+		return
+	}
+	s.reloadNotifyChannels()
+
+	logger.Info("通知渠道更新成功 - ID: %d", id)
+	c.JSON(200, gin.H{"message": "通知渠道更新成功"})
+}
+
+// handleDeleteNotifyChannel 删除通知渠道
+// @author ygw
+func (s *Server) handleDeleteNotifyChannel(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	if err := s.db.DeleteNotifyChannel(c.Request.Context(), id); err != nil {
+		logger.Error("删除通知渠道失败 - ID: %d, 错误: %v", id, err)
+		c.JSON(500, gin.H{"error": "删除通知渠道失败"})
+		return
+	}
+	s.reloadNotifyChannels()
+
+	logger.Info("通知渠道删除成功 - ID: %d", id)
+	c.JSON(200, gin.H{"message": "通知渠道删除成功"})
+}
+
+// handleTestNotifyChannel 向指定渠道发送测试通知（同步发送，返回投递结果）
+// @author ygw
+func (s *Server) handleTestNotifyChannel(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	ch, err := s.db.GetNotifyChannelByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "通知渠道不存在"})
+		return
+	}
+
+	ev := notify.Event{
+		Type:    "test",
+		Level:   notify.LevelInfo,
+		Title:   "测试通知",
+		Message: "这是一条来自 claude-api 的测试通知",
+		Fields:  map[string]string{"channel": ch.Name},
+	}
+	if err := s.notifier.Send(c.Request.Context(), ch, ev); err != nil {
+		logger.Warn("测试通知发送失败 - ID: %d, 错误: %v", id, err)
+		c.JSON(502, gin.H{"error": "测试通知发送失败: " + err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"message": "测试通知已发送"})
+}
@@ -0,0 +1,394 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 批量设备授权参数
+const (
+	deviceBatchMaxCount    = 100 // 单批最多发起的设备授权数
+	deviceBatchConcurrency = 8   // 同时向 OIDC 发起注册/授权的请求数
+)
+
+// deviceSessionView 设备授权会话的展示信息（附带剩余有效秒数）
+type deviceSessionView struct {
+	*models.DeviceAuthSession
+	Remaining int `json:"remaining"`
+}
+
+// newDeviceSessionViews 构造会话展示列表
+func newDeviceSessionViews(sessions []*models.DeviceAuthSession, now time.Time) []deviceSessionView {
+	views := make([]deviceSessionView, 0, len(sessions))
+	for _, sess := range sessions {
+		v := deviceSessionView{DeviceAuthSession: sess}
+		if expiresAt, err := time.Parse(models.TimeFormat, sess.ExpiresAt); err == nil && sess.Status == models.DeviceAuthPending {
+			if v.Remaining = int(expiresAt.Sub(now).Seconds()); v.Remaining < 0 {
+				v.Remaining = 0
+			}
+		}
+		views = append(views, v)
+	}
+	return views
+}
+
+// handleDeviceBatchStart 批量发起设备授权
+// 每个授权注册独立的 OIDC 客户端和 machineId，会话持久化后在后台并发轮询，用户完成授权后自动创建账号
+// @author ygw
+func (s *Server) handleDeviceBatchStart(c *gin.Context) {
+	var req models.DeviceAuthBatchCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+	if req.Count <= 0 || req.Count > deviceBatchMaxCount {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("数量必须在 1 到 %d 之间", deviceBatchMaxCount)})
+		return
+	}
+	if !auth.ValidRegion(req.Region) {
+		c.JSON(400, gin.H{"error": "无效的区域: " + req.Region})
+		return
+	}
+	region := auth.NormalizeRegion(req.Region)
+	startURL := auth.StartURLOf(&req.StartURL)
+
+	logger.Info("批量发起设备授权 - 数量: %d, 区域: %s, 来源: %s", req.Count, region, c.ClientIP())
+
+	// 检查账号数量限制（计入仍在等待授权的会话）
+	ctx := c.Request.Context()
+	existingAccounts, err := s.db.ListAccounts(ctx, nil, "created_at", false)
+	if err != nil {
+		logger.Error("获取现有账号列表失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取现有账号列表失败"})
+		return
+	}
+	pending, err := s.db.ListDeviceAuthSessions(ctx, "", models.DeviceAuthPending)
+	if err != nil {
+		logger.Error("获取待授权会话失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取待授权会话失败"})
+		return
+	}
+	maxAccounts := s.cfg.GetMaxAccounts()
+	if len(existingAccounts)+len(pending)+req.Count > maxAccounts {
+		c.JSON(403, gin.H{
+			"error": fmt.Sprintf("已达账号数量上限 %d（现有 %d 个，待授权 %d 个）", maxAccounts, len(existingAccounts), len(pending)),
+			"code":  "ACCOUNT_LIMIT_REACHED",
+		})
+		return
+	}
+
+	batchID := uuid.New().String()
+	enabled := req.Enabled == nil || *req.Enabled
+	sessions := make([]*models.DeviceAuthSession, req.Count)
+	errs := make([]error, req.Count)
+	sem := make(chan struct{}, deviceBatchConcurrency)
+	done := make(chan struct{}, req.Count)
+	for i := 0; i < req.Count; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var label *string
+			if req.LabelPrefix != nil && *req.LabelPrefix != "" {
+				label = strPtr(fmt.Sprintf("%s #%d", *req.LabelPrefix, i+1))
+			}
+			sessions[i], errs[i] = s.startDeviceSession(ctx, batchID, label, enabled, region, startURL)
+		}(i)
+	}
+	for i := 0; i < req.Count; i++ {
+		<-done
+	}
+
+	var started []*models.DeviceAuthSession
+	var failures []string
+	for i, sess := range sessions {
+		if errs[i] != nil {
+			failures = append(failures, errs[i].Error())
+			continue
+		}
+		started = append(started, sess)
+		go s.pollDeviceSession(sess)
+	}
+	if len(started) == 0 {
+		c.JSON(502, gin.H{"error": fmt.Sprintf("OIDC error: %s", failures[0]), "failures": failures})
+		return
+	}
+
+	logger.Info("批量设备授权已发起 - 批次: %s, 成功: %d, 失败: %d", batchID, len(started), len(failures))
+	c.JSON(200, gin.H{
+		"batchId":  batchID,
+		"sessions": newDeviceSessionViews(started, time.Now()),
+		"failures": failures,
+	})
+}
+
+// startDeviceSession 注册 OIDC 客户端、发起设备授权并保存会话
+func (s *Server) startDeviceSession(ctx context.Context, batchID string, label *string, enabled bool, region, startURL string) (*models.DeviceAuthSession, error) {
+	machineID := auth.GenerateKiroMachineID()
+	clientID, clientSecret, err := s.oidcClient.RegisterClient(ctx, region, machineID)
+	if err != nil {
+		return nil, err
+	}
+	devResp, err := s.oidcClient.DeviceAuthorize(ctx, region, startURL, clientID, clientSecret, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, _ := devResp["deviceCode"].(string)
+	userCode, _ := devResp["userCode"].(string)
+	verificationURI, _ := devResp["verificationUriComplete"].(string)
+	interval, _ := devResp["interval"].(float64)
+	expiresIn, _ := devResp["expiresIn"].(float64)
+	if deviceCode == "" {
+		return nil, fmt.Errorf("设备授权响应缺少 deviceCode")
+	}
+	if expiresIn <= 0 {
+		expiresIn = 600
+	}
+
+	sess := &models.DeviceAuthSession{
+		ID:                      uuid.New().String(),
+		BatchID:                 batchID,
+		ClientID:                clientID,
+		ClientSecret:            clientSecret,
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURIComplete: verificationURI,
+		Interval:                int(interval),
+		ExpiresAt:               time.Now().Add(time.Duration(expiresIn) * time.Second).Format(models.TimeFormat),
+		Label:                   label,
+		Enabled:                 enabled,
+		Status:                  models.DeviceAuthPending,
+		MachineID:               machineID,
+		Region:                  region,
+		StartURL:                startURL,
+	}
+	if err := s.db.CreateDeviceAuthSession(ctx, sess); err != nil {
+		return nil, fmt.Errorf("保存设备授权会话失败: %w", err)
+	}
+	return sess, nil
+}
+
+// pollDeviceSession 后台轮询单个设备授权会话，用户完成授权后创建账号
+// 同一会话只会有一个轮询任务（多实例部署时通过协调后端加锁）；会话被取消时轮询随之停止
+func (s *Server) pollDeviceSession(sess *models.DeviceAuthSession) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, loaded := s.devicePolls.LoadOrStore(sess.ID, cancel); loaded {
+		return
+	}
+	defer s.devicePolls.Delete(sess.ID)
+
+	expiresAt, err := time.Parse(models.TimeFormat, sess.ExpiresAt)
+	remaining := int(time.Until(expiresAt).Seconds())
+	if err != nil || remaining <= 0 {
+		s.finishDeviceSession(sess, models.DeviceAuthTimeout, "设备码已过期", nil)
+		return
+	}
+
+	if s.coord != nil {
+		release, ok, err := s.coord.TryLock(ctx, "device_auth:"+sess.ID, time.Duration(remaining)*time.Second+time.Minute)
+		if err != nil {
+			logger.Warn("获取设备授权会话锁失败，直接轮询 - 会话: %s, 错误: %v", sess.ID, err)
+		} else if !ok {
+			logger.Debug("设备授权会话 %s 已由其他实例轮询，跳过", sess.ID)
+			return
+		} else {
+			defer release()
+		}
+	}
+
+	tokens, err := s.oidcClient.PollToken(ctx, sess.Region, sess.ClientID, sess.ClientSecret, sess.DeviceCode, sess.MachineID, sess.Interval, remaining)
+	if ctx.Err() != nil {
+		return // 已取消
+	}
+	if err != nil {
+		status := models.DeviceAuthError
+		if msg := strings.ToLower(err.Error()); strings.Contains(msg, "timeout") || strings.Contains(msg, "expired") {
+			status = models.DeviceAuthTimeout
+		}
+		s.finishDeviceSession(sess, status, err.Error(), nil)
+		return
+	}
+
+	account, err := newDeviceAccount(tokens, sess.Label, sess.Enabled, sess.ClientID, sess.ClientSecret, sess.MachineID, sess.Region, sess.StartURL)
+	if err != nil {
+		s.finishDeviceSession(sess, models.DeviceAuthError, fmt.Sprintf("创建账号失败: %v", err), nil)
+		return
+	}
+
+	// 先把会话从等待状态原子地认领为创建中，再创建账号；会话已被取消或已由其他实例完成时不创建账号
+	claimed, err := s.db.FinishDeviceAuthSession(context.Background(), sess.ID, map[string]interface{}{
+		"status":     models.DeviceAuthCreating,
+		"account_id": account.ID,
+	})
+	if err != nil {
+		logger.Error("认领设备授权会话失败 - 会话: %s, 错误: %v", sess.ID, err)
+		return
+	}
+	if !claimed {
+		logger.Warn("设备授权会话已不在等待状态，不创建账号 - 会话: %s", sess.ID)
+		return
+	}
+
+	if err := s.db.CreateAccount(context.Background(), account); err != nil {
+		s.completeDeviceSession(sess.ID, models.DeviceAuthError, fmt.Sprintf("创建账号失败: %v", err))
+		return
+	}
+	s.completeDeviceSession(sess.ID, models.DeviceAuthCompleted, "")
+	s.InvalidateAccountCache(context.Background())
+	logger.Info("批量设备授权完成 - 会话: %s, 账号: %s", sess.ID, account.ID)
+}
+
+// completeDeviceSession 记录已认领（创建中）会话的账号创建结果
+func (s *Server) completeDeviceSession(id, status, errMsg string) {
+	updates := map[string]interface{}{"status": status}
+	if errMsg != "" {
+		updates["error"] = errMsg
+		logger.Warn("批量设备授权失败 - 会话: %s, 原因: %s", id, errMsg)
+	}
+	if _, err := s.db.TransitionDeviceAuthSession(context.Background(), id, models.DeviceAuthCreating, updates); err != nil {
+		logger.Error("保存设备授权会话状态失败 - 会话: %s, 错误: %v", id, err)
+	}
+}
+
+// finishDeviceSession 记录会话的最终状态，只有仍在等待授权的会话会被更新
+// @return bool 会话已被取消或已由其他实例完成时为 false
+func (s *Server) finishDeviceSession(sess *models.DeviceAuthSession, status, errMsg string, accountID *string) bool {
+	updates := map[string]interface{}{"status": status}
+	if errMsg != "" {
+		updates["error"] = errMsg
+	}
+	if accountID != nil {
+		updates["account_id"] = *accountID
+	}
+	updated, err := s.db.FinishDeviceAuthSession(context.Background(), sess.ID, updates)
+	if err != nil {
+		// 数据库异常时无法判断会话状态，保留本次结果
+		logger.Error("保存设备授权会话状态失败 - 会话: %s, 错误: %v", sess.ID, err)
+		return true
+	}
+	if !updated {
+		logger.Warn("设备授权会话已不在等待状态，忽略本次结果 - 会话: %s, 状态: %s", sess.ID, status)
+		return false
+	}
+	if errMsg != "" {
+		logger.Warn("批量设备授权失败 - 会话: %s, 状态: %s, 原因: %s", sess.ID, status, errMsg)
+	}
+	return true
+}
+
+// handleDeviceBatchStatus 查询批次中全部会话的授权地址、用户码、过期时间和状态
+// @author ygw
+func (s *Server) handleDeviceBatchStatus(c *gin.Context) {
+	batchID := c.Param("batchId")
+	sessions, err := s.db.ListDeviceAuthSessions(c.Request.Context(), batchID, "")
+	if err != nil {
+		logger.Error("获取设备授权会话失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取设备授权会话失败"})
+		return
+	}
+	if len(sessions) == 0 {
+		c.JSON(404, gin.H{"error": "批次不存在"})
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, sess := range sessions {
+		counts[sess.Status]++
+	}
+	c.JSON(200, gin.H{
+		"batchId":  batchID,
+		"sessions": newDeviceSessionViews(sessions, time.Now()),
+		"counts":   counts,
+		"total":    len(sessions),
+	})
+}
+
+// handleListDeviceSessions 列出设备授权会话（默认只列出等待授权的会话，?status=all 列出全部）
+// @author ygw
+func (s *Server) handleListDeviceSessions(c *gin.Context) {
+	status := c.DefaultQuery("status", models.DeviceAuthPending)
+	if status == "all" {
+		status = ""
+	}
+	sessions, err := s.db.ListDeviceAuthSessions(c.Request.Context(), c.Query("batchId"), status)
+	if err != nil {
+		logger.Error("获取设备授权会话失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取设备授权会话失败"})
+		return
+	}
+	c.JSON(200, gin.H{"sessions": newDeviceSessionViews(sessions, time.Now()), "total": len(sessions)})
+}
+
+// handleDeviceBatchCancel 取消批次中仍在等待授权的会话
+// @author ygw
+func (s *Server) handleDeviceBatchCancel(c *gin.Context) {
+	batchID := c.Param("batchId")
+	sessions, err := s.db.ListDeviceAuthSessions(c.Request.Context(), batchID, models.DeviceAuthPending)
+	if err != nil {
+		logger.Error("获取设备授权会话失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取设备授权会话失败"})
+		return
+	}
+	cancelled, err := s.db.CancelDeviceAuthBatch(c.Request.Context(), batchID)
+	if err != nil {
+		logger.Error("取消设备授权批次失败: %v", err)
+		c.JSON(500, gin.H{"error": "取消设备授权批次失败"})
+		return
+	}
+	for _, sess := range sessions {
+		if cancel, ok := s.devicePolls.Load(sess.ID); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+	logger.Info("设备授权批次已取消 - 批次: %s, 取消会话: %d", batchID, cancelled)
+	c.JSON(200, gin.H{"message": "已取消", "cancelled": cancelled})
+}
+
+// ResumeDeviceAuthSessions 启动时恢复等待授权的设备授权会话的后台轮询，已过期的会话标记为超时
+// 创建账号过程中被中断的会话按账号是否已写入标记为完成或失败
+// @author ygw
+func (s *Server) ResumeDeviceAuthSessions(ctx context.Context) {
+	creating, err := s.db.ListDeviceAuthSessions(ctx, "", models.DeviceAuthCreating)
+	if err != nil {
+		logger.Error("恢复设备授权会话失败: %v", err)
+		return
+	}
+	for _, sess := range creating {
+		if sess.AccountID != nil {
+			acc, err := s.db.GetAccount(ctx, *sess.AccountID)
+			if err != nil {
+				logger.Error("恢复设备授权会话失败 - 会话: %s, 错误: %v", sess.ID, err)
+				continue
+			}
+			if acc != nil {
+				s.completeDeviceSession(sess.ID, models.DeviceAuthCompleted, "")
+				continue
+			}
+		}
+		s.completeDeviceSession(sess.ID, models.DeviceAuthError, "创建账号时服务中断")
+	}
+
+	sessions, err := s.db.ListDeviceAuthSessions(ctx, "", models.DeviceAuthPending)
+	if err != nil {
+		logger.Error("恢复设备授权会话失败: %v", err)
+		return
+	}
+	if len(sessions) > 0 {
+		logger.Info("恢复 %d 个等待授权的设备授权会话", len(sessions))
+	}
+	for _, sess := range sessions {
+		go s.pollDeviceSession(sess)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	proxypool "claude-api/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 代理健康检查参数
+const (
+	proxyHealthInterval    = time.Minute // 主动探测间隔
+	proxyHealthConcurrency = 8           // 同时探测的代理数
+)
+
+// proxyWithHealth 代理列表项：数据库记录 + 运行时健康状态
+type proxyWithHealth struct {
+	*models.Proxy
+	Health *proxypool.Health `json:"health,omitempty"`
+}
+
+// proxyProbeTarget 探测目标：默认区域 Amazon Q 上游的 host:port
+func proxyProbeTarget() string {
+	u, err := url.Parse(auth.AmazonQEndpoint(auth.DefaultRegion))
+	if err != nil || u.Host == "" {
+		return "q.us-east-1.amazonaws.com:443"
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
+
+// BackgroundProxyHealthCheck 后台任务：定期通过每个启用的代理建立到上游的隧道，记录延迟
+// 连续失败的代理被暂时摘除，恢复后自动重新参与选择
+// @author ygw
+func (s *Server) BackgroundProxyHealthCheck(ctx context.Context) {
+	ticker := time.NewTicker(proxyHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkProxyHealth(ctx)
+		}
+	}
+}
+
+// checkProxyHealth 并发探测代理池中全部启用的代理
+func (s *Server) checkProxyHealth(ctx context.Context) {
+	pool := s.proxyPool
+	if pool == nil || !s.cfg.ProxyPoolEnabled {
+		return
+	}
+	urls := pool.EnabledURLs()
+	if len(urls) == 0 {
+		return
+	}
+
+	target := proxyProbeTarget()
+	sem := make(chan struct{}, proxyHealthConcurrency)
+	done := make(chan struct{}, len(urls))
+	for _, u := range urls {
+		go func(u string) {
+			defer func() { done <- struct{}{} }()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			latency, err := proxypool.Probe(ctx, u, target)
+			if pool.RecordProbe(u, latency, err) {
+				logger.Warn("[代理健康检查] 代理连续探测失败已暂时摘除: %s - %v", u, err)
+			}
+		}(u)
+	}
+	for range urls {
+		<-done
+	}
+}
+
+// handleTestProxy 立即测试代理连通性并返回延迟
+// 代理在代理池中时同时更新其健康状态
+// @author ygw
+func (s *Server) handleTestProxy(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	logger.Info("测试代理 - ID: %d, 来源: %s", id, c.ClientIP())
+
+	proxy, err := s.db.GetProxyByID(c.Request.Context(), id)
+	if err != nil {
+		logger.Error("获取代理失败 - ID: %d, 错误: %v", id, err)
+		c.JSON(404, gin.H{"error": "代理不存在"})
+		return
+	}
+
+	latency, err := proxypool.Probe(c.Request.Context(), proxy.URL, proxyProbeTarget())
+	resp := gin.H{"success": err == nil, "latency_ms": latency.Milliseconds()}
+	if err != nil {
+		resp["error"] = err.Error()
+		resp["latency_ms"] = -1
+	}
+	if pool := s.proxyPool; pool != nil {
+		pool.RecordProbe(proxy.URL, latency, err)
+		if h := pool.Health(proxy.URL); h != nil {
+			resp["health"] = h
+		}
+	}
+	c.JSON(200, resp)
+}
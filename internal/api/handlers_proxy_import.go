@@ -0,0 +1,418 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"claude-api/internal/database"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	proxypool "claude-api/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 代理订阅参数
+const (
+	proxySubCheckInterval   = time.Minute      // 检查订阅是否到期的间隔
+	proxySubDefaultInterval = 60               // 默认同步间隔（分钟）
+	proxySubFetchTimeout    = 30 * time.Second // 拉取订阅超时
+	proxySubMaxSize         = 4 << 20          // 订阅内容最大字节数
+)
+
+// handleImportProxies 批量导入代理（换行分隔，支持 URL、host:port、host:port:user:pass）
+// @author ygw
+func (s *Server) handleImportProxies(c *gin.Context) {
+	logger.Info("批量导入代理 - 来源: %s", c.ClientIP())
+
+	var req models.ProxyImport
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+	if !proxypool.ValidScheme(req.Scheme) {
+		c.JSON(400, gin.H{"error": "不支持的代理协议: " + req.Scheme})
+		return
+	}
+
+	tmpl := models.Proxy{Name: req.Name, Enabled: true, Weight: 1}
+	if req.Enabled != nil {
+		tmpl.Enabled = *req.Enabled
+	}
+	if req.Weight != nil && *req.Weight > 0 {
+		tmpl.Weight = *req.Weight
+	}
+
+	lines := proxypool.ParseProxyList(req.Text, req.Scheme)
+	if err := s.db.ImportProxies(c.Request.Context(), lines, tmpl); err != nil {
+		logger.Error("批量导入代理失败: %v", err)
+		c.JSON(500, gin.H{"error": "批量导入代理失败"})
+		return
+	}
+
+	counts := countImportLines(lines)
+	if counts[proxypool.ImportCreated] > 0 {
+		s.reloadProxyPool()
+	}
+
+	logger.Info("批量导入代理完成 - 新建: %d, 已存在: %d, 重复: %d, 无效: %d",
+		counts[proxypool.ImportCreated], counts[proxypool.ImportExisting], counts[proxypool.ImportDuplicate], counts[proxypool.ImportInvalid])
+	c.JSON(200, gin.H{
+		"created":   counts[proxypool.ImportCreated],
+		"existing":  counts[proxypool.ImportExisting],
+		"duplicate": counts[proxypool.ImportDuplicate],
+		"invalid":   counts[proxypool.ImportInvalid],
+		"results":   lines,
+	})
+}
+
+// countImportLines 按状态统计导入结果
+func countImportLines(lines []proxypool.ImportLine) map[string]int {
+	counts := make(map[string]int)
+	for _, l := range lines {
+		counts[l.Status]++
+	}
+	return counts
+}
+
+// ==================== 代理订阅 ====================
+
+// handleListProxySubscriptions 获取代理订阅列表
+// @author ygw
+func (s *Server) handleListProxySubscriptions(c *gin.Context) {
+	subs, err := s.db.GetProxySubscriptions(c.Request.Context())
+	if err != nil {
+		logger.Error("获取代理订阅列表失败: %v", err)
+		c.JSON(500, gin.H{"error": "获取代理订阅列表失败"})
+		return
+	}
+	c.JSON(200, gin.H{"subscriptions": subs, "total": len(subs)})
+}
+
+// handleCreateProxySubscription 创建代理订阅并立即同步一次
+// @author ygw
+func (s *Server) handleCreateProxySubscription(c *gin.Context) {
+	logger.Info("创建代理订阅 - 来源: %s", c.ClientIP())
+
+	var req models.ProxySubscriptionCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+	if !proxypool.ValidScheme(req.Scheme) {
+		c.JSON(400, gin.H{"error": "不支持的代理协议: " + req.Scheme})
+		return
+	}
+
+	if err := validateProxySubSource(strings.TrimSpace(req.Source), s.cfg.ProxySubscription.FileDir); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := &models.ProxySubscription{
+		Name:     req.Name,
+		Source:   strings.TrimSpace(req.Source),
+		Scheme:   req.Scheme,
+		Interval: proxySubDefaultInterval,
+		Enabled:  true,
+	}
+	if sub.Name == "" {
+		sub.Name = sub.Source
+	}
+	if req.Interval != nil && *req.Interval > 0 {
+		sub.Interval = *req.Interval
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+	if err := s.db.CreateProxySubscription(c.Request.Context(), sub); err != nil {
+		logger.Error("创建代理订阅失败: %v", err)
+		c.JSON(500, gin.H{"error": "创建代理订阅失败"})
+		return
+	}
+
+	lines, result, err := s.syncProxySubscription(c.Request.Context(), sub)
+	resp := gin.H{"message": "代理订阅创建成功", "subscription": sub, "sync": result, "results": lines}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	c.JSON(200, resp)
+}
+
+// handleUpdateProxySubscription 更新代理订阅
+// @author ygw
+func (s *Server) handleUpdateProxySubscription(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req models.ProxySubscriptionUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Source != nil {
+		source := strings.TrimSpace(*req.Source)
+		if err := validateProxySubSource(source, s.cfg.ProxySubscription.FileDir); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		updates["source"] = source
+	}
+	if req.Scheme != nil {
+		if !proxypool.ValidScheme(*req.Scheme) {
+			c.JSON(400, gin.H{"error": "不支持的代理协议: " + *req.Scheme})
+			return
+		}
+		updates["scheme"] = *req.Scheme
+	}
+	if req.Interval != nil && *req.Interval > 0 {
+		updates["interval_minutes"] = *req.Interval
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+	if len(updates) == 0 {
+		c.JSON(400, gin.H{"error": "没有要更新的字段"})
+		return
+	}
+
+	if err := s.db.UpdateProxySubscription(c.Request.Context(), id, updates); err != nil {
+		logger.Error("更新代理订阅失败 - ID: %d, 错误: %v", id, err)
+		c.JSON(500, gin.H{"error": "更新代理订阅失败"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "代理订阅更新成功"})
+}
+
+// handleDeleteProxySubscription 删除代理订阅及其同步的代理
+// @author ygw
+func (s *Server) handleDeleteProxySubscription(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	logger.Info("删除代理订阅 - ID: %d, 来源: %s", id, c.ClientIP())
+
+	if err := s.db.DeleteProxySubscription(c.Request.Context(), id); err != nil {
+		logger.Error("删除代理订阅失败 - ID: %d, 错误: %v", id, err)
+		c.JSON(500, gin.H{"error": "删除代理订阅失败"})
+		return
+	}
+	s.reloadProxyPool()
+	c.JSON(200, gin.H{"message": "代理订阅删除成功"})
+}
+
+// handleSyncProxySubscription 立即同步代理订阅，返回每行的导入结果
+// @author ygw
+func (s *Server) handleSyncProxySubscription(c *gin.Context) {
+	var id int64
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	sub, err := s.db.GetProxySubscriptionByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "代理订阅不存在"})
+		return
+	}
+
+	lines, result, err := s.syncProxySubscription(c.Request.Context(), sub)
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error(), "results": lines})
+		return
+	}
+	c.JSON(200, gin.H{"sync": result, "results": lines})
+}
+
+// BackgroundProxySubscriptions 后台任务：按各订阅的同步间隔拉取代理列表并同步到代理表
+// @author ygw
+func (s *Server) BackgroundProxySubscriptions(ctx context.Context) {
+	ticker := time.NewTicker(proxySubCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			subs, err := s.db.GetProxySubscriptions(ctx)
+			if err != nil {
+				logger.Error("[代理订阅] 获取订阅列表失败: %v", err)
+				continue
+			}
+			now := time.Now()
+			for _, sub := range subs {
+				if sub.Enabled && proxySubscriptionDue(sub, now) {
+					s.syncProxySubscription(ctx, sub)
+				}
+			}
+		}
+	}
+}
+
+// proxySubscriptionDue 订阅是否到了同步时间
+func proxySubscriptionDue(sub *models.ProxySubscription, now time.Time) bool {
+	last, err := time.Parse(models.TimeFormat, sub.LastSyncAt)
+	if err != nil {
+		return true
+	}
+	interval := sub.Interval
+	if interval <= 0 {
+		interval = proxySubDefaultInterval
+	}
+	return !now.Before(last.Add(time.Duration(interval) * time.Minute))
+}
+
+// syncProxySubscription 拉取订阅内容并与代理表比对同步，同步结果记录到订阅
+// 内容中没有任何有效代理时视为拉取失败，不删除已有代理
+func (s *Server) syncProxySubscription(ctx context.Context, sub *models.ProxySubscription) ([]proxypool.ImportLine, *database.ProxySyncResult, error) {
+	lines, result, err := s.doSyncProxySubscription(ctx, sub)
+
+	updates := map[string]interface{}{"last_sync_at": models.CurrentTime(), "last_error": ""}
+	if err != nil {
+		logger.Warn("[代理订阅] 同步失败 - %s: %v", sub.Name, err)
+		updates["last_error"] = err.Error()
+	} else {
+		logger.Info("[代理订阅] 同步完成 - %s: 新增 %d, 移除 %d, 保留 %d, 无效 %d", sub.Name, result.Added, result.Removed, result.Kept, result.Invalid)
+		updates["last_added"] = result.Added
+		updates["last_removed"] = result.Removed
+		updates["last_kept"] = result.Kept
+		updates["last_invalid"] = result.Invalid
+		if result.Added > 0 || result.Removed > 0 {
+			s.reloadProxyPool()
+		}
+	}
+	if uerr := s.db.UpdateProxySubscription(ctx, sub.ID, updates); uerr != nil {
+		logger.Error("[代理订阅] 保存同步结果失败 - %s: %v", sub.Name, uerr)
+	}
+	return lines, result, err
+}
+
+// doSyncProxySubscription 拉取、解析并同步订阅
+func (s *Server) doSyncProxySubscription(ctx context.Context, sub *models.ProxySubscription) ([]proxypool.ImportLine, *database.ProxySyncResult, error) {
+	text, err := fetchProxySubscription(ctx, sub.Source, s.cfg.ProxySubscription.FileDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := proxypool.ParseProxyList(text, sub.Scheme)
+	valid := false
+	for _, l := range lines {
+		if l.Status != proxypool.ImportInvalid {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return lines, nil, fmt.Errorf("订阅内容中没有有效的代理")
+	}
+	result, err := s.db.SyncSubscriptionProxies(ctx, sub, lines)
+	if err != nil {
+		return lines, nil, fmt.Errorf("同步代理失败: %w", err)
+	}
+	return lines, result, nil
+}
+
+// validateProxySubSource 校验订阅地址：http/https URL，或订阅文件目录 fileDir 内的文件路径
+func validateProxySubSource(source, fileDir string) error {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		if u, err := url.Parse(source); err != nil || u.Host == "" {
+			return fmt.Errorf("订阅地址格式错误: %s", source)
+		}
+		return nil
+	}
+	_, err := proxySubFilePath(source, fileDir)
+	return err
+}
+
+// proxySubFilePath 将文件订阅源（相对路径、绝对路径或 file:// 地址）解析为订阅文件目录内的相对路径
+// 未配置订阅文件目录时不允许文件订阅，目录外的路径一律拒绝
+func proxySubFilePath(source, fileDir string) (string, error) {
+	if fileDir == "" {
+		return "", fmt.Errorf("订阅地址必须是 http/https URL（未配置 proxy_subscription.file_dir，不支持文件订阅）")
+	}
+	path := strings.TrimPrefix(source, "file://")
+	if strings.Contains(path, "://") {
+		return "", fmt.Errorf("不支持的订阅地址: %s", source)
+	}
+	if filepath.IsAbs(path) {
+		dir, err := filepath.Abs(fileDir)
+		if err != nil {
+			return "", fmt.Errorf("解析订阅文件目录失败: %w", err)
+		}
+		if path, err = filepath.Rel(dir, filepath.Clean(path)); err != nil {
+			return "", fmt.Errorf("订阅文件必须位于 %s 目录内", fileDir)
+		}
+	}
+	path = filepath.Clean(path)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("订阅文件必须位于 %s 目录内", fileDir)
+	}
+	return path, nil
+}
+
+// fetchProxySubscription 读取订阅内容：http/https 地址通过 GET 拉取，其他视为订阅文件目录内的文件
+// 超过 proxySubMaxSize 时返回错误（避免截断后误删代理）
+func fetchProxySubscription(ctx context.Context, source, fileDir string) (string, error) {
+	if err := validateProxySubSource(source, fileDir); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return readProxySubFile(source, fileDir)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, proxySubFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", fmt.Errorf("订阅地址格式错误: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("拉取订阅失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("拉取订阅失败: HTTP %d", resp.StatusCode)
+	}
+	return readProxySubContent(resp.Body)
+}
+
+// readProxySubFile 读取订阅文件目录内的订阅文件（通过 os.Root 打开，符号链接也不能指向目录外）
+func readProxySubFile(source, fileDir string) (string, error) {
+	path, err := proxySubFilePath(source, fileDir)
+	if err != nil {
+		return "", err
+	}
+	root, err := os.OpenRoot(fileDir)
+	if err != nil {
+		return "", fmt.Errorf("打开订阅文件目录失败: %w", err)
+	}
+	defer root.Close()
+	f, err := root.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("读取订阅文件失败: %w", err)
+	}
+	defer f.Close()
+	return readProxySubContent(f)
+}
+
+// readProxySubContent 读取订阅内容，超过 proxySubMaxSize 时返回错误
+func readProxySubContent(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, proxySubMaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("读取订阅内容失败: %w", err)
+	}
+	if len(data) > proxySubMaxSize {
+		return "", fmt.Errorf("订阅内容超过 %d 字节上限", proxySubMaxSize)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-api/internal/database"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	"claude-api/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上下文键
+const (
+	tpmReservationsKey    = "tpm_reservations"   // 本次请求的 token 预占
+	requestLimitStatusKey = "ratelimit_requests" // 最严格的请求数限制状态
+	tokenLimitStatusKey   = "ratelimit_tokens"   // 最严格的 token 限制状态
+)
+
+// limitStatus 一个限制维度的当前状态（用于限流响应头）
+type limitStatus struct {
+	Limit     int
+	Remaining int
+	Reset     time.Duration // 额度完全恢复所需时间
+}
+
+// tpmLimit 一个 token 限流维度
+type tpmLimit struct {
+	key   string // 限流键
+	limit int    // 每分钟 token 上限
+	scope string // 日志与错误信息中的维度名
+}
+
+// isOpenAIPath 判断是否为 OpenAI 兼容接口（决定响应头与错误格式）
+func isOpenAIPath(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/v1/chat/completions")
+}
+
+// recordLimitStatus 记录限制状态，同一类型只保留剩余额度最少的一个（相同时取恢复更晚的）
+func recordLimitStatus(c *gin.Context, key string, st limitStatus) {
+	if st.Limit <= 0 {
+		return
+	}
+	if st.Remaining < 0 {
+		st.Remaining = 0
+	}
+	if v, ok := c.Get(key); ok {
+		prev := v.(limitStatus)
+		if prev.Remaining < st.Remaining || (prev.Remaining == st.Remaining && prev.Reset >= st.Reset) {
+			return
+		}
+	}
+	c.Set(key, st)
+}
+
+// untilTomorrow 距离明天 0 点的时间（每日配额重置）
+func untilTomorrow(now time.Time) time.Duration {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+// untilNextMonth 距离下月 1 日 0 点的时间（月度配额重置）
+func untilNextMonth(now time.Time) time.Duration {
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+// checkRequestRateLimit 每分钟请求数限流
+// 优先级：指定IP单独频率限制 > 用户单独频率限制 > 系统统一IP频率限制
+// 通过时记录限制状态用于响应头，超限时返回 429，返回 false 表示请求已被拒绝
+// @author ygw
+func (s *Server) checkRequestRateLimit(c *gin.Context, user *models.User) bool {
+	clientIP := c.ClientIP()
+	ctx := c.Request.Context()
+
+	var result ratelimit.RateLimitResult
+	var message string
+	if ipConfig, err := s.ipConfigCache.Get(ctx, clientIP); err == nil && ipConfig != nil && ipConfig.RateLimitRPM > 0 {
+		// 1. 最高优先级：指定IP有单独设置，跳过后续限制检查
+		result = s.rateLimiter.CheckIP(clientIP, ipConfig.RateLimitRPM)
+		if !result.Allowed {
+			logger.Ctx(ctx).Warn("指定IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
+			message = fmt.Sprintf("请求过于频繁，请稍后重试（指定IP限制：%d 次/分钟）", result.Limit)
+		}
+	} else if user != nil && user.RateLimitRPM > 0 {
+		// 2. 次优先级：用户设置了单独的频率限制，跳过系统统一IP限制
+		// 按用户 ID 计数，避免 API Key 明文出现在共享计数器的键名中
+		result = s.rateLimiter.CheckAPIKey("user:"+user.ID, user.RateLimitRPM)
+		if !result.Allowed {
+			logger.Ctx(ctx).Warn("API Key 限流触发 - 用户: %s (%s), 请求数: %d, 限制: %d/分钟", user.Name, user.ID, result.Count, result.Limit)
+			message = fmt.Sprintf("请求过于频繁，请稍后重试（API Key限制：%d 次/分钟）", result.Limit)
+		}
+	} else if settings, err := s.settingsCache.Get(ctx); err == nil && settings != nil && settings.EnableIPRateLimit && settings.IPRateLimitMax > 0 {
+		// 3. 最低优先级：系统统一 IP 限流
+		result = s.rateLimiter.CheckIP(clientIP, settings.IPRateLimitMax)
+		if !result.Allowed {
+			logger.Ctx(ctx).Warn("系统IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
+			message = fmt.Sprintf("请求过于频繁，请稍后重试（IP限制：%d 次/分钟）", result.Limit)
+		}
+	} else {
+		return true
+	}
+
+	recordLimitStatus(c, requestLimitStatusKey, limitStatus{Limit: result.Limit, Remaining: result.Remaining, Reset: result.Reset})
+	if !result.Allowed {
+		abortRateLimited(c, result.RetryAfter, message)
+		return false
+	}
+	return true
+}
+
+// checkUserQuota 检查指定IP每日请求限制和用户配额（每日请求次数、每日/月度 token）
+// 通过时记录各配额状态用于响应头，用尽时返回 429（retry-after 为配额重置时间），返回 false 表示请求已被拒绝
+// @author ygw
+func (s *Server) checkUserQuota(c *gin.Context, user *models.User) bool {
+	ctx := c.Request.Context()
+	clientIP := c.ClientIP()
+	now := time.Now()
+
+	// 每日请求限制检查：指定IP每日限制 > 用户每日请求限制 @author ygw
+	if ipConfig, err := s.ipConfigCache.Get(ctx, clientIP); err == nil && ipConfig != nil && ipConfig.DailyRequestLimit > 0 {
+		allowed, count, err := s.db.CheckIPDailyLimit(ctx, clientIP, ipConfig.DailyRequestLimit)
+		if err != nil {
+			logger.Error("检查IP每日请求限制失败: %v - IP: %s", err, clientIP)
+			// 出错时不阻止请求
+		} else {
+			recordLimitStatus(c, requestLimitStatusKey, limitStatus{Limit: ipConfig.DailyRequestLimit, Remaining: ipConfig.DailyRequestLimit - int(count) - 1, Reset: untilTomorrow(now)})
+			if !allowed {
+				reason := fmt.Sprintf("IP每日请求次数已用尽 (%d/%d 次)", count, ipConfig.DailyRequestLimit)
+				logger.Ctx(ctx).Warn("IP每日请求限制触发 - IP: %s, 已请求: %d, 限制: %d", clientIP, count, ipConfig.DailyRequestLimit)
+				abortQuotaExceeded(c, untilTomorrow(now), reason)
+				return false
+			}
+		}
+	}
+
+	if user.RequestQuota <= 0 && user.DailyQuota <= 0 && user.MonthlyQuota <= 0 && user.DailyBudgetUSD <= 0 && user.MonthlyBudgetUSD <= 0 {
+		return true
+	}
+	usage, err := s.db.GetUserQuotaUsage(ctx, user)
+	if err != nil {
+		logger.Ctx(ctx).Error("检查用户配额失败: %v - 用户: %s", err, user.ID)
+		c.Set("error_message", "内部服务器错误")
+		c.AbortWithStatusJSON(500, gin.H{"error": "内部服务器错误"})
+		return false
+	}
+
+	// 按检查顺序：每日请求次数 > 每日 token > 月度 token > 每日预算 > 月度预算
+	var reason string
+	var retryAfter time.Duration
+	if user.RequestQuota > 0 {
+		reset := untilTomorrow(now)
+		recordLimitStatus(c, requestLimitStatusKey, limitStatus{Limit: user.RequestQuota, Remaining: user.RequestQuota - int(usage.DailyRequests) - 1, Reset: reset})
+		if reason == "" && usage.DailyRequests >= int64(user.RequestQuota) {
+			reason, retryAfter = fmt.Sprintf("每日请求次数已用尽 (%d/%d 次)", usage.DailyRequests, user.RequestQuota), reset
+		}
+	}
+	if user.DailyQuota > 0 {
+		reset := untilTomorrow(now)
+		recordLimitStatus(c, tokenLimitStatusKey, limitStatus{Limit: user.DailyQuota, Remaining: user.DailyQuota - int(usage.DailyTokens), Reset: reset})
+		if reason == "" && usage.DailyTokens >= int64(user.DailyQuota) {
+			reason, retryAfter = fmt.Sprintf("每日配额已用尽 (%d/%d tokens)", usage.DailyTokens, user.DailyQuota), reset
+		}
+	}
+	if user.MonthlyQuota > 0 {
+		reset := untilNextMonth(now)
+		recordLimitStatus(c, tokenLimitStatusKey, limitStatus{Limit: user.MonthlyQuota, Remaining: user.MonthlyQuota - int(usage.MonthlyTokens), Reset: reset})
+		if reason == "" && usage.MonthlyTokens >= int64(user.MonthlyQuota) {
+			reason, retryAfter = fmt.Sprintf("月度配额已用尽 (%d/%d tokens)", usage.MonthlyTokens, user.MonthlyQuota), reset
+		}
+	}
+
+	// 美元预算：达到预算时拒绝，超过软限制阈值时预警
+	var warnings []string
+	for _, b := range budgetStatuses(user, usage, s.db.BudgetPeriod(), now) {
+		if b.spent >= b.budget {
+			if reason == "" {
+				reason, retryAfter = fmt.Sprintf("%s预算已用尽 ($%.2f/$%.2f)", b.label, b.spent, b.budget), b.reset.Sub(now)
+			}
+			continue
+		}
+		if b.spent >= b.budget*float64(s.cfg.Budget.SoftLimitPercent)/100 {
+			warnings = append(warnings, b.warning())
+			s.notifyBudgetWarning(ctx, user, b)
+		}
+	}
+	if len(warnings) > 0 {
+		c.Header(budgetWarningHeader, strings.Join(warnings, ", "))
+	}
+
+	if reason != "" {
+		logger.Ctx(ctx).Warn("用户配额已用尽 - 用户: %s (%s) - 原因: %s - 来源: %s", user.Name, user.ID, reason, clientIP)
+		s.notifyQuotaExceeded(user, reason)
+		abortQuotaExceeded(c, retryAfter, "配额已用尽: "+reason)
+		return false
+	}
+	return true
+}
+
+// budgetWarningHeader 消费超过预算预警阈值时返回的响应头
+const budgetWarningHeader = "x-budget-warning"
+
+// budgetStatus 一个美元预算维度在当前周期内的消费
+type budgetStatus struct {
+	period string    // daily / monthly
+	label  string    // 错误信息和通知中的维度名
+	spent  float64   // 当前周期消费（美元）
+	budget float64   // 预算（美元）
+	start  time.Time // 周期起始时间
+	reset  time.Time // 周期重置时间
+}
+
+// warning 预警响应头内容，如 monthly 85% ($42.50/$50.00)
+func (b budgetStatus) warning() string {
+	return fmt.Sprintf("%s %.0f%% ($%.2f/$%.2f)", b.period, b.spent/b.budget*100, b.spent, b.budget)
+}
+
+// budgetStatuses 返回用户设置了预算的维度（每日、月度）
+func budgetStatuses(user *models.User, usage *models.UserQuotaUsage, period database.BudgetPeriod, now time.Time) []budgetStatus {
+	var statuses []budgetStatus
+	if user.DailyBudgetUSD > 0 {
+		statuses = append(statuses, budgetStatus{
+			period: models.SpendPeriodDaily, label: "每日", spent: usage.DailyCostUSD, budget: user.DailyBudgetUSD,
+			start: period.DailyStart(now), reset: period.NextDailyReset(now),
+		})
+	}
+	if user.MonthlyBudgetUSD > 0 {
+		statuses = append(statuses, budgetStatus{
+			period: models.SpendPeriodMonthly, label: "月度", spent: usage.MonthlyCostUSD, budget: user.MonthlyBudgetUSD,
+			start: period.MonthlyStart(now), reset: period.NextMonthlyReset(now),
+		})
+	}
+	return statuses
+}
+
+// tpmLimits 返回本次请求适用的 token 限流维度：用户、指定IP、全局
+func (s *Server) tpmLimits(c *gin.Context) []tpmLimit {
+	var limits []tpmLimit
+	if v, ok := c.Get("user"); ok {
+		if u, ok := v.(*models.User); ok && u != nil && u.RateLimitTPM > 0 {
+			limits = append(limits, tpmLimit{key: "user:" + u.ID, limit: u.RateLimitTPM, scope: "用户"})
+		}
+	}
+	clientIP := c.ClientIP()
+	if ipConfig, err := s.ipConfigCache.Get(c.Request.Context(), clientIP); err == nil && ipConfig != nil && ipConfig.RateLimitTPM > 0 {
+		limits = append(limits, tpmLimit{key: "ip:" + clientIP, limit: ipConfig.RateLimitTPM, scope: "指定IP"})
+	}
+	if settings, err := s.settingsCache.Get(c.Request.Context()); err == nil && settings != nil && settings.GlobalRateLimitTPM > 0 {
+		limits = append(limits, tpmLimit{key: "global", limit: settings.GlobalRateLimitTPM, scope: "全局"})
+	}
+	return limits
+}
+
+// admitTokens 按预估输入 token 预占各维度的 TPM 额度，通过后写入限流响应头
+// 任一维度超限时释放已预占的额度并返回 429，返回 false 表示请求已被拒绝
+// 调用方需在请求结束后调用 reconcileTokens 按实际用量修正
+// @author ygw
+func (s *Server) admitTokens(c *gin.Context, inputTokens int) bool {
+	if consoleMode, ok := c.Get("console_mode"); ok && consoleMode == true {
+		return true
+	}
+
+	limits := s.tpmLimits(c)
+	reservations := make([]*ratelimit.Reservation, 0, len(limits))
+	for _, l := range limits {
+		result, r := s.tokenLimiter.Reserve(l.key, inputTokens, l.limit)
+		recordLimitStatus(c, tokenLimitStatusKey, limitStatus{Limit: result.Limit, Remaining: result.Remaining, Reset: result.Reset})
+		if !result.Allowed {
+			for _, prev := range reservations {
+				prev.Release()
+			}
+			logger.Ctx(c.Request.Context()).Warn("%s TPM 限流触发 - 键: %s, 已用: %d, 本次预估: %d, 限制: %d/分钟",
+				l.scope, l.key, result.Used, inputTokens, result.Limit)
+			abortRateLimited(c, result.RetryAfter,
+				fmt.Sprintf("token 用量超出限制（%s限制：%d tokens/分钟）", l.scope, result.Limit))
+			return false
+		}
+		reservations = append(reservations, r)
+	}
+	if len(reservations) > 0 {
+		c.Set(tpmReservationsKey, reservations)
+	}
+	setRateLimitHeaders(c)
+	return true
+}
+
+// reconcileTokens 请求结束后按实际 token 用量修正预占（失败的请求释放预占）
+func (s *Server) reconcileTokens(c *gin.Context) {
+	v, ok := c.Get(tpmReservationsKey)
+	if !ok {
+		return
+	}
+	reservations, _ := v.([]*ratelimit.Reservation)
+	actual := 0
+	if c.Writer.Status() < 400 {
+		actual = c.GetInt("input_tokens") + c.GetInt("output_tokens")
+	}
+	for _, r := range reservations {
+		r.Reconcile(actual)
+	}
+}
+
+// setRateLimitHeaders 按上下文中记录的限制状态写入限流响应头
+// Claude 接口：anthropic-ratelimit-{requests,tokens}-{limit,remaining,reset}，reset 为 RFC3339 时间
+// OpenAI 接口：x-ratelimit-{limit,remaining,reset}-{requests,tokens}，reset 为时长（如 6m0s）
+func setRateLimitHeaders(c *gin.Context) {
+	for _, kind := range []struct{ key, name string }{
+		{requestLimitStatusKey, "requests"},
+		{tokenLimitStatusKey, "tokens"},
+	} {
+		v, ok := c.Get(kind.key)
+		if !ok {
+			continue
+		}
+		st := v.(limitStatus)
+		if isOpenAIPath(c) {
+			c.Header("x-ratelimit-limit-"+kind.name, strconv.Itoa(st.Limit))
+			c.Header("x-ratelimit-remaining-"+kind.name, strconv.Itoa(st.Remaining))
+			c.Header("x-ratelimit-reset-"+kind.name, st.Reset.Round(time.Millisecond).String())
+			continue
+		}
+		c.Header("anthropic-ratelimit-"+kind.name+"-limit", strconv.Itoa(st.Limit))
+		c.Header("anthropic-ratelimit-"+kind.name+"-remaining", strconv.Itoa(st.Remaining))
+		c.Header("anthropic-ratelimit-"+kind.name+"-reset", time.Now().Add(st.Reset).UTC().Format(time.RFC3339))
+	}
+}
+
+// abortRateLimited 限流拒绝（429 rate_limit_error）
+func abortRateLimited(c *gin.Context, retryAfter time.Duration, message string) {
+	abortTooManyRequests(c, retryAfter, message, "rate_limit_error", "rate_limit_exceeded")
+}
+
+// abortQuotaExceeded 配额用尽拒绝（429，OpenAI 格式使用 insufficient_quota）
+func abortQuotaExceeded(c *gin.Context, retryAfter time.Duration, message string) {
+	abortTooManyRequests(c, retryAfter, message, "insufficient_quota", "insufficient_quota")
+}
+
+// abortTooManyRequests 写入限流响应头和 retry-after（秒，向上取整），按接口格式返回 429 错误体
+func abortTooManyRequests(c *gin.Context, retryAfter time.Duration, message, openAIType, openAICode string) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	setRateLimitHeaders(c)
+	c.Header("retry-after", strconv.Itoa(seconds))
+	c.Set("error_message", message)
+	if isOpenAIPath(c) {
+		c.AbortWithStatusJSON(429, gin.H{"error": gin.H{
+			"message": message,
+			"type":    openAIType,
+			"code":    openAICode,
+		}})
+		return
+	}
+	c.AbortWithStatusJSON(429, gin.H{"type": "error", "error": gin.H{
+		"type":    "rate_limit_error",
+		"message": message,
+	}})
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-api/internal/database"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用量报表参数
+const (
+	reportMaxDays        = 366              // 单次查询最大天数
+	reportDefaultGroupBy = "user,model,day" // 默认分组维度
+	reportCheckInterval  = time.Hour        // 月度报表检查间隔
+	reportDateLayout     = "2006-01-02"     // 查询参数日期格式
+	reportMonthLayout    = "2006-01"        // 月度报表文件名中的月份格式
+)
+
+// reportFormats 支持的导出格式及其 Content-Type
+var reportFormats = map[string]string{
+	"json":  "application/json; charset=utf-8",
+	"csv":   "text/csv; charset=utf-8",
+	"tsv":   "text/tab-separated-values; charset=utf-8",
+	"jsonl": "application/x-ndjson; charset=utf-8",
+}
+
+// parseReportGroupBy 解析并校验分组维度（逗号分隔，去重保序）
+func parseReportGroupBy(raw string) ([]string, error) {
+	var groupBy []string
+	seen := make(map[string]bool)
+	for _, g := range strings.Split(raw, ",") {
+		g = strings.ToLower(strings.TrimSpace(g))
+		if g == "" || seen[g] {
+			continue
+		}
+		switch g {
+		case models.ReportGroupUser, models.ReportGroupModel, models.ReportGroupDay, models.ReportGroupMonth:
+		default:
+			return nil, fmt.Errorf("不支持的分组维度: %s", g)
+		}
+		seen[g] = true
+		groupBy = append(groupBy, g)
+	}
+	return groupBy, nil
+}
+
+// defaultReportSource 未指定数据来源时：按模型分组使用请求日志，否则使用长期保留的每日用量表
+func defaultReportSource(groupBy []string) string {
+	for _, g := range groupBy {
+		if g == models.ReportGroupModel {
+			return models.ReportSourceLogs
+		}
+	}
+	return models.ReportSourceUsage
+}
+
+// reportLocation 解析报表时区，为空时使用配置的报表时区或服务器本地时区
+func (s *Server) reportLocation(name string) (*time.Location, error) {
+	if name == "" && s.cfg != nil {
+		name = s.cfg.Reports.Timezone
+	}
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// handleUsageReport 导出用量报表
+// 参数：from / to（YYYY-MM-DD，均含）、group_by（user,model,day,month）、tz、source（logs / usage）、format（json / csv / tsv / jsonl）
+// @author ygw
+func (s *Server) handleUsageReport(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	contentType, ok := reportFormats[format]
+	if !ok {
+		c.JSON(400, gin.H{"error": "不支持的格式，可选 json、csv、tsv、jsonl"})
+		return
+	}
+
+	groupBy, err := parseReportGroupBy(c.DefaultQuery("group_by", reportDefaultGroupBy))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	source := c.DefaultQuery("source", defaultReportSource(groupBy))
+
+	loc, err := s.reportLocation(c.Query("tz"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "无效的时区: " + c.Query("tz")})
+		return
+	}
+	if source == models.ReportSourceUsage {
+		// 每日用量表按服务器本地日期记录
+		loc = time.Local
+	}
+
+	from, err := time.ParseInLocation(reportDateLayout, c.Query("from"), loc)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "from 参数格式应为 YYYY-MM-DD"})
+		return
+	}
+	to, err := time.ParseInLocation(reportDateLayout, c.Query("to"), loc)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "to 参数格式应为 YYYY-MM-DD"})
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+	if !to.After(from) || to.Sub(from) > reportMaxDays*24*time.Hour {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("日期范围无效，最多 %d 天", reportMaxDays)})
+		return
+	}
+
+	q := &database.UsageReportQuery{From: from, To: to, Location: loc, GroupBy: groupBy, Source: source}
+	rows, err := s.db.GetUsageReport(c.Request.Context(), q)
+	if err != nil {
+		logger.Error("生成用量报表失败: %v", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("导出用量报表 - 范围: %s ~ %s, 分组: %v, 来源: %s, 格式: %s, 行数: %d - 来源IP: %s",
+		c.Query("from"), c.Query("to"), groupBy, source, format, len(rows), c.ClientIP())
+
+	if format == "json" {
+		c.JSON(200, gin.H{
+			"from":     c.Query("from"),
+			"to":       c.Query("to"),
+			"timezone": loc.String(),
+			"group_by": groupBy,
+			"source":   source,
+			"rows":     rows,
+			"total":    len(rows),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("usage-%s-%s.%s", c.Query("from"), c.Query("to"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(200)
+	if err := writeUsageReport(c.Writer, format, groupBy, rows); err != nil {
+		logger.Warn("写出用量报表失败: %v", err)
+	}
+}
+
+// reportColumns 报表列：分组维度列在前，用量列在后
+func reportColumns(groupBy []string) []string {
+	var cols []string
+	for _, g := range groupBy {
+		if g == models.ReportGroupUser {
+			cols = append(cols, "user_id", "user_name")
+			continue
+		}
+		cols = append(cols, g)
+	}
+	return append(cols, "requests", "input_tokens", "output_tokens", "total_tokens", "cost_usd")
+}
+
+// reportCell 取一行中指定列的值
+func reportCell(row *models.UsageReportRow, col string) string {
+	switch col {
+	case "day":
+		return row.Day
+	case "month":
+		return row.Month
+	case "user_id":
+		return row.UserID
+	case "user_name":
+		return row.UserName
+	case "model":
+		return row.Model
+	case "requests":
+		return strconv.FormatInt(row.Requests, 10)
+	case "input_tokens":
+		return strconv.FormatInt(row.InputTokens, 10)
+	case "output_tokens":
+		return strconv.FormatInt(row.OutputTokens, 10)
+	case "total_tokens":
+		return strconv.FormatInt(row.TotalTokens, 10)
+	case "cost_usd":
+		return strconv.FormatFloat(row.CostUSD, 'f', 6, 64)
+	}
+	return ""
+}
+
+// writeUsageReport 按格式写出报表（csv / tsv 带表头，jsonl 每行一个 JSON 对象）
+func writeUsageReport(w io.Writer, format string, groupBy []string, rows []*models.UsageReportRow) error {
+	if format == "jsonl" {
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	if format == "tsv" {
+		cw.Comma = '\t'
+	}
+	cols := reportColumns(groupBy)
+	if err := cw.Write(cols); err != nil {
+		return err
+	}
+	record := make([]string, len(cols))
+	for _, row := range rows {
+		for i, col := range cols {
+			record[i] = reportCell(row, col)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// BackgroundMonthlyReports 后台任务：每月初把上月用量报表写入配置的目录
+// 生成两份报表：按用户汇总（每日用量表，长期保留）和按用户 + 模型汇总（请求日志）
+// @author ygw
+func (s *Server) BackgroundMonthlyReports(ctx context.Context) {
+	if s.cfg.Reports.Dir == "" {
+		return
+	}
+	s.writeMonthlyReports(ctx, time.Now()) // 启动后立即补生成一次
+
+	ticker := time.NewTicker(reportCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.writeMonthlyReports(ctx, time.Now())
+		}
+	}
+}
+
+// writeMonthlyReports 生成 now 所在月份的上一个月的报表，文件已存在时跳过
+func (s *Server) writeMonthlyReports(ctx context.Context, now time.Time) {
+	format := s.cfg.Reports.Format
+	if _, ok := reportFormats[format]; !ok || format == "json" {
+		format = "csv"
+	}
+	loc, err := s.reportLocation("")
+	if err != nil {
+		loc = time.Local
+	}
+	if err := os.MkdirAll(s.cfg.Reports.Dir, 0755); err != nil {
+		logger.Error("[月度报表] 创建目录失败: %v", err)
+		return
+	}
+
+	for _, r := range []struct {
+		suffix  string
+		groupBy []string
+		source  string
+		loc     *time.Location
+	}{
+		{"", []string{models.ReportGroupUser}, models.ReportSourceUsage, time.Local},
+		{"-models", []string{models.ReportGroupUser, models.ReportGroupModel}, models.ReportSourceLogs, loc},
+	} {
+		t := now.In(r.loc)
+		to := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, r.loc)
+		from := to.AddDate(0, -1, 0)
+		path := filepath.Join(s.cfg.Reports.Dir, fmt.Sprintf("usage-%s%s.%s", from.Format(reportMonthLayout), r.suffix, format))
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		rows, err := s.db.GetUsageReport(ctx, &database.UsageReportQuery{From: from, To: to, Location: r.loc, GroupBy: r.groupBy, Source: r.source})
+		if err != nil {
+			logger.Error("[月度报表] 生成 %s 失败: %v", path, err)
+			continue
+		}
+		if err := writeReportFile(path, format, r.groupBy, rows); err != nil {
+			logger.Error("[月度报表] 写入 %s 失败: %v", path, err)
+			continue
+		}
+		logger.Info("[月度报表] 已生成 %s（%d 行）", path, len(rows))
+	}
+}
+
+// writeReportFile 先写临时文件再重命名，避免留下不完整的报表
+func writeReportFile(path, format string, groupBy []string, rows []*models.UsageReportRow) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := writeUsageReport(f, format, groupBy, rows); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/ssocache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ssoCacheMaxUpload SSO 缓存导入的上传大小上限
+const ssoCacheMaxUpload = 32 << 20
+
+// handleImportSSOCache 从上传的 ~/.aws/sso/cache 文件导入账号
+// multipart/form-data：任意字段名上传多个 JSON 文件（kiro-auth-token.json、客户端注册文件、AWS CLI SSO 令牌），
+// dryRun=true 时只验证和查重，不创建账号
+// @author ygw
+func (s *Server) handleImportSSOCache(c *gin.Context) {
+	logger.Info("SSO 缓存导入 - 请求来源: %s", c.ClientIP())
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ssoCacheMaxUpload)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "请以 multipart/form-data 上传缓存文件"})
+		return
+	}
+
+	var files []ssocache.File
+	for _, headers := range form.File {
+		for _, fh := range headers {
+			f, err := fh.Open()
+			if err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("读取上传文件 %s 失败", fh.Filename)})
+				return
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("读取上传文件 %s 失败", fh.Filename)})
+				return
+			}
+			files = append(files, ssocache.File{Name: fh.Filename, Data: data})
+		}
+	}
+	if len(files) == 0 {
+		c.JSON(400, gin.H{"error": "请上传至少一个缓存文件"})
+		return
+	}
+
+	creds, skipped := ssocache.Parse(files)
+	importer := &ssocache.Importer{
+		DB:          s.db,
+		Kiro:        s.kiroClient,
+		OIDC:        s.oidcClient,
+		MaxAccounts: s.cfg.GetMaxAccounts(),
+		DryRun:      c.PostForm("dryRun") == "true",
+	}
+	results, err := importer.Import(c.Request.Context(), creds)
+	if err != nil {
+		logger.Error("SSO 缓存导入失败: %v", err)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	if counts[ssocache.StatusImported] > 0 {
+		s.InvalidateAccountCache(c.Request.Context())
+	}
+	logger.Info("SSO 缓存导入完成 - 文件: %d, 凭证: %d, 导入: %d, 重复: %d, 无效: %d, 跳过文件: %d",
+		len(files), len(creds), counts[ssocache.StatusImported], counts[ssocache.StatusDuplicate], counts[ssocache.StatusInvalid], len(skipped))
+
+	c.JSON(200, gin.H{
+		"success":      true,
+		"dryRun":       importer.DryRun,
+		"files":        len(files),
+		"total":        len(creds),
+		"imported":     counts[ssocache.StatusImported],
+		"valid":        counts[ssocache.StatusValid],
+		"unverified":   counts[ssocache.StatusUnverified],
+		"duplicate":    counts[ssocache.StatusDuplicate],
+		"invalid":      counts[ssocache.StatusInvalid],
+		"failed":       counts[ssocache.StatusFailed],
+		"limitReached": counts[ssocache.StatusLimit] > 0,
+		"results":      results,
+		"skipped":      skipped,
+	})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	"claude-api/internal/stream"
+	"claude-api/internal/thinking"
+
+	"github.com/gin-gonic/gin"
+)
+
+// initThinkingSigner 初始化 thinking 块签名器（密钥持久化在设置表中）
+// 读取失败时退化为进程内随机密钥，重启后之前签发的签名将无法通过校验
+// @author ygw
+func (s *Server) initThinkingSigner() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key, err := s.db.GetOrCreateThinkingKey(ctx)
+	if err != nil {
+		logger.Warn("加载 thinking 签名密钥失败，使用临时密钥: %v", err)
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	s.thinkSigner = thinking.NewSigner(key)
+}
+
+// prepareThinkingHistory 校验请求历史中的 thinking 块签名，移除无法校验的 thinking 块和 redacted_thinking 块
+// redacted_thinking 块格式错误时直接返回 400，调用方应立即结束处理
+// @return bool 是否可以继续处理
+// @author ygw
+func (s *Server) prepareThinkingHistory(c *gin.Context, req *models.ClaudeRequest) bool {
+	removed, err := thinking.PrepareHistory(req.Messages, s.thinkSigner)
+	if err != nil {
+		c.Set("error_message", err.Error())
+		c.JSON(400, gin.H{"type": "error", "error": gin.H{"type": "invalid_request_error", "message": err.Error()}})
+		return false
+	}
+	if removed > 0 {
+		logger.Ctx(c.Request.Context()).Debug("已从历史中移除 %d 个无法校验的 thinking / redacted_thinking 块", removed)
+	}
+	return true
+}
+
+// buildThinkingContent 非流式响应：拆出 thinking 段落，按预算截断并签名
+// @param text 上游返回的完整文本
+// @param budget budget_tokens（0 表示不限制）
+// @return []map[string]interface{} thinking 内容块
+// @return string 去除 thinking 后的回答文本
+// @author ygw
+func (s *Server) buildThinkingContent(text string, budget int) ([]map[string]interface{}, string) {
+	thoughts, rest := thinking.Split(text, stream.ThinkingStartTag, stream.ThinkingEndTag)
+	session := thinking.NewSession(budget)
+	blocks := make([]map[string]interface{}, 0, len(thoughts))
+	for _, t := range thoughts {
+		session.Reset()
+		if session.Accept(t) == "" {
+			continue
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":      thinking.BlockThinking,
+			"thinking":  session.Text(),
+			"signature": s.thinkSigner.Sign(session.Text()),
+		})
+	}
+	return blocks, rest
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"claude-api/internal/auth"
+	"claude-api/internal/compressor"
 	"claude-api/internal/logger"
 	"claude-api/internal/models"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,59 +32,7 @@ func (s *Server) handleCreateUser(c *gin.Context) {
 		return
 	}
 
-	// 设置默认值
-	enabled := true
-	if req.Enabled != nil {
-		enabled = *req.Enabled
-	}
-
-	dailyQuota := 0
-	if req.DailyQuota != nil {
-		dailyQuota = *req.DailyQuota
-	}
-
-	monthlyQuota := 0
-	if req.MonthlyQuota != nil {
-		monthlyQuota = *req.MonthlyQuota
-	}
-
-	// 请求次数限制 @author ygw
-	requestQuota := 0
-	if req.RequestQuota != nil {
-		requestQuota = *req.RequestQuota
-	}
-
-	// 每分钟请求频率限制 @author ygw
-	rateLimitRPM := 0
-	if req.RateLimitRPM != nil {
-		rateLimitRPM = *req.RateLimitRPM
-	}
-
-	// VIP用户标识 @author ygw
-	isVip := false
-	if req.IsVip != nil {
-		isVip = *req.IsVip
-	}
-
-	// 创建用户对象
-	user := &models.User{
-		ID:              uuid.New().String(),
-		Name:            req.Name,
-		Email:           req.Email,
-		APIKey:          apiKey,
-		CreatedAt:       time.Now().Format(time.RFC3339),
-		UpdatedAt:       time.Now().Format(time.RFC3339),
-		Enabled:         enabled,
-		IsVip:           isVip,
-		DailyQuota:      dailyQuota,
-		MonthlyQuota:    monthlyQuota,
-		RequestQuota:    requestQuota,
-		RateLimitRPM:    rateLimitRPM,
-		TotalTokensUsed: 0,
-		TotalRequests:   0,
-		TotalCostUSD:    0,
-		Notes:           req.Notes,
-	}
+	user := models.NewUser(uuid.New().String(), apiKey, &req)
 
 	// 保存到数据库
 	if err := s.db.CreateUser(c.Request.Context(), user); err != nil {
@@ -233,6 +183,15 @@ func (s *Server) handleUpdateUser(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "请求格式错误: " + err.Error()})
 		return
 	}
+	if req.CompressionStrategies != nil {
+		names, err := compressor.ParseStrategies(*req.CompressionStrategies)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		normalized := strings.Join(names, ",")
+		req.CompressionStrategies = &normalized
+	}
 
 	// 更新用户
 	if err := s.db.UpdateUser(c.Request.Context(), userID, &req); err != nil {
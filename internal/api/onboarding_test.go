@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/config"
+	"claude-api/internal/coord"
+	"claude-api/internal/database"
+	"claude-api/internal/models"
+	"claude-api/internal/redis/redistest"
+)
+
+// TestDeviceSession_MultiInstance 测试设备授权会话只由持有锁的实例轮询，会话先被认领再创建账号，已取消的会话不创建账号
+func TestDeviceSession_MultiInstance(t *testing.T) {
+	cfg := &config.Config{Database: config.DatabaseConfig{Type: config.DatabaseTypeSQLite, SQLite: config.SQLiteConfig{Path: ":memory:"}}}
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	// 本地 OIDC 令牌端点：记录轮询次数，直接返回已授权的令牌
+	var polls int32
+	oidc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&polls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accessToken":"at","refreshToken":"rt","expiresIn":3600}`))
+	}))
+	defer oidc.Close()
+	upstream := config.DefaultUpstream()
+	upstream.OIDCURL = oidc.URL
+	auth.SetUpstream(upstream)
+	defer auth.SetUpstream(config.DefaultUpstream())
+
+	newSession := func(id string) *models.DeviceAuthSession {
+		sess := &models.DeviceAuthSession{
+			ID:        id,
+			BatchID:   "batch-" + id,
+			Status:    models.DeviceAuthPending,
+			Interval:  5,
+			Enabled:   true,
+			ExpiresAt: time.Now().Add(10 * time.Minute).Format(models.TimeFormat),
+		}
+		if err := db.CreateDeviceAuthSession(ctx, sess); err != nil {
+			t.Fatal(err)
+		}
+		return sess
+	}
+	sessionOf := func(sess *models.DeviceAuthSession) *models.DeviceAuthSession {
+		sessions, err := db.ListDeviceAuthSessions(ctx, sess.BatchID, "")
+		if err != nil || len(sessions) != 1 {
+			t.Fatalf("查询会话失败: %+v (%v)", sessions, err)
+		}
+		return sessions[0]
+	}
+	accountCount := func() int {
+		accounts, err := db.ListAccounts(ctx, nil, "created_at", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(accounts)
+	}
+
+	backend := coord.NewRedisBackend(redistest.NewServer(t, "").Client(t), "test:")
+	s := &Server{cfg: cfg, db: db, coord: backend, oidcClient: auth.NewOIDCClient(cfg), accountPool: NewAccountPool(db, time.Minute)}
+
+	// 其他实例持有会话锁时不轮询
+	locked := newSession("sess-locked")
+	release, ok, err := backend.TryLock(ctx, "device_auth:"+locked.ID, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("获取会话锁失败: %v", err)
+	}
+	s.pollDeviceSession(locked)
+	release()
+	if n := atomic.LoadInt32(&polls); n != 0 {
+		t.Errorf("其他实例持有锁时不应轮询，实际轮询 %d 次", n)
+	}
+	if got := sessionOf(locked); got.Status != models.DeviceAuthPending {
+		t.Errorf("未轮询的会话应保持等待状态: %s", got.Status)
+	}
+
+	// 轮询期间会话被取消：迟到的授权结果既不覆盖取消状态，也不创建账号
+	cancelled := newSession("sess-cancelled")
+	if _, err := db.CancelDeviceAuthBatch(ctx, cancelled.BatchID); err != nil {
+		t.Fatal(err)
+	}
+	s.pollDeviceSession(cancelled)
+	if n := atomic.LoadInt32(&polls); n != 1 {
+		t.Fatalf("应已取得授权令牌，实际轮询 %d 次", n)
+	}
+	if got := sessionOf(cancelled); got.Status != models.DeviceAuthCancelled || got.AccountID != nil {
+		t.Errorf("会话应保持取消状态: %+v", got)
+	}
+	if n := accountCount(); n != 0 {
+		t.Errorf("已取消的会话不应创建账号，实际 %d 个", n)
+	}
+
+	// 正常授权：会话完成并关联新建的账号
+	done := newSession("sess-done")
+	s.pollDeviceSession(done)
+	got := sessionOf(done)
+	if got.Status != models.DeviceAuthCompleted || got.AccountID == nil {
+		t.Fatalf("授权完成后会话应为 completed 并关联账号: %+v", got)
+	}
+	if acc, err := db.GetAccount(ctx, *got.AccountID); err != nil || acc == nil {
+		t.Errorf("应已创建会话关联的账号: %v", err)
+	}
+	if s.finishDeviceSession(done, models.DeviceAuthError, "late", nil) {
+		t.Error("已完成的会话不应再被更新")
+	}
+
+	// 创建账号时中断的会话在启动恢复时按账号是否存在标记
+	interrupted := newSession("sess-interrupted")
+	if ok, err := db.FinishDeviceAuthSession(ctx, interrupted.ID, map[string]interface{}{"status": models.DeviceAuthCreating, "account_id": "missing"}); err != nil || !ok {
+		t.Fatalf("认领会话失败: %v", err)
+	}
+	if _, err := db.CancelDeviceAuthBatch(ctx, locked.BatchID); err != nil {
+		t.Fatal(err)
+	}
+	s.ResumeDeviceAuthSessions(ctx)
+	if got := sessionOf(interrupted); got.Status != models.DeviceAuthError {
+		t.Errorf("账号未写入的中断会话应标记为失败: %s", got.Status)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFetchProxySubscription 测试未配置订阅文件目录时只允许 http/https 地址，超出大小上限时报错而不是截断
+func TestFetchProxySubscription(t *testing.T) {
+	for _, source := range []string{"/etc/passwd", "file:///etc/passwd", "ftp://example.com/list", "http://"} {
+		if _, err := fetchProxySubscription(context.Background(), source, ""); err == nil {
+			t.Errorf("订阅地址 %q 应被拒绝", source)
+		}
+	}
+
+	const body = "1.2.3.4:8080\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big" {
+			w.Write([]byte(strings.Repeat("x", proxySubMaxSize) + "\n"))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	text, err := fetchProxySubscription(context.Background(), srv.URL, "")
+	if err != nil || text != body {
+		t.Fatalf("应返回订阅内容，实际 %q (%v)", text, err)
+	}
+
+	if _, err := fetchProxySubscription(context.Background(), srv.URL+"/big", ""); err == nil {
+		t.Error("订阅内容超出上限时应返回错误")
+	}
+}
+
+// TestFetchProxySubscription_File 测试文件订阅只能读取订阅文件目录内的文件
+func TestFetchProxySubscription_File(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "subs")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	const body = "1.2.3.4:8080\n"
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Repeat("x", proxySubMaxSize+1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"list.txt", filepath.Join(dir, "list.txt"), "file://" + filepath.Join(dir, "list.txt")} {
+		text, err := fetchProxySubscription(context.Background(), source, dir)
+		if err != nil || text != body {
+			t.Errorf("订阅文件 %q 应可读取，实际 %q (%v)", source, text, err)
+		}
+	}
+	for _, source := range []string{"../secret.txt", filepath.Join(base, "secret.txt"), "link.txt", "big.txt", "ftp://example.com/list"} {
+		if _, err := fetchProxySubscription(context.Background(), source, dir); err == nil {
+			t.Errorf("订阅地址 %q 应被拒绝", source)
+		}
+	}
+	if err := validateProxySubSource("../secret.txt", dir); err == nil {
+		t.Error("创建订阅时应拒绝目录外的文件")
+	}
+}
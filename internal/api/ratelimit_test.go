@@ -5,10 +5,22 @@
 package api
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"claude-api/internal/config"
+	"claude-api/internal/database"
+	"claude-api/internal/models"
+	"claude-api/internal/notify"
 	"claude-api/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
 )
 
 // ==================== 频率限制（每分钟）测试 ====================
@@ -254,3 +266,256 @@ func TestRateLimitPriority_UserAndIP_Independent(t *testing.T) {
     └─ 用户有每日限制?
         └─ 是 → 检查用户今日请求数 → 结束
 */
+
+// ==================== token 限流（TPM）测试 ====================
+
+// newTPMTestServer 创建带缓存设置和指定IP配置的测试服务器
+func newTPMTestServer(globalTPM int, ipConfig *models.IPConfig) *Server {
+	s := &Server{
+		tokenLimiter:  ratelimit.NewTokenLimiter(time.Minute),
+		settingsCache: NewSettingsCache(nil, time.Hour),
+		ipConfigCache: NewIPConfigCache(nil, time.Hour),
+	}
+	s.settingsCache.settings = &models.Settings{GlobalRateLimitTPM: globalTPM}
+	s.settingsCache.lastRefresh = time.Now()
+	// 未指定配置时缓存空配置，避免查询数据库
+	ip := "192.0.2.1"
+	if ipConfig != nil {
+		ip = ipConfig.IP
+	}
+	s.ipConfigCache.cache.Store(ip, &ipConfigCacheEntry{config: ipConfig, expireAt: time.Now().Add(time.Hour)})
+	return s
+}
+
+// newTPMTestContext 创建指定路径和用户的请求上下文（客户端 IP 为 192.0.2.1）
+func newTPMTestContext(path string, user *models.User) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", path, nil)
+	c.Request.RemoteAddr = "192.0.2.1:1234"
+	if user != nil {
+		c.Set("user", user)
+	}
+	return c, w
+}
+
+// TestAdmitTokens_ReserveAndReconcile 测试按预估预占、超限拒绝以及按实际用量修正
+func TestAdmitTokens_ReserveAndReconcile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTPMTestServer(0, &models.IPConfig{IP: "192.0.2.1", RateLimitTPM: 12000})
+	defer s.tokenLimiter.Stop()
+	user := &models.User{ID: "u1", RateLimitTPM: 10000}
+
+	c, _ := newTPMTestContext("/v1/messages", user)
+	if !s.admitTokens(c, 8000) {
+		t.Fatal("额度内的请求应通过")
+	}
+
+	// 用户维度剩余 2000，预估 5000 应被拒绝
+	c2, w2 := newTPMTestContext("/v1/messages", user)
+	if s.admitTokens(c2, 5000) {
+		t.Fatal("超过用户 TPM 的请求应被拒绝")
+	}
+	if w2.Code != 429 || w2.Header().Get("retry-after") == "" {
+		t.Errorf("应返回 429 和 retry-after: %d %v", w2.Code, w2.Header())
+	}
+	if w2.Header().Get("anthropic-ratelimit-tokens-limit") != "10000" || w2.Header().Get("anthropic-ratelimit-tokens-remaining") != "2000" {
+		t.Errorf("token 限流响应头错误: %v", w2.Header())
+	}
+	if !strings.Contains(w2.Body.String(), `"type":"rate_limit_error"`) || !strings.Contains(w2.Body.String(), `"type":"error"`) {
+		t.Errorf("应返回 Anthropic 错误格式: %s", w2.Body.String())
+	}
+	// 指定IP维度拒绝时，已预占的用户维度应释放
+	other := &models.User{ID: "u2", RateLimitTPM: 100000}
+	c4, w4 := newTPMTestContext("/v1/messages", other)
+	if s.admitTokens(c4, 5000) || w4.Code != 429 {
+		t.Fatal("超过指定IP TPM 的请求应被拒绝")
+	}
+	if n := s.tokenLimiter.Used("user:u2"); n != 0 {
+		t.Errorf("被拒绝的请求不应占用用户额度，实际 %d", n)
+	}
+
+	// 第一个请求实际只用了 3000
+	c.Set("input_tokens", 2500)
+	c.Set("output_tokens", 500)
+	c.Status(200)
+	s.reconcileTokens(c)
+	if n := s.tokenLimiter.Used("user:u1"); n != 3000 {
+		t.Errorf("修正后用户用量应为 3000，实际 %d", n)
+	}
+	c3, _ := newTPMTestContext("/v1/messages", user)
+	if !s.admitTokens(c3, 5000) {
+		t.Error("按实际用量修正后应允许")
+	}
+
+	// 失败的请求释放预占
+	c3.Status(500)
+	s.reconcileTokens(c3)
+	if n := s.tokenLimiter.Used("user:u1"); n != 3000 {
+		t.Errorf("失败请求应释放预占，实际 %d", n)
+	}
+}
+
+// TestAdmitTokens_GlobalOpenAI 测试全局 TPM 与 OpenAI 错误格式
+func TestAdmitTokens_GlobalOpenAI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTPMTestServer(1000, nil)
+	defer s.tokenLimiter.Stop()
+
+	c, _ := newTPMTestContext("/v1/chat/completions", nil)
+	if !s.admitTokens(c, 900) {
+		t.Fatal("额度内的请求应通过")
+	}
+	c2, w2 := newTPMTestContext("/v1/chat/completions", nil)
+	if s.admitTokens(c2, 200) {
+		t.Fatal("超过全局 TPM 的请求应被拒绝")
+	}
+	if w2.Header().Get("x-ratelimit-limit-tokens") != "1000" || w2.Header().Get("x-ratelimit-remaining-tokens") != "100" {
+		t.Errorf("OpenAI token 限流响应头错误: %v", w2.Header())
+	}
+	if !strings.Contains(w2.Body.String(), `"code":"rate_limit_exceeded"`) {
+		t.Errorf("应返回 OpenAI 错误格式: %s", w2.Body.String())
+	}
+}
+
+// TestRateLimitHeaders_Requests 测试请求数限流的响应头、retry-after 和错误格式
+func TestRateLimitHeaders_Requests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTPMTestServer(0, nil)
+	s.rateLimiter = ratelimit.NewDualLimiter(time.Minute)
+	defer s.rateLimiter.Stop()
+	defer s.tokenLimiter.Stop()
+	user := &models.User{ID: "u1", APIKey: "sk-test", RateLimitRPM: 2, RateLimitTPM: 5000}
+
+	c, w := newTPMTestContext("/v1/messages", user)
+	if !s.checkRequestRateLimit(c, user) || !s.admitTokens(c, 1000) {
+		t.Fatal("第一次请求应通过")
+	}
+	want := map[string]string{
+		"anthropic-ratelimit-requests-limit":     "2",
+		"anthropic-ratelimit-requests-remaining": "1",
+		"anthropic-ratelimit-tokens-limit":       "5000",
+		"anthropic-ratelimit-tokens-remaining":   "4000",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s: 期望 %s，实际 %s", k, v, got)
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, w.Header().Get("anthropic-ratelimit-requests-reset")); err != nil {
+		t.Errorf("reset 应为 RFC3339 时间: %v", err)
+	}
+
+	c, _ = newTPMTestContext("/v1/chat/completions", user)
+	s.checkRequestRateLimit(c, user)
+	c, w = newTPMTestContext("/v1/chat/completions", user)
+	if s.checkRequestRateLimit(c, user) {
+		t.Fatal("超过每分钟请求数应拒绝")
+	}
+	if w.Code != 429 || w.Header().Get("x-ratelimit-remaining-requests") != "0" {
+		t.Errorf("应返回 429 和剩余 0: %d %v", w.Code, w.Header())
+	}
+	if ra, _ := strconv.Atoi(w.Header().Get("retry-after")); ra < 1 || ra > 60 {
+		t.Errorf("retry-after 应在窗口内，实际 %q", w.Header().Get("retry-after"))
+	}
+	if !strings.Contains(w.Body.String(), `"code":"rate_limit_exceeded"`) {
+		t.Errorf("应返回 OpenAI 错误格式: %s", w.Body.String())
+	}
+}
+
+// TestRecordLimitStatus 测试同类限制只保留最严格的一个
+func TestRecordLimitStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := newTPMTestContext("/v1/messages", nil)
+	recordLimitStatus(c, tokenLimitStatusKey, limitStatus{Limit: 100000, Remaining: 90000, Reset: time.Minute})
+	recordLimitStatus(c, tokenLimitStatusKey, limitStatus{Limit: 1000000, Remaining: 500, Reset: 24 * time.Hour})
+	recordLimitStatus(c, tokenLimitStatusKey, limitStatus{Limit: 0, Remaining: 0})
+	v, _ := c.Get(tokenLimitStatusKey)
+	if st := v.(limitStatus); st.Limit != 1000000 || st.Remaining != 500 {
+		t.Errorf("应保留剩余额度最少的限制: %+v", st)
+	}
+
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	if d := untilTomorrow(now); d != 12*time.Hour {
+		t.Errorf("距离明天应为 12h，实际 %v", d)
+	}
+	if d := untilNextMonth(now); d != 12*time.Hour {
+		t.Errorf("距离下月应为 12h，实际 %v", d)
+	}
+}
+
+// TestBudgetStatuses 测试预算周期划分（时区、重置日）和预警内容
+func TestBudgetStatuses(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	period := database.BudgetPeriod{Location: loc, ResetDay: 15}
+	now := time.Date(2026, 10, 3, 23, 0, 0, 0, time.UTC) // UTC+8 的 10 月 4 日 7 点
+
+	user := &models.User{DailyBudgetUSD: 5, MonthlyBudgetUSD: 50}
+	usage := &models.UserQuotaUsage{DailyCostUSD: 4.25, MonthlyCostUSD: 12}
+	statuses := budgetStatuses(user, usage, period, now)
+	if len(statuses) != 2 {
+		t.Fatalf("应返回每日和月度两个维度，实际 %d", len(statuses))
+	}
+
+	daily, monthly := statuses[0], statuses[1]
+	if !daily.start.Equal(time.Date(2026, 10, 4, 0, 0, 0, 0, loc)) || !daily.reset.Equal(time.Date(2026, 10, 5, 0, 0, 0, 0, loc)) {
+		t.Errorf("每日周期应按预算时区划分: %v - %v", daily.start, daily.reset)
+	}
+	if !monthly.start.Equal(time.Date(2026, 9, 15, 0, 0, 0, 0, loc)) || !monthly.reset.Equal(time.Date(2026, 10, 15, 0, 0, 0, 0, loc)) {
+		t.Errorf("月度周期应从重置日开始: %v - %v", monthly.start, monthly.reset)
+	}
+	if w := daily.warning(); w != "daily 85% ($4.25/$5.00)" {
+		t.Errorf("预警内容错误: %s", w)
+	}
+
+	if statuses := budgetStatuses(&models.User{}, usage, period, now); len(statuses) != 0 {
+		t.Errorf("未设置预算时不应返回维度: %+v", statuses)
+	}
+}
+
+// TestNotifyBudgetWarning_OncePerPeriod 测试预算预警每个用户每个周期只发送一次（不依赖通知去重窗口）
+func TestNotifyBudgetWarning_OncePerPeriod(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(&config.Config{Database: config.DatabaseConfig{Type: config.DatabaseTypeSQLite, SQLite: config.SQLiteConfig{Path: ":memory:"}}})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	user := models.NewUser("user-1", "sk-test-budget-user-key", &models.UserCreate{Name: "budget"})
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateTokenUsage(ctx, user.ID, 100000, 100000); err != nil {
+		t.Fatal(err)
+	}
+	dedup := 0
+	if err := db.UpdateSettings(ctx, &models.SettingsUpdate{NotifyDedupMinutes: &dedup}); err != nil {
+		t.Fatal(err)
+	}
+
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer srv.Close()
+	s := &Server{db: db, settingsCache: NewSettingsCache(db, time.Hour), notifier: notify.New(notify.Options{})}
+	defer s.notifier.Close()
+	s.notifier.SetChannels([]*models.NotifyChannel{{Name: "hook", Type: notify.ChannelWebhook, URL: srv.URL, Enabled: true}})
+
+	now := time.Now()
+	b := budgetStatus{period: models.SpendPeriodDaily, label: "每日", spent: 9, budget: 10, start: db.BudgetPeriod().DailyStart(now)}
+	for i := 0; i < 3; i++ {
+		s.notifyBudgetWarning(ctx, user, b)
+	}
+	s.notifier.Close()
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("同一周期应只预警一次，实际 %d 次", n)
+	}
+
+	if first, err := db.MarkBudgetWarned(ctx, user.ID, models.SpendPeriodMonthly, db.BudgetPeriod().MonthlyStart(now)); err != nil || !first {
+		t.Errorf("月度周期应单独预警: %v, %v", first, err)
+	}
+	if first, _ := db.MarkBudgetWarned(ctx, user.ID, models.SpendPeriodDaily, db.BudgetPeriod().DailyStart(now).AddDate(0, 0, 1)); first {
+		t.Error("尚无消费记录的周期不应标记")
+	}
+}
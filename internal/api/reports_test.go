@@ -0,0 +1,50 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"claude-api/internal/models"
+)
+
+// TestWriteUsageReport 测试分组维度解析和 csv / tsv / jsonl 输出
+func TestWriteUsageReport(t *testing.T) {
+	groupBy, err := parseReportGroupBy("Day, user,day")
+	if err != nil || strings.Join(groupBy, ",") != "day,user" {
+		t.Fatalf("分组维度应去重保序: %v %v", groupBy, err)
+	}
+	if _, err := parseReportGroupBy("user,region"); err == nil {
+		t.Error("未知维度应报错")
+	}
+	if src := defaultReportSource([]string{"user", "model"}); src != models.ReportSourceLogs {
+		t.Errorf("按模型分组应使用请求日志，实际 %s", src)
+	}
+
+	rows := []*models.UsageReportRow{{
+		Day: "2026-09-01", UserID: "u1", UserName: "team, a",
+		Requests: 2, InputTokens: 1000000, OutputTokens: 200000, TotalTokens: 1200000, CostUSD: 10,
+	}}
+
+	var buf bytes.Buffer
+	if err := writeUsageReport(&buf, "csv", groupBy, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := "day,user_id,user_name,requests,input_tokens,output_tokens,total_tokens,cost_usd\n" +
+		"2026-09-01,u1,\"team, a\",2,1000000,200000,1200000,10.000000\n"
+	if buf.String() != want {
+		t.Errorf("csv 输出错误:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	writeUsageReport(&buf, "tsv", []string{"user"}, rows)
+	if !strings.HasPrefix(buf.String(), "user_id\tuser_name\trequests\t") {
+		t.Errorf("tsv 表头错误:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	writeUsageReport(&buf, "jsonl", groupBy, rows)
+	if line := buf.String(); !strings.Contains(line, `"user_id":"u1"`) || strings.Contains(line, `"model"`) || strings.Count(line, "\n") != 1 {
+		t.Errorf("jsonl 输出错误: %s", line)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRequestIDMiddleware_ServerLogID 测试客户端重复传入同一 x-request-id 时请求日志主键仍由服务端生成且互不相同
+func TestRequestIDMiddleware_ServerLogID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	var logIDs, requestIDs []string
+	r.GET("/v1/models", func(c *gin.Context) {
+		logIDs = append(logIDs, c.GetString("log_id"))
+		requestIDs = append(requestIDs, c.GetString("request_id"))
+	})
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set(requestIDHeader, "fixed-id")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if requestIDs[0] != "fixed-id" || requestIDs[1] != "fixed-id" {
+		t.Errorf("合法的客户端请求 ID 应沿用: %v", requestIDs)
+	}
+	if logIDs[0] == "" || logIDs[0] == logIDs[1] || logIDs[0] == "fixed-id" {
+		t.Errorf("请求日志 ID 应由服务端生成且不重复: %v", logIDs)
+	}
+}
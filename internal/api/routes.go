@@ -76,7 +76,7 @@ func (s *Server) setupRoutes(r *gin.Engine) {
 
 	// OpenAI API 端点（带限流中间件和黑名单检查）
 	// 中间件顺序: IP限流(预检) -> 用户认证 -> API Key限流(后检) -> 业务处理
-	r.POST("/v1/chat/completions", s.preAuthRateLimitMiddleware(), s.requireAccount, s.postAuthRateLimitMiddleware(), s.handleChatCompletions)
+	r.POST("/v1/chat/completions", s.preAuthRateLimitMiddleware(), s.requireAPIKey, s.postAuthRateLimitMiddleware(), s.handleChatCompletions)
 
 	// 管理控制台端点（如果启用）
 	if s.cfg.EnableConsole {
@@ -105,6 +105,11 @@ func (s *Server) setupConsoleRoutes(r *gin.Engine) {
 		authGroup.POST("/start", s.handleAuthStart)
 		authGroup.GET("/status/:authId", s.handleAuthStatus)
 		authGroup.POST("/claim/:authId", s.handleAuthClaim)
+		// 批量设备授权（会话持久化，后台轮询并自动创建账号）
+		authGroup.POST("/batch", s.handleDeviceBatchStart)
+		authGroup.GET("/batch/:batchId", s.handleDeviceBatchStatus)
+		authGroup.DELETE("/batch/:batchId", s.handleDeviceBatchCancel)
+		authGroup.GET("/sessions", s.handleListDeviceSessions)
 	}
 
 	// 账号管理
@@ -115,17 +120,20 @@ func (s *Server) setupConsoleRoutes(r *gin.Engine) {
 		accountsGroup.POST("/feed", s.handleFeedAccounts)
 		accountsGroup.POST("/import", s.handleImportAccounts)
 		accountsGroup.POST("/import-by-token", s.handleImportByToken)
+		accountsGroup.POST("/import-sso-cache", s.handleImportSSOCache) // 上传 ~/.aws/sso/cache 文件导入
 		accountsGroup.POST("/direct-import", s.requireTestModePassword, s.handleDirectImportAccounts) // 直接导入账号（需要密码）
 		accountsGroup.POST("/reset-stats", s.requireTestModePassword, s.handleResetAllAccountStats)   // 测试模式需要密码
 		accountsGroup.GET("", s.handleListAccounts)
 		accountsGroup.GET("/export", s.requireTestModePassword, s.handleExportAccounts) // 测试模式需要密码
 		accountsGroup.GET("/incomplete", s.handleListIncompleteAccounts)
+		accountsGroup.GET("/history", s.handleGetPoolHistory) // 账号池指标历史与耗尽预测
 		accountsGroup.DELETE("/incomplete", s.handleDeleteIncompleteAccounts)
 		accountsGroup.DELETE("/suspended", s.requireTestModePassword, s.handleDeleteSuspendedAccounts) // 删除封控账号 @author ygw
 		accountsGroup.POST("/enable-all", s.requireTestModePassword, s.handleEnableAllAccounts)        // 批量启用所有账号 @author ygw
 		accountsGroup.POST("/disable-all", s.requireTestModePassword, s.handleDisableAllAccounts)      // 批量禁用所有账号 @author ygw
 		accountsGroup.GET("/:id", s.handleGetAccount)
 		accountsGroup.GET("/:id/quota", s.handleGetAccountQuota)
+		accountsGroup.GET("/:id/history", s.handleGetAccountHistory) // 账号指标历史
 		accountsGroup.PATCH("/:id", s.handleUpdateAccount)
 		accountsGroup.DELETE("/:id", s.requireTestModePassword, s.handleDeleteAccount) // 测试模式需要密码
 		accountsGroup.POST("/:id/refresh", s.handleRefreshAccount)
@@ -151,9 +159,27 @@ func (s *Server) setupConsoleRoutes(r *gin.Engine) {
 	{
 		proxiesGroup.GET("", s.handleListProxies)
 		proxiesGroup.POST("", s.handleCreateProxy)
+		proxiesGroup.POST("/import", s.handleImportProxies)
+		proxiesGroup.GET("/subscriptions", s.handleListProxySubscriptions)
+		proxiesGroup.POST("/subscriptions", s.handleCreateProxySubscription)
+		proxiesGroup.PUT("/subscriptions/:id", s.handleUpdateProxySubscription)
+		proxiesGroup.DELETE("/subscriptions/:id", s.handleDeleteProxySubscription)
+		proxiesGroup.POST("/subscriptions/:id/sync", s.handleSyncProxySubscription)
 		proxiesGroup.PUT("/:id", s.handleUpdateProxy)
 		proxiesGroup.DELETE("/:id", s.handleDeleteProxy)
 		proxiesGroup.POST("/:id/toggle", s.handleToggleProxy)
+		proxiesGroup.POST("/:id/test", s.handleTestProxy)
+	}
+
+	// 通知渠道管理
+	notifyGroup := r.Group("/v2/notifications/channels")
+	notifyGroup.Use(s.requireAdmin)
+	{
+		notifyGroup.GET("", s.handleListNotifyChannels)
+		notifyGroup.POST("", s.handleCreateNotifyChannel)
+		notifyGroup.PUT("/:id", s.handleUpdateNotifyChannel)
+		notifyGroup.DELETE("/:id", s.handleDeleteNotifyChannel)
+		notifyGroup.POST("/:id/test", s.handleTestNotifyChannel)
 	}
 
 	// 模型列表
@@ -173,6 +199,8 @@ func (s *Server) setupConsoleRoutes(r *gin.Engine) {
 	{
 		logsGroup.GET("", s.handleGetLogs)
 		logsGroup.GET("/stats", s.handleGetStats)
+		logsGroup.GET("/:id/capture", s.handleGetLogCapture)
+		logsGroup.POST("/:id/replay", s.handleReplayLog)
 		logsGroup.POST("/cleanup", s.requireTestModePassword, s.handleCleanupLogs) // 测试模式需要密码
 	}
 
@@ -213,6 +241,15 @@ func (s *Server) setupConsoleRoutes(r *gin.Engine) {
 	// 在线用户统计
 	r.GET("/v2/stats/online", s.requireAdmin, s.handleGetOnlineStats)
 
+	// 准入队列状态
+	r.GET("/v2/stats/queue", s.requireAdmin, s.handleGetQueueStats)
+
+	// 令牌刷新调度状态
+	r.GET("/v2/stats/token-refresh", s.requireAdmin, s.handleGetTokenRefreshStats)
+
+	// 用量报表导出（json / csv / tsv / jsonl）
+	r.GET("/v2/reports/usage", s.requireAdmin, s.handleUsageReport)
+
 	// AWS 延迟检测 @author ygw
 	r.GET("/v2/health/aws-latency", s.requireAdmin, s.handleAwsLatency)
 
@@ -5,16 +5,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"claude-api/internal/admission"
 	"claude-api/internal/amazonq"
 	"claude-api/internal/auth"
 	"claude-api/internal/compressor"
+	"claude-api/internal/coord"
 	"claude-api/internal/config"
 	"claude-api/internal/database"
 	"claude-api/internal/logger"
+	"claude-api/internal/metrics"
 	"claude-api/internal/models"
+	"claude-api/internal/notify"
 	"claude-api/internal/proxy"
 	"claude-api/internal/ratelimit"
+	"claude-api/internal/refresh"
+	"claude-api/internal/redis"
 	syncpkg "claude-api/internal/sync"
+	"claude-api/internal/thinking"
+	"claude-api/internal/tracing"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -33,7 +41,15 @@ type Server struct {
 	kiroClient   *auth.KiroClient       // Kiro 社交登录客户端
 	compressor   *compressor.Compressor // 上下文压缩器
 	proxyPool    *proxy.ProxyPool       // 代理池
+	notifier     *notify.Notifier       // 账号池健康事件通知
+	metrics      *metrics.Aggregator    // 账号指标内存聚合
+	thinkSigner  *thinking.Signer       // thinking 块签名器
+	redis        *redis.Client          // Redis 客户端（未配置时为 nil）
+	coord        coord.Backend          // 多实例协调后端（单实例内存模式为 nil）
+	metricsDone  chan struct{}
+	metricsWg    sync.WaitGroup
 	authSessions sync.Map               // 存储设备认证会话
+	devicePolls  sync.Map               // 批量设备授权的后台轮询（会话ID -> 取消函数）
 	logChan      chan *models.RequestLog
 	dbWriteChan  chan dbWriteOp // 数据库写操作队列
 	logWg        sync.WaitGroup
@@ -49,6 +65,10 @@ type Server struct {
 
 	// 双重限流器（IP + API Key）@author ygw
 	rateLimiter *ratelimit.DualLimiter
+	// token 限流器（用户 / 指定IP / 全局 TPM）
+	tokenLimiter *ratelimit.TokenLimiter
+	// 准入队列（容量不足时按优先级排队）
+	admission *admission.Queue
 
 	// 在线用户追踪
 	onlineTracker *OnlineTracker // 在线 IP 追踪器
@@ -57,6 +77,7 @@ type Server struct {
 	accountPool    *AccountPool    // 账号池缓存，避免每次请求查询数据库
 	settingsCache  *SettingsCache  // 设置缓存
 	tokenRefresher *TokenRefresher // 令牌刷新锁，避免重复刷新
+	tokenScheduler *refresh.Scheduler // 按过期时间主动刷新令牌
 	ipConfigCache  *IPConfigCache  // IP配置缓存，用于单独IP频率限制 @author ygw
 
 	// 账号封控状态缓存（免费版使用）
@@ -72,21 +93,53 @@ type suspendedCacheEntry struct {
 	expireAt  time.Time
 }
 
+// 在线 IP 追踪参数
+const (
+	onlineGroup         = "online_ips"     // 共享后端中的分组名
+	onlineSharedMinGap  = 30 * time.Second // 同一 IP 写入共享后端的最小间隔
+	onlineSharedTimeout = 2 * time.Second
+)
+
 // OnlineTracker 在线用户追踪器
 // @author ygw
 type OnlineTracker struct {
-	ips sync.Map // key: IP (string), value: 最后访问时间 (time.Time)
+	ips        sync.Map      // key: IP (string), value: 最后访问时间 (time.Time)
+	shared     coord.Backend // 多实例共享（nil 表示仅统计本实例）
+	lastShared sync.Map      // key: IP (string), value: 最近写入共享后端的时间 (time.Time)
 }
 
 // RecordIP 记录 IP 访问
 // @author ygw
 func (ot *OnlineTracker) RecordIP(ip string) {
-	ot.ips.Store(ip, time.Now())
+	now := time.Now()
+	ot.ips.Store(ip, now)
+	if ot.shared == nil {
+		return
+	}
+	if last, ok := ot.lastShared.Load(ip); ok && now.Sub(last.(time.Time)) < onlineSharedMinGap {
+		return
+	}
+	ot.lastShared.Store(ip, now)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), onlineSharedTimeout)
+		defer cancel()
+		if err := ot.shared.Touch(ctx, onlineGroup, ip, now); err != nil {
+			logger.Debug("记录共享在线 IP 失败: %v", err)
+		}
+	}()
 }
 
 // GetOnlineCount 获取当前在线用户数（5分钟内活跃的 IP 数量）
+// 配置协调后端时统计所有实例的在线 IP
 // @author ygw
 func (ot *OnlineTracker) GetOnlineCount() int {
+	if ot.shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), onlineSharedTimeout)
+		defer cancel()
+		if n, err := ot.shared.CountActive(ctx, onlineGroup, time.Now().Add(-5*time.Minute)); err == nil {
+			return n
+		}
+	}
 	count := 0
 	now := time.Now()
 	ot.ips.Range(func(key, value interface{}) bool {
@@ -107,6 +160,7 @@ func (ot *OnlineTracker) CleanupExpired() {
 		lastTime := value.(time.Time)
 		if now.Sub(lastTime) > 5*time.Minute {
 			ot.ips.Delete(key)
+			ot.lastShared.Delete(key)
 		}
 		return true
 	})
@@ -130,6 +184,12 @@ type statsUpdate struct {
 	success   bool
 }
 
+// stickyProxyUpdate 粘性代理分配数据
+type stickyProxyUpdate struct {
+	accountID string
+	proxyID   int64
+}
+
 // tokenUsageUpdate token使用量更新数据
 type tokenUsageUpdate struct {
 	userID       string
@@ -148,6 +208,12 @@ func NewServer(cfg *config.Config, db *database.DB, version string) *Server {
 		}
 	}
 
+	// 上游地址（默认 AWS 官方地址，可配置为本地模拟上游）
+	auth.SetUpstream(cfg.Upstream)
+	if cfg.Upstream != config.DefaultUpstream() {
+		logger.Info("已覆盖上游地址 - Amazon Q: %s, OIDC: %s, Kiro: %s", cfg.Upstream.AmazonQURL, cfg.Upstream.OIDCURL, cfg.Upstream.KiroAuthURL)
+	}
+
 	// 创建账号池缓存（30秒刷新间隔）
 	accountPool := NewAccountPool(db, 30*time.Second)
 	accountPool.SetConfig(
@@ -158,6 +224,14 @@ func NewServer(cfg *config.Config, db *database.DB, version string) *Server {
 		cfg.AccountSelectionMode,
 	)
 
+	// Redis 客户端与压缩摘要缓存存储
+	redisClient := newRedisClient(cfg)
+	compressCfg := compressor.DefaultConfig()
+	if cfg.SummaryCache.Dir != "" {
+		compressCfg.CacheDir = cfg.SummaryCache.Dir
+	}
+	contextCompressor := compressor.NewWithStore(compressCfg, newSummaryCacheStore(cfg, db, redisClient, compressCfg))
+
 	// 创建设置缓存（30秒 TTL）
 	settingsCache := NewSettingsCache(db, 30*time.Second)
 	// 创建IP配置缓存（60秒 TTL）@author ygw
@@ -169,7 +243,8 @@ func NewServer(cfg *config.Config, db *database.DB, version string) *Server {
 		aqClient:          amazonq.NewClient(cfg),
 		oidcClient:        auth.NewOIDCClient(cfg),
 		kiroClient:        auth.NewKiroClient(cfg),             // Kiro 社交登录客户端
-		compressor:        compressor.New(nil),                 // 使用默认配置初始化压缩器
+		compressor:        contextCompressor,                   // 上下文压缩器
+		redis:             redisClient,                         // Redis 客户端（未配置时为 nil）
 		logChan:           make(chan *models.RequestLog, 5000), // 扩容日志队列
 		dbWriteChan:       make(chan dbWriteOp, 10000),         // 扩容数据库写队列
 		version:           version,
@@ -181,10 +256,18 @@ func NewServer(cfg *config.Config, db *database.DB, version string) *Server {
 		tokenRefresher:    NewTokenRefresher(),                   // 令牌刷新锁
 		rateLimiter:       ratelimit.NewDualLimiter(time.Minute), // 双重限流器（60秒滑动窗口）
 		suspendedCacheTTL: 5 * time.Minute,                       // 账号封控状态缓存 5 分钟
+		metrics:           metrics.NewAggregator(),               // 账号指标聚合
 	}
 	s.reloadProxyPool() // 初始化代理池
+	s.initNotifier()    // 初始化通知渠道
+	s.tokenLimiter = ratelimit.NewTokenLimiter(time.Minute)
+	s.initAdmission()
+	s.initTokenScheduler()
+	s.initThinkingSigner()
+	s.initCoordination()
 	s.startLogWorker()
 	s.startDBWriteWorker()
+	s.startMetricsWorker()
 
 	// 启动时同步设备信息
 	go func() {
@@ -209,9 +292,20 @@ func (s *Server) reloadProxyPool() {
 	}
 	if s.proxyPool == nil {
 		s.proxyPool = proxy.NewProxyPool(s.cfg.ProxyPoolStrategy)
+		s.proxyPool.OnAssign(s.queueStickyProxy)
 	}
 	s.proxyPool.Reload(proxies)
 	s.proxyPool.SetStrategy(s.cfg.ProxyPoolStrategy)
+	if bindings, err := s.db.GetAccountProxyBindings(context.Background()); err != nil {
+		logger.Error("加载账号代理绑定失败: %v", err)
+	} else {
+		s.proxyPool.SetBindings(bindings)
+	}
+	if assignments, err := s.db.GetAccountStickyProxies(context.Background()); err != nil {
+		logger.Error("加载粘性代理分配失败: %v", err)
+	} else {
+		s.proxyPool.SetStickyAssignments(assignments)
+	}
 	s.aqClient.SetProxyPool(s.proxyPool)
 	logger.Info("代理池已加载，共 %d 个代理，策略: %s", len(proxies), s.cfg.ProxyPoolStrategy)
 }
@@ -287,7 +381,7 @@ func (s *Server) RefreshAllAccountsQuota(ctx context.Context) {
 			accountStartTime := time.Now()
 
 			machineId := s.ensureAccountMachineID(ctx, account)
-			quota, err := s.aqClient.GetUsageLimits(ctx, *account.AccessToken, machineId, "AGENTIC_REQUEST")
+			quota, err := s.aqClient.GetUsageLimits(ctx, auth.RegionOf(account.Region), *account.AccessToken, machineId, "AGENTIC_REQUEST")
 
 			elapsed := time.Since(accountStartTime)
 
@@ -322,7 +416,7 @@ func (s *Server) RefreshAllAccountsQuota(ctx context.Context) {
 			// 提取配额信息
 			var usageCurrent, usageLimit float64
 			var subscriptionType string
-			var tokenExpiry *int64
+			var trialExpiry *int64
 
 			// 提取订阅类型
 			if subInfo, ok := quota["subscriptionInfo"].(map[string]interface{}); ok {
@@ -343,11 +437,11 @@ func (s *Server) RefreshAllAccountsQuota(ctx context.Context) {
 						usageCurrent = freeUsed + outerUsed
 						usageLimit = freeLimit + outerLimit
 
-						// 提取有效时间
+						// 提取试用到期时间
 						if expiry, ok := freeTrialInfo["freeTrialExpiry"]; ok {
 							if expiryVal, ok := expiry.(float64); ok {
 								expiryInt := int64(expiryVal)
-								tokenExpiry = &expiryInt
+								trialExpiry = &expiryInt
 							}
 						}
 					} else {
@@ -358,7 +452,8 @@ func (s *Server) RefreshAllAccountsQuota(ctx context.Context) {
 			}
 
 			// 更新数据库（同时更新配额数据）
-			if err := s.db.UpdateAccountQuota(ctx, account.ID, usageCurrent, usageLimit, subscriptionType, tokenExpiry); err != nil {
+			s.metrics.RecordQuota(account.ID, time.Now(), usageCurrent, usageLimit)
+			if err := s.db.UpdateAccountQuota(ctx, account.ID, usageCurrent, usageLimit, subscriptionType, trialExpiry); err != nil {
 				logger.Debug("[配额同步] 更新账号 %s 配额失败 - 耗时: %.0fms, 错误: %v", account.ID, elapsed.Seconds()*1000, err)
 				atomic.AddInt32(&errorCount, 1)
 			} else {
@@ -423,7 +518,7 @@ func (s *Server) RefreshAllAccountsQuotaWithStats(ctx context.Context) map[strin
 			accountStartTime := time.Now()
 
 			machineId := s.ensureAccountMachineID(ctx, account)
-			quota, err := s.aqClient.GetUsageLimits(ctx, *account.AccessToken, machineId, "AGENTIC_REQUEST")
+			quota, err := s.aqClient.GetUsageLimits(ctx, auth.RegionOf(account.Region), *account.AccessToken, machineId, "AGENTIC_REQUEST")
 
 			elapsed := time.Since(accountStartTime)
 
@@ -458,7 +553,7 @@ func (s *Server) RefreshAllAccountsQuotaWithStats(ctx context.Context) map[strin
 			// 提取配额信息
 			var usageCurrent, usageLimit float64
 			var subscriptionType string
-			var tokenExpiry *int64
+			var trialExpiry *int64
 
 			// 提取订阅类型
 			if subInfo, ok := quota["subscriptionInfo"].(map[string]interface{}); ok {
@@ -479,11 +574,11 @@ func (s *Server) RefreshAllAccountsQuotaWithStats(ctx context.Context) map[strin
 						usageCurrent = freeUsed + outerUsed
 						usageLimit = freeLimit + outerLimit
 
-						// 提取有效时间
+						// 提取试用到期时间
 						if expiry, ok := freeTrialInfo["freeTrialExpiry"]; ok {
 							if expiryVal, ok := expiry.(float64); ok {
 								expiryInt := int64(expiryVal)
-								tokenExpiry = &expiryInt
+								trialExpiry = &expiryInt
 							}
 						}
 					} else {
@@ -494,7 +589,8 @@ func (s *Server) RefreshAllAccountsQuotaWithStats(ctx context.Context) map[strin
 			}
 
 			// 更新数据库配额信息
-			if err := s.db.UpdateAccountQuota(ctx, account.ID, usageCurrent, usageLimit, subscriptionType, tokenExpiry); err != nil {
+			s.metrics.RecordQuota(account.ID, time.Now(), usageCurrent, usageLimit)
+			if err := s.db.UpdateAccountQuota(ctx, account.ID, usageCurrent, usageLimit, subscriptionType, trialExpiry); err != nil {
 				logger.Debug("[配额同步] 更新账号 %s 配额失败 - 耗时: %.0fms, 错误: %v", account.ID, elapsed.Seconds()*1000, err)
 				atomic.AddInt32(&errorCount, 1)
 			} else {
@@ -524,7 +620,16 @@ func (s *Server) RefreshAllAccountsQuotaWithStats(ctx context.Context) map[strin
 // RebuildAmazonQClient 重建 Amazon Q 客户端（代理配置变更时调用）
 // @author ygw
 func (s *Server) RebuildAmazonQClient() {
-	s.aqClient = amazonq.NewClient(s.cfg)
+	old := s.aqClient
+	client := amazonq.NewClient(s.cfg)
+	if old != nil {
+		old.SetProxyPool(nil)
+		old.CloseIdleConnections()
+	}
+	if s.proxyPool != nil {
+		client.SetProxyPool(s.proxyPool)
+	}
+	s.aqClient = client
 	logger.Info("Amazon Q 客户端已重建")
 }
 
@@ -546,6 +651,12 @@ func (s *Server) Router() *gin.Engine {
 	r := gin.New()        // 使用 gin.New() 替代 gin.Default()，避免重复日志
 	r.Use(gin.Recovery()) // 只保留 Recovery 中间件
 
+	// 请求 ID 中间件（生成或透传 x-request-id，并写入日志上下文）
+	r.Use(requestIDMiddleware())
+
+	// 链路追踪中间件（提取 W3C traceparent，仅追踪 API 请求）
+	r.Use(tracing.Middleware("/v1/"))
+
 	// IP黑名单检查中间件
 	r.Use(s.ipBlockMiddleware())
 
@@ -576,7 +687,7 @@ func (s *Server) Router() *gin.Engine {
 		statusCode := c.Writer.Status()
 		clientIP := c.ClientIP()
 
-		logger.LogRequest(method, path, clientIP, statusCode, duration)
+		logger.LogRequest(c.Request.Context(), method, path, clientIP, statusCode, duration)
 	})
 
 	// CORS 中间件
@@ -584,6 +695,7 @@ func (s *Server) Router() *gin.Engine {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "*") // 允许浏览器读取 X-Compression-* 等响应头
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(200)
 			return
@@ -597,112 +709,6 @@ func (s *Server) Router() *gin.Engine {
 	return r
 }
 
-// BackgroundTokenRefresh 后台任务刷新过期令牌
-func (s *Server) BackgroundTokenRefresh(ctx context.Context) {
-	s.refreshStaleTokens(ctx) // 启动后立即刷新一次
-
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			s.refreshStaleTokens(ctx)
-		}
-	}
-}
-
-func (s *Server) refreshStaleTokens(ctx context.Context) {
-	startTime := time.Now()
-
-	// 从数据库读取并发数配置
-	settings, _ := s.db.GetSettings(ctx)
-	concurrency := 10
-	if settings != nil && settings.QuotaRefreshConcurrency > 0 {
-		// 令牌刷新使用配额刷新并发数的一半
-		concurrency = settings.QuotaRefreshConcurrency / 2
-		if concurrency < 5 {
-			concurrency = 5
-		}
-		if concurrency > 20 {
-			concurrency = 20
-		}
-	}
-
-	logger.Debug("[令牌刷新] 开始刷新周期")
-
-	// 全量刷新所有启用的账号
-	enabled := true
-	accounts, err := s.db.ListAccounts(ctx, &enabled, "created_at", true)
-
-	if err != nil {
-		logger.Error("[令牌刷新] 列出账号错误: %v", err)
-		return
-	}
-
-	// 筛选需要刷新的账号
-	now := time.Now()
-	var needRefreshAccounts []*models.Account
-	for _, acc := range accounts {
-		shouldRefresh := false
-
-		if acc.LastRefreshTime == nil || *acc.LastRefreshTime == "" || *acc.LastRefreshTime == "never" {
-			shouldRefresh = true
-		} else {
-			lastRefresh, err := time.Parse(models.TimeFormat, *acc.LastRefreshTime)
-			// 刷新阈值：20 分钟
-			if err != nil || now.Sub(lastRefresh) > 20*time.Minute {
-				shouldRefresh = true
-			}
-		}
-
-		if shouldRefresh {
-			needRefreshAccounts = append(needRefreshAccounts, acc)
-		}
-	}
-
-	if len(needRefreshAccounts) == 0 {
-		logger.Debug("[令牌刷新] 没有需要刷新的账号")
-		return
-	}
-
-	logger.Info("[令牌刷新] 开始刷新 %d 个账号的令牌, 并发数: %d", len(needRefreshAccounts), concurrency)
-
-	// 使用配置的并发数
-	semaphore := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
-
-	// 统计结果
-	var successCount, failCount int32
-
-	for _, acc := range needRefreshAccounts {
-		wg.Add(1)
-		go func(account *models.Account) {
-			defer wg.Done()
-			semaphore <- struct{}{}        // 获取信号量
-			defer func() { <-semaphore }() // 释放信号量
-
-			accountStartTime := time.Now()
-
-			if err := s.refreshAccountToken(ctx, account.ID); err != nil {
-				elapsed := time.Since(accountStartTime)
-				logger.Warn("[令牌刷新] 刷新账号 %s 失败 - 耗时: %.0fms, 错误: %v", account.ID, elapsed.Seconds()*1000, err)
-				atomic.AddInt32(&failCount, 1)
-			} else {
-				elapsed := time.Since(accountStartTime)
-				logger.Debug("[令牌刷新] 刷新账号 %s 成功 - 耗时: %.0fms", account.ID, elapsed.Seconds()*1000)
-				atomic.AddInt32(&successCount, 1)
-			}
-		}(acc)
-	}
-
-	wg.Wait()
-	totalElapsed := time.Since(startTime)
-	logger.Info("[令牌刷新] 刷新完成 - 成功: %d, 失败: %d, 总耗时: %.0fms", successCount, failCount, totalElapsed.Seconds()*1000)
-}
-
 // ensureAccountMachineID 确保账户有持久化的 machineId
 // 如果账户没有 machineId（历史账户），则生成新的并保存到数据库
 // 返回有效的 machineId
@@ -725,7 +731,9 @@ func (s *Server) ensureAccountMachineID(ctx context.Context, acc *models.Account
 func (s *Server) refreshAccountToken(ctx context.Context, accountID string) error {
 	// 使用 singleflight 模式，避免同一账号的重复刷新
 	result := s.tokenRefresher.TryRefresh(accountID, func() error {
-		return s.doRefreshAccountToken(ctx, accountID)
+		return s.withRefreshLock(ctx, accountID, func() error {
+			return s.doRefreshAccountToken(ctx, accountID)
+		})
 	})
 
 	if result.Skipped {
@@ -751,62 +759,48 @@ func (s *Server) doRefreshAccountToken(ctx context.Context, accountID string) er
 	// 确保账户有持久化的 machineId
 	machineId := s.ensureAccountMachineID(ctx, acc)
 
-	var accessToken, refreshToken string
-
-	// 判断是否为社交登录账号（clientId 以 "social-" 开头）
-	isSocialLogin := strings.HasPrefix(acc.ClientID, "social-")
-
-	if isSocialLogin {
-		// 社交登录账号使用 Kiro 刷新接口
-		logger.Debug("使用 Kiro 社交登录刷新接口 - 账号: %s", accountID)
-		result, err := s.kiroClient.RefreshSocialToken(ctx, *acc.RefreshToken, machineId)
-		if err != nil {
-			// 更新状态为失败，UpdateStats 会自动处理错误计数和禁用逻辑
-			_ = s.db.UpdateTokens(ctx, accountID, "", *acc.RefreshToken, "failed")
-			_ = s.db.UpdateStats(ctx, accountID, false)
-			return fmt.Errorf("社交登录刷新失败: %w", err)
-		}
-
-		if !result.Success {
-			// 更新状态为失败，UpdateStats 会自动处理错误计数和禁用逻辑
-			_ = s.db.UpdateTokens(ctx, accountID, "", *acc.RefreshToken, "failed")
-			_ = s.db.UpdateStats(ctx, accountID, false)
-			return fmt.Errorf("社交登录刷新失败: %s", result.Error)
-		}
+	// OIDC 账号缺少客户端凭证时无法刷新，不计入失败
+	if !auth.IsSocialClientID(acc.ClientID) && (acc.ClientID == "" || acc.ClientSecret == "") {
+		return fmt.Errorf("账号缺少 clientId 或 clientSecret，无法刷新令牌")
+	}
 
-		accessToken = result.AccessToken
-		refreshToken = result.RefreshToken
-		if refreshToken == "" {
-			refreshToken = *acc.RefreshToken // 保持原来的 refreshToken
-		}
-	} else {
-		// OIDC 账号使用标准刷新接口
-		if acc.ClientID == "" || acc.ClientSecret == "" {
-			return fmt.Errorf("账号缺少 clientId 或 clientSecret，无法刷新令牌")
-		}
+	// 社交登录账号使用 Kiro 刷新接口，其余使用 OIDC 标准刷新接口
+	logger.Debug("刷新账号令牌 - 账号: %s, 社交登录: %v", accountID, auth.IsSocialClientID(acc.ClientID))
+	accessToken, refreshToken, expiresIn, err := auth.RefreshTokens(ctx, s.oidcClient, s.kiroClient, auth.RegionOf(acc.Region), acc.ClientID, acc.ClientSecret, *acc.RefreshToken, machineId)
+	if err != nil {
+		// 更新状态为失败，UpdateStats 会自动处理错误计数和禁用逻辑
+		_ = s.db.UpdateTokens(ctx, accountID, "", *acc.RefreshToken, "failed")
+		_ = s.db.UpdateStats(ctx, accountID, false)
+		s.notifyRefreshFailed(accountID, err)
+		return err
+	}
 
-		logger.Debug("使用 OIDC 标准刷新接口 - 账号: %s", accountID)
-		var err error
-		accessToken, refreshToken, err = s.oidcClient.RefreshAccessToken(ctx, acc.ClientID, acc.ClientSecret, *acc.RefreshToken, machineId)
-		if err != nil {
-			// 更新状态为失败，UpdateStats 会自动处理错误计数和禁用逻辑
-			_ = s.db.UpdateTokens(ctx, accountID, "", *acc.RefreshToken, "failed")
-			_ = s.db.UpdateStats(ctx, accountID, false)
-			return err
-		}
+	// 记录本次刷新时旧令牌的剩余有效期
+	if prev := tokenExpiresAt(acc); !prev.IsZero() {
+		s.tokenScheduler.RecordLead(time.Until(prev))
 	}
 
-	// 更新令牌
-	return s.db.UpdateTokens(ctx, accountID, accessToken, refreshToken, "success")
+	// 更新令牌并按新过期时间安排下一次刷新
+	expiresAt := time.Now().Add(tokenDefaultLifetime)
+	var expiresAtUnix int64
+	if expiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+		expiresAtUnix = expiresAt.Unix()
+	}
+	if err := s.db.UpdateTokensWithExpiry(ctx, accountID, accessToken, refreshToken, "success", expiresAtUnix); err != nil {
+		return err
+	}
+	s.tokenScheduler.Schedule(accountID, expiresAt)
+	return nil
 }
 
-// requireAccount 中间件：需要账号（授权）
+// requireAPIKey 中间件：验证 API key（授权），账号在请求通过准入控制后由 acquireAccount 选择
 // 验证逻辑：
 // 1. 用户 API key 正确 → 通过
 // 2. 系统 apiKey 正确 → 通过
 // 3. 系统 apiKey 为空 且 用户表为空 → 放行（开发模式）
 // 4. 否则 → 拒绝
-func (s *Server) requireAccount(c *gin.Context) {
+func (s *Server) requireAPIKey(c *gin.Context) {
 	apiKey := extractBearerToken(c)
 	if apiKey == "" {
 		logger.Warn("API key 验证失败 - 未提供 API key - 来源: %s", c.ClientIP())
@@ -826,31 +820,15 @@ func (s *Server) requireAccount(c *gin.Context) {
 			c.Abort()
 			return
 		}
-		// 每日请求限制检查：指定IP每日限制 > 用户每日请求限制 @author ygw
-		ipDailyAllowed, ipDailyReason := s.checkDailyRequestLimit(c.Request.Context(), c.ClientIP(), user)
-		if !ipDailyAllowed {
-			logger.Warn("IP每日请求限制触发 - IP: %s - 原因: %s", c.ClientIP(), ipDailyReason)
-			c.JSON(429, gin.H{"error": ipDailyReason})
-			c.Abort()
-			return
-		}
-		// 用户配额检查（包含用户每日请求限制、每日token配额、月度token配额）
-		allowed, reason, err := s.db.CheckUserQuota(c.Request.Context(), user.ID)
-		if err != nil {
-			logger.Error("检查用户配额失败: %v - 用户: %s", err, user.ID)
-			c.JSON(500, gin.H{"error": "内部服务器错误"})
-			c.Abort()
-			return
-		}
-		if !allowed {
-			logger.Warn("用户配额已用尽 - 用户: %s (%s) - 原因: %s - 来源: %s", user.Name, user.ID, reason, c.ClientIP())
-			c.JSON(429, gin.H{"error": "配额已用尽: " + reason})
-			c.Abort()
+		// 每日请求限制和用户配额检查（指定IP每日限制、用户每日请求次数、每日/月度 token 配额）
+		if !s.checkUserQuota(c, user) {
 			return
 		}
 		c.Set("user", user)
 		c.Set("api_key_prefix", apiKey[:12]+"...")
-		logger.Info("用户 API key 验证成功 - 用户: %s (%s) - 来源: %s", user.Name, user.ID, c.ClientIP())
+		logger.AddFields(c.Request.Context(), logger.Fields{UserID: user.ID})
+		tracing.SetAttributes(c.Request.Context(), tracing.AttrUserID.String(user.ID))
+		logger.Ctx(c.Request.Context()).Info("用户 API key 验证成功 - 用户: %s (%s) - 来源: %s", user.Name, user.ID, c.ClientIP())
 		validated = true
 	}
 
@@ -882,18 +860,29 @@ func (s *Server) requireAccount(c *gin.Context) {
 		return
 	}
 
-	// 选择账号
+	c.Next()
+}
+
+// acquireAccount 选择处理请求的账号并存入上下文，无可用账号时返回 503 并返回 nil
+// 应在 admitRequest 之后调用，使排队中的请求等到有容量时再选择账号
+// @author ygw
+func (s *Server) acquireAccount(c *gin.Context) *models.Account {
+	_, selectSpan := tracing.Start(c.Request.Context(), tracing.SpanAccountSelect)
 	account, err := s.selectAccount(c.Request.Context())
+	if account != nil {
+		selectSpan.SetAttributes(tracing.AttrAccountID.String(account.ID))
+	}
+	tracing.End(selectSpan, err)
 	if err != nil {
-		logger.Error("选择账号失败: %v - 来源: %s", err, c.ClientIP())
+		logger.Ctx(c.Request.Context()).Error("选择账号失败: %v - 来源: %s", err, c.ClientIP())
 		c.JSON(503, gin.H{"error": "无可用账号，请先添加并配置账号"})
-		c.Abort()
-		return
+		return nil
 	}
 
 	// 将账号存储在上下文中
 	c.Set("account", account)
-	c.Next()
+	logger.AddFields(c.Request.Context(), logger.Fields{AccountID: account.ID})
+	return account
 }
 
 func (s *Server) selectAccount(ctx context.Context) (*models.Account, error) {
@@ -949,6 +938,8 @@ type AuthSession struct {
 	Error                   *string
 	AccountID               *string
 	MachineID               string // Kiro 设备标识
+	Region                  string // 设备授权所在区域，轮询和创建账号时沿用
+	StartURL                string // IdC 起始地址
 }
 
 func (s *Server) requireAdmin(c *gin.Context) {
@@ -1064,6 +1055,42 @@ func (s *Server) handleLogout(c *gin.Context) {
 	c.JSON(200, gin.H{"success": true})
 }
 
+// requestIDHeader 请求 ID 头
+const requestIDHeader = "x-request-id"
+
+// requestIDMiddleware 请求 ID 中间件
+// 优先使用客户端传入的 x-request-id（需为安全字符且不超过 36 位），否则生成新的 UUID
+// 请求 ID 会写入响应头、gin 上下文和日志上下文，仅用于关联；请求日志主键 log_id 始终由服务端生成，
+// 避免客户端重复或伪造的 ID 与已有日志主键冲突
+// @author ygw
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Set("log_id", uuid.New().String())
+		c.Header(requestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(), logger.Fields{RequestID: requestID}))
+		c.Next()
+	}
+}
+
+// isValidRequestID 校验外部传入的请求 ID，防止日志注入
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 36 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
 // ipBlockMiddleware IP黑名单检查中间件（使用内存缓存减少数据库查询）
 func (s *Server) ipBlockMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -1129,69 +1156,7 @@ func (s *Server) refreshBlockedIPCache(ctx context.Context) {
 // 只应用于 /v1/messages 和 /v1/chat/completions 接口
 // @author ygw
 func (s *Server) apiRateLimitMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		ctx := c.Request.Context()
-
-		// 1. 最高优先级：检查指定IP是否有单独设置
-		ipConfig, err := s.ipConfigCache.Get(ctx, clientIP)
-		if err == nil && ipConfig != nil && ipConfig.RateLimitRPM > 0 {
-			// 指定IP有单独的频率限制
-			result := s.rateLimiter.CheckIP(clientIP, ipConfig.RateLimitRPM)
-			if !result.Allowed {
-				logger.Warn("指定IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-				c.JSON(429, gin.H{
-					"error": fmt.Sprintf("请求过于频繁，请稍后重试（指定IP限制：%d 次/分钟）", result.Limit),
-					"code":  "IP_RATE_LIMIT_EXCEEDED",
-					"type":  "rate_limit_error",
-				})
-				c.Abort()
-				return
-			}
-			// 指定IP有设置，跳过后续限制检查
-			c.Next()
-			return
-		}
-
-		// 2. 次优先级：检查用户是否设置了单独的频率限制
-		if user, exists := c.Get("user"); exists {
-			if u, ok := user.(*models.User); ok && u.RateLimitRPM > 0 {
-				// 用户设置了单独的频率限制，使用 API Key 限流
-				result := s.rateLimiter.CheckAPIKey(u.APIKey, u.RateLimitRPM)
-				if !result.Allowed {
-					logger.Warn("API Key 限流触发 - 用户: %s (%s), 请求数: %d, 限制: %d/分钟", u.Name, u.ID, result.Count, result.Limit)
-					c.JSON(429, gin.H{
-						"error": fmt.Sprintf("请求过于频繁，请稍后重试（API Key限制：%d 次/分钟）", result.Limit),
-						"code":  "APIKEY_RATE_LIMIT_EXCEEDED",
-						"type":  "rate_limit_error",
-					})
-					c.Abort()
-					return
-				}
-				// 用户有单独设置，跳过系统统一IP限制
-				c.Next()
-				return
-			}
-		}
-
-		// 3. 最低优先级：使用系统统一 IP 限流
-		settings, err := s.settingsCache.Get(ctx)
-		if err == nil && settings != nil && settings.EnableIPRateLimit && settings.IPRateLimitMax > 0 {
-			result := s.rateLimiter.CheckIP(clientIP, settings.IPRateLimitMax)
-			if !result.Allowed {
-				logger.Warn("系统IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-				c.JSON(429, gin.H{
-					"error": fmt.Sprintf("请求过于频繁，请稍后重试（IP限制：%d 次/分钟）", result.Limit),
-					"code":  "IP_RATE_LIMIT_EXCEEDED",
-					"type":  "rate_limit_error",
-				})
-				c.Abort()
-				return
-			}
-		}
-
-		c.Next()
-	}
+	return s.postAuthRateLimitMiddleware()
 }
 
 // preAuthRateLimitMiddleware 认证前的空中间件（保留兼容性）
@@ -1211,129 +1176,25 @@ func (s *Server) preAuthRateLimitMiddleware() gin.HandlerFunc {
 // @author ygw
 func (s *Server) postAuthRateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		ctx := c.Request.Context()
-
-		// 1. 最高优先级：检查指定IP是否有单独设置
-		ipConfig, err := s.ipConfigCache.Get(ctx, clientIP)
-		if err == nil && ipConfig != nil && ipConfig.RateLimitRPM > 0 {
-			// 指定IP有单独的频率限制
-			result := s.rateLimiter.CheckIP(clientIP, ipConfig.RateLimitRPM)
-			if !result.Allowed {
-				logger.Warn("指定IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-				c.JSON(429, gin.H{
-					"error": fmt.Sprintf("请求过于频繁，请稍后重试（指定IP限制：%d 次/分钟）", result.Limit),
-					"code":  "IP_RATE_LIMIT_EXCEEDED",
-					"type":  "rate_limit_error",
-				})
-				c.Abort()
-				return
-			}
-			// 指定IP有设置，跳过后续限制检查
-			c.Next()
-			return
+		var user *models.User
+		if v, exists := c.Get("user"); exists {
+			user, _ = v.(*models.User)
 		}
-
-		// 2. 次优先级：检查用户是否设置了单独的频率限制
-		if user, exists := c.Get("user"); exists {
-			if u, ok := user.(*models.User); ok && u.RateLimitRPM > 0 {
-				// 用户设置了单独的频率限制，使用 API Key 限流
-				result := s.rateLimiter.CheckAPIKey(u.APIKey, u.RateLimitRPM)
-				if !result.Allowed {
-					logger.Warn("API Key 限流触发 - 用户: %s (%s), 请求数: %d, 限制: %d/分钟", u.Name, u.ID, result.Count, result.Limit)
-					c.JSON(429, gin.H{
-						"error": fmt.Sprintf("请求过于频繁，请稍后重试（API Key限制：%d 次/分钟）", result.Limit),
-						"code":  "APIKEY_RATE_LIMIT_EXCEEDED",
-						"type":  "rate_limit_error",
-					})
-					c.Abort()
-					return
-				}
-				// 用户有单独设置，跳过系统统一IP限制
-				c.Next()
-				return
-			}
-		}
-
-		// 3. 最低优先级：使用系统统一 IP 限流
-		settings, err := s.settingsCache.Get(ctx)
-		if err == nil && settings != nil && settings.EnableIPRateLimit && settings.IPRateLimitMax > 0 {
-			result := s.rateLimiter.CheckIP(clientIP, settings.IPRateLimitMax)
-			if !result.Allowed {
-				logger.Warn("系统IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-				c.JSON(429, gin.H{
-					"error": fmt.Sprintf("请求过于频繁，请稍后重试（IP限制：%d 次/分钟）", result.Limit),
-					"code":  "IP_RATE_LIMIT_EXCEEDED",
-					"type":  "rate_limit_error",
-				})
-				c.Abort()
-				return
-			}
+		if !s.checkRequestRateLimit(c, user) {
+			return
 		}
-
 		c.Next()
 	}
 }
 
-// checkIPRateLimit 检查IP频率限制（指定IP设置 > 系统统一IP设置）
-// 返回 true 表示被限流，false 表示通过
-// @author ygw
-func (s *Server) checkIPRateLimit(ctx context.Context, clientIP string) bool {
-	// 1. 优先检查指定IP是否有单独设置
-	ipConfig, err := s.ipConfigCache.Get(ctx, clientIP)
-	if err == nil && ipConfig != nil && ipConfig.RateLimitRPM > 0 {
-		// 指定IP有单独的频率限制
-		result := s.rateLimiter.CheckIP(clientIP, ipConfig.RateLimitRPM)
-		if !result.Allowed {
-			logger.Warn("指定IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-			return true
-		}
-		return false // 指定IP有设置且通过，不再检查系统统一设置
-	}
-
-	// 2. 检查系统统一 IP 限流
-	settings, err := s.settingsCache.Get(ctx)
-	if err == nil && settings != nil && settings.EnableIPRateLimit && settings.IPRateLimitMax > 0 {
-		result := s.rateLimiter.CheckIP(clientIP, settings.IPRateLimitMax)
-		if !result.Allowed {
-			logger.Warn("系统IP限流触发 - IP: %s, 请求数: %d, 限制: %d/分钟", clientIP, result.Count, result.Limit)
-			return true
-		}
-	}
-
-	return false
-}
 
-// checkDailyRequestLimit 检查每日请求限制
-// 优先级：指定IP每日请求限制 > 用户每日请求限制
-// 返回: (allowed bool, reason string)
-// @author ygw
-func (s *Server) checkDailyRequestLimit(ctx context.Context, clientIP string, user *models.User) (bool, string) {
-	// 1. 最高优先级：检查指定IP的每日请求限制
-	ipConfig, err := s.ipConfigCache.Get(ctx, clientIP)
-	if err == nil && ipConfig != nil && ipConfig.DailyRequestLimit > 0 {
-		allowed, count, err := s.db.CheckIPDailyLimit(ctx, clientIP, ipConfig.DailyRequestLimit)
-		if err != nil {
-			logger.Error("检查IP每日请求限制失败: %v - IP: %s", err, clientIP)
-			// 出错时不阻止请求
-		} else if !allowed {
-			reason := fmt.Sprintf("IP每日请求次数已用尽 (%d/%d 次)", count, ipConfig.DailyRequestLimit)
-			logger.Warn("IP每日请求限制触发 - IP: %s, 已请求: %d, 限制: %d", clientIP, count, ipConfig.DailyRequestLimit)
-			return false, reason
-		}
-		// IP有设置且通过，跳过用户每日请求限制检查
-		return true, ""
-	}
-
-	// 2. 次优先级：检查用户的每日请求限制（由 CheckUserQuota 处理）
-	// 这里不处理，留给原有的 CheckUserQuota 函数
-	return true, ""
-}
 
 // GetRateLimiterStats 获取限流器统计信息
 // @author ygw
 func (s *Server) GetRateLimiterStats() map[string]interface{} {
-	return s.rateLimiter.Stats()
+	stats := s.rateLimiter.Stats()
+	stats["token_limiter"] = s.tokenLimiter.Stats()
+	return stats
 }
 
 // StopRateLimiter 停止限流器
@@ -1342,6 +1203,12 @@ func (s *Server) StopRateLimiter() {
 	if s.rateLimiter != nil {
 		s.rateLimiter.Stop()
 	}
+	if s.tokenLimiter != nil {
+		s.tokenLimiter.Stop()
+	}
+	if s.admission != nil {
+		s.admission.Stop()
+	}
 }
 
 // requestLogMiddleware 请求日志中间件
@@ -1360,10 +1227,15 @@ func (s *Server) requestLogMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 保存账号指标（与请求日志开关无关）
+		s.recordRequestMetrics(c, time.Since(startTime))
+
 		settings, _ := s.settingsCache.Get(c.Request.Context())
 		if settings == nil || !settings.EnableRequestLog {
 			return
 		}
+		// 载荷采集通过 log_id 关联请求日志，仅在记录请求日志时保存
+		s.finishCapture(c)
 
 		duration := time.Since(startTime)
 		statusCode := c.Writer.Status()
@@ -1379,8 +1251,15 @@ func (s *Server) requestLogMiddleware() gin.HandlerFunc {
 		outputTokens, _ := c.Get("output_tokens")
 		errorMsg, _ := c.Get("error_message")
 
+		// 请求日志主键由服务端生成，x-request-id 单独记录用于关联服务日志
+		logID := c.GetString("log_id")
+		if logID == "" {
+			logID = uuid.New().String()
+		}
+
 		log := &models.RequestLog{
-			ID:           uuid.New().String(),
+			ID:           logID,
+			RequestID:    strPtr(c.GetString("request_id")),
 			Timestamp:    models.CurrentTime(),
 			ClientIP:     c.ClientIP(),
 			Method:       c.Request.Method,
@@ -1439,6 +1318,14 @@ func (s *Server) requestLogMiddleware() gin.HandlerFunc {
 				log.ErrorMessage = &errStr
 			}
 		}
+		if v, ok := c.Get("compression"); ok {
+			if report, ok := v.(*compressor.Report); ok {
+				log.OriginalInputTokens = report.TokensBefore
+				log.SummaryBlocks = report.SummaryBlocks
+				log.CompressionCacheHit = report.CacheHit
+				log.CompressionStrategies = strPtr(strings.Join(report.Applied(), ","))
+			}
+		}
 
 		// 如果是成功的请求且有用户信息和token数据，更新用户token使用量
 		if log.IsSuccess && user != nil && (log.InputTokens > 0 || log.OutputTokens > 0) {
@@ -1509,11 +1396,21 @@ func (s *Server) flushLogs(logs []*models.RequestLog) {
 
 // StopLogWorker 停止日志worker
 func (s *Server) StopLogWorker() {
+	s.stopMetricsWorker() // 先写入剩余的账号指标
 	s.closing.Store(true) // 标记服务器正在关闭
 	close(s.logChan)
 	close(s.dbWriteChan)
 	s.logWg.Wait()
 	s.dbWriteWg.Wait()
+	if s.notifier != nil {
+		s.notifier.Close()
+	}
+	if s.coord != nil {
+		s.coord.Close()
+	}
+	if s.redis != nil {
+		s.redis.Close()
+	}
 }
 
 // DBWriteWorkerCount 数据库写 worker 数量
@@ -1549,6 +1446,24 @@ func (s *Server) dbWriteWorker(workerID int) {
 					logger.Debug("Worker %d: 更新token使用量失败: %v", workerID, err)
 				}
 			}
+		case "metrics":
+			if data, ok := op.data.([]*models.AccountMetric); ok {
+				if err := s.db.SaveAccountMetrics(ctx, data); err != nil {
+					logger.Debug("Worker %d: 保存账号指标失败: %v", workerID, err)
+				}
+			}
+		case "capture":
+			if data, ok := op.data.(*models.PayloadCapture); ok {
+				if err := s.db.SavePayloadCapture(ctx, data); err != nil {
+					logger.Debug("Worker %d: 保存载荷采集失败: %v", workerID, err)
+				}
+			}
+		case "sticky_proxy":
+			if data, ok := op.data.(stickyProxyUpdate); ok {
+				if err := s.db.SetAccountStickyProxy(ctx, data.accountID, data.proxyID); err != nil {
+					logger.Debug("Worker %d: 保存粘性代理分配失败: %v", workerID, err)
+				}
+			}
 		}
 	}
 }
@@ -1565,6 +1480,18 @@ func (s *Server) QueueStatsUpdate(accountID string, success bool) {
 	}
 }
 
+// queueStickyProxy 将粘性代理分配加入写队列（代理池产生新分配时回调）
+func (s *Server) queueStickyProxy(accountID string, proxyID int64) {
+	if s.closing.Load() {
+		return
+	}
+	select {
+	case s.dbWriteChan <- dbWriteOp{opType: "sticky_proxy", data: stickyProxyUpdate{accountID: accountID, proxyID: proxyID}}:
+	default:
+		logger.Warn("数据库写队列已满，丢弃粘性代理分配")
+	}
+}
+
 // LogFailedRequest 记录失败的请求日志（用于换号重试时记录中间失败）
 // @author ygw
 func (s *Server) LogFailedRequest(c *gin.Context, acc *models.Account, model string, isStream bool, errMsg string, startTime time.Time) {
@@ -1637,13 +1564,21 @@ func getEndpointType(path string) *string {
 
 func (s *Server) handleAuthStart(c *gin.Context) {
 	var req struct {
-		Label   *string `json:"label"`
-		Enabled *bool   `json:"enabled"`
+		Label    *string `json:"label"`
+		Enabled  *bool   `json:"enabled"`
+		Region   string  `json:"region"`
+		StartURL string  `json:"startUrl"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "无效的请求格式"})
 		return
 	}
+	if !auth.ValidRegion(req.Region) {
+		c.JSON(400, gin.H{"error": "无效的区域: " + req.Region})
+		return
+	}
+	region := auth.NormalizeRegion(req.Region)
+	startURL := auth.StartURLOf(&req.StartURL)
 
 	// 检查账号数量限制
 	existingAccounts, err := s.db.ListAccounts(c.Request.Context(), nil, "created_at", false)
@@ -1666,14 +1601,14 @@ func (s *Server) handleAuthStart(c *gin.Context) {
 	machineId := auth.GenerateKiroMachineID()
 
 	// 注册客户端
-	clientID, clientSecret, err := s.oidcClient.RegisterClient(c.Request.Context(), machineId)
+	clientID, clientSecret, err := s.oidcClient.RegisterClient(c.Request.Context(), region, machineId)
 	if err != nil {
 		c.JSON(502, gin.H{"error": fmt.Sprintf("OIDC error: %v", err)})
 		return
 	}
 
 	// 开始设备授权
-	devResp, err := s.oidcClient.DeviceAuthorize(c.Request.Context(), clientID, clientSecret, machineId)
+	devResp, err := s.oidcClient.DeviceAuthorize(c.Request.Context(), region, startURL, clientID, clientSecret, machineId)
 	if err != nil {
 		c.JSON(502, gin.H{"error": fmt.Sprintf("OIDC error: %v", err)})
 		return
@@ -1693,6 +1628,8 @@ func (s *Server) handleAuthStart(c *gin.Context) {
 		Enabled:                 req.Enabled == nil || *req.Enabled,
 		Status:                  "pending",
 		MachineID:               machineId,
+		Region:                  region,
+		StartURL:                startURL,
 	}
 
 	s.authSessions.Store(authID, session)
@@ -1703,6 +1640,7 @@ func (s *Server) handleAuthStart(c *gin.Context) {
 		"userCode":                session.UserCode,
 		"expiresIn":               session.ExpiresIn,
 		"interval":                session.Interval,
+		"region":                  session.Region,
 	})
 }
 
@@ -1747,7 +1685,7 @@ func (s *Server) handleAuthClaim(c *gin.Context) {
 	}
 
 	// 轮询令牌 - 最大等待10分钟
-	tokens, err := s.oidcClient.PollToken(c.Request.Context(), session.ClientID, session.ClientSecret, session.DeviceCode, session.MachineID, session.Interval, min(session.ExpiresIn, 600))
+	tokens, err := s.oidcClient.PollToken(c.Request.Context(), session.Region, session.ClientID, session.ClientSecret, session.DeviceCode, session.MachineID, session.Interval, min(session.ExpiresIn, 600))
 	if err != nil {
 		errStr := err.Error()
 		session.Status = "error"
@@ -1756,33 +1694,15 @@ func (s *Server) handleAuthClaim(c *gin.Context) {
 		return
 	}
 
-	accessToken, _ := tokens["accessToken"].(string)
-	refreshToken, _ := tokens["refreshToken"].(string)
-
-	if accessToken == "" {
-		errStr := "No accessToken returned"
+	account, err := newDeviceAccount(tokens, session.Label, session.Enabled, session.ClientID, session.ClientSecret, session.MachineID, session.Region, session.StartURL)
+	if err != nil {
+		errStr := err.Error()
 		session.Status = "error"
 		session.Error = &errStr
 		c.JSON(502, gin.H{"error": errStr})
 		return
 	}
-
-	// 创建账号（保存 machineId）
-	accountID := uuid.New().String()
-	account := &models.Account{
-		ID:                accountID,
-		Label:             session.Label,
-		ClientID:          session.ClientID,
-		ClientSecret:      session.ClientSecret,
-		RefreshToken:      &refreshToken,
-		AccessToken:       &accessToken,
-		LastRefreshTime:   strPtr(models.CurrentTime()),
-		LastRefreshStatus: strPtr("success"),
-		CreatedAt:         models.CurrentTime(),
-		UpdatedAt:         models.CurrentTime(),
-		Enabled:           session.Enabled,
-		MachineID:         &session.MachineID,
-	}
+	accountID := account.ID
 
 	if err := s.db.CreateAccount(c.Request.Context(), account); err != nil {
 		c.JSON(500, gin.H{"error": "创建账号失败"})
@@ -1798,6 +1718,39 @@ func (s *Server) handleAuthClaim(c *gin.Context) {
 	})
 }
 
+// newDeviceAccount 根据设备授权得到的令牌构造账号（保存 machineId、区域和 IdC 起始地址）
+func newDeviceAccount(tokens map[string]interface{}, label *string, enabled bool, clientID, clientSecret, machineID, region, startURL string) (*models.Account, error) {
+	accessToken, _ := tokens["accessToken"].(string)
+	refreshToken, _ := tokens["refreshToken"].(string)
+	if accessToken == "" {
+		return nil, fmt.Errorf("No accessToken returned")
+	}
+
+	account := &models.Account{
+		ID:                uuid.New().String(),
+		Label:             label,
+		ClientID:          clientID,
+		ClientSecret:      clientSecret,
+		RefreshToken:      &refreshToken,
+		AccessToken:       &accessToken,
+		LastRefreshTime:   strPtr(models.CurrentTime()),
+		LastRefreshStatus: strPtr("success"),
+		CreatedAt:         models.CurrentTime(),
+		UpdatedAt:         models.CurrentTime(),
+		Enabled:           enabled,
+		MachineID:         &machineID,
+		Region:            &region,
+	}
+	if startURL != auth.DefaultStartURL {
+		account.StartURL = &startURL
+	}
+	if expiresIn, _ := tokens["expiresIn"].(float64); expiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second).Unix()
+		account.TokenExpiry = &expiresAt
+	}
+	return account, nil
+}
+
 func strPtr(s string) *string {
 	return &s
 }
@@ -1969,7 +1922,7 @@ func (s *Server) RefreshAccountQuota(ctx context.Context, account *models.Accoun
 	}
 
 	machineId := s.ensureAccountMachineID(ctx, account)
-	quota, err := s.aqClient.GetUsageLimits(ctx, *account.AccessToken, machineId, "AGENTIC_REQUEST")
+	quota, err := s.aqClient.GetUsageLimits(ctx, auth.RegionOf(account.Region), *account.AccessToken, machineId, "AGENTIC_REQUEST")
 
 	if err != nil {
 		// 检查是否为封控错误
@@ -1997,7 +1950,7 @@ func (s *Server) RefreshAccountQuota(ctx context.Context, account *models.Accoun
 	// 提取配额信息并更新数据库
 	var usageCurrent, usageLimit float64
 	var subscriptionType string
-	var tokenExpiry *int64
+	var trialExpiry *int64
 
 	// 提取订阅类型
 	if subInfo, ok := quota["subscriptionInfo"].(map[string]interface{}); ok {
@@ -2018,11 +1971,11 @@ func (s *Server) RefreshAccountQuota(ctx context.Context, account *models.Accoun
 				usageCurrent = freeUsed + outerUsed
 				usageLimit = freeLimit + outerLimit
 
-				// 提取有效时间
+				// 提取试用到期时间
 				if expiry, ok := freeTrialInfo["freeTrialExpiry"]; ok {
 					if expiryVal, ok := expiry.(float64); ok {
 						expiryInt := int64(expiryVal)
-						tokenExpiry = &expiryInt
+						trialExpiry = &expiryInt
 					}
 				}
 			} else {
@@ -2040,7 +1993,7 @@ func (s *Server) RefreshAccountQuota(ctx context.Context, account *models.Accoun
 	}
 
 	// 更新数据库配额信息
-	if err := s.db.UpdateAccountQuota(ctx, account.ID, usageCurrent, usageLimit, subscriptionType, tokenExpiry); err != nil {
+	if err := s.db.UpdateAccountQuota(ctx, account.ID, usageCurrent, usageLimit, subscriptionType, trialExpiry); err != nil {
 		logger.Debug("[被动刷新] 更新账号 %s 配额失败: %v", account.ID, err)
 	} else {
 		logger.Debug("[被动刷新] 账号 %s 配额正常: %.2f/%.2f", account.ID, usageCurrent, usageLimit)
@@ -2067,36 +2020,30 @@ func (s *Server) RefreshAccountTokenAndRetry(ctx context.Context, account *model
 
 // EnsureAccountReady 确保账号可用（被动刷新策略核心函数）
 // 执行流程：
-// 1. 检查令牌是否需要刷新（超过25分钟）→ 是 → 刷新令牌
-// 2. 整个过程对用户透明无感知
+// 1. 访问令牌缺失、已过期或即将过期（不足 1 分钟）→ 同步刷新（无法避免的等待，计入统计）
+// 2. 进入提前刷新窗口 → 交给刷新调度器尽快在后台刷新，本次请求继续使用当前令牌
+// 3. 整个过程对用户透明无感知
 // 注意：配额刷新由用户在页面手动触发，不在请求时自动刷新
 // @author ygw - 被动刷新策略
 func (s *Server) EnsureAccountReady(ctx context.Context, account *models.Account) (*models.Account, error) {
 	startTime := time.Now()
 	logger.Debug("[被动刷新] 开始检查账号 %s 令牌状态", account.ID)
 
-	// 检查并刷新过期的令牌（超过 25 分钟自动刷新）
-	if account.LastRefreshTime == nil || *account.LastRefreshTime == "" || *account.LastRefreshTime == "never" {
-		logger.Debug("[被动刷新] 账号 %s 从未刷新过令牌，执行刷新", account.ID)
+	expiresAt := tokenExpiresAt(account)
+	if remaining := time.Until(expiresAt); expiresAt.IsZero() || remaining < tokenBlockingMargin {
+		logger.Debug("[被动刷新] 账号 %s 令牌缺失或即将过期，执行刷新", account.ID)
+		s.tokenScheduler.RecordBlocking()
 		if err := s.refreshAccountToken(ctx, account.ID); err != nil {
 			logger.Warn("[被动刷新] 账号 %s 令牌刷新失败: %v", account.ID, err)
 			return nil, fmt.Errorf("令牌刷新失败: %w", err)
 		}
 		// 重新获取账号信息
 		account, _ = s.db.GetAccount(ctx, account.ID)
+	} else if remaining < s.tokenScheduler.Window() {
+		logger.Debug("[被动刷新] 账号 %s 令牌剩余 %.0f 秒，交给后台刷新", account.ID, remaining.Seconds())
+		s.tokenScheduler.RefreshSoon(account.ID)
 	} else {
-		lastRefresh, err := time.Parse(models.TimeFormat, *account.LastRefreshTime)
-		if err != nil || time.Since(lastRefresh) > 25*time.Minute {
-			logger.Debug("[被动刷新] 账号 %s 令牌已过期（>25分钟），执行刷新", account.ID)
-			if err := s.refreshAccountToken(ctx, account.ID); err != nil {
-				logger.Warn("[被动刷新] 账号 %s 令牌刷新失败: %v", account.ID, err)
-				return nil, fmt.Errorf("令牌刷新失败: %w", err)
-			}
-			// 重新获取账号信息
-			account, _ = s.db.GetAccount(ctx, account.ID)
-		} else {
-			logger.Debug("[被动刷新] 账号 %s 令牌仍有效，无需刷新", account.ID)
-		}
+		logger.Debug("[被动刷新] 账号 %s 令牌仍有效，无需刷新", account.ID)
 	}
 
 	// 确保账号有访问令牌
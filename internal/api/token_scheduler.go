@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+	"claude-api/internal/refresh"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 令牌刷新调度参数
+const (
+	tokenDefaultLifetime = time.Hour        // 刷新响应未提供 expiresIn 时按此估算访问令牌有效期
+	tokenBlockingMargin  = time.Minute      // 剩余有效期不足该值时请求路径上同步刷新
+	tokenResyncInterval  = 10 * time.Minute // 与账号列表对齐的间隔（新增、删除、禁用账号）
+)
+
+// initTokenScheduler 初始化令牌刷新调度器
+// @author ygw
+func (s *Server) initTokenScheduler() {
+	s.tokenScheduler = refresh.New(refresh.DefaultConfig(), s.refreshScheduledToken)
+}
+
+// refreshScheduledToken 调度到期时刷新账号令牌，返回新的过期时间
+// 多实例部署时各实例都会为同一账号排期：刷新前重新读取过期时间，
+// 其他实例已完成刷新（剩余有效期超出刷新窗口）时不再刷新，按新的过期时间重新排期
+func (s *Server) refreshScheduledToken(ctx context.Context, accountID string) (time.Time, error) {
+	acc, err := s.storedTokenAccount(ctx, accountID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if expiresAt := tokenExpiresAt(acc); time.Until(expiresAt) > s.tokenScheduler.Window() {
+		logger.Debug("[令牌刷新] 账号 %s 已由其他实例刷新，重新排期", accountID)
+		return expiresAt, nil
+	}
+
+	if err := s.refreshAccountToken(ctx, accountID); err != nil {
+		return time.Time{}, err
+	}
+	// 重新读取过期时间（可能由其他实例完成刷新）
+	if acc, err = s.storedTokenAccount(ctx, accountID); err != nil {
+		return time.Time{}, err
+	}
+	expiresAt := tokenExpiresAt(acc)
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(tokenDefaultLifetime)
+	}
+	return expiresAt, nil
+}
+
+// storedTokenAccount 读取账号的最新令牌状态，账号已删除时从调度中移除
+func (s *Server) storedTokenAccount(ctx context.Context, accountID string) (*models.Account, error) {
+	acc, err := s.db.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil {
+		s.tokenScheduler.Remove(accountID)
+		return nil, fmt.Errorf("账号不存在: %s", accountID)
+	}
+	return acc, nil
+}
+
+// tokenExpiresAt 访问令牌过期时间
+// 优先使用刷新响应记录的过期时间，否则按上次刷新时间 + 默认有效期估算；无访问令牌或无法估算时返回零值
+func tokenExpiresAt(acc *models.Account) time.Time {
+	if acc.AccessToken == nil || *acc.AccessToken == "" {
+		return time.Time{}
+	}
+	if acc.TokenExpiry != nil && *acc.TokenExpiry > 0 {
+		return time.Unix(*acc.TokenExpiry, 0)
+	}
+	if acc.LastRefreshTime == nil || *acc.LastRefreshTime == "" || *acc.LastRefreshTime == "never" {
+		return time.Time{}
+	}
+	lastRefresh, err := time.Parse(models.TimeFormat, *acc.LastRefreshTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return lastRefresh.Add(tokenDefaultLifetime)
+}
+
+// tokenRefreshConcurrency 令牌刷新并发数：配额刷新并发数的一半，限制在 5~20
+func (s *Server) tokenRefreshConcurrency(ctx context.Context) int {
+	settings, _ := s.db.GetSettings(ctx)
+	if settings == nil || settings.QuotaRefreshConcurrency <= 0 {
+		return 10
+	}
+	concurrency := settings.QuotaRefreshConcurrency / 2
+	if concurrency < 5 {
+		concurrency = 5
+	}
+	if concurrency > 20 {
+		concurrency = 20
+	}
+	return concurrency
+}
+
+// BackgroundTokenScheduler 后台任务：按访问令牌过期时间主动刷新
+// 每个账号在过期前 5~15 分钟刷新，失败按账号指数退避；定期与账号列表对齐
+// @author ygw
+func (s *Server) BackgroundTokenScheduler(ctx context.Context) {
+	s.syncTokenSchedule(ctx)
+	go s.tokenScheduler.Run(ctx)
+
+	ticker := time.NewTicker(tokenResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncTokenSchedule(ctx)
+		}
+	}
+}
+
+// syncTokenSchedule 将启用且有刷新令牌的账号同步到调度器
+func (s *Server) syncTokenSchedule(ctx context.Context) {
+	enabled := true
+	accounts, err := s.db.ListAccounts(ctx, &enabled, "created_at", true)
+	if err != nil {
+		logger.Error("[令牌刷新] 列出账号错误: %v", err)
+		return
+	}
+
+	due := make(map[string]time.Time, len(accounts))
+	for _, acc := range accounts {
+		if acc.RefreshToken == nil || *acc.RefreshToken == "" {
+			continue
+		}
+		due[acc.ID] = tokenExpiresAt(acc)
+	}
+	s.tokenScheduler.SetConcurrency(s.tokenRefreshConcurrency(ctx))
+	s.tokenScheduler.Sync(due)
+	logger.Debug("[令牌刷新] 已同步 %d 个账号到刷新调度", len(due))
+}
+
+// handleGetTokenRefreshStats 获取令牌刷新调度状态（排期数、退避数、提前量分布、请求路径同步刷新次数）
+// @author ygw
+func (s *Server) handleGetTokenRefreshStats(c *gin.Context) {
+	c.JSON(200, s.tokenScheduler.Stats())
+}
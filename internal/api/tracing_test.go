@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"claude-api/internal/config"
+	"claude-api/internal/database"
+	"claude-api/internal/models"
+	"claude-api/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanHasAttr 检查 Span 是否包含指定属性
+func spanHasAttr(span tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, a := range span.Attributes {
+		if a.Key == kv.Key && a.Value == kv.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRequireAccount_Tracing 测试认证中间件在根 Span 上记录用户、在账号选择 Span 上记录账号
+func TestRequireAccount_Tracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := tracing.InitWithExporter(exporter)
+	defer shutdown(context.Background())
+
+	cfg := &config.Config{Database: config.DatabaseConfig{Type: config.DatabaseTypeSQLite, SQLite: config.SQLiteConfig{Path: ":memory:"}}}
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	user := models.NewUser("user-1", "sk-test-tracing-user-key", &models.UserCreate{Name: "tracing"})
+	if err := db.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewAccountPool(nil, time.Minute)
+	pool.accounts = []*models.Account{{ID: "acc-1", Enabled: true}}
+	s := &Server{
+		cfg:           cfg,
+		db:            db,
+		accountPool:   pool,
+		settingsCache: NewSettingsCache(db, time.Hour),
+		ipConfigCache: NewIPConfigCache(db, time.Hour),
+	}
+	s.initAdmission()
+	defer s.admission.Stop()
+
+	r := gin.New()
+	r.Use(tracing.Middleware("/v1/"))
+	r.POST("/v1/chat/completions", s.requireAPIKey, func(c *gin.Context) {
+		if s.acquireAccount(c) != nil {
+			c.Status(http.StatusOK)
+		}
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer "+user.APIKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("认证应通过，实际 %d: %s", w.Code, w.Body.String())
+	}
+
+	var root, selectSpan *tracetest.SpanStub
+	spans := exporter.GetSpans()
+	for i := range spans {
+		switch spans[i].Name {
+		case "POST /v1/chat/completions":
+			root = &spans[i]
+		case tracing.SpanAccountSelect:
+			selectSpan = &spans[i]
+		}
+	}
+	if root == nil || !spanHasAttr(*root, tracing.AttrUserID.String("user-1")) {
+		t.Errorf("根 Span 应记录用户 ID: %+v", root)
+	}
+	if selectSpan == nil || !spanHasAttr(*selectSpan, tracing.AttrAccountID.String("acc-1")) {
+		t.Errorf("账号选择 Span 应记录账号 ID: %+v", selectSpan)
+	}
+}
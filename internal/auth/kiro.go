@@ -15,13 +15,6 @@ import (
 	"github.com/google/uuid"
 )
 
-const (
-	// KiroAuthEndpoint 社交登录 Token 刷新端点
-	KiroAuthEndpoint = "https://prod.us-east-1.auth.desktop.kiro.dev"
-	// AmazonQUsageLimitsEndpoint 配额查询端点
-	AmazonQUsageLimitsEndpoint = "https://q.us-east-1.amazonaws.com/getUsageLimits"
-)
-
 // KiroClient 处理 Kiro/社交登录相关操作
 type KiroClient struct {
 	httpClient *http.Client
@@ -58,13 +51,14 @@ type SocialTokenRefreshResult struct {
 }
 
 // RefreshSocialToken 刷新社交登录的 Token（GitHub/Google）
+// region: 账号所在区域（为空时使用默认区域）
 // machineId: 设备标识，用于构建 User-Agent
 // 这种类型的账号只需要 refreshToken，不需要 clientId 和 clientSecret
 // @author ygw
-func (c *KiroClient) RefreshSocialToken(ctx context.Context, refreshToken, machineId string) (*SocialTokenRefreshResult, error) {
+func (c *KiroClient) RefreshSocialToken(ctx context.Context, region, refreshToken, machineId string) (*SocialTokenRefreshResult, error) {
 	logger.Info("Kiro: 开始刷新社交登录 Token")
 
-	url := KiroAuthEndpoint + "/refreshToken"
+	url := KiroAuthEndpoint(region) + "/refreshToken"
 
 	payload := map[string]string{
 		"refreshToken": refreshToken,
@@ -140,12 +134,13 @@ type UserInfo struct {
 }
 
 // GetUserInfo 获取用户信息（使用 Amazon Q 的配额 API）
+// region: 账号所在区域（为空时使用默认区域）
 // machineId: 设备标识，用于构建 User-Agent
 // @author ygw
-func (c *KiroClient) GetUserInfo(ctx context.Context, accessToken, machineId string) (*UserInfo, error) {
+func (c *KiroClient) GetUserInfo(ctx context.Context, region, accessToken, machineId string) (*UserInfo, error) {
 	logger.Info("Kiro: 开始获取用户信息")
 
-	url := AmazonQUsageLimitsEndpoint + "?isEmailRequired=true&origin=AI_EDITOR&resourceType=AGENTIC_REQUEST"
+	url := AmazonQEndpoint(region) + "getUsageLimits?isEmailRequired=true&origin=AI_EDITOR&resourceType=AGENTIC_REQUEST"
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -281,14 +276,15 @@ type VerifyTokenResult struct {
 }
 
 // VerifyAndGetUserInfo 验证 refreshToken 并获取用户信息
+// region: 账号所在区域（为空时使用默认区域）
 // machineId: 设备标识，用于构建 User-Agent
 // 这是导入功能的核心方法，通过 refreshToken 获取完整的账号信息
 // @author ygw
-func (c *KiroClient) VerifyAndGetUserInfo(ctx context.Context, refreshToken, machineId string) (*VerifyTokenResult, error) {
+func (c *KiroClient) VerifyAndGetUserInfo(ctx context.Context, region, refreshToken, machineId string) (*VerifyTokenResult, error) {
 	logger.Info("Kiro: 开始验证 Token 并获取用户信息")
 
 	// Step 1: 刷新 Token 获取 accessToken
-	refreshResult, err := c.RefreshSocialToken(ctx, refreshToken, machineId)
+	refreshResult, err := c.RefreshSocialToken(ctx, region, refreshToken, machineId)
 	if err != nil {
 		return nil, fmt.Errorf("刷新 Token 失败: %w", err)
 	}
@@ -301,7 +297,7 @@ func (c *KiroClient) VerifyAndGetUserInfo(ctx context.Context, refreshToken, mac
 	}
 
 	// Step 2: 使用 accessToken 获取用户信息
-	userInfo, err := c.GetUserInfo(ctx, refreshResult.AccessToken, machineId)
+	userInfo, err := c.GetUserInfo(ctx, region, refreshResult.AccessToken, machineId)
 	if err != nil {
 		return &VerifyTokenResult{
 			Success:      true,
@@ -16,11 +16,6 @@ import (
 )
 
 const (
-	OIDCBase      = "https://oidc.us-east-1.amazonaws.com"
-	RegisterURL   = OIDCBase + "/client/register"
-	DeviceAuthURL = OIDCBase + "/device_authorization"
-	TokenURL      = OIDCBase + "/token"
-	StartURL      = "https://view.awsapps.com/start"
 	AmzSDKRequest = "attempt=1; max=3"
 )
 
@@ -119,10 +114,11 @@ func (c *OIDCClient) postJSON(ctx context.Context, url string, payload interface
 }
 
 // RegisterClient 注册新的 OIDC 客户端
+// region: 账号所在区域（为空时使用默认区域）
 // machineId: 设备标识，用于构建 User-Agent
 // @author ygw
-func (c *OIDCClient) RegisterClient(ctx context.Context, machineId string) (string, string, error) {
-	logger.Info("OIDC: 开始注册客户端")
+func (c *OIDCClient) RegisterClient(ctx context.Context, region, machineId string) (string, string, error) {
+	logger.Info("OIDC: 开始注册客户端 - 区域: %s", NormalizeRegion(region))
 
 	payload := map[string]interface{}{
 		"clientName": "Kiro IDE",
@@ -136,7 +132,7 @@ func (c *OIDCClient) RegisterClient(ctx context.Context, machineId string) (stri
 		},
 	}
 
-	result, err := c.postJSON(ctx, RegisterURL, payload, machineId)
+	result, err := c.postJSON(ctx, OIDCEndpoint(region)+"/client/register", payload, machineId)
 	if err != nil {
 		logger.Error("OIDC: 注册客户端失败: %v", err)
 		return "", "", err
@@ -155,18 +151,23 @@ func (c *OIDCClient) RegisterClient(ctx context.Context, machineId string) (stri
 }
 
 // DeviceAuthorize 启动设备授权流程
+// region: 账号所在区域（为空时使用默认区域）
+// startURL: IdC 起始地址（为空时使用 Builder ID 地址）
 // machineId: 设备标识，用于构建 User-Agent
 // @author ygw
-func (c *OIDCClient) DeviceAuthorize(ctx context.Context, clientID, clientSecret, machineId string) (map[string]interface{}, error) {
+func (c *OIDCClient) DeviceAuthorize(ctx context.Context, region, startURL, clientID, clientSecret, machineId string) (map[string]interface{}, error) {
 	logger.Info("OIDC: 开始设备授权流程 - ClientID: %s", clientID)
 
+	if startURL == "" {
+		startURL = DefaultStartURL
+	}
 	payload := map[string]interface{}{
 		"clientId":     clientID,
 		"clientSecret": clientSecret,
-		"startUrl":     StartURL,
+		"startUrl":     startURL,
 	}
 
-	result, err := c.postJSON(ctx, DeviceAuthURL, payload, machineId)
+	result, err := c.postJSON(ctx, OIDCEndpoint(region)+"/device_authorization", payload, machineId)
 	if err != nil {
 		logger.Error("OIDC: 设备授权失败: %v", err)
 		return nil, err
@@ -180,9 +181,10 @@ func (c *OIDCClient) DeviceAuthorize(ctx context.Context, clientID, clientSecret
 }
 
 // PollToken 轮询设备代码令牌
+// region: 账号所在区域（需与设备授权时一致）
 // machineId: 设备标识，用于构建 User-Agent
 // @author ygw
-func (c *OIDCClient) PollToken(ctx context.Context, clientID, clientSecret, deviceCode, machineId string, interval, expiresIn int) (map[string]interface{}, error) {
+func (c *OIDCClient) PollToken(ctx context.Context, region, clientID, clientSecret, deviceCode, machineId string, interval, expiresIn int) (map[string]interface{}, error) {
 	logger.Info("OIDC: 开始轮询令牌 - 间隔: %ds, 超时: %ds", interval, expiresIn)
 
 	payload := map[string]interface{}{
@@ -213,7 +215,7 @@ func (c *OIDCClient) PollToken(ctx context.Context, clientID, clientSecret, devi
 		pollCount++
 		logger.Debug("OIDC: 令牌轮询尝试 #%d/%d", pollCount, maxPolls)
 
-		result, err := c.postJSON(ctx, TokenURL, payload, machineId)
+		result, err := c.postJSON(ctx, OIDCEndpoint(region)+"/token", payload, machineId)
 		if err == nil {
 			logger.Info("OIDC: 令牌轮询成功 - 共轮询 %d 次", pollCount)
 			return result, nil
@@ -240,9 +242,17 @@ func (c *OIDCClient) PollToken(ctx context.Context, clientID, clientSecret, devi
 }
 
 // RefreshAccessToken 刷新访问令牌
+// region: 账号所在区域
 // machineId: 设备标识，必须使用登录时的 machineId
 // @author ygw
-func (c *OIDCClient) RefreshAccessToken(ctx context.Context, clientID, clientSecret, refreshToken, machineId string) (string, string, error) {
+func (c *OIDCClient) RefreshAccessToken(ctx context.Context, region, clientID, clientSecret, refreshToken, machineId string) (string, string, error) {
+	accessToken, newRefreshToken, _, err := c.RefreshAccessTokenWithExpiry(ctx, region, clientID, clientSecret, refreshToken, machineId)
+	return accessToken, newRefreshToken, err
+}
+
+// RefreshAccessTokenWithExpiry 刷新访问令牌，同时返回新访问令牌的有效期（秒，响应未提供时为 0）
+// @author ygw
+func (c *OIDCClient) RefreshAccessTokenWithExpiry(ctx context.Context, region, clientID, clientSecret, refreshToken, machineId string) (string, string, int, error) {
 	logger.Debug("OIDC: 开始刷新访问令牌 - ClientID: %s", clientID)
 
 	payload := map[string]interface{}{
@@ -252,18 +262,19 @@ func (c *OIDCClient) RefreshAccessToken(ctx context.Context, clientID, clientSec
 		"refreshToken": refreshToken,
 	}
 
-	result, err := c.postJSON(ctx, TokenURL, payload, machineId)
+	result, err := c.postJSON(ctx, OIDCEndpoint(region)+"/token", payload, machineId)
 	if err != nil {
 		logger.Error("OIDC: 刷新访问令牌失败: %v", err)
-		return "", "", err
+		return "", "", 0, err
 	}
 
 	accessToken, _ := result["accessToken"].(string)
 	newRefreshToken, _ := result["refreshToken"].(string)
+	expiresIn, _ := result["expiresIn"].(float64)
 
 	if accessToken == "" {
 		logger.Error("OIDC: 刷新响应无效 - 缺少 accessToken")
-		return "", "", fmt.Errorf("no accessToken in response")
+		return "", "", 0, fmt.Errorf("no accessToken in response")
 	}
 
 	if newRefreshToken == "" {
@@ -271,8 +282,8 @@ func (c *OIDCClient) RefreshAccessToken(ctx context.Context, clientID, clientSec
 		newRefreshToken = refreshToken // 如果未提供则使用旧刷新令牌
 	}
 
-	logger.Debug("OIDC: 访问令牌刷新成功 - AccessToken长度: %d", len(accessToken))
-	return accessToken, newRefreshToken, nil
+	logger.Debug("OIDC: 访问令牌刷新成功 - AccessToken长度: %d, 有效期: %.0f 秒", len(accessToken), expiresIn)
+	return accessToken, newRefreshToken, int(expiresIn), nil
 }
 
 func containsIgnoreCase(s, substr string) bool {
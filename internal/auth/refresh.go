@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// IsSocialClientID 判断是否为社交登录账号（导入时生成的占位 clientId 以 "social-" 开头）
+func IsSocialClientID(clientID string) bool {
+	return strings.HasPrefix(clientID, "social-")
+}
+
+// RefreshTokens 刷新账号令牌：社交登录账号使用 Kiro 刷新接口，其余使用 OIDC 标准刷新接口
+// 响应未返回新的 refreshToken 时沿用原值
+// @return accessToken 新访问令牌
+// @return newRefreshToken 新刷新令牌
+// @return expiresIn 访问令牌有效期（秒），0 表示响应未提供
+// @author ygw
+func RefreshTokens(ctx context.Context, oidc *OIDCClient, kiro *KiroClient, region, clientID, clientSecret, refreshToken, machineId string) (string, string, int, error) {
+	if !IsSocialClientID(clientID) {
+		if clientID == "" || clientSecret == "" {
+			return "", "", 0, fmt.Errorf("账号缺少 clientId 或 clientSecret，无法刷新令牌")
+		}
+		return oidc.RefreshAccessTokenWithExpiry(ctx, region, clientID, clientSecret, refreshToken, machineId)
+	}
+
+	result, err := kiro.RefreshSocialToken(ctx, region, refreshToken, machineId)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("社交登录刷新失败: %w", err)
+	}
+	if !result.Success {
+		return "", "", 0, fmt.Errorf("社交登录刷新失败: %s", result.Error)
+	}
+	newRefreshToken := result.RefreshToken
+	if newRefreshToken == "" {
+		newRefreshToken = refreshToken
+	}
+	return result.AccessToken, newRefreshToken, result.ExpiresIn, nil
+}
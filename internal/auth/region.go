@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"claude-api/internal/config"
+)
+
+const (
+	// DefaultRegion 账号未设置区域时使用的默认区域
+	DefaultRegion = "us-east-1"
+	// DefaultStartURL 默认 IdC 起始地址（AWS Builder ID）
+	DefaultStartURL = "https://view.awsapps.com/start"
+)
+
+// KnownRegions 已知提供 Amazon Q / Kiro 服务的区域（用于延迟检测）
+var KnownRegions = []string{"us-east-1", "eu-central-1"}
+
+// upstream 当前生效的上游地址模板，默认为 AWS 官方地址
+var upstream atomic.Pointer[config.UpstreamConfig]
+
+func init() {
+	u := config.DefaultUpstream()
+	upstream.Store(&u)
+}
+
+// SetUpstream 设置上游地址模板（空字段使用默认地址），用于对接本地模拟上游
+// @author ygw
+func SetUpstream(u config.UpstreamConfig) {
+	def := config.DefaultUpstream()
+	for _, f := range []struct{ dst, def *string }{
+		{&u.AmazonQURL, &def.AmazonQURL},
+		{&u.OIDCURL, &def.OIDCURL},
+		{&u.KiroAuthURL, &def.KiroAuthURL},
+		{&u.CodeWhispererURL, &def.CodeWhispererURL},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.def
+		}
+	}
+	upstream.Store(&u)
+}
+
+// expandUpstream 将地址模板中的 {region} 替换为规范化后的区域
+func expandUpstream(tmpl, region string) string {
+	return strings.TrimRight(strings.ReplaceAll(tmpl, "{region}", NormalizeRegion(region)), "/")
+}
+
+// regionPattern AWS 区域名格式，如 us-east-1、eu-central-1、ap-southeast-2
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// ValidRegion 检查区域名格式是否合法（空字符串表示默认区域，也视为合法；与 NormalizeRegion 一样不区分大小写）
+func ValidRegion(region string) bool {
+	region = strings.ToLower(strings.TrimSpace(region))
+	return region == "" || regionPattern.MatchString(region)
+}
+
+// NormalizeRegion 规范化区域名，空值或非法值返回默认区域
+// 区域会被拼接到上游域名中，非法值一律回退，避免请求被导向非预期的主机
+func NormalizeRegion(region string) string {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if region == "" || !regionPattern.MatchString(region) {
+		return DefaultRegion
+	}
+	return region
+}
+
+// RegionOf 返回账号区域字段的值（nil 时为默认区域）
+func RegionOf(region *string) string {
+	if region == nil {
+		return DefaultRegion
+	}
+	return NormalizeRegion(*region)
+}
+
+// StartURLOf 返回账号 IdC 起始地址（nil 或空时为默认地址）
+func StartURLOf(startURL *string) string {
+	if startURL == nil || strings.TrimSpace(*startURL) == "" {
+		return DefaultStartURL
+	}
+	return strings.TrimSpace(*startURL)
+}
+
+// OIDCEndpoint 区域的 OIDC 端点（客户端注册、设备授权、令牌）
+func OIDCEndpoint(region string) string {
+	return expandUpstream(upstream.Load().OIDCURL, region)
+}
+
+// AmazonQEndpoint 区域的 Amazon Q 端点（对话和配额查询），以 / 结尾
+func AmazonQEndpoint(region string) string {
+	return expandUpstream(upstream.Load().AmazonQURL, region) + "/"
+}
+
+// KiroAuthEndpoint 区域的 Kiro 社交登录令牌刷新端点
+func KiroAuthEndpoint(region string) string {
+	return expandUpstream(upstream.Load().KiroAuthURL, region)
+}
+
+// CodeWhispererEndpoint 区域的 CodeWhisperer 端点（延迟检测）
+func CodeWhispererEndpoint(region string) string {
+	return expandUpstream(upstream.Load().CodeWhispererURL, region)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import "testing"
+
+// TestRegionEndpoints 测试区域规范化和端点拼接（非法区域回退默认区域）
+func TestRegionEndpoints(t *testing.T) {
+	cases := map[string]string{
+		"":                   DefaultRegion,
+		" EU-Central-1 ":     "eu-central-1",
+		"ap-southeast-2":     "ap-southeast-2",
+		"evil.com/x":         DefaultRegion,
+		"us-east-1.evil.com": DefaultRegion,
+	}
+	for in, want := range cases {
+		if got := NormalizeRegion(in); got != want {
+			t.Errorf("NormalizeRegion(%q) = %q, 期望 %q", in, got, want)
+		}
+	}
+	if ValidRegion("us-east-1.evil.com") || !ValidRegion("") || !ValidRegion(" EU-Central-1 ") {
+		t.Error("ValidRegion 判断错误")
+	}
+
+	region := "eu-central-1"
+	if got := AmazonQEndpoint(region); got != "https://q.eu-central-1.amazonaws.com/" {
+		t.Errorf("AmazonQEndpoint = %s", got)
+	}
+	if got := OIDCEndpoint(region); got != "https://oidc.eu-central-1.amazonaws.com" {
+		t.Errorf("OIDCEndpoint = %s", got)
+	}
+	if got := RegionOf(nil); got != DefaultRegion {
+		t.Errorf("RegionOf(nil) = %s", got)
+	}
+	empty := " "
+	if got := StartURLOf(&empty); got != DefaultStartURL {
+		t.Errorf("StartURLOf 空值应回退默认地址, 实际 %s", got)
+	}
+}
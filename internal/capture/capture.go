@@ -0,0 +1,171 @@
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// DefaultMaxUpstreamBytes 上游事件流最大采集字节数（超出部分截断）
+const DefaultMaxUpstreamBytes = 8 * 1024 * 1024
+
+// 采集原因
+const (
+	ReasonUser    = "user"    // 用户开启了采集
+	ReasonSampled = "sampled" // 按采样率命中
+)
+
+// ShouldCapture 判断本次请求是否需要采集
+// @param userOptIn 用户是否开启了载荷采集
+// @param sampleRate 全局采样率 [0,1]
+// @return string 采集原因，空字符串表示不采集
+// @author ygw
+func ShouldCapture(userOptIn bool, sampleRate float64) string {
+	if userOptIn {
+		return ReasonUser
+	}
+	if sampleRate > 0 && (sampleRate >= 1 || rand.Float64() < sampleRate) {
+		return ReasonSampled
+	}
+	return ""
+}
+
+// Recorder 单次请求的载荷采集器
+// 入站请求和 Amazon Q 载荷在写入时脱敏；上游事件流保留原始二进制帧（含 CRC），查看时再解码脱敏
+type Recorder struct {
+	mu        sync.Mutex
+	redactor  *Redactor
+	reason    string
+	inbound   []byte
+	aqPayload []byte
+	upstream  bytes.Buffer
+	maxBytes  int
+	truncated bool
+}
+
+// NewRecorder 创建采集器
+func NewRecorder(redactor *Redactor, reason string) *Recorder {
+	return &Recorder{redactor: redactor, reason: reason, maxBytes: DefaultMaxUpstreamBytes}
+}
+
+// Reason 返回采集原因
+func (r *Recorder) Reason() string {
+	return r.reason
+}
+
+// SetInbound 记录入站请求体（脱敏）
+func (r *Recorder) SetInbound(body []byte) {
+	redacted := r.redactor.RedactJSON(body)
+	r.mu.Lock()
+	r.inbound = redacted
+	r.mu.Unlock()
+}
+
+// SetAmazonQPayload 记录转换后的 Amazon Q 载荷（脱敏），重试时覆盖为最后一次
+func (r *Recorder) SetAmazonQPayload(payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	redacted := r.redactor.RedactJSON(data)
+	r.mu.Lock()
+	r.aqPayload = redacted
+	r.mu.Unlock()
+}
+
+// WrapUpstream 包装上游响应体，读取时同步采集原始事件流
+// 每次调用会清空上一次尝试的采集内容
+func (r *Recorder) WrapUpstream(body io.ReadCloser) io.ReadCloser {
+	r.mu.Lock()
+	r.upstream.Reset()
+	r.truncated = false
+	r.mu.Unlock()
+	return &teeReadCloser{ReadCloser: body, rec: r}
+}
+
+// write 追加上游数据（超出上限则截断）
+func (r *Recorder) write(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remain := r.maxBytes - r.upstream.Len()
+	if remain <= 0 {
+		r.truncated = true
+		return
+	}
+	if len(p) > remain {
+		p = p[:remain]
+		r.truncated = true
+	}
+	r.upstream.Write(p)
+}
+
+// Snapshot 采集内容快照
+type Snapshot struct {
+	Inbound   []byte
+	AmazonQ   []byte
+	Upstream  []byte
+	Truncated bool
+}
+
+// Snapshot 返回当前采集内容的副本
+func (r *Recorder) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Snapshot{
+		Inbound:   append([]byte(nil), r.inbound...),
+		AmazonQ:   append([]byte(nil), r.aqPayload...),
+		Upstream:  append([]byte(nil), r.upstream.Bytes()...),
+		Truncated: r.truncated,
+	}
+}
+
+// teeReadCloser 读取时同步写入采集器
+type teeReadCloser struct {
+	io.ReadCloser
+	rec *Recorder
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.rec.write(p[:n])
+	}
+	return n, err
+}
+
+// Compress gzip 压缩
+func Compress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("压缩失败: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("压缩失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress gzip 解压
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压失败: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("解压失败: %w", err)
+	}
+	return out, nil
+}
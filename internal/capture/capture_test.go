@@ -0,0 +1,92 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestRedactJSON_SecretsAndImages 测试密钥字段、密钥格式和图片的脱敏
+func TestRedactJSON_SecretsAndImages(t *testing.T) {
+	r := NewRedactor([]string{"X-Custom-Token"}, true)
+	in := `{
+		"model": "claude-sonnet-4",
+		"api_key": "should-hide",
+		"x-custom-token": "also-hide",
+		"messages": [{"role": "user", "content": [
+			{"type": "text", "text": "my key is sk-abcdefghijklmnopqrstuvwx please"},
+			{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgoAAAANSUhEUgAA"}},
+			{"type": "image_url", "image_url": {"url": "data:image/jpeg;base64,/9j/4AAQSkZJRg=="}}
+		]}],
+		"images": [{"format": "png", "source": {"bytes": "AAAABBBB"}}]
+	}`
+
+	out := string(r.RedactJSON([]byte(in)))
+
+	for _, leaked := range []string{"should-hide", "also-hide", "sk-abcdefghijklmnopqrstuvwx", "iVBORw0KGgo", "/9j/4AAQ", "AAAABBBB"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("脱敏后仍包含 %q: %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, "[image redacted: 24 bytes]") {
+		t.Errorf("图片占位符缺失: %s", out)
+	}
+	if !json.Valid([]byte(out)) || !strings.Contains(out, `"model":"claude-sonnet-4"`) {
+		t.Errorf("脱敏后 JSON 结构被破坏: %s", out)
+	}
+}
+
+// TestRedactJSON_KeepImages 测试关闭图片脱敏时保留图片数据
+func TestRedactJSON_KeepImages(t *testing.T) {
+	r := NewRedactor(nil, false)
+	out := string(r.RedactJSON([]byte(`{"source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo"}}`)))
+	if !strings.Contains(out, "iVBORw0KGgo") {
+		t.Errorf("关闭图片脱敏后图片数据不应被替换: %s", out)
+	}
+}
+
+// TestRecorder_UpstreamTeeAndCompress 测试上游事件流采集、截断与压缩往返
+func TestRecorder_UpstreamTeeAndCompress(t *testing.T) {
+	rec := NewRecorder(NewRedactor(nil, true), ReasonSampled)
+	rec.maxBytes = 10
+	rec.SetInbound([]byte(`{"password":"p"}`))
+	rec.SetAmazonQPayload(map[string]string{"conversationId": "c1"})
+
+	body := rec.WrapUpstream(io.NopCloser(bytes.NewReader([]byte("0123456789abcdef"))))
+	got, _ := io.ReadAll(body)
+	if string(got) != "0123456789abcdef" {
+		t.Fatalf("包装后的响应体内容被修改: %s", got)
+	}
+
+	snap := rec.Snapshot()
+	if string(snap.Upstream) != "0123456789" || !snap.Truncated {
+		t.Errorf("上游采集截断不正确: %q truncated=%v", snap.Upstream, snap.Truncated)
+	}
+	if strings.Contains(string(snap.Inbound), `"p"`) {
+		t.Errorf("入站请求未脱敏: %s", snap.Inbound)
+	}
+
+	compressed, err := Compress(snap.AmazonQ)
+	if err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	plain, err := Decompress(compressed)
+	if err != nil || string(plain) != `{"conversationId":"c1"}` {
+		t.Errorf("压缩往返失败: %s, %v", plain, err)
+	}
+}
+
+// TestShouldCapture 测试采集判定
+func TestShouldCapture(t *testing.T) {
+	if ShouldCapture(true, 0) != ReasonUser {
+		t.Error("用户开启采集时应必采")
+	}
+	if ShouldCapture(false, 0) != "" {
+		t.Error("采样率为 0 时不应采集")
+	}
+	if ShouldCapture(false, 1) != ReasonSampled {
+		t.Error("采样率为 1 时应全部采集")
+	}
+}
@@ -0,0 +1,152 @@
+// Package capture 请求/响应载荷采集（脱敏、压缩），用于问题排查与请求重放
+// @author ygw
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactedPlaceholder 脱敏后的占位文本
+const RedactedPlaceholder = "[REDACTED]"
+
+// DefaultSecretKeys 默认脱敏的 JSON 字段名（不区分大小写）
+var DefaultSecretKeys = []string{
+	"authorization",
+	"x-api-key",
+	"api_key",
+	"apikey",
+	"access_token",
+	"accesstoken",
+	"refresh_token",
+	"refreshtoken",
+	"client_secret",
+	"clientsecret",
+	"password",
+	"secret",
+}
+
+// secretPatterns 字符串内容中的常见密钥格式
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)bearer\s+[a-z0-9._~+/=-]{16,}`),
+	regexp.MustCompile(`sk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`),
+	regexp.MustCompile(`\baor[A-Za-z0-9_-]{40,}`), // AWS SSO 刷新令牌
+}
+
+// dataURLPattern data URL 形式的内联图片
+var dataURLPattern = regexp.MustCompile(`^data:image/[a-zA-Z0-9.+-]+;base64,`)
+
+// Redactor 载荷脱敏器
+type Redactor struct {
+	keys         map[string]bool
+	redactImages bool
+}
+
+// NewRedactor 创建脱敏器
+// @param extraKeys 额外需要脱敏的 JSON 字段名
+// @param redactImages 是否将内联图片替换为占位符
+// @return *Redactor 脱敏器
+// @author ygw
+func NewRedactor(extraKeys []string, redactImages bool) *Redactor {
+	keys := make(map[string]bool, len(DefaultSecretKeys)+len(extraKeys))
+	for _, k := range DefaultSecretKeys {
+		keys[k] = true
+	}
+	for _, k := range extraKeys {
+		if k = strings.TrimSpace(k); k != "" {
+			keys[strings.ToLower(k)] = true
+		}
+	}
+	return &Redactor{keys: keys, redactImages: redactImages}
+}
+
+// RedactJSON 对 JSON 载荷脱敏；非 JSON 内容按纯文本处理
+// @param data 原始载荷
+// @return []byte 脱敏后的载荷
+// @author ygw
+func (r *Redactor) RedactJSON(data []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return r.RedactText(data)
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return r.RedactText(data)
+	}
+	return out
+}
+
+// RedactValue 对已解码的 JSON 值脱敏（返回新值，不修改入参）
+func (r *Redactor) RedactValue(v interface{}) interface{} {
+	return r.redactValue(v)
+}
+
+// RedactText 替换文本中的密钥格式
+func (r *Redactor) RedactText(data []byte) []byte {
+	s := string(data)
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, RedactedPlaceholder)
+	}
+	return []byte(s)
+}
+
+// redactValue 递归脱敏
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		isImage := r.redactImages && isImageObject(t)
+		for k, val := range t {
+			lower := strings.ToLower(k)
+			switch {
+			case r.keys[lower]:
+				out[k] = RedactedPlaceholder
+			case isImage && (lower == "data" || lower == "bytes"):
+				out[k] = imagePlaceholder(val)
+			default:
+				out[k] = r.redactValue(val)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = r.redactValue(val)
+		}
+		return out
+	case string:
+		if r.redactImages && dataURLPattern.MatchString(t) {
+			return imagePlaceholder(t)
+		}
+		return string(r.RedactText([]byte(t)))
+	default:
+		return v
+	}
+}
+
+// isImageObject 判断是否为图片数据对象
+// Claude: {"type":"base64","media_type":"image/png","data":"..."}
+// Amazon Q: {"format":"png","source":{"bytes":"..."}} 中的 source 对象
+func isImageObject(m map[string]interface{}) bool {
+	if _, ok := m["media_type"]; ok {
+		return true
+	}
+	if t, ok := m["type"].(string); ok && t == "base64" {
+		return true
+	}
+	if _, ok := m["bytes"].(string); ok {
+		return true
+	}
+	return false
+}
+
+// imagePlaceholder 生成图片占位符（保留原始大小便于排查）
+func imagePlaceholder(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("[image redacted: %d bytes]", len(s))
+	}
+	return "[image redacted]"
+}
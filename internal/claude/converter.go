@@ -3,6 +3,7 @@ package claude
 import (
 	"claude-api/internal/logger"
 	"claude-api/internal/models"
+	"claude-api/internal/thinking"
 	"claude-api/internal/utils"
 	"encoding/json"
 	"fmt"
@@ -134,6 +135,23 @@ func appendThinkingHint(text string) string {
 	return text + separator + ThinkingHint
 }
 
+// appendBudgetThinkingHint 按 budget_tokens 设置 max_thinking_length 的 thinking 提示（仅用于当前消息）
+func appendBudgetThinkingHint(text string, budget int) string {
+	hint := fmt.Sprintf("<thinking_mode>interleaved</thinking_mode><max_thinking_length>%d</max_thinking_length>", budget)
+	normalized := strings.TrimRight(text, " \t\r\n")
+	if strings.HasSuffix(normalized, hint) {
+		return text
+	}
+	if strings.HasSuffix(normalized, ThinkingHint) {
+		text = strings.TrimSuffix(normalized, ThinkingHint)
+	}
+	separator := ""
+	if text != "" && !strings.HasSuffix(text, "\n") && !strings.HasSuffix(text, "\r") {
+		separator = "\n"
+	}
+	return text + separator + hint
+}
+
 // detectToolCallLoop 检测是否存在无限工具调用循环
 // 只有当同一工具在连续的 assistant 消息中被调用 threshold 次且输入相同时才触发
 func detectToolCallLoop(messages []models.ClaudeMessage, threshold int) error {
@@ -310,7 +328,11 @@ func ConvertClaudeToAmazonQ(req *models.ClaudeRequest, conversationID string, _
 
 	// 如果启用了 thinking 模式，添加 thinking 提示
 	if thinkingEnabled && promptContent != "" {
-		promptContent = appendThinkingHint(promptContent)
+		if budget := thinking.ParseBudget(req.Thinking); budget > 0 {
+			promptContent = appendBudgetThinkingHint(promptContent, budget)
+		} else {
+			promptContent = appendThinkingHint(promptContent)
+		}
 	}
 
 	// 3. 构建上下文
@@ -1,11 +1,11 @@
 package compressor
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"os"
-	"path/filepath"
+	"errors"
 	"sort"
 	"strings"
 	"sync"
@@ -22,15 +22,24 @@ type CacheIndexEntry struct {
 	TotalCompressedMsg int       // 已压缩的消息数
 	BlockIDs           []string  // 摘要块 ID 列表（用于冗余检测）
 	UpdatedAt          time.Time // 最后更新时间
-	FileName           string    // 缓存文件名
+	FileName           string    // 缓存文件名（仅文件存储）
+
+	indexedAt time.Time // 本实例保存后加入索引的时间（从存储加载的条目为零值）
 }
 
-// SummaryCache 摘要文件缓存（带内存索引）
+// indexSyncInterval 共享存储下刷新内存索引的最小间隔（获取其他实例写入的缓存）
+const indexSyncInterval = 10 * time.Second
+
+// storeTimeout 单次存储操作超时
+const storeTimeout = 5 * time.Second
+
+// SummaryCache 摘要缓存（带内存索引，持久化由 CacheStore 完成）
 // @author ygw
 type SummaryCache struct {
-	cacheDir string
+	store    CacheStore
 	ttl      time.Duration
 	mu       sync.RWMutex
+	lastSync time.Time
 
 	// 内存索引：PrefixHash -> 索引条目
 	index map[string]*CacheIndexEntry
@@ -66,22 +75,26 @@ type ConversationCache struct {
 	UpdatedAt          time.Time      `json:"updated_at"`           // 最后更新时间
 }
 
-// NewSummaryCache 创建缓存实例
+// NewSummaryCache 创建使用本地文件存储的缓存实例
 func NewSummaryCache(cacheDir string, ttl time.Duration) *SummaryCache {
+	return NewSummaryCacheWithStore(NewFileStore(cacheDir), ttl)
+}
+
+// NewSummaryCacheWithStore 创建使用指定存储后端的缓存实例
+// @param store 存储后端
+// @param ttl 缓存过期时间
+// @author ygw
+func NewSummaryCacheWithStore(store CacheStore, ttl time.Duration) *SummaryCache {
 	cache := &SummaryCache{
-		cacheDir:        cacheDir,
+		store:           store,
 		ttl:             ttl,
 		index:           make(map[string]*CacheIndexEntry),
 		indexByMsgCount: make(map[int][]*CacheIndexEntry),
 		sortedMsgCounts: make([]int, 0),
 	}
 
-	// 确保缓存目录存在
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		logger.Error("[智能压缩] 创建缓存目录失败: %v", err)
-	}
-
 	// 启动时加载索引
+	cache.lastSync = time.Now()
 	cache.loadIndex()
 
 	// 启动清理协程
@@ -90,15 +103,17 @@ func NewSummaryCache(cacheDir string, ttl time.Duration) *SummaryCache {
 	return cache
 }
 
-// loadIndex 从磁盘加载所有缓存的索引信息到内存
+// loadIndex 从存储加载所有缓存的索引信息并合并到内存索引（过期条目从存储删除）
+// 读取存储时不持有锁；合并时以存储为准，但保留读取存储期间本实例新保存的条目
 // @author ygw
 func (c *SummaryCache) loadIndex() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
 
-	entries, err := os.ReadDir(c.cacheDir)
+	listStart := time.Now()
+	entries, err := c.store.List(ctx)
 	if err != nil {
-		logger.Debug("[智能压缩] 读取缓存目录失败: %v", err)
+		logger.Debug("[智能压缩] 读取缓存索引失败: %v", err)
 		return
 	}
 
@@ -106,54 +121,56 @@ func (c *SummaryCache) loadIndex() {
 	loadedCount := 0
 	expiredCount := 0
 
+	live := make(map[string]*CacheIndexEntry, len(entries))
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
-			continue
-		}
-
-		filePath := filepath.Join(c.cacheDir, entry.Name())
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			continue
-		}
-
-		var cache ConversationCache
-		if err := json.Unmarshal(data, &cache); err != nil {
-			// 删除损坏的缓存文件
-			os.Remove(filePath)
-			continue
-		}
-
 		// 检查是否过期
-		if now.Sub(cache.UpdatedAt) > c.ttl {
-			os.Remove(filePath)
+		if now.Sub(entry.UpdatedAt) > c.ttl {
+			c.store.Delete(ctx, entry.PrefixHash)
 			expiredCount++
 			continue
 		}
+		live[entry.PrefixHash] = entry
+		loadedCount++
+	}
 
-		// 提取摘要块 ID 列表
-		blockIDs := make([]string, len(cache.SummaryBlocks))
-		for i, block := range cache.SummaryBlocks {
-			blockIDs[i] = block.BlockID
+	c.mu.Lock()
+	// 存储中已不存在的条目（被其他实例淘汰）从索引移除，读取期间新保存的除外
+	for prefixHash, entry := range c.index {
+		if _, ok := live[prefixHash]; !ok && entry.indexedAt.Before(listStart) {
+			c.removeFromIndexLocked(prefixHash)
 		}
-
-		// 添加到索引
-		indexEntry := &CacheIndexEntry{
-			PrefixHash:         cache.PrefixHash,
-			TotalCompressedMsg: cache.TotalCompressedMsg,
-			BlockIDs:           blockIDs,
-			UpdatedAt:          cache.UpdatedAt,
-			FileName:           entry.Name(),
+	}
+	for prefixHash, entry := range live {
+		if existing, ok := c.index[prefixHash]; ok {
+			if !existing.UpdatedAt.Before(entry.UpdatedAt) {
+				continue
+			}
+			c.removeFromIndexLocked(prefixHash)
 		}
-		c.addToIndexLocked(indexEntry)
-		loadedCount++
+		c.addToIndexLocked(entry)
 	}
+	c.mu.Unlock()
 
-	if loadedCount > 0 || expiredCount > 0 {
+	if expiredCount > 0 || (loadedCount > 0 && !c.store.Shared()) {
 		logger.Info("[智能压缩] 索引加载完成 - 有效: %d, 过期清理: %d", loadedCount, expiredCount)
 	}
 }
 
+// syncIndex 共享存储下按间隔刷新内存索引（同一时间只有一个请求负责刷新）
+func (c *SummaryCache) syncIndex() {
+	if !c.store.Shared() {
+		return
+	}
+	c.mu.Lock()
+	if time.Since(c.lastSync) < indexSyncInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastSync = time.Now()
+	c.mu.Unlock()
+	c.loadIndex()
+}
+
 // addToIndexLocked 添加条目到索引（需要持有写锁）
 // @author ygw
 func (c *SummaryCache) addToIndexLocked(entry *CacheIndexEntry) {
@@ -243,6 +260,7 @@ func (c *SummaryCache) GeneratePrefixHash(messages []models.ClaudeMessage, count
 // 返回匹配的缓存和匹配的消息数量
 // @author ygw
 func (c *SummaryCache) FindMatchingCache(messages []models.ClaudeMessage) (*ConversationCache, int) {
+	c.syncIndex()
 	c.mu.RLock()
 
 	// 如果没有索引，直接返回
@@ -302,10 +320,20 @@ func (c *SummaryCache) FindMatchingCache(messages []models.ClaudeMessage) (*Conv
 		return nil, 0
 	}
 
-	// 从文件加载完整缓存数据
-	cache, err := c.loadCacheFromFile(matchedEntry.FileName)
+	// 从存储加载完整缓存数据
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	cache, err := c.store.Load(ctx, matchedEntry.PrefixHash)
+	if errors.Is(err, ErrCacheNotFound) {
+		// 已被其他实例淘汰或存储侧过期
+		c.mu.Lock()
+		c.removeFromIndexLocked(matchedEntry.PrefixHash)
+		c.mu.Unlock()
+		logger.Debug("[智能压缩] 缓存已失效 - 匹配 %d 条消息", matchedEntry.TotalCompressedMsg)
+		return nil, 0
+	}
 	if err != nil {
-		logger.Error("[智能压缩] 加载缓存文件失败: %v", err)
+		logger.Error("[智能压缩] 加载缓存失败: %v", err)
 		return nil, 0
 	}
 
@@ -313,103 +341,80 @@ func (c *SummaryCache) FindMatchingCache(messages []models.ClaudeMessage) (*Conv
 	return cache, matchedEntry.TotalCompressedMsg
 }
 
-// loadCacheFromFile 从文件加载完整缓存数据
-// @author ygw
-func (c *SummaryCache) loadCacheFromFile(fileName string) (*ConversationCache, error) {
-	filePath := filepath.Join(c.cacheDir, fileName)
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, err
-	}
-
-	var cache ConversationCache
-	if err := json.Unmarshal(data, &cache); err != nil {
-		return nil, err
-	}
-
-	return &cache, nil
-}
-
-// SaveCache 保存缓存（使用 hash 作为文件名）
-// 保存新缓存时会删除被包含的旧缓存文件，并更新内存索引
+// SaveCache 保存缓存（以前缀 hash 为键）
+// 保存新缓存时会删除被包含的旧缓存，并更新内存索引
 // @author ygw
 func (c *SummaryCache) SaveCache(cache *ConversationCache) {
 	if cache == nil || cache.PrefixHash == "" {
 		return
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	now := time.Now()
 	if cache.CreatedAt.IsZero() {
 		cache.CreatedAt = now
 	}
 	cache.UpdatedAt = now
 
-	// 删除被当前缓存包含的旧缓存文件
-	c.removeObsoleteCachesLocked(cache)
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
 
-	data, err := json.Marshal(cache)
-	if err != nil {
-		logger.Error("[智能压缩] 序列化缓存失败: %v", err)
+	// 存储读写不持有锁，避免远程存储的延迟阻塞其他请求查找缓存
+	if err := c.store.Save(ctx, cache); err != nil {
+		logger.Error("[智能压缩] %v", err)
 		return
 	}
 
-	// 确保缓存目录存在
-	if err := os.MkdirAll(c.cacheDir, 0755); err != nil {
-		logger.Error("[智能压缩] 创建缓存目录失败: %v", err)
-		return
-	}
-
-	// 使用 hash 前缀作为文件名
-	fileName := cache.PrefixHash[:32] + ".json"
-	filePath := filepath.Join(c.cacheDir, fileName)
-
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		logger.Error("[智能压缩] 写入缓存失败: %v", err)
-		return
-	}
+	// 删除被当前缓存包含的旧缓存
+	removed := c.deleteFromStore(ctx, c.findObsoleteCaches(cache))
 
 	// 更新内存索引
+	entry := newIndexEntry(cache)
+	entry.indexedAt = time.Now()
+	c.mu.Lock()
+	for _, prefixHash := range removed {
+		c.removeFromIndexLocked(prefixHash)
+	}
 	// 先移除旧的（如果存在）
 	c.removeFromIndexLocked(cache.PrefixHash)
+	c.addToIndexLocked(entry)
+	indexSize := len(c.index)
+	c.mu.Unlock()
 
-	// 提取摘要块 ID 列表
-	blockIDs := make([]string, len(cache.SummaryBlocks))
-	for i, block := range cache.SummaryBlocks {
-		blockIDs[i] = block.BlockID
+	if len(removed) > 0 {
+		logger.Debug("[智能压缩] 清理 %d 个冗余缓存", len(removed))
 	}
+	logger.Debug("[智能压缩] 缓存已保存 - %d 条消息, %d 个摘要块, 索引条目: %d",
+		cache.TotalCompressedMsg, len(cache.SummaryBlocks), indexSize)
+}
 
-	// 添加新的索引条目
-	indexEntry := &CacheIndexEntry{
-		PrefixHash:         cache.PrefixHash,
-		TotalCompressedMsg: cache.TotalCompressedMsg,
-		BlockIDs:           blockIDs,
-		UpdatedAt:          cache.UpdatedAt,
-		FileName:           fileName,
+// deleteFromStore 从存储删除缓存（不持有锁），返回删除成功的前缀 hash
+func (c *SummaryCache) deleteFromStore(ctx context.Context, prefixHashes []string) []string {
+	deleted := make([]string, 0, len(prefixHashes))
+	for _, prefixHash := range prefixHashes {
+		if err := c.store.Delete(ctx, prefixHash); err == nil {
+			deleted = append(deleted, prefixHash)
+		}
 	}
-	c.addToIndexLocked(indexEntry)
-
-	logger.Debug("[智能压缩] 缓存已保存 - %d 条消息, %d 个摘要块, 索引条目: %d",
-		cache.TotalCompressedMsg, len(cache.SummaryBlocks), len(c.index))
+	return deleted
 }
 
-// removeObsoleteCachesLocked 删除被新缓存包含的旧缓存文件（需要持有锁）
-// 如果新缓存的摘要块包含了旧缓存的所有摘要块，则删除旧缓存
-// 优化：使用内存索引而非遍历文件
+// findObsoleteCaches 查找被新缓存包含的旧缓存
+// 如果新缓存的摘要块包含了旧缓存的所有摘要块，则旧缓存可以删除
+// 优化：使用内存索引而非遍历存储
 // @author ygw
-func (c *SummaryCache) removeObsoleteCachesLocked(newCache *ConversationCache) {
+func (c *SummaryCache) findObsoleteCaches(newCache *ConversationCache) []string {
 	// 构建新缓存的摘要块 ID 集合
 	newBlockIDs := make(map[string]bool)
 	for _, block := range newCache.SummaryBlocks {
 		newBlockIDs[block.BlockID] = true
 	}
 
-	removedCount := 0
 	toRemove := make([]string, 0)
 
-	// 遍历内存索引而非文件系统
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 遍历内存索引而非存储
 	for prefixHash, entry := range c.index {
 		// 跳过自己（hash 相同）
 		if prefixHash == newCache.PrefixHash {
@@ -431,21 +436,7 @@ func (c *SummaryCache) removeObsoleteCachesLocked(newCache *ConversationCache) {
 		}
 	}
 
-	// 执行删除
-	for _, prefixHash := range toRemove {
-		entry := c.index[prefixHash]
-		if entry != nil {
-			filePath := filepath.Join(c.cacheDir, entry.FileName)
-			if err := os.Remove(filePath); err == nil {
-				c.removeFromIndexLocked(prefixHash)
-				removedCount++
-			}
-		}
-	}
-
-	if removedCount > 0 {
-		logger.Debug("[智能压缩] 清理 %d 个冗余缓存", removedCount)
-	}
+	return toRemove
 }
 
 // cleanupLoop 定期清理过期缓存
@@ -462,40 +453,40 @@ func (c *SummaryCache) cleanupLoop() {
 // 优化：使用内存索引进行清理
 // @author ygw
 func (c *SummaryCache) cleanup() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
 
 	now := time.Now()
 	toRemove := make([]string, 0)
 
 	// 遍历内存索引查找过期条目
+	c.mu.RLock()
 	for prefixHash, entry := range c.index {
 		if now.Sub(entry.UpdatedAt) > c.ttl {
 			toRemove = append(toRemove, prefixHash)
 		}
 	}
+	c.mu.RUnlock()
 
-	// 执行删除
-	cleanedCount := 0
-	for _, prefixHash := range toRemove {
-		entry := c.index[prefixHash]
-		if entry != nil {
-			filePath := filepath.Join(c.cacheDir, entry.FileName)
-			if err := os.Remove(filePath); err == nil {
-				c.removeFromIndexLocked(prefixHash)
-				cleanedCount++
-			}
-		}
+	// 执行删除（存储操作不持有锁）
+	removed := c.deleteFromStore(ctx, toRemove)
+
+	c.mu.Lock()
+	for _, prefixHash := range removed {
+		c.removeFromIndexLocked(prefixHash)
 	}
+	remaining := len(c.index)
+	c.mu.Unlock()
 
-	if cleanedCount > 0 {
-		logger.Debug("[智能压缩] 清理 %d 个过期缓存, 剩余索引: %d", cleanedCount, len(c.index))
+	if len(removed) > 0 {
+		logger.Debug("[智能压缩] 清理 %d 个过期缓存, 剩余索引: %d", len(removed), remaining)
 	}
 }
 
 // GetIndexStats 获取索引统计信息（用于调试）
 // @author ygw
 func (c *SummaryCache) GetIndexStats() (totalEntries int, msgCountGroups int) {
+	c.syncIndex()
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return len(c.index), len(c.indexByMsgCount)
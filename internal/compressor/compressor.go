@@ -22,14 +22,23 @@ type Compressor struct {
 // SummarizerFunc 摘要生成函数类型
 type SummarizerFunc func(ctx context.Context, content, model string) (string, error)
 
-// New 创建压缩器实例
+// New 创建压缩器实例（摘要缓存使用本地文件存储）
 func New(config *CompressConfig) *Compressor {
+	return NewWithStore(config, nil)
+}
+
+// NewWithStore 创建使用指定摘要缓存存储的压缩器实例（store 为 nil 时使用本地文件存储）
+// @author ygw
+func NewWithStore(config *CompressConfig, store CacheStore) *Compressor {
 	if config == nil {
 		config = DefaultConfig()
 	}
+	if store == nil {
+		store = NewFileStore(config.CacheDir)
+	}
 	return &Compressor{
 		config: config,
-		cache:  NewSummaryCache(config.CacheDir, config.CacheTTL),
+		cache:  NewSummaryCacheWithStore(store, config.CacheTTL),
 	}
 }
 
@@ -45,7 +54,7 @@ func (c *Compressor) GetSummaryModel() string {
 	return c.config.SummaryModel
 }
 
-// NeedsCompression 检查是否需要压缩
+// NeedsCompression 检查是否需要压缩（token 计数口径见 countTokens）
 // 返回: needsCompress bool, tokenCount int, messageCount int
 func (c *Compressor) NeedsCompression(messages []models.ClaudeMessage, systemPrompt interface{}) (bool, int, int) {
 	tokenCount := c.countTokens(messages, systemPrompt)
@@ -58,6 +67,7 @@ func (c *Compressor) NeedsCompression(messages []models.ClaudeMessage, systemPro
 }
 
 // countTokens 计算消息的 token 数量
+// 默认只统计文本块；配置 CountAllBlocks 时工具调用参数、工具结果和图片也计入
 func (c *Compressor) countTokens(messages []models.ClaudeMessage, systemPrompt interface{}) int {
 	total := 0
 
@@ -74,11 +84,15 @@ func (c *Compressor) countTokens(messages []models.ClaudeMessage, systemPrompt i
 			total += tokenizer.CountTokens(content)
 		} else if contentList, ok := msg.Content.([]interface{}); ok {
 			for _, block := range contentList {
-				if blockMap, ok := block.(map[string]interface{}); ok {
-					if blockMap["type"] == "text" {
-						if text, ok := blockMap["text"].(string); ok {
-							total += tokenizer.CountTokens(text)
-						}
+				blockMap, ok := block.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if c.config.CountAllBlocks {
+					total += countBlockTokens(blockMap)
+				} else if blockMap["type"] == "text" {
+					if text, ok := blockMap["text"].(string); ok {
+						total += tokenizer.CountTokens(text)
 					}
 				}
 			}
@@ -87,11 +101,60 @@ func (c *Compressor) countTokens(messages []models.ClaudeMessage, systemPrompt i
 	return total
 }
 
+// countBlockTokens 计算单个内容块的 token 数（工具调用参数、工具结果和图片也计入，便于衡量各压缩策略的效果）
+func countBlockTokens(block map[string]interface{}) int {
+	switch block["type"] {
+	case "text":
+		if text, ok := block["text"].(string); ok {
+			return tokenizer.CountTokens(text)
+		}
+	case "tool_use":
+		if data, err := json.Marshal(block["input"]); err == nil {
+			return tokenizer.CountTokens(string(data))
+		}
+	case "tool_result":
+		total := tokenizer.CountTokens(extractToolResultContent(block["content"]))
+		if items, ok := block["content"].([]interface{}); ok {
+			for _, item := range items {
+				if m, ok := item.(map[string]interface{}); ok && m["type"] == "image" {
+					total += ImageTokenEstimate
+				}
+			}
+		}
+		return total
+	case "image":
+		return ImageTokenEstimate
+	}
+	return 0
+}
+
+// withCountAllBlocks 返回按全部内容块计数的压缩器副本（共享摘要缓存，不影响原压缩器）
+func (c *Compressor) withCountAllBlocks() *Compressor {
+	if c.config.CountAllBlocks {
+		return c
+	}
+	cfg := *c.config
+	cfg.CountAllBlocks = true
+	return &Compressor{config: &cfg, cache: c.cache}
+}
+
+// SummaryStats 摘要压缩统计
+type SummaryStats struct {
+	Blocks   int  // 压缩后请求中的摘要块数
+	CacheHit bool // 是否复用了缓存的摘要块
+}
+
 // CompressIfNeeded 如果需要则执行压缩（分块模式）
 // 使用消息内容 hash 匹配缓存，支持增量压缩和多摘要块复用
 // @author ygw
 func (c *Compressor) CompressIfNeeded(ctx context.Context, req *models.ClaudeRequest,
 	summarizer SummarizerFunc) (*models.ClaudeRequest, error) {
+	return c.compressWithStats(ctx, req, summarizer, &SummaryStats{})
+}
+
+// compressWithStats 执行摘要压缩并记录摘要块数与缓存命中情况
+func (c *Compressor) compressWithStats(ctx context.Context, req *models.ClaudeRequest,
+	summarizer SummarizerFunc, stats *SummaryStats) (*models.ClaudeRequest, error) {
 
 	// 1. 尝试查找匹配的缓存
 	var existingBlocks []SummaryBlock
@@ -102,6 +165,8 @@ func (c *Compressor) CompressIfNeeded(ctx context.Context, req *models.ClaudeReq
 		if cached != nil && count > 0 {
 			existingBlocks = cached.SummaryBlocks
 			matchedCount = count
+			stats.CacheHit = true
+			stats.Blocks = len(existingBlocks)
 			logger.Info("[智能压缩] 命中缓存 - 复用 %d 条消息的 %d 个摘要块",
 				matchedCount, len(existingBlocks))
 		}
@@ -137,13 +202,13 @@ func (c *Compressor) CompressIfNeeded(ctx context.Context, req *models.ClaudeReq
 		tokenCount, c.config.TokenThreshold, msgCount, c.config.MessageThreshold)
 
 	// 4. 执行增量压缩
-	return c.compressIncremental(ctx, req, existingBlocks, matchedCount, summarizer)
+	return c.compressIncremental(ctx, req, existingBlocks, matchedCount, summarizer, stats)
 }
 
 // compressIncremental 增量压缩（只压缩新增消息，生成新摘要块）
 // @author ygw
 func (c *Compressor) compressIncremental(ctx context.Context, originalReq *models.ClaudeRequest,
-	existingBlocks []SummaryBlock, alreadyCompressed int, summarizer SummarizerFunc) (*models.ClaudeRequest, error) {
+	existingBlocks []SummaryBlock, alreadyCompressed int, summarizer SummarizerFunc, stats *SummaryStats) (*models.ClaudeRequest, error) {
 
 	// 计算需要压缩的消息范围
 	// 如果有已压缩的消息，从已压缩位置开始；否则从头开始
@@ -184,6 +249,7 @@ func (c *Compressor) compressIncremental(ctx context.Context, originalReq *model
 
 	// 合并所有摘要块
 	allBlocks := append(existingBlocks, newBlock)
+	stats.Blocks = len(allBlocks)
 
 	// 构建压缩后的请求
 	compressedReq := c.buildCompressedRequestWithBlocks(originalReq, allBlocks, keepMsgs)
@@ -504,16 +570,22 @@ func (c *Compressor) messagesToText(messages []models.ClaudeMessage) string {
 // 保留头尾，省略中间，确保关键信息不丢失
 // @author ygw
 func truncateToolResult(content string) string {
-	if len(content) <= MaxToolResultLength {
+	return truncateText(content, MaxToolResultLength, KeepHeadChars, KeepTailChars)
+}
+
+// truncateText 超过 maxChars 字符时保留头尾各 head/tail 个字符（按字符切分，不会截断多字节字符）
+func truncateText(content string, maxChars, head, tail int) string {
+	if len(content) <= maxChars {
+		return content
+	}
+	runes := []rune(content)
+	if len(runes) <= maxChars || head+tail >= len(runes) {
 		return content
 	}
 
-	head := content[:KeepHeadChars]
-	tail := content[len(content)-KeepTailChars:]
-	omittedChars := len(content) - KeepHeadChars - KeepTailChars
-
+	omittedChars := len(runes) - head - tail
 	return fmt.Sprintf("%s\n\n... [省略 %d 字符] ...\n\n%s",
-		head, omittedChars, tail)
+		string(runes[:head]), omittedChars, string(runes[len(runes)-tail:]))
 }
 
 // extractToolResultContent 从工具结果中提取文本内容
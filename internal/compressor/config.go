@@ -11,19 +11,28 @@ const (
 	MaxToolResultLength = 2000 // 单个工具结果最大字符数
 	KeepHeadChars       = 800  // 保留头部字符数
 	KeepTailChars       = 800  // 保留尾部字符数
+
+	// 确定性压缩策略配置
+	DroppedToolResultMinChars = 200       // 短于该长度的工具结果不丢弃、不按内容去重
+	ImagePlaceholder          = "[图片已省略]" // 旧轮次图片的占位文本
+	ImageTokenEstimate        = 1600      // 单张图片的估算 token 数
 )
 
 // CompressConfig 上下文压缩配置
 // @author ygw
 type CompressConfig struct {
 	// 触发条件
-	TokenThreshold   int // 触发压缩的 token 阈值，默认 150000
-	MessageThreshold int // 触发压缩的消息数阈值，默认 100
+	TokenThreshold   int  // 触发压缩的 token 阈值，默认 150000
+	MessageThreshold int  // 触发压缩的消息数阈值，默认 100
+	CountAllBlocks   bool // token 计数是否包含工具调用参数、工具结果和图片（默认只统计文本；策略链包含确定性策略时自动开启）
 
 	// 保留策略
 	KeepMessageCount int // 保留最近的消息数量，默认 6
 	MaxToolLookback  int // 工具调用最大回溯距离，默认 10
 
+	// 滑动窗口策略保留的消息数，默认 40
+	SlidingWindowMessages int
+
 	// 摘要生成
 	MaxBatchChars          int    // 单批摘要最大字符数，默认 80000
 	SummaryModel           string // 用于生成摘要的模型
@@ -42,6 +51,7 @@ func DefaultConfig() *CompressConfig {
 		MessageThreshold:       100,
 		KeepMessageCount:       6,
 		MaxToolLookback:        10,
+		SlidingWindowMessages:  40,
 		MaxBatchChars:          80000,
 		SummaryModel:           "claude-sonnet-4-5-20250929",
 		MaxSingleSummaryTokens: 25000,
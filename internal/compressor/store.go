@@ -0,0 +1,156 @@
+package compressor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"claude-api/internal/logger"
+)
+
+// 缓存存储类型
+const (
+	StoreFile     = "file"     // 本地 JSON 文件（默认，单实例）
+	StoreDatabase = "database" // 复用主数据库（SQLite / MySQL）
+	StoreRedis    = "redis"    // Redis 协议服务
+)
+
+// ErrCacheNotFound 缓存不存在（已过期或被其他实例删除）
+var ErrCacheNotFound = errors.New("摘要缓存不存在")
+
+// CacheStore 摘要缓存存储后端
+// SummaryCache 负责内存索引、TTL 判断和冗余淘汰，存储后端只负责持久化
+// @author ygw
+type CacheStore interface {
+	// List 返回所有缓存的索引信息（不含摘要内容）
+	List(ctx context.Context) ([]*CacheIndexEntry, error)
+	// Load 加载完整缓存，不存在时返回 ErrCacheNotFound
+	Load(ctx context.Context, prefixHash string) (*ConversationCache, error)
+	// Save 写入（覆盖）缓存
+	Save(ctx context.Context, cache *ConversationCache) error
+	// Delete 删除缓存（不存在时不报错）
+	Delete(ctx context.Context, prefixHash string) error
+	// Shared 是否为多实例共享存储（共享存储需要定期从存储刷新内存索引）
+	Shared() bool
+}
+
+// newIndexEntry 从缓存内容构建索引条目
+func newIndexEntry(cache *ConversationCache) *CacheIndexEntry {
+	blockIDs := make([]string, len(cache.SummaryBlocks))
+	for i, block := range cache.SummaryBlocks {
+		blockIDs[i] = block.BlockID
+	}
+	return &CacheIndexEntry{
+		PrefixHash:         cache.PrefixHash,
+		TotalCompressedMsg: cache.TotalCompressedMsg,
+		BlockIDs:           blockIDs,
+		UpdatedAt:          cache.UpdatedAt,
+	}
+}
+
+// FileStore 本地文件存储（每个缓存一个 JSON 文件）
+// @author ygw
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore 创建文件存储
+// @param dir 缓存目录（不存在时自动创建）
+func NewFileStore(dir string) *FileStore {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Error("[智能压缩] 创建缓存目录失败: %v", err)
+	}
+	return &FileStore{dir: dir}
+}
+
+// fileName 使用 hash 前缀作为文件名
+func (s *FileStore) fileName(prefixHash string) string {
+	if len(prefixHash) > 32 {
+		prefixHash = prefixHash[:32]
+	}
+	return prefixHash + ".json"
+}
+
+// List 读取目录下所有缓存文件（损坏的文件直接删除）
+func (s *FileStore) List(ctx context.Context) ([]*CacheIndexEntry, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存目录失败: %w", err)
+	}
+
+	var result []*CacheIndexEntry
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		filePath := filepath.Join(s.dir, entry.Name())
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+		var cache ConversationCache
+		if err := json.Unmarshal(data, &cache); err != nil {
+			os.Remove(filePath)
+			continue
+		}
+		indexEntry := newIndexEntry(&cache)
+		indexEntry.FileName = entry.Name()
+		result = append(result, indexEntry)
+	}
+	return result, nil
+}
+
+// Load 从文件加载完整缓存
+func (s *FileStore) Load(ctx context.Context, prefixHash string) (*ConversationCache, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, s.fileName(prefixHash)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCacheNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cache ConversationCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// Save 写入缓存文件
+func (s *FileStore) Save(ctx context.Context, cache *ConversationCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("序列化缓存失败: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, s.fileName(cache.PrefixHash)), data, 0644); err != nil {
+		return fmt.Errorf("写入缓存失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除缓存文件
+func (s *FileStore) Delete(ctx context.Context, prefixHash string) error {
+	err := os.Remove(filepath.Join(s.dir, s.fileName(prefixHash)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Shared 文件存储仅供本实例使用
+func (s *FileStore) Shared() bool {
+	return false
+}
+
+// fromUnixMilli 将存储中的毫秒时间戳转换为时间
+func fromUnixMilli(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,105 @@
+package compressor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"claude-api/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore 数据库存储（复用主数据库连接，多实例共享）
+// @author ygw
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore 创建数据库存储（summary_caches 表由数据库迁移创建）
+// @param db GORM 实例
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// List 读取所有缓存的索引字段
+func (s *DBStore) List(ctx context.Context) ([]*CacheIndexEntry, error) {
+	var rows []*models.SummaryCacheEntry
+	err := s.db.WithContext(ctx).
+		Select("prefix_hash", "total_compressed_msg", "block_ids", "updated_at").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询摘要缓存失败: %w", err)
+	}
+
+	result := make([]*CacheIndexEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := &CacheIndexEntry{
+			PrefixHash:         row.PrefixHash,
+			TotalCompressedMsg: row.TotalCompressedMsg,
+			UpdatedAt:          fromUnixMilli(row.UpdatedAt),
+		}
+		if row.BlockIDs != "" {
+			json.Unmarshal([]byte(row.BlockIDs), &entry.BlockIDs)
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Load 加载完整缓存
+func (s *DBStore) Load(ctx context.Context, prefixHash string) (*ConversationCache, error) {
+	var row models.SummaryCacheEntry
+	err := s.db.WithContext(ctx).Where("prefix_hash = ?", prefixHash).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCacheNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询摘要缓存失败: %w", err)
+	}
+	var cache ConversationCache
+	if err := json.Unmarshal(row.Data, &cache); err != nil {
+		return nil, fmt.Errorf("解析摘要缓存失败: %w", err)
+	}
+	return &cache, nil
+}
+
+// Save 写入（覆盖）缓存
+func (s *DBStore) Save(ctx context.Context, cache *ConversationCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("序列化缓存失败: %w", err)
+	}
+	blockIDs, _ := json.Marshal(newIndexEntry(cache).BlockIDs)
+	row := &models.SummaryCacheEntry{
+		PrefixHash:         cache.PrefixHash,
+		TotalCompressedMsg: cache.TotalCompressedMsg,
+		BlockIDs:           string(blockIDs),
+		Data:               data,
+		UpdatedAt:          cache.UpdatedAt.UnixMilli(),
+	}
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "prefix_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"total_compressed_msg", "block_ids", "data", "updated_at"}),
+	}).Create(row).Error
+	if err != nil {
+		return fmt.Errorf("保存摘要缓存失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除缓存
+func (s *DBStore) Delete(ctx context.Context, prefixHash string) error {
+	err := s.db.WithContext(ctx).Where("prefix_hash = ?", prefixHash).Delete(&models.SummaryCacheEntry{}).Error
+	if err != nil {
+		return fmt.Errorf("删除摘要缓存失败: %w", err)
+	}
+	return nil
+}
+
+// Shared 数据库存储在多实例间共享
+func (s *DBStore) Shared() bool {
+	return true
+}
@@ -0,0 +1,129 @@
+package compressor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"claude-api/internal/redis"
+)
+
+// RedisStore Redis 协议存储（多实例共享）
+// 缓存内容存为带过期时间的字符串键，索引信息存于单个哈希中；
+// 哈希字段无法单独过期，读取索引时清理已过期的字段，哈希本身随最后一次写入顺延过期
+// @author ygw
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// redisIndexValue 索引哈希中的字段值
+type redisIndexValue struct {
+	TotalCompressedMsg int      `json:"n"`
+	BlockIDs           []string `json:"b"`
+	UpdatedAt          int64    `json:"t"` // Unix 毫秒
+}
+
+// NewRedisStore 创建 Redis 存储
+// @param client Redis 客户端
+// @param keyPrefix 键前缀（多个部署共用一个 Redis 时区分）
+// @param ttl 缓存键过期时间（与 SummaryCache 的 TTL 一致）
+func NewRedisStore(client *redis.Client, keyPrefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, prefix: keyPrefix + "summary:", ttl: ttl}
+}
+
+func (s *RedisStore) indexKey() string {
+	return s.prefix + "index"
+}
+
+func (s *RedisStore) dataKey(prefixHash string) string {
+	return s.prefix + "data:" + prefixHash
+}
+
+// List 读取索引哈希（损坏或数据键已过期的字段直接删除）
+func (s *RedisStore) List(ctx context.Context) ([]*CacheIndexEntry, error) {
+	fields, err := s.client.HGetAll(ctx, s.indexKey())
+	if err != nil {
+		return nil, fmt.Errorf("读取摘要缓存索引失败: %w", err)
+	}
+	now := time.Now()
+	result := make([]*CacheIndexEntry, 0, len(fields))
+	var stale []string
+	for prefixHash, raw := range fields {
+		var v redisIndexValue
+		if err := json.Unmarshal([]byte(raw), &v); err != nil || (s.ttl > 0 && now.Sub(fromUnixMilli(v.UpdatedAt)) > s.ttl) {
+			stale = append(stale, prefixHash)
+			continue
+		}
+		result = append(result, &CacheIndexEntry{
+			PrefixHash:         prefixHash,
+			TotalCompressedMsg: v.TotalCompressedMsg,
+			BlockIDs:           v.BlockIDs,
+			UpdatedAt:          fromUnixMilli(v.UpdatedAt),
+		})
+	}
+	if len(stale) > 0 {
+		s.client.HDel(ctx, s.indexKey(), stale...)
+	}
+	return result, nil
+}
+
+// Load 加载完整缓存（键已过期时返回 ErrCacheNotFound）
+func (s *RedisStore) Load(ctx context.Context, prefixHash string) (*ConversationCache, error) {
+	data, err := s.client.Get(ctx, s.dataKey(prefixHash))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, ErrCacheNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取摘要缓存失败: %w", err)
+	}
+	var cache ConversationCache
+	if err := json.Unmarshal([]byte(data), &cache); err != nil {
+		return nil, fmt.Errorf("解析摘要缓存失败: %w", err)
+	}
+	return &cache, nil
+}
+
+// Save 写入缓存内容和索引
+func (s *RedisStore) Save(ctx context.Context, cache *ConversationCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("序列化缓存失败: %w", err)
+	}
+	if err := s.client.Set(ctx, s.dataKey(cache.PrefixHash), string(data), s.ttl); err != nil {
+		return fmt.Errorf("写入摘要缓存失败: %w", err)
+	}
+	index, _ := json.Marshal(redisIndexValue{
+		TotalCompressedMsg: cache.TotalCompressedMsg,
+		BlockIDs:           newIndexEntry(cache).BlockIDs,
+		UpdatedAt:          cache.UpdatedAt.UnixMilli(),
+	})
+	if err := s.client.HSet(ctx, s.indexKey(), cache.PrefixHash, string(index)); err != nil {
+		return fmt.Errorf("写入摘要缓存索引失败: %w", err)
+	}
+	if s.ttl > 0 {
+		if err := s.client.PExpire(ctx, s.indexKey(), s.ttl); err != nil {
+			return fmt.Errorf("设置摘要缓存索引过期时间失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete 删除缓存内容和索引
+func (s *RedisStore) Delete(ctx context.Context, prefixHash string) error {
+	if _, err := s.client.Del(ctx, s.dataKey(prefixHash)); err != nil {
+		return fmt.Errorf("删除摘要缓存失败: %w", err)
+	}
+	if err := s.client.HDel(ctx, s.indexKey(), prefixHash); err != nil {
+		return fmt.Errorf("删除摘要缓存索引失败: %w", err)
+	}
+	return nil
+}
+
+// Shared Redis 存储在多实例间共享
+func (s *RedisStore) Shared() bool {
+	return true
+}
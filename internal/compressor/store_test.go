@@ -0,0 +1,210 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"claude-api/internal/models"
+	"claude-api/internal/redis/redistest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// storeFactories 各存储后端的构造函数（同一测试内多次调用返回共享同一份数据的存储）
+func storeFactories(t *testing.T) map[string]func(ttl time.Duration) CacheStore {
+	dir := t.TempDir()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cache.db")), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SummaryCacheEntry{}); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+
+	srv := redistest.NewServer(t, "secret")
+	client := srv.Client(t)
+
+	return map[string]func(time.Duration) CacheStore{
+		StoreFile:     func(time.Duration) CacheStore { return NewFileStore(dir) },
+		StoreDatabase: func(time.Duration) CacheStore { return NewDBStore(db) },
+		StoreRedis:    func(ttl time.Duration) CacheStore { return NewRedisStore(client, "test:", ttl) },
+	}
+}
+
+// testMessages 构造 n 条对话消息
+func testMessages(n int) []models.ClaudeMessage {
+	messages := make([]models.ClaudeMessage, n)
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = models.ClaudeMessage{Role: role, Content: fmt.Sprintf("消息 %d", i)}
+	}
+	return messages
+}
+
+// saveBlocks 保存覆盖前 msgCount 条消息、包含指定摘要块的缓存
+func saveBlocks(c *SummaryCache, messages []models.ClaudeMessage, msgCount int, blockIDs ...string) {
+	cache := &ConversationCache{
+		PrefixHash:         c.GeneratePrefixHash(messages, msgCount),
+		TotalCompressedMsg: msgCount,
+	}
+	for _, id := range blockIDs {
+		cache.SummaryBlocks = append(cache.SummaryBlocks, SummaryBlock{BlockID: id, Summary: "摘要 " + id})
+	}
+	c.SaveCache(cache)
+}
+
+// TestCacheStores_SaveFindEvict 测试各存储的命中、冗余淘汰和跨实例共享行为一致
+func TestCacheStores_SaveFindEvict(t *testing.T) {
+	for name, newStore := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			c := NewSummaryCacheWithStore(newStore(time.Hour), time.Hour)
+			messages := testMessages(12)
+
+			saveBlocks(c, messages, 4, "b1")
+			cached, count := c.FindMatchingCache(messages)
+			if cached == nil || count != 4 || cached.SummaryBlocks[0].Summary != "摘要 b1" {
+				t.Fatalf("应命中 4 条消息的缓存: %v %d", cached, count)
+			}
+
+			// 新缓存包含旧缓存的全部摘要块，旧缓存应被淘汰
+			saveBlocks(c, messages, 8, "b1", "b2")
+			if total, groups := c.GetIndexStats(); total != 1 || groups != 1 {
+				t.Errorf("冗余缓存应被淘汰，索引: %d/%d", total, groups)
+			}
+			if entries, _ := c.store.List(context.Background()); len(entries) != 1 {
+				t.Errorf("存储中应只剩 1 条缓存，实际 %d", len(entries))
+			}
+			if _, count := c.FindMatchingCache(messages); count != 8 {
+				t.Errorf("应优先命中消息数最多的缓存，实际 %d", count)
+			}
+			if cached, _ := c.FindMatchingCache(testMessages(6)); cached != nil {
+				t.Error("已淘汰的缓存不应命中")
+			}
+
+			// 另一个实例从同一存储加载索引
+			other := NewSummaryCacheWithStore(newStore(time.Hour), time.Hour)
+			if _, count := other.FindMatchingCache(messages); count != 8 {
+				t.Errorf("新实例应命中已有缓存，实际 %d", count)
+			}
+		})
+	}
+}
+
+// TestCacheStores_TTL 测试各存储的过期判断和清理行为一致
+func TestCacheStores_TTL(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	for name, newStore := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			c := NewSummaryCacheWithStore(newStore(ttl), ttl)
+			messages := testMessages(6)
+			saveBlocks(c, messages, 4, "b1")
+			if _, count := c.FindMatchingCache(messages); count != 4 {
+				t.Fatalf("过期前应命中，实际 %d", count)
+			}
+
+			time.Sleep(ttl + 100*time.Millisecond)
+			if cached, _ := c.FindMatchingCache(messages); cached != nil {
+				t.Error("过期缓存不应命中")
+			}
+			c.cleanup()
+			if total, _ := c.GetIndexStats(); total != 0 {
+				t.Errorf("清理后索引应为空，实际 %d", total)
+			}
+			if entries, _ := c.store.List(context.Background()); len(entries) != 0 {
+				t.Errorf("清理后存储应为空，实际 %d", len(entries))
+			}
+		})
+	}
+}
+
+// TestCacheStores_RemovedByOtherInstance 测试共享存储中被其他实例删除的缓存不会命中
+func TestCacheStores_RemovedByOtherInstance(t *testing.T) {
+	for name, newStore := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			a := NewSummaryCacheWithStore(newStore(time.Hour), time.Hour)
+			messages := testMessages(6)
+			saveBlocks(a, messages, 4, "b1")
+
+			b := NewSummaryCacheWithStore(newStore(time.Hour), time.Hour)
+			b.store.Delete(context.Background(), b.GeneratePrefixHash(messages, 4))
+
+			if cached, _ := a.FindMatchingCache(messages); cached != nil {
+				t.Error("已删除的缓存不应命中")
+			}
+			if total, _ := a.GetIndexStats(); total != 0 {
+				t.Errorf("加载失败的条目应从索引移除，实际 %d", total)
+			}
+		})
+	}
+}
+
+// blockingListStore List 期间阻塞的存储，用于模拟远程存储延迟
+type blockingListStore struct {
+	CacheStore
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingListStore) List(ctx context.Context) ([]*CacheIndexEntry, error) {
+	entries, err := s.CacheStore.List(ctx)
+	if s.listing != nil {
+		close(s.listing)
+		<-s.release
+		s.listing = nil
+	}
+	return entries, err
+}
+
+// TestSummaryCache_SaveDuringIndexSync 测试刷新索引期间保存的缓存不会被覆盖，且存储读取不阻塞查找
+func TestSummaryCache_SaveDuringIndexSync(t *testing.T) {
+	store := &blockingListStore{CacheStore: storeFactories(t)[StoreRedis](time.Hour)}
+	c := NewSummaryCacheWithStore(store, time.Hour)
+	messages := testMessages(6)
+
+	store.listing, store.release = make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.loadIndex()
+		close(done)
+	}()
+	<-store.listing
+
+	saveBlocks(c, messages, 4, "b1")
+	if _, count := c.FindMatchingCache(messages); count != 4 {
+		t.Errorf("刷新索引期间应能保存并命中缓存，实际 %d", count)
+	}
+	close(store.release)
+	<-done
+
+	if total, _ := c.GetIndexStats(); total != 1 {
+		t.Errorf("刷新索引不应丢弃期间保存的缓存，索引条目 %d", total)
+	}
+}
+
+// TestRedisStore_PrunesExpiredIndex 测试 Redis 索引哈希中数据已过期的字段会被清理
+func TestRedisStore_PrunesExpiredIndex(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	client := redistest.NewServer(t, "").Client(t)
+	store := NewRedisStore(client, "test:", ttl)
+	ctx := context.Background()
+
+	if err := store.Save(ctx, &ConversationCache{PrefixHash: "h1", TotalCompressedMsg: 2, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(ttl + 100*time.Millisecond)
+	if entries, err := store.List(ctx); err != nil || len(entries) != 0 {
+		t.Errorf("过期字段不应返回: %v (%v)", entries, err)
+	}
+	if fields, _ := client.HGetAll(ctx, store.indexKey()); len(fields) != 0 {
+		t.Errorf("过期字段应从索引哈希删除，剩余 %v", fields)
+	}
+}
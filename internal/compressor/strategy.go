@@ -0,0 +1,472 @@
+package compressor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+)
+
+// 压缩策略名称
+const (
+	StrategySummarize       = "summarize"         // LLM 摘要（需要额外的上游调用）
+	StrategyToolResults     = "tool_results"      // 裁剪过期工具结果（保留头尾）
+	StrategyDropToolResults = "drop_tool_results" // 丢弃过期工具结果正文
+	StrategyDedupReads      = "dedup_reads"       // 去重重复的文件读取结果
+	StrategyImages          = "images"            // 旧轮次图片替换为占位符
+	StrategySlidingWindow   = "sliding_window"    // 只保留最近的消息
+)
+
+// DefaultStrategies 默认策略链（仅 LLM 摘要，触发阈值只统计文本 token）
+var DefaultStrategies = []string{StrategySummarize}
+
+// Strategy 上下文压缩策略
+// @author ygw
+type Strategy interface {
+	// Name 策略名称
+	Name() string
+	// Apply 执行压缩，返回新的请求；无可压缩内容时返回 nil（不得修改传入的请求）
+	// step 用于记录策略特有的统计（如摘要块数）
+	Apply(ctx context.Context, c *Compressor, req *models.ClaudeRequest, summarizer SummarizerFunc, step *StepReport) (*models.ClaudeRequest, error)
+}
+
+// strategies 已注册的策略
+var strategies = map[string]Strategy{
+	StrategySummarize:       summarizeStrategy{},
+	StrategyToolResults:     toolResultStrategy{},
+	StrategyDropToolResults: toolResultStrategy{drop: true},
+	StrategyDedupReads:      dedupReadsStrategy{},
+	StrategyImages:          imageStrategy{},
+	StrategySlidingWindow:   slidingWindowStrategy{},
+}
+
+// StrategyNames 返回所有可用的策略名称
+func StrategyNames() []string {
+	return []string{StrategyToolResults, StrategyDropToolResults, StrategyDedupReads, StrategyImages, StrategySlidingWindow, StrategySummarize}
+}
+
+// ParseStrategies 解析策略链（逗号分隔），校验名称并去重
+// @param spec 策略链，如 "dedup_reads,tool_results,summarize"
+// @return []string 策略名称（为空表示未配置）
+// @author ygw
+func ParseStrategies(spec string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		name := strings.TrimSpace(part)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := strategies[name]; !ok {
+			return nil, fmt.Errorf("未知的压缩策略: %s（可用: %s）", name, strings.Join(StrategyNames(), ", "))
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// StepReport 单个策略的执行结果
+type StepReport struct {
+	Strategy       string        `json:"strategy"`
+	Applied        bool          `json:"applied"` // 是否修改了请求
+	TokensBefore   int           `json:"tokens_before"`
+	TokensAfter    int           `json:"tokens_after"`
+	MessagesBefore int           `json:"messages_before"`
+	MessagesAfter  int           `json:"messages_after"`
+	Duration       time.Duration `json:"duration"`
+	SummaryBlocks  int           `json:"summary_blocks,omitempty"` // 仅 summarize：压缩后的摘要块数
+	CacheHit       bool          `json:"cache_hit,omitempty"`      // 仅 summarize：是否复用缓存的摘要块
+}
+
+// Report 策略链执行结果
+type Report struct {
+	TokensBefore  int          `json:"tokens_before"`
+	TokensAfter   int          `json:"tokens_after"`
+	SummaryBlocks int          `json:"summary_blocks"`
+	CacheHit      bool         `json:"cache_hit"`
+	Steps         []StepReport `json:"steps"`
+}
+
+// Applied 返回实际修改了请求的策略名称
+func (r *Report) Applied() []string {
+	var names []string
+	for _, step := range r.Steps {
+		if step.Applied {
+			names = append(names, step.Strategy)
+		}
+	}
+	return names
+}
+
+// Run 按顺序执行策略链，请求降到阈值以下后停止（summarize 自行判断是否需要压缩及复用缓存）
+// 策略链包含确定性策略时，token 计数包含工具调用参数、工具结果和图片，以衡量这些策略的效果；
+// 只有 summarize 时沿用只统计文本的计数，不改变默认压缩的触发时机
+// @param req 原始请求
+// @param names 策略链（为空时使用 DefaultStrategies）
+// @param summarizer 摘要生成函数（仅 summarize 使用）
+// @return *models.ClaudeRequest 压缩后的请求；未做任何修改时返回 nil
+// @return *Report 各策略的 token/消息数变化
+// @return error 某个策略失败时返回错误，此时请求为失败前的结果
+// @author ygw
+func (c *Compressor) Run(ctx context.Context, req *models.ClaudeRequest, names []string,
+	summarizer SummarizerFunc) (*models.ClaudeRequest, *Report, error) {
+
+	if len(names) == 0 {
+		names = DefaultStrategies
+	}
+	for _, name := range names {
+		if name != StrategySummarize {
+			c = c.withCountAllBlocks()
+			break
+		}
+	}
+
+	tokens := c.countTokens(req.Messages, req.System)
+	report := &Report{TokensBefore: tokens, TokensAfter: tokens}
+	current := req
+	changed := false
+
+	for _, name := range names {
+		strategy, ok := strategies[name]
+		if !ok {
+			continue
+		}
+		if name != StrategySummarize {
+			if needs, _, _ := c.NeedsCompression(current.Messages, current.System); !needs {
+				break
+			}
+		}
+
+		start := time.Now()
+		step := StepReport{Strategy: name, TokensBefore: tokens, MessagesBefore: len(current.Messages)}
+		next, err := strategy.Apply(ctx, c, current, summarizer, &step)
+		step.Duration = time.Since(start)
+		if err != nil {
+			step.TokensAfter, step.MessagesAfter = step.TokensBefore, step.MessagesBefore
+			report.Steps = append(report.Steps, step)
+			if !changed {
+				current = nil
+			}
+			return current, report, fmt.Errorf("压缩策略 %s 失败: %w", name, err)
+		}
+		if next != nil {
+			current = next
+			changed = true
+			step.Applied = true
+			tokens = c.countTokens(current.Messages, current.System)
+		}
+		step.TokensAfter, step.MessagesAfter = tokens, len(current.Messages)
+		report.Steps = append(report.Steps, step)
+		report.TokensAfter = tokens
+		if step.SummaryBlocks > 0 {
+			report.SummaryBlocks = step.SummaryBlocks
+		}
+		report.CacheHit = report.CacheHit || step.CacheHit
+
+		if step.Applied {
+			logger.Debug("[智能压缩] 策略 %s: Token %d→%d 消息 %d→%d 耗时 %dms", name,
+				step.TokensBefore, step.TokensAfter, step.MessagesBefore, step.MessagesAfter, step.Duration.Milliseconds())
+		}
+	}
+
+	if !changed {
+		return nil, report, nil
+	}
+	return current, report, nil
+}
+
+// summarizeStrategy LLM 摘要（原有的分块增量摘要 + 缓存）
+type summarizeStrategy struct{}
+
+func (summarizeStrategy) Name() string { return StrategySummarize }
+
+func (summarizeStrategy) Apply(ctx context.Context, c *Compressor, req *models.ClaudeRequest, summarizer SummarizerFunc, step *StepReport) (*models.ClaudeRequest, error) {
+	if summarizer == nil {
+		return nil, nil
+	}
+	stats := &SummaryStats{}
+	out, err := c.compressWithStats(ctx, req, summarizer, stats)
+	step.SummaryBlocks, step.CacheHit = stats.Blocks, stats.CacheHit
+	return out, err
+}
+
+// toolResultStrategy 处理保留区之前的工具结果：裁剪为头尾（drop=false）或整体替换为占位符（drop=true）
+type toolResultStrategy struct {
+	drop bool
+}
+
+func (s toolResultStrategy) Name() string {
+	if s.drop {
+		return StrategyDropToolResults
+	}
+	return StrategyToolResults
+}
+
+func (s toolResultStrategy) Apply(_ context.Context, c *Compressor, req *models.ClaudeRequest, _ SummarizerFunc, _ *StepReport) (*models.ClaudeRequest, error) {
+	stale := c.staleCount(req.Messages)
+	return rewriteBlocks(req, stale, func(_ int, block map[string]interface{}) map[string]interface{} {
+		if block["type"] != "tool_result" {
+			return nil
+		}
+		text := extractToolResultContent(block["content"])
+		if s.drop {
+			if len([]rune(text)) <= DroppedToolResultMinChars {
+				return nil
+			}
+			return withContent(block, fmt.Sprintf("[工具结果已省略，原长度 %d 字符]", len([]rune(text))))
+		}
+		truncated := truncateToolResult(text)
+		if truncated == text {
+			return nil
+		}
+		return withContent(block, truncated)
+	}), nil
+}
+
+// dedupReadsStrategy 同一文件被多次读取（读取类工具的名称与参数相同）或工具结果内容完全相同时，只保留最后一次
+// 只替换保留区之前的结果；保留区内的读取结果仍作为"最后一次"参与比较
+type dedupReadsStrategy struct{}
+
+func (dedupReadsStrategy) Name() string { return StrategyDedupReads }
+
+func (dedupReadsStrategy) Apply(_ context.Context, c *Compressor, req *models.ClaudeRequest, _ SummarizerFunc, _ *StepReport) (*models.ClaudeRequest, error) {
+	// tool_use id → 读取键（只处理带文件路径参数的读取类工具）
+	readKeys := make(map[string]string)
+	for _, msg := range req.Messages {
+		forEachBlock(msg.Content, func(block map[string]interface{}) {
+			if block["type"] != "tool_use" {
+				return
+			}
+			id, _ := block["id"].(string)
+			if key := fileReadKey(block); id != "" && key != "" {
+				readKeys[id] = key
+			}
+		})
+	}
+
+	// 第一遍：记录每个键最后一次出现的 tool_use_id
+	last := make(map[string]string)
+	for _, msg := range req.Messages {
+		forEachBlock(msg.Content, func(block map[string]interface{}) {
+			if block["type"] != "tool_result" {
+				return
+			}
+			id, _ := block["tool_use_id"].(string)
+			for _, key := range dedupKeys(block, readKeys[id]) {
+				last[key] = id
+			}
+		})
+	}
+
+	// 第二遍：替换保留区之前较早的重复结果
+	return rewriteBlocks(req, c.staleCount(req.Messages), func(_ int, block map[string]interface{}) map[string]interface{} {
+		if block["type"] != "tool_result" {
+			return nil
+		}
+		id, _ := block["tool_use_id"].(string)
+		for _, key := range dedupKeys(block, readKeys[id]) {
+			if latest := last[key]; latest != "" && latest != id {
+				return withContent(block, fmt.Sprintf("[重复的读取结果已省略，见后续 tool_result %s]", latest))
+			}
+		}
+		return nil
+	}), nil
+}
+
+// imageStrategy 保留区之前的图片（包括工具结果中的图片）替换为文本占位符
+type imageStrategy struct{}
+
+func (imageStrategy) Name() string { return StrategyImages }
+
+func (imageStrategy) Apply(_ context.Context, c *Compressor, req *models.ClaudeRequest, _ SummarizerFunc, _ *StepReport) (*models.ClaudeRequest, error) {
+	stale := c.staleCount(req.Messages)
+	return rewriteBlocks(req, stale, func(_ int, block map[string]interface{}) map[string]interface{} {
+		switch block["type"] {
+		case "image":
+			return map[string]interface{}{"type": "text", "text": ImagePlaceholder}
+		case "tool_result":
+			items, ok := block["content"].([]interface{})
+			if !ok {
+				return nil
+			}
+			replaced := false
+			out := make([]interface{}, len(items))
+			for i, item := range items {
+				if m, ok := item.(map[string]interface{}); ok && m["type"] == "image" {
+					out[i] = map[string]interface{}{"type": "text", "text": ImagePlaceholder}
+					replaced = true
+					continue
+				}
+				out[i] = item
+			}
+			if !replaced {
+				return nil
+			}
+			cp := copyBlock(block)
+			cp["content"] = out
+			return cp
+		}
+		return nil
+	}), nil
+}
+
+// slidingWindowStrategy 只保留最近 SlidingWindowMessages 条消息（不拆分工具调用对，窗口以普通用户消息开头）
+type slidingWindowStrategy struct{}
+
+func (slidingWindowStrategy) Name() string { return StrategySlidingWindow }
+
+func (slidingWindowStrategy) Apply(_ context.Context, c *Compressor, req *models.ClaudeRequest, _ SummarizerFunc, _ *StepReport) (*models.ClaudeRequest, error) {
+	window := c.config.SlidingWindowMessages
+	if window <= 0 || len(req.Messages) <= window {
+		return nil, nil
+	}
+	start := c.findSafeSplitPoint(req.Messages, len(req.Messages)-window)
+	for start < len(req.Messages) {
+		msg := req.Messages[start]
+		if msg.Role == "user" && len(extractToolResultIDs(msg.Content)) == 0 {
+			break
+		}
+		start++
+	}
+	if start == 0 || start >= len(req.Messages) {
+		return nil, nil
+	}
+	return cloneRequest(req, append([]models.ClaudeMessage(nil), req.Messages[start:]...)), nil
+}
+
+// staleCount 返回保留区之前的消息数（与摘要使用相同的安全分割点）
+func (c *Compressor) staleCount(messages []models.ClaudeMessage) int {
+	history, _ := c.splitMessages(messages)
+	return len(history)
+}
+
+// rewriteBlocks 对前 limit 条消息的内容块逐个调用 fn，fn 返回非 nil 时替换该块
+// 只复制被修改的消息，原请求保持不变；没有任何修改时返回 nil
+func rewriteBlocks(req *models.ClaudeRequest, limit int, fn func(msgIdx int, block map[string]interface{}) map[string]interface{}) *models.ClaudeRequest {
+	var messages []models.ClaudeMessage
+	for i := 0; i < limit && i < len(req.Messages); i++ {
+		blocks, ok := req.Messages[i].Content.([]interface{})
+		if !ok {
+			continue
+		}
+		var newBlocks []interface{}
+		for j, block := range blocks {
+			m, ok := block.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			replacement := fn(i, m)
+			if replacement == nil {
+				continue
+			}
+			if newBlocks == nil {
+				newBlocks = append([]interface{}(nil), blocks...)
+			}
+			newBlocks[j] = replacement
+		}
+		if newBlocks == nil {
+			continue
+		}
+		if messages == nil {
+			messages = append([]models.ClaudeMessage(nil), req.Messages...)
+		}
+		messages[i].Content = newBlocks
+	}
+	if messages == nil {
+		return nil
+	}
+	return cloneRequest(req, messages)
+}
+
+// forEachBlock 遍历消息中的 map 类型内容块
+func forEachBlock(content interface{}, fn func(block map[string]interface{})) {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return
+	}
+	for _, block := range blocks {
+		if m, ok := block.(map[string]interface{}); ok {
+			fn(m)
+		}
+	}
+}
+
+// copyBlock 浅拷贝内容块
+func copyBlock(block map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(block))
+	for k, v := range block {
+		cp[k] = v
+	}
+	return cp
+}
+
+// withContent 返回替换了 content 的工具结果块副本
+func withContent(block map[string]interface{}, content string) map[string]interface{} {
+	cp := copyBlock(block)
+	cp["content"] = content
+	return cp
+}
+
+// fileReadPathKeys 视为文件读取的工具参数名
+var fileReadPathKeys = []string{"path", "file_path", "filePath", "filename", "file"}
+
+// fileReadTools 视为文件读取的工具名（小写、去掉下划线和连字符后比较），写入、编辑类工具不参与按参数去重
+var fileReadTools = map[string]bool{
+	"read":         true,
+	"readfile":     true,
+	"fsread":       true,
+	"viewfile":     true,
+	"notebookread": true,
+}
+
+// isFileReadTool 判断工具名是否为文件读取工具
+func isFileReadTool(name string) bool {
+	name = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+	return fileReadTools[name]
+}
+
+// fileReadKey 读取类工具调用带文件路径参数时，返回 "工具名|参数 JSON" 作为读取键
+func fileReadKey(toolUse map[string]interface{}) string {
+	name, _ := toolUse["name"].(string)
+	if !isFileReadTool(name) {
+		return ""
+	}
+	input, ok := toolUse["input"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, k := range fileReadPathKeys {
+		if _, ok := input[k].(string); ok {
+			data, _ := json.Marshal(input) // map 序列化按键排序，结果稳定
+			return "read:" + name + "|" + string(data)
+		}
+	}
+	return ""
+}
+
+// dedupKeys 工具结果的去重键：读取键 + 内容 hash（内容过短时不按内容去重）
+func dedupKeys(toolResult map[string]interface{}, readKey string) []string {
+	var keys []string
+	if readKey != "" {
+		keys = append(keys, readKey)
+	}
+	if text := extractToolResultContent(toolResult["content"]); len(text) > DroppedToolResultMinChars {
+		sum := sha256.Sum256([]byte(text))
+		keys = append(keys, "content:"+hex.EncodeToString(sum[:]))
+	}
+	return keys
+}
+
+// cloneRequest 复制请求并替换消息
+func cloneRequest(original *models.ClaudeRequest, messages []models.ClaudeMessage) *models.ClaudeRequest {
+	cp := *original
+	cp.Messages = messages
+	return &cp
+}
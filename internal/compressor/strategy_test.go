@@ -0,0 +1,258 @@
+package compressor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"claude-api/internal/models"
+)
+
+// buildAgentConversation 构造一段典型的编码代理对话：反复读取同一批文件、大段工具输出和截图
+// @param rounds 工具调用轮数（每轮 assistant tool_use + user tool_result 两条消息）
+func buildAgentConversation(rounds int) *models.ClaudeRequest {
+	messages := []models.ClaudeMessage{{Role: "user", Content: "请帮我重构 internal/api 下的处理器"}}
+	for i := 0; i < rounds; i++ {
+		id := fmt.Sprintf("toolu_%03d", i)
+		file := fmt.Sprintf("internal/api/file_%d.go", i%5) // 5 个文件被反复读取
+		messages = append(messages,
+			models.ClaudeMessage{Role: "assistant", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": fmt.Sprintf("读取 %s", file)},
+				map[string]interface{}{"type": "tool_use", "id": id, "name": "read_file", "input": map[string]interface{}{"path": file}},
+			}},
+			models.ClaudeMessage{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "tool_result", "tool_use_id": id, "content": strings.Repeat(fmt.Sprintf("// %s line of code\n", file), 400)},
+				map[string]interface{}{"type": "image", "source": map[string]interface{}{"type": "base64", "data": "iVBORw0KGgo="}},
+			}},
+		)
+	}
+	messages = append(messages, models.ClaudeMessage{Role: "assistant", Content: "好的，继续下一步"})
+	messages = append(messages, models.ClaudeMessage{Role: "user", Content: "继续"})
+	return &models.ClaudeRequest{Model: "claude-sonnet-4.5", Messages: messages}
+}
+
+// strategyResult 单个策略链的模拟结果
+type strategyResult struct {
+	Chain        string
+	TokensBefore int
+	TokensAfter  int
+	Messages     int
+}
+
+// RunStrategySimulation 对同一段对话分别执行各策略链，统计 token 变化（不调用上游）
+// @author ygw
+func RunStrategySimulation(c *Compressor, req *models.ClaudeRequest, chains [][]string) []strategyResult {
+	var results []strategyResult
+	for _, chain := range chains {
+		out, report, _ := c.Run(context.Background(), req, chain, nil)
+		r := strategyResult{Chain: strings.Join(chain, ","), TokensBefore: report.TokensBefore, TokensAfter: report.TokensAfter, Messages: len(req.Messages)}
+		if out != nil {
+			r.Messages = len(out.Messages)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// newTestCompressor 创建阈值较低、不写缓存的压缩器
+func newTestCompressor() *Compressor {
+	cfg := DefaultConfig()
+	cfg.TokenThreshold = 1000
+	cfg.CacheEnabled = false
+	cfg.CacheDir = ""
+	cfg.SlidingWindowMessages = 10
+	return &Compressor{config: cfg}
+}
+
+// TestStrategySimulation 测试各确定性策略的压缩效果
+func TestStrategySimulation(t *testing.T) {
+	c := newTestCompressor()
+	req := buildAgentConversation(20)
+	original, _ := json.Marshal(req)
+
+	results := RunStrategySimulation(c, req, [][]string{
+		{StrategyToolResults},
+		{StrategyDropToolResults},
+		{StrategyDedupReads},
+		{StrategyImages},
+		{StrategySlidingWindow},
+		{StrategyDedupReads, StrategyToolResults, StrategyImages},
+	})
+	for _, r := range results {
+		t.Logf("%-40s Token %6d → %6d (%.0f%%) 消息 %d", r.Chain, r.TokensBefore, r.TokensAfter,
+			100*float64(r.TokensAfter)/float64(r.TokensBefore), r.Messages)
+		if r.TokensAfter >= r.TokensBefore {
+			t.Errorf("策略 %s 应减少 token", r.Chain)
+		}
+	}
+	if results[5].TokensAfter >= results[0].TokensAfter {
+		t.Error("组合策略应比单一裁剪节省更多 token")
+	}
+	if results[4].Messages > c.config.SlidingWindowMessages {
+		t.Errorf("滑动窗口应保留不超过 %d 条消息，实际 %d", c.config.SlidingWindowMessages, results[4].Messages)
+	}
+
+	if after, _ := json.Marshal(req); string(after) != string(original) {
+		t.Error("策略不应修改原始请求")
+	}
+}
+
+// TestStrategy_KeepsRecentMessages 测试裁剪类策略不修改保留区内的消息
+func TestStrategy_KeepsRecentMessages(t *testing.T) {
+	c := newTestCompressor()
+	req := buildAgentConversation(10)
+
+	for _, name := range []string{StrategyToolResults, StrategyDropToolResults, StrategyDedupReads, StrategyImages} {
+		out, err := strategies[name].Apply(context.Background(), c, req, nil, &StepReport{})
+		if err != nil || out == nil {
+			t.Fatalf("%s 应产生修改: %v", name, err)
+		}
+		stale := c.staleCount(req.Messages)
+		for i := stale; i < len(req.Messages); i++ {
+			a, _ := json.Marshal(req.Messages[i])
+			b, _ := json.Marshal(out.Messages[i])
+			if string(a) != string(b) {
+				t.Errorf("%s 不应修改保留区消息 #%d", name, i)
+			}
+		}
+	}
+}
+
+// TestDedupReads 测试只保留最后一次文件读取
+func TestDedupReads(t *testing.T) {
+	c := newTestCompressor()
+	req := buildAgentConversation(10) // file_0..file_4 各读取两次
+
+	out, _ := dedupReadsStrategy{}.Apply(context.Background(), c, req, nil, &StepReport{})
+	if out == nil {
+		t.Fatal("重复读取应被去重")
+	}
+	deduped := 0
+	for _, msg := range out.Messages {
+		forEachBlock(msg.Content, func(b map[string]interface{}) {
+			if s, ok := b["content"].(string); ok && strings.HasPrefix(s, "[重复的读取结果已省略") {
+				deduped++
+			}
+		})
+	}
+	if deduped != 5 {
+		t.Errorf("应去重 5 个较早的读取结果，实际 %d", deduped)
+	}
+}
+
+// TestDedupReads_OnlyReadTools 测试写入类工具的相同参数调用不被当作重复读取
+func TestDedupReads_OnlyReadTools(t *testing.T) {
+	c := newTestCompressor()
+	var messages []models.ClaudeMessage
+	for i := 0; i < 2; i++ {
+		id := fmt.Sprintf("toolu_w%d", i)
+		messages = append(messages,
+			models.ClaudeMessage{Role: "assistant", Content: []interface{}{
+				map[string]interface{}{"type": "tool_use", "id": id, "name": "Write", "input": map[string]interface{}{"file_path": "a.go"}},
+			}},
+			models.ClaudeMessage{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "tool_result", "tool_use_id": id, "content": fmt.Sprintf("已写入 %d", i)},
+			}},
+		)
+	}
+	req := &models.ClaudeRequest{Messages: append(messages, buildAgentConversation(6).Messages...)}
+
+	if out, _ := (dedupReadsStrategy{}).Apply(context.Background(), c, req, nil, &StepReport{}); out != nil {
+		for _, msg := range out.Messages[:4] {
+			forEachBlock(msg.Content, func(b map[string]interface{}) {
+				if s, ok := b["content"].(string); ok && strings.HasPrefix(s, "[重复的读取结果已省略") {
+					t.Errorf("写入工具的结果不应被去重: %v", b)
+				}
+			})
+		}
+	}
+}
+
+// TestCountTokens_DefaultChainTextOnly 测试默认策略链只统计文本，确定性策略链计入工具内容
+func TestCountTokens_DefaultChainTextOnly(t *testing.T) {
+	c := newTestCompressor()
+	req := buildAgentConversation(10)
+
+	_, report, _ := c.Run(context.Background(), req, nil, nil)
+	_, full, _ := c.Run(context.Background(), req, []string{StrategySlidingWindow}, nil)
+	if report.TokensBefore >= full.TokensBefore {
+		t.Errorf("默认策略链不应计入工具内容: 默认 %d，确定性策略 %d", report.TokensBefore, full.TokensBefore)
+	}
+	if c.config.CountAllBlocks {
+		t.Error("执行确定性策略链不应修改压缩器配置")
+	}
+}
+
+// TestSlidingWindow_StartsWithUserMessage 测试滑动窗口不以孤立的 tool_result 开头
+func TestSlidingWindow_StartsWithUserMessage(t *testing.T) {
+	c := newTestCompressor()
+	c.config.SlidingWindowMessages = 5
+	req := buildAgentConversation(10)
+
+	out, _ := slidingWindowStrategy{}.Apply(context.Background(), c, req, nil, &StepReport{})
+	if out == nil {
+		t.Fatal("超过窗口时应丢弃旧消息")
+	}
+	first := out.Messages[0]
+	if first.Role != "user" || len(extractToolResultIDs(first.Content)) > 0 {
+		t.Errorf("窗口应以普通用户消息开头: %+v", first)
+	}
+}
+
+// TestRun_StopsBelowThreshold 测试降到阈值以下后不再执行后续策略
+func TestRun_StopsBelowThreshold(t *testing.T) {
+	c := newTestCompressor()
+	c.config.TokenThreshold = 50000
+	req := buildAgentConversation(20)
+
+	called := false
+	summarizer := func(ctx context.Context, content, model string) (string, error) {
+		called = true
+		return "摘要", nil
+	}
+	out, report, err := c.Run(context.Background(), req, []string{StrategyDropToolResults, StrategyImages, StrategySlidingWindow}, summarizer)
+	if err != nil || out == nil {
+		t.Fatalf("应完成压缩: %v", err)
+	}
+	if report.TokensAfter > c.config.TokenThreshold {
+		t.Fatalf("压缩后应低于阈值: %d", report.TokensAfter)
+	}
+	last := report.Steps[len(report.Steps)-1].Strategy
+	if last != StrategyDropToolResults || called {
+		t.Errorf("降到阈值以下后不应继续执行，最后执行: %s", last)
+	}
+
+	if out, _, _ := c.Run(context.Background(), buildAgentConversation(1), []string{StrategyToolResults}, nil); out != nil {
+		t.Error("未超阈值时应返回 nil")
+	}
+}
+
+// TestParseStrategies 测试策略链解析
+func TestParseStrategies(t *testing.T) {
+	names, err := ParseStrategies(" dedup_reads, tool_results ,,dedup_reads,summarize")
+	if err != nil || strings.Join(names, ",") != "dedup_reads,tool_results,summarize" {
+		t.Errorf("解析结果错误: %v %v", names, err)
+	}
+	if _, err := ParseStrategies("tool_results,unknown"); err == nil {
+		t.Error("未知策略应报错")
+	}
+	if names, _ := ParseStrategies(""); len(names) != 0 {
+		t.Error("空字符串应返回空策略链")
+	}
+}
+
+// TestTruncateText_RuneSafe 测试裁剪不会截断多字节字符
+func TestTruncateText_RuneSafe(t *testing.T) {
+	s := strings.Repeat("中文内容", 1000)
+	out := truncateToolResult(s)
+	if !strings.Contains(out, "[省略") || !strings.HasPrefix(out, "中文内容") {
+		t.Errorf("裁剪结果错误: %.40s", out)
+	}
+	for _, r := range out {
+		if r == '�' {
+			t.Fatal("裁剪结果包含无效字符")
+		}
+	}
+}
@@ -2,7 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -46,6 +50,150 @@ type ServerConfig struct {
 	Port int    `yaml:"port" json:"port"`
 } 
 
+// LogConfig 日志配置
+type LogConfig struct {
+	Format        string `yaml:"format" json:"format"`                 // 输出格式: text（默认）、json
+	MaxSizeMB     int    `yaml:"max_size_mb" json:"max_size_mb"`       // 单个日志文件最大大小（MB），超出后轮转
+	RetentionDays int    `yaml:"retention_days" json:"retention_days"` // 日志文件保留天数
+}
+
+// TracingConfig 链路追踪配置（OpenTelemetry OTLP/HTTP 导出）
+// 未启用或未配置 endpoint 时使用 no-op 实现
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled" json:"enabled"`
+	Endpoint    string            `yaml:"endpoint" json:"endpoint"`         // OTLP 端点，如 localhost:4318 或 http://collector:4318/v1/traces
+	Insecure    bool              `yaml:"insecure" json:"insecure"`         // 端点不带协议时是否使用 HTTP
+	ServiceName string            `yaml:"service_name" json:"service_name"` // 服务名，默认 claude-api
+	SampleRatio float64           `yaml:"sample_ratio" json:"sample_ratio"` // 采样率 (0,1]，默认 1
+	Headers     map[string]string `yaml:"headers" json:"headers"`           // 导出请求附加头（如鉴权）
+}
+
+// RedisConfig Redis 协议服务配置（Redis / Valkey / KeyDB 等）
+type RedisConfig struct {
+	URL       string `yaml:"url" json:"url"`               // 连接地址：redis://[:password@]host:port/db，为空表示不使用
+	KeyPrefix string `yaml:"key_prefix" json:"key_prefix"` // 键前缀，默认 claude-api:
+}
+
+// SummaryCacheConfig 压缩摘要缓存配置
+type SummaryCacheConfig struct {
+	Store string `yaml:"store" json:"store"` // 存储后端：file（默认）、database、redis
+	Dir   string `yaml:"dir" json:"dir"`     // file 存储的缓存目录，默认 cache/summaries
+}
+
+// CoordinationConfig 多实例协调配置（共享限流计数、令牌刷新锁、在线 IP）
+type CoordinationConfig struct {
+	Backend string `yaml:"backend" json:"backend"` // memory（默认，单实例）、database（共用主数据库）、redis（需配置 redis.url）
+}
+
+// AdmissionConfig 推理请求准入队列配置
+// 并发已满或暂无空闲账号时请求按优先级（VIP > 普通 > 批处理）排队等待
+type AdmissionConfig struct {
+	MaxConcurrent  int `yaml:"max_concurrent" json:"max_concurrent"`     // 同时处理的最大请求数，0 表示不限制
+	MaxPerAccount  int `yaml:"max_per_account" json:"max_per_account"`   // 每个可用账号同时处理的请求数，0 表示不限制
+	MaxQueue       int `yaml:"max_queue" json:"max_queue"`               // 最大排队数，队列满时返回 529；-1 表示不排队
+	MaxWaitSeconds int `yaml:"max_wait_seconds" json:"max_wait_seconds"` // 单个请求最长等待秒数
+}
+
+// BudgetConfig 用户美元预算配置
+// 每日预算在预算时区的 0 点重置，月度预算在每月重置日的 0 点重置
+type BudgetConfig struct {
+	ResetDay         int    `yaml:"reset_day" json:"reset_day"`                   // 月度预算重置日（1-28），默认 1
+	Timezone         string `yaml:"timezone" json:"timezone"`                     // 预算周期时区（IANA 名称，如 Asia/Shanghai），为空时使用服务器本地时区
+	SoftLimitPercent int    `yaml:"soft_limit_percent" json:"soft_limit_percent"` // 软限制阈值（预算百分比），超过后发送预警通知并返回预警响应头，默认 80
+
+	// Location 加载配置时解析的预算时区，nil 表示服务器本地时区
+	Location *time.Location `yaml:"-" json:"-"`
+}
+
+// ReportsConfig 月度用量报表配置
+type ReportsConfig struct {
+	Dir      string `yaml:"dir" json:"dir"`           // 月度报表输出目录，为空表示不生成
+	Format   string `yaml:"format" json:"format"`     // 报表格式：csv（默认）、tsv、jsonl
+	Timezone string `yaml:"timezone" json:"timezone"` // 报表时区（IANA 名称），为空时使用服务器本地时区
+}
+
+// ProxySubscriptionConfig 代理订阅配置
+type ProxySubscriptionConfig struct {
+	FileDir string `yaml:"file_dir" json:"file_dir"` // 允许作为订阅源的本地文件目录，为空表示只允许 http/https 订阅
+}
+
+// UpstreamConfig 上游地址配置
+// 地址中的 {region} 会替换为账号区域；不含占位符时所有区域共用同一地址（如本地模拟上游）
+type UpstreamConfig struct {
+	AmazonQURL       string `yaml:"amazonq_url" json:"amazonq_url"`             // Amazon Q 对话与配额查询
+	OIDCURL          string `yaml:"oidc_url" json:"oidc_url"`                   // OIDC 客户端注册、设备授权、令牌
+	KiroAuthURL      string `yaml:"kiro_auth_url" json:"kiro_auth_url"`         // Kiro 社交登录令牌刷新
+	CodeWhispererURL string `yaml:"codewhisperer_url" json:"codewhisperer_url"` // 延迟检测
+}
+
+// upstreamEnvVars 上游地址环境变量（优先级高于配置文件）
+var upstreamEnvVars = map[string]func(*UpstreamConfig) *string{
+	"CLAUDE_API_AMAZONQ_URL":       func(u *UpstreamConfig) *string { return &u.AmazonQURL },
+	"CLAUDE_API_OIDC_URL":          func(u *UpstreamConfig) *string { return &u.OIDCURL },
+	"CLAUDE_API_KIRO_AUTH_URL":     func(u *UpstreamConfig) *string { return &u.KiroAuthURL },
+	"CLAUDE_API_CODEWHISPERER_URL": func(u *UpstreamConfig) *string { return &u.CodeWhispererURL },
+}
+
+// DefaultUpstream 返回 AWS 官方上游地址
+func DefaultUpstream() UpstreamConfig {
+	return UpstreamConfig{
+		AmazonQURL:       "https://q.{region}.amazonaws.com",
+		OIDCURL:          "https://oidc.{region}.amazonaws.com",
+		KiroAuthURL:      "https://prod.{region}.auth.desktop.kiro.dev",
+		CodeWhispererURL: "https://codewhisperer.{region}.amazonaws.com",
+	}
+}
+
+// validUpstreamURL 检查上游地址是否为 http(s) 地址
+func validUpstreamURL(raw string) error {
+	u, err := url.Parse(strings.ReplaceAll(raw, "{region}", "us-east-1"))
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("需要 http:// 或 https:// 地址")
+	}
+	return nil
+}
+
+// mergeUpstream 用 src 中的非空地址覆盖 dst，并校验格式
+func mergeUpstream(dst *UpstreamConfig, src UpstreamConfig) error {
+	for _, f := range []struct {
+		name     string
+		dst, src *string
+	}{
+		{"amazonq_url", &dst.AmazonQURL, &src.AmazonQURL},
+		{"oidc_url", &dst.OIDCURL, &src.OIDCURL},
+		{"kiro_auth_url", &dst.KiroAuthURL, &src.KiroAuthURL},
+		{"codewhisperer_url", &dst.CodeWhispererURL, &src.CodeWhispererURL},
+	} {
+		v := strings.TrimSpace(*f.src)
+		if v == "" {
+			continue
+		}
+		if err := validUpstreamURL(v); err != nil {
+			return fmt.Errorf("无效的上游地址 %s=%s: %w", f.name, v, err)
+		}
+		*f.dst = strings.TrimRight(v, "/")
+	}
+	return nil
+}
+
+// ApplyEnv 用环境变量覆盖上游地址（CLAUDE_API_AMAZONQ_URL 等），任一地址无效时不做修改
+// @author ygw
+func (c *Config) ApplyEnv() error {
+	var env UpstreamConfig
+	for name, field := range upstreamEnvVars {
+		*field(&env) = os.Getenv(name)
+	}
+	merged := c.Upstream
+	if err := mergeUpstream(&merged, env); err != nil {
+		return err
+	}
+	c.Upstream = merged
+	return nil
+}
+
 // Config 应用配置
 type Config struct {
 	// 数据库配置
@@ -54,6 +202,36 @@ type Config struct {
 	// 服务器配置
 	Server ServerConfig
 
+	// 日志配置
+	Log LogConfig
+
+	// 链路追踪配置
+	Tracing TracingConfig
+
+	// Redis 配置（多实例部署共享状态）
+	Redis RedisConfig
+
+	// 压缩摘要缓存配置
+	SummaryCache SummaryCacheConfig
+
+	// 多实例协调配置
+	Coordination CoordinationConfig
+
+	// 准入队列配置
+	Admission AdmissionConfig
+
+	// 用户美元预算配置
+	Budget BudgetConfig
+
+	// 月度用量报表配置
+	Reports ReportsConfig
+
+	// 代理订阅配置
+	ProxySubscription ProxySubscriptionConfig
+
+	// 上游地址配置
+	Upstream UpstreamConfig
+
 	// 运行时配置（从数据库加载或动态设置）
 	DatabaseURL                  string
 	OpenAIKeys                   []string
@@ -61,7 +239,7 @@ type Config struct {
 	MaxErrorCount                int
 	HTTPProxy                    string
 	ProxyPoolEnabled             bool   // 是否启用代理池
-	ProxyPoolStrategy            string // 代理选择策略: round_robin, random, weighted
+	ProxyPoolStrategy            string // 代理选择策略: round_robin, random, weighted, sticky
 	EnableConsole                bool
 	AdminPassword                string
 	Host                         string
@@ -100,6 +278,40 @@ func Load() *Config {
 			Host: "0.0.0.0",
 			Port: 62311,
 		},
+		Log: LogConfig{
+			Format:        "text",
+			MaxSizeMB:     100,
+			RetentionDays: 30,
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			ServiceName: "claude-api",
+			SampleRatio: 1.0,
+		},
+		Redis: RedisConfig{
+			KeyPrefix: "claude-api:",
+		},
+		SummaryCache: SummaryCacheConfig{
+			Store: "file",
+			Dir:   "cache/summaries",
+		},
+		Coordination: CoordinationConfig{
+			Backend: "memory",
+		},
+		Admission: AdmissionConfig{
+			MaxConcurrent:  0,
+			MaxPerAccount:  0,
+			MaxQueue:       100,
+			MaxWaitSeconds: 30,
+		},
+		Budget: BudgetConfig{
+			ResetDay:         1,
+			SoftLimitPercent: 80,
+		},
+		Reports: ReportsConfig{
+			Format: "csv",
+		},
+		Upstream:                     DefaultUpstream(),
 		DatabaseURL:                  "",
 		OpenAIKeys:                   []string{},
 		TokenCountMultiplier:         1.0,
@@ -130,10 +342,20 @@ func (c *Config) GetMaxAccounts() int {
 
 // YAMLFileConfig YAML 配置文件结构
 type YAMLFileConfig struct {
-	Database DatabaseConfig `yaml:"database"`
-	Server   ServerConfig   `yaml:"server"`
-	Debug    bool           `yaml:"debug"`
-	Test     bool           `yaml:"test"`
+	Database          DatabaseConfig          `yaml:"database"`
+	Server            ServerConfig            `yaml:"server"`
+	Log               LogConfig               `yaml:"log"`
+	Tracing           TracingConfig           `yaml:"tracing"`
+	Redis             RedisConfig             `yaml:"redis"`
+	SummaryCache      SummaryCacheConfig      `yaml:"summary_cache"`
+	Coordination      CoordinationConfig      `yaml:"coordination"`
+	Admission         AdmissionConfig         `yaml:"admission"`
+	Budget            BudgetConfig            `yaml:"budget"`
+	Reports           ReportsConfig           `yaml:"reports"`
+	ProxySubscription ProxySubscriptionConfig `yaml:"proxy_subscription"`
+	Upstream          UpstreamConfig          `yaml:"upstream"`
+	Debug             bool                    `yaml:"debug"`
+	Test              bool                    `yaml:"test"`
 }
 
 // FileConfig 配置文件结构（兼容旧 JSON 格式）
@@ -194,6 +416,84 @@ func LoadFromYAML(path string) (*Config, error) {
 		cfg.Server.Port = yamlConfig.Server.Port
 		cfg.Port = yamlConfig.Server.Port
 	}
+	if yamlConfig.Log.Format != "" {
+		cfg.Log.Format = yamlConfig.Log.Format
+	}
+	if yamlConfig.Log.MaxSizeMB > 0 {
+		cfg.Log.MaxSizeMB = yamlConfig.Log.MaxSizeMB
+	}
+	if yamlConfig.Log.RetentionDays > 0 {
+		cfg.Log.RetentionDays = yamlConfig.Log.RetentionDays
+	}
+	cfg.Tracing.Enabled = yamlConfig.Tracing.Enabled
+	if yamlConfig.Tracing.Endpoint != "" {
+		cfg.Tracing.Endpoint = yamlConfig.Tracing.Endpoint
+	}
+	cfg.Tracing.Insecure = yamlConfig.Tracing.Insecure
+	if yamlConfig.Tracing.ServiceName != "" {
+		cfg.Tracing.ServiceName = yamlConfig.Tracing.ServiceName
+	}
+	if yamlConfig.Tracing.SampleRatio > 0 {
+		cfg.Tracing.SampleRatio = yamlConfig.Tracing.SampleRatio
+	}
+	if len(yamlConfig.Tracing.Headers) > 0 {
+		cfg.Tracing.Headers = yamlConfig.Tracing.Headers
+	}
+	if yamlConfig.Redis.URL != "" {
+		cfg.Redis.URL = yamlConfig.Redis.URL
+	}
+	if yamlConfig.Redis.KeyPrefix != "" {
+		cfg.Redis.KeyPrefix = yamlConfig.Redis.KeyPrefix
+	}
+	if yamlConfig.SummaryCache.Store != "" {
+		cfg.SummaryCache.Store = yamlConfig.SummaryCache.Store
+	}
+	if yamlConfig.SummaryCache.Dir != "" {
+		cfg.SummaryCache.Dir = yamlConfig.SummaryCache.Dir
+	}
+	if yamlConfig.Coordination.Backend != "" {
+		cfg.Coordination.Backend = yamlConfig.Coordination.Backend
+	}
+	if yamlConfig.Admission.MaxConcurrent > 0 {
+		cfg.Admission.MaxConcurrent = yamlConfig.Admission.MaxConcurrent
+	}
+	if yamlConfig.Admission.MaxPerAccount != 0 {
+		cfg.Admission.MaxPerAccount = yamlConfig.Admission.MaxPerAccount
+	}
+	if yamlConfig.Admission.MaxQueue != 0 {
+		cfg.Admission.MaxQueue = yamlConfig.Admission.MaxQueue
+	}
+	if yamlConfig.Admission.MaxWaitSeconds > 0 {
+		cfg.Admission.MaxWaitSeconds = yamlConfig.Admission.MaxWaitSeconds
+	}
+	if yamlConfig.Budget.ResetDay >= 1 && yamlConfig.Budget.ResetDay <= 28 {
+		cfg.Budget.ResetDay = yamlConfig.Budget.ResetDay
+	}
+	if yamlConfig.Budget.Timezone != "" {
+		loc, err := time.LoadLocation(yamlConfig.Budget.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("无效的预算时区 %s: %w", yamlConfig.Budget.Timezone, err)
+		}
+		cfg.Budget.Timezone = yamlConfig.Budget.Timezone
+		cfg.Budget.Location = loc
+	}
+	if yamlConfig.Budget.SoftLimitPercent > 0 && yamlConfig.Budget.SoftLimitPercent <= 100 {
+		cfg.Budget.SoftLimitPercent = yamlConfig.Budget.SoftLimitPercent
+	}
+	cfg.Reports.Dir = yamlConfig.Reports.Dir
+	cfg.ProxySubscription.FileDir = yamlConfig.ProxySubscription.FileDir
+	if yamlConfig.Reports.Format != "" {
+		cfg.Reports.Format = yamlConfig.Reports.Format
+	}
+	if yamlConfig.Reports.Timezone != "" {
+		if _, err := time.LoadLocation(yamlConfig.Reports.Timezone); err != nil {
+			return nil, fmt.Errorf("无效的报表时区 %s: %w", yamlConfig.Reports.Timezone, err)
+		}
+		cfg.Reports.Timezone = yamlConfig.Reports.Timezone
+	}
+	if err := mergeUpstream(&cfg.Upstream, yamlConfig.Upstream); err != nil {
+		return nil, err
+	}
 	cfg.Debug = yamlConfig.Debug
 	cfg.Test = yamlConfig.Test
 
@@ -0,0 +1,80 @@
+// Package coord 多实例部署的协调后端：共享计数器、滑动窗口限流、分布式锁和在线成员追踪
+// 单实例部署不需要协调后端（默认内存模式），多个副本共用一个数据库或 Redis 时使用
+// @author ygw
+package coord
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// 协调后端类型
+const (
+	BackendMemory   = "memory"   // 单实例内存模式（默认，不创建后端）
+	BackendDatabase = "database" // 复用主数据库（SQLite / MySQL）
+	BackendRedis    = "redis"    // Redis 协议服务
+)
+
+// ErrLockTimeout 等待分布式锁超时
+var ErrLockTimeout = errors.New("等待分布式锁超时")
+
+// lockPollInterval 等待锁时的轮询间隔
+const lockPollInterval = 200 * time.Millisecond
+
+// Backend 协调后端
+// @author ygw
+type Backend interface {
+	// Name 后端类型
+	Name() string
+	// IncrBy 原子增加计数器并返回新值（ttl 为 0 表示不过期，否则每次写入刷新过期时间）
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get 读取计数器（不存在或已过期返回 0）
+	Get(ctx context.Context, key string) (int64, error)
+	// Del 删除计数器
+	Del(ctx context.Context, keys ...string) error
+	// TryLock 尝试获取锁（不等待），成功时返回释放函数
+	TryLock(ctx context.Context, name string, ttl time.Duration) (release func(), ok bool, err error)
+	// Touch 记录分组内成员的最近活跃时间
+	Touch(ctx context.Context, group, member string, at time.Time) error
+	// CountActive 统计 since 之后活跃的成员数（早于 since 的成员会被清理）
+	CountActive(ctx context.Context, group string, since time.Time) (int, error)
+	// Close 释放后台资源
+	Close() error
+}
+
+// Lock 获取锁，锁被占用时轮询等待
+// @param wait 最长等待时间
+// @return release 释放函数
+// @return waited 是否等待过（锁曾被其他实例持有）
+// @author ygw
+func Lock(ctx context.Context, b Backend, name string, ttl, wait time.Duration) (release func(), waited bool, err error) {
+	deadline := time.Now().Add(wait)
+	for {
+		release, ok, err := b.TryLock(ctx, name, ttl)
+		if err != nil {
+			return nil, waited, err
+		}
+		if ok {
+			return release, waited, nil
+		}
+		waited = true
+		if time.Now().After(deadline) {
+			return nil, waited, ErrLockTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return nil, waited, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// newLockToken 生成锁持有者标识（释放时校验，避免误删其他实例的锁）
+func newLockToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,193 @@
+package coord
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"claude-api/internal/models"
+	"claude-api/internal/redis/redistest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// testBackends 返回数据库和 Redis 两种后端（每个测试使用独立的存储）
+func testBackends(t *testing.T) map[string]Backend {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "coord.db")), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CoordCounter{}, &models.CoordLock{}, &models.CoordPresence{}); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	dbBackend := NewDBBackend(db)
+	t.Cleanup(func() { dbBackend.Close() })
+
+	srv := redistest.NewServer(t, "")
+	return map[string]Backend{
+		BackendDatabase: dbBackend,
+		BackendRedis:    NewRedisBackend(srv.Client(t), "test:"),
+	}
+}
+
+// TestWindow_SharedAcrossInstances 测试两个实例共用一个窗口时总量不超过限制
+func TestWindow_SharedAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			a := NewWindow(b, "rl:", time.Hour)
+			c := NewWindow(b, "rl:", time.Hour)
+
+			var allowed int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(w *Window) {
+					defer wg.Done()
+					if ok, _, err := w.Allow(ctx, "1.2.3.4", 1, 10); err == nil && ok {
+						atomic.AddInt32(&allowed, 1)
+					}
+				}([]*Window{a, c}[i%2])
+			}
+			wg.Wait()
+			if allowed != 10 {
+				t.Errorf("两个实例合计应允许 10 次，实际 %d", allowed)
+			}
+			if n, _ := a.Count(ctx, "1.2.3.4"); n != 10 {
+				t.Errorf("窗口计数应为 10，实际 %d", n)
+			}
+
+			// 按数量计入（token 限流）
+			if ok, n, _ := a.Allow(ctx, "user", 600, 1000); !ok || n != 600 {
+				t.Errorf("应允许 600: %v %d", ok, n)
+			}
+			if ok, n, _ := c.Allow(ctx, "user", 600, 1000); ok || n != 600 {
+				t.Errorf("超出限制应拒绝且不计入: %v %d", ok, n)
+			}
+			a.Add(ctx, "user", -200)
+			if ok, _, _ := c.Allow(ctx, "user", 600, 1000); !ok {
+				t.Error("修正用量后应允许")
+			}
+
+			a.Reset(ctx, "1.2.3.4")
+			if n, _ := c.Count(ctx, "1.2.3.4"); n != 0 {
+				t.Errorf("重置后计数应为 0，实际 %d", n)
+			}
+		})
+	}
+}
+
+// TestWindow_Slides 测试上一窗口的计数按比例滑出
+func TestWindow_Slides(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			base := time.Unix(1700000000, 0).Truncate(time.Minute)
+			w := NewWindow(b, "slide:", time.Minute)
+			w.now = func() time.Time { return base.Add(50 * time.Second) }
+			for i := 0; i < 10; i++ {
+				w.Allow(ctx, "k", 1, 10)
+			}
+			// 下一个窗口过去一半：上一窗口的 10 次按 50% 计入
+			w.now = func() time.Time { return base.Add(90 * time.Second) }
+			if n, _ := w.Count(ctx, "k"); n != 5 {
+				t.Errorf("滑动后计数应为 5，实际 %d", n)
+			}
+			if ok, _, _ := w.Allow(ctx, "k", 5, 10); !ok {
+				t.Error("滑出部分应可再次使用")
+			}
+			if ok, _, _ := w.Allow(ctx, "k", 1, 10); ok {
+				t.Error("超过限制应拒绝")
+			}
+		})
+	}
+}
+
+// TestLock 测试分布式锁互斥、释放和等待
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			release, ok, err := b.TryLock(ctx, "refresh:acc-1", time.Minute)
+			if err != nil || !ok {
+				t.Fatalf("应获取到锁: %v", err)
+			}
+			if _, ok, _ := b.TryLock(ctx, "refresh:acc-1", time.Minute); ok {
+				t.Fatal("锁被持有时不应再次获取")
+			}
+			if _, ok, _ := b.TryLock(ctx, "refresh:acc-2", time.Minute); !ok {
+				t.Error("不同名称的锁互不影响")
+			}
+
+			go func() {
+				time.Sleep(300 * time.Millisecond)
+				release()
+			}()
+			release2, waited, err := Lock(ctx, b, "refresh:acc-1", time.Minute, 5*time.Second)
+			if err != nil || !waited {
+				t.Fatalf("应等待后获取到锁: %v %v", waited, err)
+			}
+			release2()
+
+			// 过期的锁可被抢占
+			if _, ok, _ := b.TryLock(ctx, "short", 50*time.Millisecond); !ok {
+				t.Fatal("应获取到锁")
+			}
+			time.Sleep(100 * time.Millisecond)
+			if _, ok, _ := b.TryLock(ctx, "short", time.Minute); !ok {
+				t.Error("过期的锁应可被抢占")
+			}
+
+			if _, _, err := Lock(ctx, b, "short", time.Minute, 300*time.Millisecond); err != ErrLockTimeout {
+				t.Errorf("等待超时应返回 ErrLockTimeout，实际 %v", err)
+			}
+		})
+	}
+}
+
+// TestPresence 测试在线成员统计
+func TestPresence(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			b.Touch(ctx, "online", "1.1.1.1", now)
+			b.Touch(ctx, "online", "2.2.2.2", now.Add(-10*time.Minute))
+			b.Touch(ctx, "online", "1.1.1.1", now) // 重复记录不重复计数
+			b.Touch(ctx, "other", "3.3.3.3", now)
+
+			if n, err := b.CountActive(ctx, "online", now.Add(-5*time.Minute)); err != nil || n != 1 {
+				t.Errorf("应有 1 个在线成员，实际 %d %v", n, err)
+			}
+			b.Touch(ctx, "online", "2.2.2.2", now)
+			if n, _ := b.CountActive(ctx, "online", now.Add(-5*time.Minute)); n != 2 {
+				t.Errorf("重新活跃后应有 2 个在线成员，实际 %d", n)
+			}
+		})
+	}
+}
+
+// TestIncrBy_TTL 测试计数器过期后重新计数
+func TestIncrBy_TTL(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			b.IncrBy(ctx, "rr", 5, 100*time.Millisecond)
+			if n, _ := b.Get(ctx, "rr"); n != 5 {
+				t.Fatalf("计数应为 5，实际 %d", n)
+			}
+			time.Sleep(150 * time.Millisecond)
+			if n, _ := b.Get(ctx, "rr"); n != 0 {
+				t.Errorf("过期后读取应为 0，实际 %d", n)
+			}
+			if n, _ := b.IncrBy(ctx, "rr", 1, 0); n != 1 {
+				t.Errorf("过期后应重新计数，实际 %d", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package coord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dbCleanupInterval 数据库后端清理过期计数器和锁的间隔
+const dbCleanupInterval = 10 * time.Minute
+
+// DBBackend 基于主数据库的协调后端（coord_* 表由数据库迁移创建）
+// @author ygw
+type DBBackend struct {
+	db        *gorm.DB
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDBBackend 创建数据库协调后端，并启动过期数据清理
+// @param db GORM 实例
+func NewDBBackend(db *gorm.DB) *DBBackend {
+	b := &DBBackend{db: db, done: make(chan struct{})}
+	go b.cleanupLoop()
+	return b
+}
+
+// Name 后端类型
+func (b *DBBackend) Name() string {
+	return BackendDatabase
+}
+
+// IncrBy 原子增加计数器（已过期的计数器从 delta 重新开始）
+func (b *DBBackend) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	now := time.Now().UnixMilli()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now + ttl.Milliseconds()
+	}
+
+	var value int64
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// MySQL 按顺序执行赋值，value 必须在 expires_at 之前更新
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "counter_key"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "value"}, Value: gorm.Expr("CASE WHEN expires_at > 0 AND expires_at < ? THEN ? ELSE value + ? END", now, delta, delta)},
+				{Column: clause.Column{Name: "expires_at"}, Value: expiresAt},
+			},
+		}).Create(&models.CoordCounter{Key: key, Value: delta, ExpiresAt: expiresAt}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.CoordCounter{}).Where("counter_key = ?", key).Pluck("value", &value).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("更新共享计数器失败: %w", err)
+	}
+	return value, nil
+}
+
+// Get 读取计数器
+func (b *DBBackend) Get(ctx context.Context, key string) (int64, error) {
+	var values []int64
+	err := b.db.WithContext(ctx).Model(&models.CoordCounter{}).
+		Where("counter_key = ? AND (expires_at = 0 OR expires_at >= ?)", key, time.Now().UnixMilli()).
+		Pluck("value", &values).Error
+	if err != nil {
+		return 0, fmt.Errorf("读取共享计数器失败: %w", err)
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	return values[0], nil
+}
+
+// Del 删除计数器
+func (b *DBBackend) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := b.db.WithContext(ctx).Where("counter_key IN ?", keys).Delete(&models.CoordCounter{}).Error; err != nil {
+		return fmt.Errorf("删除共享计数器失败: %w", err)
+	}
+	return nil
+}
+
+// TryLock 插入锁记录获取锁，已存在但过期的锁可被抢占
+func (b *DBBackend) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	token := newLockToken()
+	now := time.Now().UnixMilli()
+	lock := &models.CoordLock{Name: name, Owner: token, ExpiresAt: now + ttl.Milliseconds()}
+
+	result := b.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(lock)
+	if result.Error != nil {
+		return nil, false, fmt.Errorf("获取分布式锁失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// 锁已存在：仅当已过期时抢占
+		result = b.db.WithContext(ctx).Model(&models.CoordLock{}).
+			Where("lock_name = ? AND expires_at < ?", name, now).
+			Updates(map[string]interface{}{"owner": token, "expires_at": lock.ExpiresAt})
+		if result.Error != nil {
+			return nil, false, fmt.Errorf("获取分布式锁失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil, false, nil
+		}
+	}
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := b.db.WithContext(ctx).Where("lock_name = ? AND owner = ?", name, token).Delete(&models.CoordLock{}).Error; err != nil {
+			logger.Warn("释放分布式锁失败: %s - %v", name, err)
+		}
+	}
+	return release, true, nil
+}
+
+// Touch 记录成员活跃时间
+func (b *DBBackend) Touch(ctx context.Context, group, member string, at time.Time) error {
+	err := b.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_name"}, {Name: "member"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen"}),
+	}).Create(&models.CoordPresence{Group: group, Member: member, LastSeen: at.UnixMilli()}).Error
+	if err != nil {
+		return fmt.Errorf("记录在线成员失败: %w", err)
+	}
+	return nil
+}
+
+// CountActive 统计活跃成员并清理过期成员
+func (b *DBBackend) CountActive(ctx context.Context, group string, since time.Time) (int, error) {
+	cutoff := since.UnixMilli()
+	db := b.db.WithContext(ctx)
+	if err := db.Where("group_name = ? AND last_seen < ?", group, cutoff).Delete(&models.CoordPresence{}).Error; err != nil {
+		return 0, fmt.Errorf("清理在线成员失败: %w", err)
+	}
+	var count int64
+	if err := db.Model(&models.CoordPresence{}).Where("group_name = ? AND last_seen >= ?", group, cutoff).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("统计在线成员失败: %w", err)
+	}
+	return int(count), nil
+}
+
+// Close 停止后台清理
+func (b *DBBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	return nil
+}
+
+// cleanupLoop 定期删除过期的计数器和锁
+func (b *DBBackend) cleanupLoop() {
+	ticker := time.NewTicker(dbCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.cleanup(context.Background()); err != nil {
+				logger.Warn("清理协调数据失败: %v", err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// cleanup 删除过期的计数器和锁
+func (b *DBBackend) cleanup(ctx context.Context) error {
+	now := time.Now().UnixMilli()
+	err := b.db.WithContext(ctx).Where("expires_at > 0 AND expires_at < ?", now).Delete(&models.CoordCounter{}).Error
+	if err == nil {
+		err = b.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.CoordLock{}).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package coord
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"claude-api/internal/redis"
+)
+
+// RedisBackend 基于 Redis 协议服务的协调后端
+// @author ygw
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend 创建 Redis 协调后端
+// @param client Redis 客户端
+// @param keyPrefix 键前缀
+func NewRedisBackend(client *redis.Client, keyPrefix string) *RedisBackend {
+	return &RedisBackend{client: client, prefix: keyPrefix + "coord:"}
+}
+
+// Name 后端类型
+func (b *RedisBackend) Name() string {
+	return BackendRedis
+}
+
+// IncrBy 原子增加计数器
+func (b *RedisBackend) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	key = b.prefix + "n:" + key
+	n, err := b.client.IncrBy(ctx, key, delta)
+	if err != nil {
+		return 0, err
+	}
+	if ttl > 0 {
+		if err := b.client.PExpire(ctx, key, ttl); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Get 读取计数器
+func (b *RedisBackend) Get(ctx context.Context, key string) (int64, error) {
+	v, err := b.client.Get(ctx, b.prefix+"n:"+key)
+	if errors.Is(err, redis.ErrNil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// Del 删除计数器
+func (b *RedisBackend) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = b.prefix + "n:" + k
+	}
+	_, err := b.client.Del(ctx, full...)
+	return err
+}
+
+// TryLock 使用 SET NX PX 获取锁
+// 释放时先校验持有者再删除（两步操作，锁在两步之间恰好过期并被他人获取的极端情况可忽略）
+func (b *RedisBackend) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	key := b.prefix + "lock:" + name
+	token := newLockToken()
+	ok, err := b.client.SetNX(ctx, key, token, ttl)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if v, err := b.client.Get(ctx, key); err == nil && v == token {
+			b.client.Del(ctx, key)
+		}
+	}
+	return release, true, nil
+}
+
+// Touch 记录成员活跃时间（哈希字段值为 Unix 毫秒）
+func (b *RedisBackend) Touch(ctx context.Context, group, member string, at time.Time) error {
+	return b.client.HSet(ctx, b.prefix+"presence:"+group, member, strconv.FormatInt(at.UnixMilli(), 10))
+}
+
+// CountActive 统计活跃成员并清理过期成员
+func (b *RedisBackend) CountActive(ctx context.Context, group string, since time.Time) (int, error) {
+	key := b.prefix + "presence:" + group
+	members, err := b.client.HGetAll(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := since.UnixMilli()
+	count := 0
+	var expired []string
+	for member, v := range members {
+		ms, _ := strconv.ParseInt(v, 10, 64)
+		if ms >= cutoff {
+			count++
+		} else {
+			expired = append(expired, member)
+		}
+	}
+	if len(expired) > 0 {
+		b.client.HDel(ctx, key, expired...)
+	}
+	return count, nil
+}
+
+// Close Redis 客户端由调用方管理，这里不关闭
+func (b *RedisBackend) Close() error {
+	return nil
+}
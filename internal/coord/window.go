@@ -0,0 +1,110 @@
+package coord
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Window 基于共享计数器的滑动窗口（滑动窗口计数法）
+// 每个窗口周期一个计数桶，当前计数 = 上一桶 × 未滑出比例 + 当前桶
+// 只依赖原子自增，不需要服务端脚本，各后端行为一致
+// @author ygw
+type Window struct {
+	backend Backend
+	prefix  string
+	size    time.Duration
+	now     func() time.Time
+}
+
+// NewWindow 创建滑动窗口
+// @param backend 协调后端
+// @param prefix 键前缀（区分不同的限流维度）
+// @param size 窗口大小
+func NewWindow(backend Backend, prefix string, size time.Duration) *Window {
+	if size <= 0 {
+		size = time.Minute
+	}
+	return &Window{backend: backend, prefix: prefix, size: size, now: time.Now}
+}
+
+// Size 返回窗口大小
+func (w *Window) Size() time.Duration {
+	return w.size
+}
+
+// bucketKey 计数桶的键
+func (w *Window) bucketKey(key string, bucket int64) string {
+	return w.prefix + key + ":" + strconv.FormatInt(bucket, 10)
+}
+
+// position 当前桶序号和上一桶的权重
+func (w *Window) position() (int64, float64) {
+	now := w.now().UnixNano()
+	size := int64(w.size)
+	bucket := now / size
+	elapsed := float64(now%size) / float64(size)
+	return bucket, 1 - elapsed
+}
+
+// estimate 根据两个桶估算窗口内计数
+func estimate(prev, cur int64, weight float64) int {
+	return int(float64(prev)*weight) + int(cur)
+}
+
+// Allow 在窗口内计入 n 个单位，超出 limit 时回滚并拒绝
+// @param n 本次计入的数量（请求数为 1，token 限流为 token 数）
+// @param limit 窗口内允许的总量（<=0 表示不限制）
+// @return allowed 是否允许
+// @return count 计入后的窗口内总量（拒绝时为当前总量）
+// @author ygw
+func (w *Window) Allow(ctx context.Context, key string, n, limit int) (bool, int, error) {
+	if limit <= 0 {
+		return true, 0, nil
+	}
+	bucket, weight := w.position()
+	cur, err := w.backend.IncrBy(ctx, w.bucketKey(key, bucket), int64(n), 2*w.size)
+	if err != nil {
+		return false, 0, err
+	}
+	prev, err := w.backend.Get(ctx, w.bucketKey(key, bucket-1))
+	if err != nil {
+		return false, 0, err
+	}
+	count := estimate(prev, cur, weight)
+	if count > limit {
+		w.backend.IncrBy(ctx, w.bucketKey(key, bucket), -int64(n), 2*w.size)
+		return false, count - n, nil
+	}
+	return true, count, nil
+}
+
+// Add 直接调整窗口内计数（不做限制检查，用于按实际用量修正预占量）
+func (w *Window) Add(ctx context.Context, key string, n int) error {
+	if n == 0 {
+		return nil
+	}
+	bucket, _ := w.position()
+	_, err := w.backend.IncrBy(ctx, w.bucketKey(key, bucket), int64(n), 2*w.size)
+	return err
+}
+
+// Count 返回窗口内当前总量
+func (w *Window) Count(ctx context.Context, key string) (int, error) {
+	bucket, weight := w.position()
+	cur, err := w.backend.Get(ctx, w.bucketKey(key, bucket))
+	if err != nil {
+		return 0, err
+	}
+	prev, err := w.backend.Get(ctx, w.bucketKey(key, bucket-1))
+	if err != nil {
+		return 0, err
+	}
+	return estimate(prev, cur, weight), nil
+}
+
+// Reset 清空窗口计数
+func (w *Window) Reset(ctx context.Context, key string) error {
+	bucket, _ := w.position()
+	return w.backend.Del(ctx, w.bucketKey(key, bucket), w.bucketKey(key, bucket-1))
+}
@@ -214,6 +214,16 @@ func (db *DB) UpdateAccount(ctx context.Context, id string, updates *models.Acco
 	if updates.Region != nil {
 		updateMap["region"] = updates.Region
 	}
+	if updates.StartURL != nil {
+		updateMap["start_url"] = updates.StartURL
+	}
+	if updates.ProxyID != nil {
+		if *updates.ProxyID > 0 {
+			updateMap["proxy_id"] = *updates.ProxyID
+		} else {
+			updateMap["proxy_id"] = nil
+		}
+	}
 	if updates.QUserID != nil {
 		updateMap["q_user_id"] = updates.QUserID
 	}
@@ -385,6 +395,13 @@ func (db *DB) ResetAllAccountStats(ctx context.Context) error {
 
 // UpdateTokens 更新访问令牌和刷新令牌
 func (db *DB) UpdateTokens(ctx context.Context, id string, accessToken, refreshToken, status string) error {
+	return db.UpdateTokensWithExpiry(ctx, id, accessToken, refreshToken, status, 0)
+}
+
+// UpdateTokensWithExpiry 更新访问令牌和刷新令牌，并记录访问令牌过期时间
+// @param expiresAt 访问令牌过期时间（Unix时间戳），0 表示未知（清空）
+// @author ygw
+func (db *DB) UpdateTokensWithExpiry(ctx context.Context, id string, accessToken, refreshToken, status string, expiresAt int64) error {
 	logger.Debug("数据库: 更新账号令牌 - ID: %s, 状态: %s", id, status)
 
 	now := models.CurrentTime()
@@ -395,6 +412,11 @@ func (db *DB) UpdateTokens(ctx context.Context, id string, accessToken, refreshT
 		"last_refresh_status": status,
 		"updated_at":          now,
 	}
+	if expiresAt > 0 {
+		updateMap["token_expiry"] = expiresAt
+	} else {
+		updateMap["token_expiry"] = nil
+	}
 
 	// 如果刷新成功，将账号状态恢复为 normal（修复：之前 expired 的账号刷新后无法使用）
 	if status == "success" && accessToken != "" {
@@ -450,6 +472,25 @@ func (db *DB) GetAccountByQUserID(ctx context.Context, qUserID string) (*models.
 	return &acc, nil
 }
 
+// GetAccountByCredential 根据凭证查找账号（refreshToken 相同，或 clientId 非空且相同）
+// 用于无法获取 Q 用户 ID 时的查重
+// @author ygw
+func (db *DB) GetAccountByCredential(ctx context.Context, refreshToken, clientID string) (*models.Account, error) {
+	query := db.gorm.WithContext(ctx).Where("refreshToken = ?", refreshToken)
+	if clientID != "" {
+		query = query.Or("clientId = ?", clientID)
+	}
+	var acc models.Account
+	err := query.First(&acc).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
 // FindDuplicateAccounts 查找重复的账号（相同 q_user_id）
 // @author ygw
 func (db *DB) FindDuplicateAccounts(ctx context.Context) (map[string][]string, error) {
@@ -814,7 +855,20 @@ func (db *DB) UpdateAccountStatus(ctx context.Context, id string, status string,
 	// 同步更新 enabled 字段（保持兼容性）
 	updateMap["enabled"] = (status == models.AccountStatusNormal)
 
-	return db.gorm.WithContext(ctx).Model(&models.Account{}).Where("id = ?", id).Updates(updateMap).Error
+	// 有监听器时先读取原状态，用于判断是否发生变化
+	var oldStatus string
+	if db.statusListener != nil {
+		db.gorm.WithContext(ctx).Model(&models.Account{}).Where("id = ?", id).Select("status").Scan(&oldStatus)
+	}
+
+	if err := db.gorm.WithContext(ctx).Model(&models.Account{}).Where("id = ?", id).Updates(updateMap).Error; err != nil {
+		return err
+	}
+
+	if db.statusListener != nil && oldStatus != status {
+		db.statusListener(id, oldStatus, status, reason)
+	}
+	return nil
 }
 
 // ListAccountsByStatus 按状态列出账号
@@ -893,8 +947,8 @@ func (db *DB) GetExhaustedAccountsCount(ctx context.Context) (int64, error) {
 // UpdateAccountQuota 更新账号配额信息
 // 使用重试机制处理 SQLite 高并发写入时的锁竞争
 // @author ygw
-func (db *DB) UpdateAccountQuota(ctx context.Context, id string, usageCurrent, usageLimit float64, subscriptionType string, tokenExpiry *int64) error {
-	logger.Debug("数据库: 更新账号配额 - ID: %s, 使用量: %.2f/%.2f, 订阅类型: %s, 有效时间: %v", id, usageCurrent, usageLimit, subscriptionType, tokenExpiry)
+func (db *DB) UpdateAccountQuota(ctx context.Context, id string, usageCurrent, usageLimit float64, subscriptionType string, trialExpiry *int64) error {
+	logger.Debug("数据库: 更新账号配额 - ID: %s, 使用量: %.2f/%.2f, 订阅类型: %s, 试用到期时间: %v", id, usageCurrent, usageLimit, subscriptionType, trialExpiry)
 
 	updateMap := map[string]interface{}{
 		"usage_current":      usageCurrent,
@@ -907,8 +961,8 @@ func (db *DB) UpdateAccountQuota(ctx context.Context, id string, usageCurrent, u
 		updateMap["subscription_type"] = subscriptionType
 	}
 
-	if tokenExpiry != nil {
-		updateMap["token_expiry"] = *tokenExpiry
+	if trialExpiry != nil {
+		updateMap["trial_expiry"] = *trialExpiry
 	}
 
 	// 使用重试机制处理 SQLite 锁竞争
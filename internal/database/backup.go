@@ -62,6 +62,9 @@ func (db *DB) BackupData(ctx context.Context) (map[string]interface{}, error) {
 		if acc.Region != nil {
 			accMap["region"] = *acc.Region
 		}
+		if acc.StartURL != nil {
+			accMap["start_url"] = *acc.StartURL
+		}
 		if acc.MachineID != nil {
 			accMap["machine_id"] = *acc.MachineID
 		}
@@ -189,6 +192,7 @@ func (db *DB) RestoreData(ctx context.Context, data map[string]interface{}) erro
 				Email:             getStringPtr(accMap, "email"),
 				AuthMethod:        getStringPtrFallback(accMap, "auth_method", "authMethod"),
 				Region:            getStringPtr(accMap, "region"),
+				StartURL:          getStringPtrFallback(accMap, "start_url", "startUrl"),
 				MachineID:         getStringPtrFallback(accMap, "machine_id", "machineId"),
 			}
 
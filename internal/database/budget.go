@@ -0,0 +1,116 @@
+package database
+
+import (
+	"claude-api/internal/models"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BudgetPeriod 用户美元预算的周期划分
+// 每日周期从预算时区的 0 点开始，月度周期从每月重置日的 0 点开始
+type BudgetPeriod struct {
+	Location *time.Location
+	ResetDay int // 月度重置日（1-28）
+}
+
+// BudgetPeriod 返回配置的预算周期（时区在加载配置时解析，未配置时使用服务器本地时区）
+// @author ygw
+func (db *DB) BudgetPeriod() BudgetPeriod {
+	p := BudgetPeriod{Location: time.Local, ResetDay: 1}
+	if db.cfg == nil {
+		return p
+	}
+	if db.cfg.Budget.Location != nil {
+		p.Location = db.cfg.Budget.Location
+	}
+	if db.cfg.Budget.ResetDay >= 1 && db.cfg.Budget.ResetDay <= 28 {
+		p.ResetDay = db.cfg.Budget.ResetDay
+	}
+	return p
+}
+
+// DailyStart 当前每日周期的起始时间
+func (p BudgetPeriod) DailyStart(now time.Time) time.Time {
+	t := now.In(p.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, p.Location)
+}
+
+// MonthlyStart 当前月度周期的起始时间（本月或上月的重置日）
+func (p BudgetPeriod) MonthlyStart(now time.Time) time.Time {
+	t := now.In(p.Location)
+	start := time.Date(t.Year(), t.Month(), p.ResetDay, 0, 0, 0, 0, p.Location)
+	if t.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// NextDailyReset 下一次每日预算重置时间
+func (p BudgetPeriod) NextDailyReset(now time.Time) time.Time {
+	return p.DailyStart(now).AddDate(0, 0, 1)
+}
+
+// NextMonthlyReset 下一次月度预算重置时间
+func (p BudgetPeriod) NextMonthlyReset(now time.Time) time.Time {
+	return p.MonthlyStart(now).AddDate(0, 1, 0)
+}
+
+// addUserSpend 将一次请求的成本累加到当前每日和月度预算周期
+func (db *DB) addUserSpend(tx *gorm.DB, userID string, cost float64, now time.Time) error {
+	if cost <= 0 {
+		return nil
+	}
+	p := db.BudgetPeriod()
+	for _, row := range []*models.UserSpend{
+		{UserID: userID, Period: models.SpendPeriodDaily, PeriodStart: p.DailyStart(now).Format("2006-01-02"), CostUSD: cost},
+		{UserID: userID, Period: models.SpendPeriodMonthly, PeriodStart: p.MonthlyStart(now).Format("2006-01-02"), CostUSD: cost},
+	} {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "period"}, {Name: "period_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"cost_usd": gorm.Expr("cost_usd + ?", cost)}),
+		}).Create(row).Error
+		if err != nil {
+			return fmt.Errorf("更新用户消费失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// fillUserSpend 查询用户当前每日和月度预算周期的消费
+func (db *DB) fillUserSpend(ctx context.Context, userID string, usage *models.UserQuotaUsage, now time.Time) error {
+	p := db.BudgetPeriod()
+	var rows []models.UserSpend
+	err := db.gorm.WithContext(ctx).
+		Where("user_id = ? AND ((period = ? AND period_start = ?) OR (period = ? AND period_start = ?))", userID,
+			models.SpendPeriodDaily, p.DailyStart(now).Format("2006-01-02"),
+			models.SpendPeriodMonthly, p.MonthlyStart(now).Format("2006-01-02")).
+		Find(&rows).Error
+	if err != nil {
+		return fmt.Errorf("查询用户消费失败: %w", err)
+	}
+	for _, r := range rows {
+		if r.Period == models.SpendPeriodDaily {
+			usage.DailyCostUSD = r.CostUSD
+		} else {
+			usage.MonthlyCostUSD = r.CostUSD
+		}
+	}
+	return nil
+}
+
+// MarkBudgetWarned 标记用户本预算周期已发送预警，返回是否为本周期首次标记
+// 条件更新保证多实例部署时每个周期只有一个实例发送预警
+// @author ygw
+func (db *DB) MarkBudgetWarned(ctx context.Context, userID, period string, periodStart time.Time) (bool, error) {
+	result := db.gorm.WithContext(ctx).Model(&models.UserSpend{}).
+		Where("user_id = ? AND period = ? AND period_start = ? AND warned_at IS NULL", userID, period, periodStart.Format("2006-01-02")).
+		Update("warned_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("标记预算预警失败: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"claude-api/internal/models"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SavePayloadCapture 保存载荷采集记录
+// @author ygw
+func (db *DB) SavePayloadCapture(ctx context.Context, capture *models.PayloadCapture) error {
+	if err := db.gorm.WithContext(ctx).Create(capture).Error; err != nil {
+		return fmt.Errorf("保存载荷采集失败: %w", err)
+	}
+	return nil
+}
+
+// GetPayloadCapture 根据请求日志 ID 获取载荷采集记录
+// @author ygw
+func (db *DB) GetPayloadCapture(ctx context.Context, logID string) (*models.PayloadCapture, error) {
+	var capture models.PayloadCapture
+	err := db.gorm.WithContext(ctx).Where("log_id = ?", logID).First(&capture).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询载荷采集失败: %w", err)
+	}
+	return &capture, nil
+}
+
+// GetCapturedLogIDs 返回给定日志 ID 中存在载荷采集的集合
+// @author ygw
+func (db *DB) GetCapturedLogIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var found []string
+	if err := db.gorm.WithContext(ctx).Model(&models.PayloadCapture{}).Where("log_id IN ?", ids).Pluck("log_id", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		result[id] = true
+	}
+	return result, nil
+}
+
+// CleanupOldCaptures 清理过期的载荷采集记录
+func (db *DB) CleanupOldCaptures(ctx context.Context, daysToKeep int) (int64, error) {
+	cutoffTime := time.Now().AddDate(0, 0, -daysToKeep).Format(models.TimeFormat)
+
+	result := db.gorm.WithContext(ctx).Where("created_at < ?", cutoffTime).Delete(&models.PayloadCapture{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -19,6 +19,21 @@ import (
 type DB struct {
 	gorm *gorm.DB
 	cfg  *config.Config
+
+	statusListener AccountStatusListener // 账号状态变更回调（可选）
+}
+
+// AccountStatusListener 账号状态变更回调
+// @param id 账号ID
+// @param from 原状态
+// @param to 新状态
+// @param reason 变更原因
+type AccountStatusListener func(id, from, to, reason string)
+
+// SetAccountStatusListener 设置账号状态变更回调（状态实际发生变化时触发）
+// @author ygw
+func (db *DB) SetAccountStatusListener(fn AccountStatusListener) {
+	db.statusListener = fn
 }
 
 // New 创建新的数据库实例（支持 SQLite 和 MySQL）
@@ -36,7 +51,7 @@ func New(cfg *config.Config) (*DB, error) {
 			cfg.Database.MySQL.Database,
 			cfg.Database.MySQL.Charset,
 		)
-		fmt.Printf("[DB] 使用 MySQL 数据库: %s@%s:%d/%s\n",
+		logger.Info("数据库: 使用 MySQL 数据库: %s@%s:%d/%s",
 			cfg.Database.MySQL.User,
 			cfg.Database.MySQL.Host,
 			cfg.Database.MySQL.Port,
@@ -52,7 +67,7 @@ func New(cfg *config.Config) (*DB, error) {
 		}
 		// 添加 SQLite 优化参数
 		dsn := fmt.Sprintf("%s?_busy_timeout=30000&_txlock=immediate", dbPath)
-		fmt.Printf("[DB] 使用 SQLite 数据库: %s\n", dbPath)
+		logger.Info("数据库: 使用 SQLite 数据库: %s", dbPath)
 		dialector = sqlite.Open(dsn)
 	}
 
@@ -88,27 +103,27 @@ func New(cfg *config.Config) (*DB, error) {
 		// SQLite 性能优化
 		// 1. 启用 WAL 模式（允许读写并发）
 		if err := gormDB.Exec("PRAGMA journal_mode=WAL").Error; err != nil {
-			fmt.Printf("[DB] 警告: 启用 WAL 模式失败: %v\n", err)
+			logger.Warn("数据库: 启用 WAL 模式失败: %v", err)
 		} else {
-			fmt.Println("[DB] 已启用 WAL 模式")
+			logger.Info("数据库: 已启用 WAL 模式")
 		}
 
 		// 2. 设置同步模式为 NORMAL（平衡性能和安全性）
 		if err := gormDB.Exec("PRAGMA synchronous=NORMAL").Error; err != nil {
-			fmt.Printf("[DB] 警告: 设置同步模式失败: %v\n", err)
+			logger.Warn("数据库: 设置同步模式失败: %v", err)
 		}
 
 		// 3. 增加缓存大小到 64MB
 		if err := gormDB.Exec("PRAGMA cache_size=-64000").Error; err != nil {
-			fmt.Printf("[DB] 警告: 设置缓存大小失败: %v\n", err)
+			logger.Warn("数据库: 设置缓存大小失败: %v", err)
 		}
 
 		// 4. 临时表使用内存
 		if err := gormDB.Exec("PRAGMA temp_store=MEMORY").Error; err != nil {
-			fmt.Printf("[DB] 警告: 设置临时存储失败: %v\n", err)
+			logger.Warn("数据库: 设置临时存储失败: %v", err)
 		}
 
-		fmt.Println("[DB] SQLite 性能优化已应用")
+		logger.Info("数据库: SQLite 性能优化已应用")
 	}
 
 	db := &DB{gorm: gormDB, cfg: cfg}
@@ -146,6 +161,11 @@ func (db *DB) autoMigrate() error {
 		logger.Warn("迁移 accounts.clientSecret 列类型时出现警告: %v", err)
 	}
 
+	// 处理 accounts 表的试用到期时间迁移（token_expiry -> trial_expiry）
+	if err := db.migrateAccountTrialExpiryColumn(); err != nil {
+		logger.Warn("迁移 accounts.trial_expiry 字段时出现警告: %v", err)
+	}
+
 	// 处理 accounts 表的 status 字段迁移
 	if err := db.migrateAccountStatusColumn(); err != nil {
 		logger.Warn("迁移 accounts.status 字段时出现警告: %v", err)
@@ -166,11 +186,21 @@ func (db *DB) autoMigrate() error {
 		{&models.Account{}, "accounts"},
 		{&models.User{}, "users"},
 		{&models.UserTokenUsage{}, "user_token_usage"},
+		{&models.UserSpend{}, "user_spend"},
 		{&models.RequestLog{}, "request_logs"},
 		{&models.BlockedIP{}, "blocked_ips"},
 		{&models.IPConfig{}, "ip_configs"},
 		{&models.ImportedAccount{}, "imported_accounts"},
 		{&models.Proxy{}, "proxies"},
+		{&models.ProxySubscription{}, "proxy_subscriptions"},
+		{&models.DeviceAuthSession{}, "device_auth_sessions"},
+		{&models.PayloadCapture{}, "payload_captures"},
+		{&models.NotifyChannel{}, "notify_channels"},
+		{&models.AccountMetric{}, "account_metrics"},
+		{&models.SummaryCacheEntry{}, "summary_caches"},
+		{&models.CoordCounter{}, "coord_counters"},
+		{&models.CoordLock{}, "coord_locks"},
+		{&models.CoordPresence{}, "coord_presence"},
 	}
 
 	for _, t := range tables {
@@ -269,6 +299,24 @@ func (db *DB) migrateSettingsTable() error {
 	return nil
 }
 
+// migrateAccountTrialExpiryColumn 迁移试用到期时间
+// 旧版本在 token_expiry 中保存试用到期时间，现改为保存访问令牌过期时间；
+// 首次添加 trial_expiry 列时把旧值移入新列并清空 token_expiry（之后按上次刷新时间估算，下次刷新时写入）
+func (db *DB) migrateAccountTrialExpiryColumn() error {
+	migrator := db.gorm.Migrator()
+	if !migrator.HasTable(&models.Account{}) || migrator.HasColumn(&models.Account{}, "trial_expiry") {
+		return nil
+	}
+	if err := migrator.AddColumn(&models.Account{}, "TrialExpiry"); err != nil {
+		return err
+	}
+	if !migrator.HasColumn(&models.Account{}, "token_expiry") {
+		return nil
+	}
+	logger.Info("迁移 accounts.token_expiry 中的试用到期时间到 trial_expiry...")
+	return db.gorm.Exec("UPDATE accounts SET trial_expiry = token_expiry, token_expiry = NULL WHERE token_expiry IS NOT NULL").Error
+}
+
 // migrateAccountsClientSecretColumn 迁移 accounts 表的 clientSecret 列类型（VARCHAR -> TEXT）
 // 因为 clientSecret 存储的是 JWT 令牌，长度可能超过 255 字符
 func (db *DB) migrateAccountsClientSecretColumn() error {
@@ -323,6 +371,7 @@ func (db *DB) addMissingColumns(model interface{}, tableName string) error {
 		return err
 	}
 
+	added := make(map[string]bool)
 	for _, field := range stmt.Schema.Fields {
 		if field.DBName == "" {
 			continue
@@ -334,7 +383,23 @@ func (db *DB) addMissingColumns(model interface{}, tableName string) error {
 				logger.Warn("添加列 %s.%s 时出现警告: %v", tableName, field.DBName, err)
 			} else {
 				logger.Info("添加列: %s.%s", tableName, field.DBName)
+				added[field.DBName] = true
+			}
+		}
+	}
+
+	// 为新增的列创建模型中声明的索引（已有列的索引保持不变）
+	for _, idx := range stmt.Schema.ParseIndexes() {
+		for _, f := range idx.Fields {
+			if !added[f.DBName] || migrator.HasIndex(model, idx.Name) {
+				continue
+			}
+			if err := migrator.CreateIndex(model, idx.Name); err != nil {
+				logger.Warn("创建索引 %s.%s 时出现警告: %v", tableName, idx.Name, err)
+			} else {
+				logger.Info("创建索引: %s.%s", tableName, idx.Name)
 			}
+			break
 		}
 	}
 
@@ -355,7 +420,7 @@ func (db *DB) initDefaultSettings() error {
 		if err := db.gorm.Create(setting).Error; err != nil {
 			return err
 		}
-		fmt.Println("[DB] 已初始化默认管理密码: admin")
+		logger.Info("数据库: 已初始化默认管理密码: admin")
 	}
 
 	return nil
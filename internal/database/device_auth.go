@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+
+	"claude-api/internal/models"
+)
+
+// CreateDeviceAuthSession 保存设备授权会话
+// @param sess 会话数据
+// @author ygw
+func (db *DB) CreateDeviceAuthSession(ctx context.Context, sess *models.DeviceAuthSession) error {
+	sess.CreatedAt = models.CurrentTime()
+	sess.UpdatedAt = sess.CreatedAt
+	return db.gorm.WithContext(ctx).Create(sess).Error
+}
+
+// FinishDeviceAuthSession 记录设备授权会话的最终状态（只更新仍在等待授权的会话）
+// @param id 会话ID
+// @param updates 更新数据
+// @return bool 是否更新成功（会话已被取消或已由其他实例完成时为 false）
+// @author ygw
+func (db *DB) FinishDeviceAuthSession(ctx context.Context, id string, updates map[string]interface{}) (bool, error) {
+	return db.TransitionDeviceAuthSession(ctx, id, models.DeviceAuthPending, updates)
+}
+
+// TransitionDeviceAuthSession 条件更新设备授权会话：只有当前状态为 from 的会话会被更新，多实例并发时只有一方成功
+// @param id 会话ID
+// @param from 期望的当前状态
+// @param updates 更新数据
+// @return bool 是否更新成功
+// @author ygw
+func (db *DB) TransitionDeviceAuthSession(ctx context.Context, id, from string, updates map[string]interface{}) (bool, error) {
+	updates["updated_at"] = models.CurrentTime()
+	result := db.gorm.WithContext(ctx).Model(&models.DeviceAuthSession{}).
+		Where("id = ? AND status = ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListDeviceAuthSessions 查询设备授权会话
+// @param batchID 批次ID，为空时不按批次过滤
+// @param status 状态，为空时不按状态过滤
+// @author ygw
+func (db *DB) ListDeviceAuthSessions(ctx context.Context, batchID, status string) ([]*models.DeviceAuthSession, error) {
+	query := db.gorm.WithContext(ctx).Model(&models.DeviceAuthSession{})
+	if batchID != "" {
+		query = query.Where("batch_id = ?", batchID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var sessions []*models.DeviceAuthSession
+	err := query.Order("created_at ASC, id ASC").Find(&sessions).Error
+	return sessions, err
+}
+
+// CancelDeviceAuthBatch 取消批次中仍在等待授权的会话
+// @param batchID 批次ID
+// @return int64 取消的会话数
+// @author ygw
+func (db *DB) CancelDeviceAuthBatch(ctx context.Context, batchID string) (int64, error) {
+	result := db.gorm.WithContext(ctx).Model(&models.DeviceAuthSession{}).
+		Where("batch_id = ? AND status = ?", batchID, models.DeviceAuthPending).
+		Updates(map[string]interface{}{"status": models.DeviceAuthCancelled, "updated_at": models.CurrentTime()})
+	return result.RowsAffected, result.Error
+}
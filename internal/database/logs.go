@@ -203,6 +203,11 @@ func (db *DB) CleanupOldLogs(ctx context.Context, daysToKeep int) (int64, error)
 		return 0, result.Error
 	}
 
+	// 载荷采集随请求日志一起过期
+	if _, err := db.CleanupOldCaptures(ctx, daysToKeep); err != nil {
+		logger.Warn("清理载荷采集失败: %v", err)
+	}
+
 	return result.RowsAffected, nil
 }
 
@@ -273,6 +278,7 @@ func (db *DB) GetVisitorIPs(ctx context.Context) ([]models.VisitorIP, error) {
 				if config, ok := ipConfigs[ips[i].IP]; ok && config != nil {
 					ips[i].Notes = config.Notes
 					ips[i].RateLimitRPM = config.RateLimitRPM
+					ips[i].RateLimitTPM = config.RateLimitTPM
 					ips[i].DailyRequestLimit = config.DailyRequestLimit
 				}
 			}
@@ -364,6 +370,9 @@ func (db *DB) UpsertIPConfig(ctx context.Context, ip string, updates *models.IPC
 		if updates.RateLimitRPM != nil {
 			config.RateLimitRPM = *updates.RateLimitRPM
 		}
+		if updates.RateLimitTPM != nil {
+			config.RateLimitTPM = *updates.RateLimitTPM
+		}
 		if updates.DailyRequestLimit != nil {
 			config.DailyRequestLimit = *updates.DailyRequestLimit
 		}
@@ -383,6 +392,9 @@ func (db *DB) UpsertIPConfig(ctx context.Context, ip string, updates *models.IPC
 	if updates.RateLimitRPM != nil {
 		updateMap["rate_limit_rpm"] = *updates.RateLimitRPM
 	}
+	if updates.RateLimitTPM != nil {
+		updateMap["rate_limit_tpm"] = *updates.RateLimitTPM
+	}
 	if updates.DailyRequestLimit != nil {
 		updateMap["daily_request_limit"] = *updates.DailyRequestLimit
 	}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"claude-api/internal/models"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveAccountMetrics 累加写入账号指标小时快照（同账号同分桶的记录合并）
+// @param metrics 内存聚合后的增量
+// @author ygw
+func (db *DB) SaveAccountMetrics(ctx context.Context, metrics []*models.AccountMetric) error {
+	return db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range metrics {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "account_id"}, {Name: "bucket_start"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"requests":       gorm.Expr("requests + ?", m.Requests),
+					"error_count":    gorm.Expr("error_count + ?", m.Errors),
+					"latency_ms_sum": gorm.Expr("latency_ms_sum + ?", m.LatencyMsSum),
+					"input_tokens":   gorm.Expr("input_tokens + ?", m.InputTokens),
+					"output_tokens":  gorm.Expr("output_tokens + ?", m.OutputTokens),
+					"usage_current":  gorm.Expr("COALESCE(?, usage_current)", m.UsageCurrent),
+					"usage_limit":    gorm.Expr("COALESCE(?, usage_limit)", m.UsageLimit),
+				}),
+			}).Create(m).Error
+			if err != nil {
+				return fmt.Errorf("保存账号指标失败: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetAccountMetrics 查询时间范围内的账号指标（accountID 为空时返回所有账号）
+// @param accountID 账号ID
+// @param since 起始时间（Unix 秒，含）
+// @return []*models.AccountMetric 按时间升序的小时快照
+// @author ygw
+func (db *DB) GetAccountMetrics(ctx context.Context, accountID string, since int64) ([]*models.AccountMetric, error) {
+	var rows []*models.AccountMetric
+	query := db.gorm.WithContext(ctx).Where("bucket_start >= ?", since)
+	if accountID != "" {
+		query = query.Where("account_id = ?", accountID)
+	}
+	if err := query.Order("bucket_start ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("查询账号指标失败: %w", err)
+	}
+	return rows, nil
+}
+
+// CleanupOldAccountMetrics 清理过期的账号指标快照
+func (db *DB) CleanupOldAccountMetrics(ctx context.Context, daysToKeep int) (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -daysToKeep).Unix()
+	result := db.gorm.WithContext(ctx).Where("bucket_start < ?", cutoff).Delete(&models.AccountMetric{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"claude-api/internal/models"
+	"context"
+)
+
+// GetNotifyChannels 获取所有通知渠道
+// @return []*models.NotifyChannel 渠道列表
+// @author ygw
+func (db *DB) GetNotifyChannels(ctx context.Context) ([]*models.NotifyChannel, error) {
+	var channels []*models.NotifyChannel
+	err := db.gorm.WithContext(ctx).Order("id ASC").Find(&channels).Error
+	return channels, err
+}
+
+// GetNotifyChannelByID 根据ID获取通知渠道
+// @param id 渠道ID
+// @return *models.NotifyChannel 渠道
+// @author ygw
+func (db *DB) GetNotifyChannelByID(ctx context.Context, id int64) (*models.NotifyChannel, error) {
+	var ch models.NotifyChannel
+	err := db.gorm.WithContext(ctx).First(&ch, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// CreateNotifyChannel 创建通知渠道
+// @param ch 渠道数据
+// @author ygw
+func (db *DB) CreateNotifyChannel(ctx context.Context, ch *models.NotifyChannel) error {
+	ch.CreatedAt = models.CurrentTime()
+	ch.UpdatedAt = models.CurrentTime()
+	return db.gorm.WithContext(ctx).Create(ch).Error
+}
+
+// UpdateNotifyChannel 更新通知渠道
+// @param id 渠道ID
+// @param updates 更新数据
+// @author ygw
+func (db *DB) UpdateNotifyChannel(ctx context.Context, id int64, updates map[string]interface{}) error {
+	updates["updated_at"] = models.CurrentTime()
+	return db.gorm.WithContext(ctx).Model(&models.NotifyChannel{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// DeleteNotifyChannel 删除通知渠道
+// @param id 渠道ID
+// @author ygw
+func (db *DB) DeleteNotifyChannel(ctx context.Context, id int64) error {
+	return db.gorm.WithContext(ctx).Delete(&models.NotifyChannel{}, id).Error
+}
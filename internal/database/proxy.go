@@ -2,7 +2,12 @@ package database
 
 import (
 	"context"
+	"fmt"
+
 	"claude-api/internal/models"
+	proxypool "claude-api/internal/proxy"
+
+	"gorm.io/gorm"
 )
 
 // GetProxies 获取所有代理
@@ -55,14 +60,119 @@ func (db *DB) UpdateProxy(ctx context.Context, id int64, updates map[string]inte
 }
 
 // DeleteProxy 删除代理
+// 同时解除绑定到该代理的账号
 // @param id 代理ID
 // @author ygw
 func (db *DB) DeleteProxy(ctx context.Context, id int64) error {
-	return db.gorm.WithContext(ctx).Delete(&models.Proxy{}, id).Error
+	return db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Account{}).Where("proxy_id = ?", id).Update("proxy_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Proxy{}, id).Error
+	})
 }
 
 // DeleteAllProxies 删除所有代理
 // @author ygw
 func (db *DB) DeleteAllProxies(ctx context.Context) error {
-	return db.gorm.WithContext(ctx).Where("1 = 1").Delete(&models.Proxy{}).Error
+	return db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Account{}).Where("proxy_id IS NOT NULL").Update("proxy_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("1 = 1").Delete(&models.Proxy{}).Error
+	})
+}
+
+// GetAccountProxyBindings 获取账号与代理的显式绑定关系
+// @return map[string]int64 账号ID -> 代理ID
+// @author ygw
+func (db *DB) GetAccountProxyBindings(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		ID      string
+		ProxyID int64
+	}
+	err := db.gorm.WithContext(ctx).Model(&models.Account{}).
+		Select("id, proxy_id").Where("proxy_id IS NOT NULL AND proxy_id > 0").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	bindings := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		bindings[r.ID] = r.ProxyID
+	}
+	return bindings, nil
+}
+
+// GetAccountStickyProxies 获取粘性策略已持久化的账号代理分配
+// @return map[string]int64 账号ID -> 代理ID
+// @author ygw
+func (db *DB) GetAccountStickyProxies(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		ID            string
+		StickyProxyID int64
+	}
+	err := db.gorm.WithContext(ctx).Model(&models.Account{}).
+		Select("id, sticky_proxy_id").Where("sticky_proxy_id IS NOT NULL AND sticky_proxy_id > 0").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	assignments := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		assignments[r.ID] = r.StickyProxyID
+	}
+	return assignments, nil
+}
+
+// SetAccountStickyProxy 持久化粘性策略为账号分配的代理
+// @param accountID 账号ID
+// @param proxyID 代理ID
+// @author ygw
+func (db *DB) SetAccountStickyProxy(ctx context.Context, accountID string, proxyID int64) error {
+	return db.gorm.WithContext(ctx).Model(&models.Account{}).Where("id = ?", accountID).
+		UpdateColumn("sticky_proxy_id", proxyID).Error
+}
+
+// ImportProxies 批量导入代理，已存在相同地址的行标记为 existing，其余新建
+// @param lines 解析后的代理列表（Status 为空的行参与导入），导入结果写回各行
+// @param tmpl 新建代理的默认字段（名称、启用状态、权重）
+// @author ygw
+func (db *DB) ImportProxies(ctx context.Context, lines []proxypool.ImportLine, tmpl models.Proxy) error {
+	return db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		existing, err := proxyIDsByURL(tx)
+		if err != nil {
+			return err
+		}
+		now := models.CurrentTime()
+		for i := range lines {
+			line := &lines[i]
+			if line.Status != "" {
+				continue
+			}
+			if id, ok := existing[line.URL]; ok {
+				line.Status, line.ID = proxypool.ImportExisting, id
+				continue
+			}
+			p := tmpl
+			p.URL, p.CreatedAt, p.UpdatedAt = line.URL, now, now
+			if err := tx.Create(&p).Error; err != nil {
+				return fmt.Errorf("创建代理失败 (第 %d 行): %w", line.Line, err)
+			}
+			existing[p.URL] = p.ID
+			line.Status, line.ID = proxypool.ImportCreated, p.ID
+		}
+		return nil
+	})
+}
+
+// proxyIDsByURL 返回全部代理的地址到 ID 的映射
+func proxyIDsByURL(tx *gorm.DB) (map[string]int64, error) {
+	var proxies []*models.Proxy
+	if err := tx.Select("id, url").Find(&proxies).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int64, len(proxies))
+	for _, p := range proxies {
+		ids[p.URL] = p.ID
+	}
+	return ids, nil
 }
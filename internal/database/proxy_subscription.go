@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"claude-api/internal/models"
+	proxypool "claude-api/internal/proxy"
+
+	"gorm.io/gorm"
+)
+
+// ProxySyncResult 订阅同步统计
+type ProxySyncResult struct {
+	Added   int `json:"added"`   // 新增代理数
+	Removed int `json:"removed"` // 移除代理数（订阅中已不存在）
+	Kept    int `json:"kept"`    // 保留代理数
+	Invalid int `json:"invalid"` // 无效行数
+}
+
+// GetProxySubscriptions 获取所有代理订阅
+// @author ygw
+func (db *DB) GetProxySubscriptions(ctx context.Context) ([]*models.ProxySubscription, error) {
+	var subs []*models.ProxySubscription
+	err := db.gorm.WithContext(ctx).Order("id ASC").Find(&subs).Error
+	return subs, err
+}
+
+// GetProxySubscriptionByID 根据ID获取代理订阅
+// @param id 订阅ID
+// @author ygw
+func (db *DB) GetProxySubscriptionByID(ctx context.Context, id int64) (*models.ProxySubscription, error) {
+	var sub models.ProxySubscription
+	if err := db.gorm.WithContext(ctx).First(&sub, id).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// CreateProxySubscription 创建代理订阅
+// @param sub 订阅数据
+// @author ygw
+func (db *DB) CreateProxySubscription(ctx context.Context, sub *models.ProxySubscription) error {
+	sub.CreatedAt = models.CurrentTime()
+	sub.UpdatedAt = models.CurrentTime()
+	return db.gorm.WithContext(ctx).Create(sub).Error
+}
+
+// UpdateProxySubscription 更新代理订阅
+// @param id 订阅ID
+// @param updates 更新数据
+// @author ygw
+func (db *DB) UpdateProxySubscription(ctx context.Context, id int64, updates map[string]interface{}) error {
+	updates["updated_at"] = models.CurrentTime()
+	return db.gorm.WithContext(ctx).Model(&models.ProxySubscription{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// DeleteProxySubscription 删除代理订阅及其同步的代理，并解除绑定到这些代理的账号
+// @param id 订阅ID
+// @author ygw
+func (db *DB) DeleteProxySubscription(ctx context.Context, id int64) error {
+	return db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		owned := tx.Model(&models.Proxy{}).Select("id").Where("subscription_id = ?", id)
+		if err := tx.Model(&models.Account{}).Where("proxy_id IN (?)", owned).Update("proxy_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&models.Proxy{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ProxySubscription{}, id).Error
+	})
+}
+
+// SyncSubscriptionProxies 将订阅拉取到的代理列表同步到代理表
+// 新地址创建为该订阅的代理；已存在的地址保留（保持启用状态、权重和账号绑定不变）；
+// 该订阅之前同步、本次列表中已不存在的代理被删除，绑定到这些代理的账号解除绑定
+// @param sub 订阅
+// @param lines 解析后的代理列表，同步结果写回各行
+// @return *ProxySyncResult 同步统计
+// @author ygw
+func (db *DB) SyncSubscriptionProxies(ctx context.Context, sub *models.ProxySubscription, lines []proxypool.ImportLine) (*ProxySyncResult, error) {
+	result := &ProxySyncResult{}
+	err := db.gorm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		existing, err := proxyIDsByURL(tx)
+		if err != nil {
+			return err
+		}
+		var owned []*models.Proxy
+		if err := tx.Select("id, url").Where("subscription_id = ?", sub.ID).Find(&owned).Error; err != nil {
+			return err
+		}
+
+		now := models.CurrentTime()
+		listed := make(map[string]bool)
+		for i := range lines {
+			line := &lines[i]
+			switch line.Status {
+			case proxypool.ImportInvalid:
+				result.Invalid++
+				continue
+			case proxypool.ImportDuplicate:
+				continue
+			}
+			listed[line.URL] = true
+			if id, ok := existing[line.URL]; ok {
+				line.Status, line.ID = proxypool.ImportExisting, id
+				result.Kept++
+				continue
+			}
+			subID := sub.ID
+			p := &models.Proxy{
+				URL:            line.URL,
+				Name:           sub.Name,
+				Enabled:        true,
+				Weight:         1,
+				SubscriptionID: &subID,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			if err := tx.Create(p).Error; err != nil {
+				return fmt.Errorf("创建代理失败 (第 %d 行): %w", line.Line, err)
+			}
+			existing[p.URL] = p.ID
+			line.Status, line.ID = proxypool.ImportCreated, p.ID
+			result.Added++
+		}
+
+		var stale []int64
+		for _, p := range owned {
+			if !listed[p.URL] {
+				stale = append(stale, p.ID)
+			}
+		}
+		if len(stale) > 0 {
+			if err := tx.Model(&models.Account{}).Where("proxy_id IN ?", stale).Update("proxy_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&models.Proxy{}, stale).Error; err != nil {
+				return err
+			}
+			result.Removed = len(stale)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"claude-api/internal/models"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UsageReportQuery 用量报表查询条件
+type UsageReportQuery struct {
+	From     time.Time      // 起始时间（含）
+	To       time.Time      // 结束时间（不含）
+	Location *time.Location // 按日 / 按月分组使用的时区（仅 logs 来源生效）
+	GroupBy  []string       // 分组维度：user、model、day、month
+	Source   string         // 数据来源：logs、usage
+}
+
+// hasGroup 是否按指定维度分组
+func (q *UsageReportQuery) hasGroup(dim string) bool {
+	for _, g := range q.GroupBy {
+		if g == dim {
+			return true
+		}
+	}
+	return false
+}
+
+// usageReportAggregator 按分组维度累加用量
+type usageReportAggregator struct {
+	q    *UsageReportQuery
+	rows map[string]*models.UsageReportRow
+}
+
+// add 累加一条记录（day 为 YYYY-MM-DD）
+func (a *usageReportAggregator) add(day, userID, model string, requests, input, output int64) {
+	var key models.UsageReportRow
+	if a.q.hasGroup(models.ReportGroupDay) {
+		key.Day = day
+	}
+	if a.q.hasGroup(models.ReportGroupMonth) && len(day) >= 7 {
+		key.Month = day[:7]
+	}
+	if a.q.hasGroup(models.ReportGroupUser) {
+		key.UserID = userID
+	}
+	if a.q.hasGroup(models.ReportGroupModel) {
+		key.Model = model
+	}
+	k := key.Day + "|" + key.Month + "|" + key.UserID + "|" + key.Model
+	row, ok := a.rows[k]
+	if !ok {
+		row = &key
+		a.rows[k] = row
+	}
+	row.Requests += requests
+	row.InputTokens += input
+	row.OutputTokens += output
+}
+
+// GetUsageReport 按分组维度聚合时间范围内的用量（请求数、token、美元成本）
+// logs 来源读取 request_logs，支持按模型分组并按指定时区划分日期；
+// usage 来源读取 user_token_usage，不受日志保留天数影响，但没有模型维度且日期为服务器本地日期
+// @author ygw
+func (db *DB) GetUsageReport(ctx context.Context, q *UsageReportQuery) ([]*models.UsageReportRow, error) {
+	if q.Location == nil {
+		q.Location = time.Local
+	}
+	agg := &usageReportAggregator{q: q, rows: make(map[string]*models.UsageReportRow)}
+
+	switch q.Source {
+	case models.ReportSourceUsage:
+		if q.hasGroup(models.ReportGroupModel) {
+			return nil, fmt.Errorf("usage 来源不支持按模型分组")
+		}
+		if err := db.aggregateTokenUsage(ctx, q, agg); err != nil {
+			return nil, err
+		}
+	case models.ReportSourceLogs:
+		if err := db.aggregateRequestLogs(ctx, q, agg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的数据来源: %s", q.Source)
+	}
+
+	// 补充用户名
+	names := make(map[string]string)
+	if q.hasGroup(models.ReportGroupUser) {
+		users, err := db.ListUsers(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			names[u.ID] = u.Name
+		}
+	}
+
+	rows := make([]*models.UsageReportRow, 0, len(agg.rows))
+	for _, row := range agg.rows {
+		row.UserName = names[row.UserID]
+		row.TotalTokens = row.InputTokens + row.OutputTokens
+		_, _, row.CostUSD = models.CalculateTokenCost(row.InputTokens, row.OutputTokens)
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.UserName != b.UserName {
+			return a.UserName < b.UserName
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.Model < b.Model
+	})
+	return rows, nil
+}
+
+// aggregateRequestLogs 从请求日志聚合用量
+// 日志时间戳为带时区偏移的字符串，先按前后各放宽一天的字符串范围查询，再解析后精确过滤
+func (db *DB) aggregateRequestLogs(ctx context.Context, q *UsageReportQuery, agg *usageReportAggregator) error {
+	rows, err := db.gorm.WithContext(ctx).Model(&models.RequestLog{}).
+		Select("timestamp", "user_id", "model", "input_tokens", "output_tokens").
+		Where("timestamp >= ? AND timestamp < ?",
+			q.From.AddDate(0, 0, -1).Format(models.TimeFormat),
+			q.To.AddDate(0, 0, 1).Format(models.TimeFormat)).
+		Rows()
+	if err != nil {
+		return fmt.Errorf("查询请求日志失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			timestamp     string
+			userID, model *string
+			input, output int64
+		)
+		if err := rows.Scan(&timestamp, &userID, &model, &input, &output); err != nil {
+			return fmt.Errorf("读取请求日志失败: %w", err)
+		}
+		ts, err := time.Parse(models.TimeFormat, timestamp)
+		if err != nil || ts.Before(q.From) || !ts.Before(q.To) {
+			continue
+		}
+		agg.add(ts.In(q.Location).Format("2006-01-02"), derefString(userID), derefString(model), 1, input, output)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取请求日志失败: %w", err)
+	}
+	return nil
+}
+
+// aggregateTokenUsage 从用户每日用量表聚合用量
+func (db *DB) aggregateTokenUsage(ctx context.Context, q *UsageReportQuery, agg *usageReportAggregator) error {
+	var usages []models.UserTokenUsage
+	err := db.gorm.WithContext(ctx).
+		Where("date >= ? AND date < ?", q.From.In(time.Local).Format("2006-01-02"), q.To.In(time.Local).Format("2006-01-02")).
+		Find(&usages).Error
+	if err != nil {
+		return fmt.Errorf("查询用户用量失败: %w", err)
+	}
+	for _, u := range usages {
+		agg.add(u.Date, u.UserID, "", u.RequestCount, u.InputTokens, u.OutputTokens)
+	}
+	return nil
+}
+
+// derefString 返回字符串指针的值（nil 时为空字符串）
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
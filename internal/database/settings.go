@@ -2,7 +2,10 @@ package database
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"claude-api/internal/models"
 	"strconv"
@@ -30,6 +33,12 @@ func (db *DB) GetSettings(ctx context.Context) (*models.Settings, error) {
 		CompressionModel:        models.DefaultCompressionModel,
 		QuotaRefreshConcurrency: 20,  // 默认 20 并发
 		QuotaRefreshInterval:    120, // 默认 2 分钟
+		CaptureSampleRate:       0,   // 默认不采样
+		CaptureRedactImages:     true,
+		CaptureRedactKeys:       []string{},
+		CompressionStrategies:      []string{},
+		CompressionModelStrategies: map[string][]string{},
+		NotifyDedupMinutes:      10, // 默认 10 分钟去重
 	}
 
 	var settingsList []models.Setting
@@ -122,6 +131,36 @@ func (db *DB) GetSettings(ctx context.Context) (*models.Settings, error) {
 		case "proxy_pool_enabled":
 			settings.ProxyPoolEnabled = s.Value == "true"
 			db.cfg.ProxyPoolEnabled = s.Value == "true"
+		case "capture_sample_rate":
+			if v, err := strconv.ParseFloat(s.Value, 64); err == nil && v >= 0 && v <= 1 {
+				settings.CaptureSampleRate = v
+			}
+		case "capture_redact_images":
+			settings.CaptureRedactImages = s.Value != "false"
+		case "capture_redact_keys":
+			if s.Value != "" {
+				json.Unmarshal([]byte(s.Value), &settings.CaptureRedactKeys)
+			}
+		case "compression_strategies":
+			if s.Value != "" {
+				json.Unmarshal([]byte(s.Value), &settings.CompressionStrategies)
+			}
+		case "compression_model_strategies":
+			if s.Value != "" {
+				json.Unmarshal([]byte(s.Value), &settings.CompressionModelStrategies)
+			}
+		case "notify_min_valid_accounts":
+			if v, err := strconv.Atoi(s.Value); err == nil && v >= 0 {
+				settings.NotifyMinValidAccounts = v
+			}
+		case "notify_dedup_minutes":
+			if v, err := strconv.Atoi(s.Value); err == nil && v >= 0 {
+				settings.NotifyDedupMinutes = v
+			}
+		case "global_rate_limit_tpm":
+			if v, err := strconv.Atoi(s.Value); err == nil && v >= 0 {
+				settings.GlobalRateLimitTPM = v
+			}
 		case "proxy_pool_strategy":
 			if s.Value != "" {
 				settings.ProxyPoolStrategy = s.Value
@@ -307,6 +346,75 @@ func (db *DB) UpdateSettings(ctx context.Context, updates *models.SettingsUpdate
 			}
 		}
 
+		if updates.CaptureSampleRate != nil {
+			v := *updates.CaptureSampleRate
+			if v < 0 {
+				v = 0
+			}
+			if v > 1 {
+				v = 1
+			}
+			if err := upsertSetting("capture_sample_rate", strconv.FormatFloat(v, 'f', -1, 64)); err != nil {
+				return err
+			}
+		}
+
+		if updates.CaptureRedactImages != nil {
+			if err := upsertSetting("capture_redact_images", boolToString(*updates.CaptureRedactImages)); err != nil {
+				return err
+			}
+		}
+
+		if updates.CompressionStrategies != nil {
+			strategiesJSON, _ := json.Marshal(*updates.CompressionStrategies)
+			if err := upsertSetting("compression_strategies", string(strategiesJSON)); err != nil {
+				return err
+			}
+		}
+		if updates.CompressionModelStrategies != nil {
+			strategiesJSON, _ := json.Marshal(*updates.CompressionModelStrategies)
+			if err := upsertSetting("compression_model_strategies", string(strategiesJSON)); err != nil {
+				return err
+			}
+		}
+
+		if updates.CaptureRedactKeys != nil {
+			keysJSON, _ := json.Marshal(*updates.CaptureRedactKeys)
+			if err := upsertSetting("capture_redact_keys", string(keysJSON)); err != nil {
+				return err
+			}
+		}
+
+		if updates.NotifyMinValidAccounts != nil {
+			v := *updates.NotifyMinValidAccounts
+			if v < 0 {
+				v = 0
+			}
+			if err := upsertSetting("notify_min_valid_accounts", fmt.Sprintf("%d", v)); err != nil {
+				return err
+			}
+		}
+
+		if updates.NotifyDedupMinutes != nil {
+			v := *updates.NotifyDedupMinutes
+			if v < 0 {
+				v = 0
+			}
+			if err := upsertSetting("notify_dedup_minutes", fmt.Sprintf("%d", v)); err != nil {
+				return err
+			}
+		}
+
+		if updates.GlobalRateLimitTPM != nil {
+			v := *updates.GlobalRateLimitTPM
+			if v < 0 {
+				v = 0
+			}
+			if err := upsertSetting("global_rate_limit_tpm", fmt.Sprintf("%d", v)); err != nil {
+				return err
+			}
+		}
+
 		if updates.HTTPProxy != nil {
 			if err := upsertSetting("http_proxy", *updates.HTTPProxy); err != nil {
 				return err
@@ -357,6 +465,39 @@ func (db *DB) UpdateSettings(ctx context.Context, updates *models.SettingsUpdate
 	})
 }
 
+// thinkingSigningKeySetting thinking 块签名密钥的设置项（不通过 GetSettings 对外暴露）
+const thinkingSigningKeySetting = "thinking_signing_key"
+
+// GetOrCreateThinkingKey 获取 thinking 块签名密钥，不存在时生成并保存
+// 密钥持久化后重启服务仍能校验之前签发的 thinking 块
+// @return []byte 32 字节密钥
+// @author ygw
+func (db *DB) GetOrCreateThinkingKey(ctx context.Context) ([]byte, error) {
+	var setting models.Setting
+	err := db.gorm.WithContext(ctx).Where("setting_key = ?", thinkingSigningKeySetting).First(&setting).Error
+	if err == nil {
+		if key, decErr := hex.DecodeString(setting.Value); decErr == nil && len(key) > 0 {
+			return key, nil
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("读取 thinking 签名密钥失败: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("生成 thinking 签名密钥失败: %w", err)
+	}
+	setting = models.Setting{Key: thinkingSigningKeySetting, Value: hex.EncodeToString(key)}
+	// 并发启动时以先写入的密钥为准
+	if err := db.gorm.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&setting).Error; err != nil {
+		return nil, fmt.Errorf("保存 thinking 签名密钥失败: %w", err)
+	}
+	if err := db.gorm.WithContext(ctx).Where("setting_key = ?", thinkingSigningKeySetting).First(&setting).Error; err != nil {
+		return nil, fmt.Errorf("读取 thinking 签名密钥失败: %w", err)
+	}
+	return hex.DecodeString(setting.Value)
+}
+
 // strPtr 返回字符串指针
 func strPtr(s string) *string {
 	return &s
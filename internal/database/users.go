@@ -112,10 +112,27 @@ func (db *DB) UpdateUser(ctx context.Context, id string, updates *models.UserUpd
 	if updates.RateLimitRPM != nil {
 		updateMap["rate_limit_rpm"] = *updates.RateLimitRPM
 	}
+	// 每分钟 token 限制
+	if updates.RateLimitTPM != nil {
+		updateMap["rate_limit_tpm"] = *updates.RateLimitTPM
+	}
 	// VIP用户标识 @author ygw
 	if updates.IsVip != nil {
 		updateMap["is_vip"] = *updates.IsVip
 	}
+	// 消费预算
+	if updates.DailyBudgetUSD != nil {
+		updateMap["daily_budget_usd"] = *updates.DailyBudgetUSD
+	}
+	if updates.MonthlyBudgetUSD != nil {
+		updateMap["monthly_budget_usd"] = *updates.MonthlyBudgetUSD
+	}
+	if updates.CapturePayloads != nil {
+		updateMap["capture_payloads"] = *updates.CapturePayloads
+	}
+	if updates.CompressionStrategies != nil {
+		updateMap["compression_strategies"] = *updates.CompressionStrategies
+	}
 
 	result := db.gorm.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(updateMap)
 	if result.Error != nil {
@@ -139,6 +156,9 @@ func (db *DB) DeleteUser(ctx context.Context, id string) error {
 		if err := tx.Where("user_id = ?", id).Delete(&models.UserTokenUsage{}).Error; err != nil {
 			return fmt.Errorf("删除用户Token使用记录失败: %w", err)
 		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.UserSpend{}).Error; err != nil {
+			return fmt.Errorf("删除用户消费记录失败: %w", err)
+		}
 
 		// 删除用户
 		result := tx.Where("id = ?", id).Delete(&models.User{})
@@ -222,7 +242,8 @@ func (db *DB) UpdateTokenUsage(ctx context.Context, userID string, inputTokens,
 			return fmt.Errorf("更新总使用量失败: %w", err)
 		}
 
-		return nil
+		// 累加当前预算周期的消费
+		return db.addUserSpend(tx, userID, cost, time.Now())
 	})
 }
 
@@ -235,61 +256,76 @@ func (db *DB) CheckUserQuota(ctx context.Context, userID string) (bool, string,
 		return false, "", err
 	}
 
-	today := time.Now().Format("2006-01-02")
-	thisMonth := time.Now().Format("2006-01")
+	usage, err := db.GetUserQuotaUsage(ctx, user)
+	if err != nil {
+		return false, "", err
+	}
 
 	// 检查每日请求次数限制 @author ygw
-	if user.RequestQuota > 0 {
-		var dailyRequests int64
-		err := db.gorm.WithContext(ctx).Model(&models.UserTokenUsage{}).
-			Select("COALESCE(request_count, 0)").
-			Where("user_id = ? AND date = ?", userID, today).
-			Scan(&dailyRequests).Error
+	if user.RequestQuota > 0 && usage.DailyRequests >= int64(user.RequestQuota) {
+		return false, fmt.Sprintf("每日请求次数已用尽 (%d/%d 次)", usage.DailyRequests, user.RequestQuota), nil
+	}
 
-		if err != nil && err != gorm.ErrRecordNotFound {
-			return false, "", fmt.Errorf("检查每日请求次数失败: %w", err)
-		}
+	// 检查每日配额
+	if user.DailyQuota > 0 && usage.DailyTokens >= int64(user.DailyQuota) {
+		return false, fmt.Sprintf("每日配额已用尽 (%d/%d tokens)", usage.DailyTokens, user.DailyQuota), nil
+	}
 
-		if dailyRequests >= int64(user.RequestQuota) {
-			return false, fmt.Sprintf("每日请求次数已用尽 (%d/%d 次)", dailyRequests, user.RequestQuota), nil
-		}
+	// 检查月度配额
+	if user.MonthlyQuota > 0 && usage.MonthlyTokens >= int64(user.MonthlyQuota) {
+		return false, fmt.Sprintf("月度配额已用尽 (%d/%d tokens)", usage.MonthlyTokens, user.MonthlyQuota), nil
 	}
 
-	// 检查每日配额
-	if user.DailyQuota > 0 {
-		var dailyUsage int64
-		err := db.gorm.WithContext(ctx).Model(&models.UserTokenUsage{}).
-			Select("COALESCE(total_tokens, 0)").
-			Where("user_id = ? AND date = ?", userID, today).
-			Scan(&dailyUsage).Error
+	// 检查美元预算（硬限制）
+	if user.DailyBudgetUSD > 0 && usage.DailyCostUSD >= user.DailyBudgetUSD {
+		return false, fmt.Sprintf("每日预算已用尽 ($%.2f/$%.2f)", usage.DailyCostUSD, user.DailyBudgetUSD), nil
+	}
+	if user.MonthlyBudgetUSD > 0 && usage.MonthlyCostUSD >= user.MonthlyBudgetUSD {
+		return false, fmt.Sprintf("月度预算已用尽 ($%.2f/$%.2f)", usage.MonthlyCostUSD, user.MonthlyBudgetUSD), nil
+	}
 
-		if err != nil && err != gorm.ErrRecordNotFound {
-			return false, "", fmt.Errorf("检查每日配额失败: %w", err)
-		}
+	return true, "", nil
+}
 
-		if dailyUsage >= int64(user.DailyQuota) {
-			return false, fmt.Sprintf("每日配额已用尽 (%d/%d tokens)", dailyUsage, user.DailyQuota), nil
+// GetUserQuotaUsage 查询用户今日请求数、今日 token、本月 token 用量以及当前预算周期的消费
+// 只查询用户设置了限制的项，未设置的项为 0
+func (db *DB) GetUserQuotaUsage(ctx context.Context, user *models.User) (*models.UserQuotaUsage, error) {
+	usage := &models.UserQuotaUsage{}
+	today := time.Now().Format("2006-01-02")
+	thisMonth := time.Now().Format("2006-01")
+
+	if user.RequestQuota > 0 || user.DailyQuota > 0 {
+		var rows []models.UserTokenUsage
+		err := db.gorm.WithContext(ctx).
+			Select("request_count", "total_tokens").
+			Where("user_id = ? AND date = ?", user.ID, today).
+			Limit(1).Find(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("检查每日用量失败: %w", err)
+		}
+		if len(rows) > 0 {
+			usage.DailyRequests = rows[0].RequestCount
+			usage.DailyTokens = rows[0].TotalTokens
 		}
 	}
 
-	// 检查月度配额
 	if user.MonthlyQuota > 0 {
-		var monthlyUsage int64
 		err := db.gorm.WithContext(ctx).Model(&models.UserTokenUsage{}).
 			Select("COALESCE(SUM(total_tokens), 0)").
-			Where("user_id = ? AND date LIKE ?", userID, thisMonth+"%").
-			Scan(&monthlyUsage).Error
-
+			Where("user_id = ? AND date LIKE ?", user.ID, thisMonth+"%").
+			Scan(&usage.MonthlyTokens).Error
 		if err != nil && err != gorm.ErrRecordNotFound {
-			return false, "", fmt.Errorf("检查月度配额失败: %w", err)
+			return nil, fmt.Errorf("检查月度配额失败: %w", err)
 		}
+	}
 
-		if monthlyUsage >= int64(user.MonthlyQuota) {
-			return false, fmt.Sprintf("月度配额已用尽 (%d/%d tokens)", monthlyUsage, user.MonthlyQuota), nil
+	if user.DailyBudgetUSD > 0 || user.MonthlyBudgetUSD > 0 {
+		if err := db.fillUserSpend(ctx, user.ID, usage, time.Now()); err != nil {
+			return nil, err
 		}
 	}
 
-	return true, "", nil
+	return usage, nil
 }
 
 // GetUserStats 获取用户的综合统计数据
@@ -1,11 +1,11 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 )
@@ -16,13 +16,60 @@ var (
 	ErrorLogger  *log.Logger
 	DebugLogger  *log.Logger
 	debugEnabled bool
-	logFile      *os.File
+	logFile      *rotatingWriter
+
+	// 输出格式与目标 writer（JSON 模式直接写入 output）
+	format             = FormatText
+	jsonOut  io.Writer = os.Stdout
+	outputMu sync.Mutex
 
 	// 日志广播
 	subscribers   = make(map[chan string]struct{})
 	subscribersMu sync.RWMutex
 )
 
+// 日志级别
+type level int
+
+const (
+	levelDebug level = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// String 返回级别名称（JSON 字段使用小写）
+func (l level) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelWarn:
+		return "warn"
+	case levelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// Options 日志配置
+type Options struct {
+	Format        string // 输出格式: text（默认）、json
+	Dir           string // 日志目录，默认 logs
+	MaxSizeMB     int    // 单个日志文件最大大小（MB），0 表示仅按日期轮转
+	RetentionDays int    // 日志文件保留天数，0 表示不自动清理
+}
+
+// DefaultOptions 返回默认日志配置
+func DefaultOptions() Options {
+	return Options{
+		Format:        FormatText,
+		Dir:           "logs",
+		MaxSizeMB:     100,
+		RetentionDays: 30,
+	}
+}
+
 // broadcastWriter 将日志同时写入原始 writer 和广播给订阅者
 type broadcastWriter struct {
 	original io.Writer
@@ -64,35 +111,72 @@ func Unsubscribe(ch chan string) {
 	subscribersMu.Unlock()
 }
 
-// Init 初始化日志系统
+// Init 初始化日志系统（使用默认配置）
 func Init() error {
-	// 创建日志目录
-	logDir := "logs"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("创建日志目录失败: %v", err)
+	return InitWithOptions(DefaultOptions())
+}
+
+// InitWithOptions 按配置初始化日志系统
+// 日志文件按日期和大小轮转，超过保留天数的文件自动清理
+// @param opts 日志配置
+// @return error 错误信息
+// @author ygw
+func InitWithOptions(opts Options) error {
+	if opts.Dir == "" {
+		opts.Dir = "logs"
 	}
 
-	// 创建日志文件（按日期命名）
-	logFileName := filepath.Join(logDir, fmt.Sprintf("server_%s.log", time.Now().Format("2006-01-02")))
-	var err error
-	logFile, err = os.OpenFile(logFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	w, err := newRotatingWriter(opts.Dir, "server", opts.MaxSizeMB, opts.RetentionDays)
 	if err != nil {
-		return fmt.Errorf("创建日志文件失败: %v", err)
+		return err
 	}
+	logFile = w
 
 	// 同时输出到控制台和文件，并广播
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
 	broadcastW := &broadcastWriter{original: multiWriter}
+	jsonOut = broadcastW
+	setFormat(opts.Format)
 
 	InfoLogger = log.New(broadcastW, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
 	WarnLogger = log.New(broadcastW, "[WARN] ", log.Ldate|log.Ltime|log.Lshortfile)
 	ErrorLogger = log.New(broadcastW, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
 	DebugLogger = log.New(broadcastW, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile)
 
-	InfoLogger.Println("日志系统初始化成功，日志文件: " + logFileName)
+	Info("日志系统初始化成功，日志文件: %s", logFile.Name())
+	go logFile.cleanup()
 	return nil
 }
 
+// Configure 在配置文件加载后调整日志格式和轮转策略（不重新打开文件）
+// @param opts 日志配置
+// @author ygw
+func Configure(opts Options) {
+	setFormat(opts.Format)
+	if logFile != nil {
+		logFile.SetLimits(opts.MaxSizeMB, opts.RetentionDays)
+	}
+	Info("日志配置已更新 - 格式: %s, 单文件上限: %dMB, 保留天数: %d", format, opts.MaxSizeMB, opts.RetentionDays)
+}
+
+// setFormat 设置输出格式，未知格式回退为 text
+func setFormat(f string) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if f == FormatJSON {
+		format = FormatJSON
+	} else {
+		format = FormatText
+	}
+}
+
+// IsJSONFormat 返回是否为 JSON 输出格式
+func IsJSONFormat() bool {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	return format == FormatJSON
+}
+
 // CloseSubscribers 关闭所有订阅者的 channel（用于优雅关闭时先断开 SSE 连接）
 func CloseSubscribers() {
 	subscribersMu.Lock()
@@ -116,9 +200,9 @@ func Close() {
 func SetDebugEnabled(enabled bool) {
 	debugEnabled = enabled
 	if enabled {
-		InfoLogger.Println("调试日志已启用")
+		Info("调试日志已启用")
 	} else {
-		InfoLogger.Println("调试日志已禁用")
+		Info("调试日志已禁用")
 	}
 }
 
@@ -129,33 +213,59 @@ func IsDebugEnabled() bool {
 
 // Info 记录信息级别日志
 func Info(format string, v ...interface{}) {
-	if InfoLogger != nil {
-		InfoLogger.Output(2, fmt.Sprintf(format, v...))
-	}
+	output(levelInfo, 1, nil, fmt.Sprintf(format, v...))
 }
 
 // Warn 记录警告级别日志
 func Warn(format string, v ...interface{}) {
-	if WarnLogger != nil {
-		WarnLogger.Output(2, fmt.Sprintf(format, v...))
-	}
+	output(levelWarn, 1, nil, fmt.Sprintf(format, v...))
 }
 
 // Error 记录错误级别日志
 func Error(format string, v ...interface{}) {
-	if ErrorLogger != nil {
-		ErrorLogger.Output(2, fmt.Sprintf(format, v...))
-	}
+	output(levelError, 1, nil, fmt.Sprintf(format, v...))
 }
 
 // Debug 记录调试级别日志
 func Debug(format string, v ...interface{}) {
-	if DebugLogger != nil && debugEnabled {
-		DebugLogger.Output(2, fmt.Sprintf(format, v...))
+	if debugEnabled {
+		output(levelDebug, 1, nil, fmt.Sprintf(format, v...))
+	}
+}
+
+// output 按当前格式输出一条日志
+// depth 为相对 output 调用方的栈深度（1 表示调用 Info/Warn 等函数的位置）
+func output(l level, depth int, f *Fields, msg string) {
+	if IsJSONFormat() {
+		line := formatJSON(time.Now(), l.String(), callerInfo(depth+1), f, msg)
+		outputMu.Lock()
+		jsonOut.Write(line)
+		outputMu.Unlock()
+		return
+	}
+
+	var lg *log.Logger
+	switch l {
+	case levelDebug:
+		lg = DebugLogger
+	case levelWarn:
+		lg = WarnLogger
+	case levelError:
+		lg = ErrorLogger
+	default:
+		lg = InfoLogger
+	}
+	if lg == nil {
+		return
+	}
+	if f != nil && f.RequestID != "" {
+		msg = "[" + f.RequestID + "] " + msg
 	}
+	lg.Output(depth+2, msg)
 }
 
-// LogRequest 记录 HTTP 请求详情
-func LogRequest(method, path, ip string, statusCode int, duration time.Duration) {
-	Info("%s %s from %s - Status: %d - Duration: %v", method, path, ip, statusCode, duration)
+// LogRequest 记录 HTTP 请求详情（携带 context 中的请求字段）
+func LogRequest(ctx context.Context, method, path, ip string, statusCode int, duration time.Duration) {
+	f := FieldsFromContext(ctx)
+	output(levelInfo, 1, &f, fmt.Sprintf("%s %s from %s - Status: %d - Duration: %v", method, path, ip, statusCode, duration))
 }
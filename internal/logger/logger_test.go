@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJSONFormat_WithContextFields 测试 JSON 日志包含请求字段且广播给订阅者
+func TestJSONFormat_WithContextFields(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitWithOptions(Options{Format: FormatJSON, Dir: dir}); err != nil {
+		t.Fatalf("初始化日志失败: %v", err)
+	}
+	defer func() {
+		Close()
+		setFormat(FormatText)
+	}()
+
+	ch := Subscribe()
+	ctx := NewContext(context.Background(), Fields{RequestID: "req-1"})
+	AddFields(ctx, Fields{UserID: "user-1", AccountID: "acc-1", Model: "claude-sonnet-4"})
+	Ctx(ctx).Warn("上游请求失败: %d", 502)
+
+	var line string
+	select {
+	case line = <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("订阅者未收到日志")
+	}
+
+	var entry map[string]string
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("日志不是合法 JSON: %v - %s", err, line)
+	}
+	want := map[string]string{
+		"level":      "warn",
+		"message":    "上游请求失败: 502",
+		"request_id": "req-1",
+		"user_id":    "user-1",
+		"account_id": "acc-1",
+		"model":      "claude-sonnet-4",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("字段 %s = %q，期望 %q", k, entry[k], v)
+		}
+	}
+	if entry["timestamp"] == "" || !strings.HasPrefix(entry["caller"], "logger_test.go:") {
+		t.Errorf("timestamp/caller 字段不正确: %v", entry)
+	}
+}
+
+// TestRotatingWriter_SizeAndRetention 测试按大小轮转和过期清理
+func TestRotatingWriter_SizeAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.Local)
+
+	// 预置一个过期文件
+	old := filepath.Join(dir, "server_2025-12-01.log")
+	os.WriteFile(old, []byte("old\n"), 0644)
+	os.Chtimes(old, now.AddDate(0, 0, -40), now.AddDate(0, 0, -40))
+
+	w, err := newRotatingWriter(dir, "server", 1, 30)
+	if err != nil {
+		t.Fatalf("创建轮转 writer 失败: %v", err)
+	}
+	defer w.Close()
+	w.now = func() time.Time { return now }
+	w.mu.Lock()
+	w.date = ""
+	w.openLocked()
+	w.mu.Unlock()
+
+	chunk := []byte(strings.Repeat("a", 600*1024))
+	w.Write(chunk)
+	w.Write(chunk) // 超过 1MB，触发轮转
+
+	if _, err := os.Stat(filepath.Join(dir, "server_2026-01-10.1.log")); err != nil {
+		t.Errorf("未按大小轮转: %v", err)
+	}
+
+	// 跨天轮转
+	w.mu.Lock()
+	now = now.AddDate(0, 0, 1)
+	w.mu.Unlock()
+	w.Write([]byte("next day\n"))
+	if got := filepath.Base(w.Name()); got != "server_2026-01-11.log" {
+		t.Errorf("未按日期轮转，当前文件: %s", got)
+	}
+
+	// 轮转时已异步触发清理，这里同步再执行一次确保完成
+	w.cleanup()
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("过期文件未被删除")
+	}
+}
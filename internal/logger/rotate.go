@@ -0,0 +1,180 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingWriter 按日期和大小轮转的日志文件 writer
+// 文件命名: <prefix>_YYYY-MM-DD.log，超出大小后依次为 <prefix>_YYYY-MM-DD.1.log、.2.log ...
+// @author ygw
+type rotatingWriter struct {
+	mu            sync.Mutex
+	dir           string
+	prefix        string
+	maxSize       int64 // 单文件最大字节数，0 表示不按大小轮转
+	retentionDays int   // 保留天数，0 表示不清理
+	file          *os.File
+	date          string
+	seq           int
+	size          int64
+	now           func() time.Time
+}
+
+// newRotatingWriter 创建轮转 writer 并打开当前日志文件
+func newRotatingWriter(dir, prefix string, maxSizeMB, retentionDays int) (*rotatingWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	w := &rotatingWriter{
+		dir:           dir,
+		prefix:        prefix,
+		maxSize:       int64(maxSizeMB) * 1024 * 1024,
+		retentionDays: retentionDays,
+		now:           time.Now,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.openLocked(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// filename 返回指定日期和序号的文件路径
+func (w *rotatingWriter) filename(date string, seq int) string {
+	if seq == 0 {
+		return filepath.Join(w.dir, fmt.Sprintf("%s_%s.log", w.prefix, date))
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("%s_%s.%d.log", w.prefix, date, seq))
+}
+
+// openLocked 打开当前日期下第一个未写满的文件（调用方需持有锁）
+func (w *rotatingWriter) openLocked() error {
+	date := w.now().Format("2006-01-02")
+	if date != w.date {
+		w.date = date
+		w.seq = 0
+	}
+
+	for {
+		name := w.filename(w.date, w.seq)
+		info, err := os.Stat(name)
+		if err == nil && w.maxSize > 0 && info.Size() >= w.maxSize {
+			w.seq++
+			continue
+		}
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("创建日志文件失败: %v", err)
+		}
+		if w.file != nil {
+			w.file.Close()
+		}
+		w.file = f
+		w.size = 0
+		if info != nil {
+			w.size = info.Size()
+		}
+		return nil
+	}
+}
+
+// Write 写入日志，必要时先轮转
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	rotated := false
+	if w.now().Format("2006-01-02") != w.date {
+		rotated = true
+	} else if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		w.seq++
+		rotated = true
+	}
+	if rotated {
+		if err := w.openLocked(); err != nil {
+			return 0, err
+		}
+		go w.cleanup()
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Name 返回当前日志文件路径
+func (w *rotatingWriter) Name() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.filename(w.date, w.seq)
+}
+
+// SetLimits 更新大小和保留天数限制
+func (w *rotatingWriter) SetLimits(maxSizeMB, retentionDays int) {
+	w.mu.Lock()
+	w.maxSize = int64(maxSizeMB) * 1024 * 1024
+	w.retentionDays = retentionDays
+	w.mu.Unlock()
+	go w.cleanup()
+}
+
+// cleanup 删除超过保留天数的日志文件
+// @return int 删除的文件数
+func (w *rotatingWriter) cleanup() int {
+	w.mu.Lock()
+	retention := w.retentionDays
+	current := w.filename(w.date, w.seq)
+	cutoff := w.now().AddDate(0, 0, -retention)
+	w.mu.Unlock()
+
+	if retention <= 0 {
+		return 0
+	}
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, w.prefix+"_") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		path := filepath.Join(w.dir, name)
+		if path == current {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if os.Remove(path) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Close 关闭当前日志文件
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 日志输出格式
+const (
+	FormatText = "text" // 传统文本格式（默认）
+	FormatJSON = "json" // 结构化 JSON 格式，每行一个对象，便于 Loki 等采集
+)
+
+// Fields 请求级日志字段，随 context 在请求链路中传递
+type Fields struct {
+	RequestID string
+	UserID    string
+	AccountID string
+	Model     string
+}
+
+// fieldsHolder 可变的字段容器（请求处理过程中逐步补充用户、账号、模型）
+type fieldsHolder struct {
+	mu     sync.RWMutex
+	fields Fields
+}
+
+type fieldsKey struct{}
+
+// NewContext 返回携带日志字段的新 context
+// @param ctx 父 context
+// @param f 初始字段（通常只有 RequestID）
+// @return context.Context 新 context
+// @author ygw
+func NewContext(ctx context.Context, f Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fieldsHolder{fields: f})
+}
+
+// AddFields 合并非空字段到 context 中的日志字段（context 未携带字段时忽略）
+// @param ctx 由 NewContext 创建的 context
+// @param f 需要补充的字段
+// @author ygw
+func AddFields(ctx context.Context, f Fields) {
+	h, ok := ctx.Value(fieldsKey{}).(*fieldsHolder)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	if f.RequestID != "" {
+		h.fields.RequestID = f.RequestID
+	}
+	if f.UserID != "" {
+		h.fields.UserID = f.UserID
+	}
+	if f.AccountID != "" {
+		h.fields.AccountID = f.AccountID
+	}
+	if f.Model != "" {
+		h.fields.Model = f.Model
+	}
+	h.mu.Unlock()
+}
+
+// FieldsFromContext 读取 context 中的日志字段
+func FieldsFromContext(ctx context.Context) Fields {
+	if ctx == nil {
+		return Fields{}
+	}
+	h, ok := ctx.Value(fieldsKey{}).(*fieldsHolder)
+	if !ok {
+		return Fields{}
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.fields
+}
+
+// RequestID 读取 context 中的请求 ID
+func RequestID(ctx context.Context) string {
+	return FieldsFromContext(ctx).RequestID
+}
+
+// Entry 绑定了请求字段的日志记录器
+type Entry struct {
+	ctx context.Context
+}
+
+// Ctx 返回绑定 context 字段的日志记录器
+// 用法: logger.Ctx(c.Request.Context()).Info("...")
+func Ctx(ctx context.Context) *Entry {
+	return &Entry{ctx: ctx}
+}
+
+// Info 记录信息级别日志
+func (e *Entry) Info(format string, v ...interface{}) {
+	f := FieldsFromContext(e.ctx)
+	output(levelInfo, 1, &f, fmt.Sprintf(format, v...))
+}
+
+// Warn 记录警告级别日志
+func (e *Entry) Warn(format string, v ...interface{}) {
+	f := FieldsFromContext(e.ctx)
+	output(levelWarn, 1, &f, fmt.Sprintf(format, v...))
+}
+
+// Error 记录错误级别日志
+func (e *Entry) Error(format string, v ...interface{}) {
+	f := FieldsFromContext(e.ctx)
+	output(levelError, 1, &f, fmt.Sprintf(format, v...))
+}
+
+// Debug 记录调试级别日志
+func (e *Entry) Debug(format string, v ...interface{}) {
+	if !debugEnabled {
+		return
+	}
+	f := FieldsFromContext(e.ctx)
+	output(levelDebug, 1, &f, fmt.Sprintf(format, v...))
+}
+
+// jsonEntry JSON 日志行结构
+type jsonEntry struct {
+	Time      string `json:"timestamp"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	Caller    string `json:"caller,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+	Model     string `json:"model,omitempty"`
+}
+
+// formatJSON 序列化一行 JSON 日志（末尾带换行）
+func formatJSON(t time.Time, level, caller string, f *Fields, msg string) []byte {
+	entry := jsonEntry{
+		Time:    t.Format(time.RFC3339Nano),
+		Level:   level,
+		Message: msg,
+		Caller:  caller,
+	}
+	if f != nil {
+		entry.RequestID = f.RequestID
+		entry.UserID = f.UserID
+		entry.AccountID = f.AccountID
+		entry.Model = f.Model
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data = []byte(`{"level":"error","message":"日志序列化失败"}`)
+	}
+	return append(data, '\n')
+}
+
+// callerInfo 返回调用位置 file:line
+func callerInfo(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	return filepath.Base(file) + ":" + strconv.Itoa(line)
+}
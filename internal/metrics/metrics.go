@@ -0,0 +1,248 @@
+// Package metrics 账号指标时间序列：请求完成时在内存中按小时聚合，定期落库；
+// 查询时按需重新分桶，并根据配额消耗速度预测账号池耗尽时间
+// @author ygw
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"claude-api/internal/models"
+)
+
+// BucketSize 落库的基础分桶粒度
+const BucketSize = time.Hour
+
+// BucketStart 返回时间点所在基础分桶的起始 Unix 秒
+func BucketStart(t time.Time) int64 {
+	return t.Truncate(BucketSize).Unix()
+}
+
+// Aggregator 请求指标内存聚合器（按账号 + 小时分桶累加，Drain 后清空）
+type Aggregator struct {
+	mu      sync.Mutex
+	buckets map[aggKey]*models.AccountMetric
+}
+
+type aggKey struct {
+	accountID string
+	bucket    int64
+}
+
+// NewAggregator 创建聚合器
+func NewAggregator() *Aggregator {
+	return &Aggregator{buckets: make(map[aggKey]*models.AccountMetric)}
+}
+
+// RecordRequest 记录一次请求完成
+// @param accountID 账号ID
+// @param at 完成时间
+// @param success 是否成功
+// @param latency 请求耗时
+// @param inputTokens 输入 token 数
+// @param outputTokens 输出 token 数
+// @author ygw
+func (a *Aggregator) RecordRequest(accountID string, at time.Time, success bool, latency time.Duration, inputTokens, outputTokens int) {
+	if accountID == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := a.bucket(accountID, BucketStart(at))
+	m.Requests++
+	if !success {
+		m.Errors++
+	}
+	m.LatencyMsSum += latency.Milliseconds()
+	m.InputTokens += int64(inputTokens)
+	m.OutputTokens += int64(outputTokens)
+}
+
+// RecordQuota 记录一次配额快照（同一分桶内保留最新值）
+func (a *Aggregator) RecordQuota(accountID string, at time.Time, usageCurrent, usageLimit float64) {
+	if accountID == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := a.bucket(accountID, BucketStart(at))
+	m.UsageCurrent = &usageCurrent
+	m.UsageLimit = &usageLimit
+}
+
+// Drain 取出并清空当前累计的指标
+func (a *Aggregator) Drain() []*models.AccountMetric {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.buckets) == 0 {
+		return nil
+	}
+	out := make([]*models.AccountMetric, 0, len(a.buckets))
+	for _, m := range a.buckets {
+		out = append(out, m)
+	}
+	a.buckets = make(map[aggKey]*models.AccountMetric)
+	return out
+}
+
+// Snapshot 返回当前累计指标的副本（不清空）
+func (a *Aggregator) Snapshot() []*models.AccountMetric {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]*models.AccountMetric, 0, len(a.buckets))
+	for _, m := range a.buckets {
+		cp := *m
+		out = append(out, &cp)
+	}
+	return out
+}
+
+func (a *Aggregator) bucket(accountID string, start int64) *models.AccountMetric {
+	k := aggKey{accountID, start}
+	m, ok := a.buckets[k]
+	if !ok {
+		m = &models.AccountMetric{AccountID: accountID, BucketStart: start}
+		a.buckets[k] = m
+	}
+	return m
+}
+
+// Point 时间序列中的一个数据点
+type Point struct {
+	Time         int64    `json:"time"` // 分桶起始 Unix 秒
+	Requests     int64    `json:"requests"`
+	Errors       int64    `json:"errors"`
+	ErrorRate    float64  `json:"error_rate"`
+	AvgLatencyMs float64  `json:"avg_latency_ms"`
+	InputTokens  int64    `json:"input_tokens"`
+	OutputTokens int64    `json:"output_tokens"`
+	UsageCurrent *float64 `json:"usage_current,omitempty"` // 分桶内最后一次配额快照（账号池为各账号之和）
+	UsageLimit   *float64 `json:"usage_limit,omitempty"`
+}
+
+// Series 将小时记录按指定粒度重新分桶
+// 多个账号的记录会合并：计数累加，配额取每个账号在分桶内的最后一次快照再求和
+// @param rows 按时间排序的小时记录
+// @param bucket 目标粒度（不小于 1 小时）
+// @return []Point 数据点（按时间升序）
+// @author ygw
+func Series(rows []*models.AccountMetric, bucket time.Duration) []Point {
+	if bucket < BucketSize {
+		bucket = BucketSize
+	}
+	step := int64(bucket / time.Second)
+
+	type usage struct {
+		at             int64
+		current, limit float64
+	}
+	points := make(map[int64]*Point)
+	lastUsage := make(map[int64]map[string]usage)
+
+	for _, r := range rows {
+		start := r.BucketStart - r.BucketStart%step
+		p, ok := points[start]
+		if !ok {
+			p = &Point{Time: start}
+			points[start] = p
+			lastUsage[start] = make(map[string]usage)
+		}
+		p.Requests += r.Requests
+		p.Errors += r.Errors
+		p.AvgLatencyMs += float64(r.LatencyMsSum) // 先累加总耗时，最后再求平均
+		p.InputTokens += r.InputTokens
+		p.OutputTokens += r.OutputTokens
+		if r.UsageCurrent != nil && r.UsageLimit != nil {
+			if u, ok := lastUsage[start][r.AccountID]; !ok || r.BucketStart >= u.at {
+				lastUsage[start][r.AccountID] = usage{r.BucketStart, *r.UsageCurrent, *r.UsageLimit}
+			}
+		}
+	}
+
+	out := make([]Point, 0, len(points))
+	for start, p := range points {
+		if p.Requests > 0 {
+			p.ErrorRate = float64(p.Errors) / float64(p.Requests)
+			p.AvgLatencyMs = p.AvgLatencyMs / float64(p.Requests)
+		} else {
+			p.AvgLatencyMs = 0
+		}
+		if len(lastUsage[start]) > 0 {
+			var cur, lim float64
+			for _, u := range lastUsage[start] {
+				cur += u.current
+				lim += u.limit
+			}
+			p.UsageCurrent, p.UsageLimit = &cur, &lim
+		}
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time < out[j].Time })
+	return out
+}
+
+// Forecast 账号池耗尽预测
+type Forecast struct {
+	Remaining       float64 `json:"remaining"`                   // 当前剩余配额（各账号 limit-current 之和）
+	BurnPerHour     float64 `json:"burn_per_hour"`               // 观察窗口内的平均每小时消耗
+	HoursUntilEmpty float64 `json:"hours_until_empty,omitempty"` // 按当前速度耗尽所需小时数
+	EmptyAt         int64   `json:"empty_at,omitempty"`          // 预计耗尽时间（Unix 秒）
+	WindowHours     float64 `json:"window_hours"`                // 实际观察窗口
+}
+
+// Quota 账号当前配额
+type Quota struct {
+	AccountID    string
+	UsageCurrent float64
+	UsageLimit   float64
+}
+
+// ForecastExhaustion 根据配额快照的历史增长计算消耗速度，预测账号池耗尽时间
+// 只统计相邻快照间的正向增量，配额重置（用量下降）不计入消耗
+// @param rows 小时记录（可包含多个账号）
+// @param current 各账号当前配额
+// @param now 当前时间
+// @return Forecast 预测结果；没有消耗时不返回耗尽时间
+// @author ygw
+func ForecastExhaustion(rows []*models.AccountMetric, current []Quota, now time.Time) Forecast {
+	var f Forecast
+	for _, q := range current {
+		if q.UsageLimit > q.UsageCurrent {
+			f.Remaining += q.UsageLimit - q.UsageCurrent
+		}
+	}
+
+	sorted := make([]*models.AccountMetric, 0, len(rows))
+	for _, r := range rows {
+		if r.UsageCurrent != nil {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].BucketStart < sorted[j].BucketStart })
+
+	var burned float64
+	var first, last int64
+	prev := make(map[string]float64)
+	for _, r := range sorted {
+		if first == 0 {
+			first = r.BucketStart
+		}
+		last = r.BucketStart
+		if p, ok := prev[r.AccountID]; ok && *r.UsageCurrent > p {
+			burned += *r.UsageCurrent - p
+		}
+		prev[r.AccountID] = *r.UsageCurrent
+	}
+	if first == 0 || last == first {
+		return f
+	}
+
+	f.WindowHours = float64(last-first) / 3600
+	f.BurnPerHour = burned / f.WindowHours
+	if f.BurnPerHour > 0 {
+		f.HoursUntilEmpty = f.Remaining / f.BurnPerHour
+		f.EmptyAt = now.Add(time.Duration(f.HoursUntilEmpty * float64(time.Hour))).Unix()
+	}
+	return f
+}
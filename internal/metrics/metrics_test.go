@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"claude-api/internal/models"
+)
+
+func f64(v float64) *float64 { return &v }
+
+// TestAggregator_RecordAndDrain 测试请求与配额的小时聚合
+func TestAggregator_RecordAndDrain(t *testing.T) {
+	a := NewAggregator()
+	base := time.Date(2026, 1, 1, 10, 5, 0, 0, time.UTC)
+	a.RecordRequest("acc1", base, true, 100*time.Millisecond, 10, 20)
+	a.RecordRequest("acc1", base.Add(10*time.Minute), false, 300*time.Millisecond, 5, 0)
+	a.RecordRequest("acc1", base.Add(time.Hour), true, time.Millisecond, 0, 0)
+	a.RecordQuota("acc1", base, 1, 50)
+	a.RecordQuota("acc1", base.Add(20*time.Minute), 2, 50)
+
+	if got := len(a.Snapshot()); got != 2 {
+		t.Fatalf("快照不应清空聚合，期望 2 个分桶，实际 %d", got)
+	}
+	batch := a.Drain()
+	if len(batch) != 2 || len(a.Drain()) != 0 {
+		t.Fatalf("Drain 后应清空，期望 2 个分桶，实际 %d", len(batch))
+	}
+	for _, m := range batch {
+		if m.BucketStart != BucketStart(base) {
+			continue
+		}
+		if m.Requests != 2 || m.Errors != 1 || m.LatencyMsSum != 400 || m.InputTokens != 15 || m.OutputTokens != 20 {
+			t.Errorf("分桶累计错误: %+v", m)
+		}
+		if m.UsageCurrent == nil || *m.UsageCurrent != 2 {
+			t.Errorf("配额快照应保留最新值: %v", m.UsageCurrent)
+		}
+	}
+}
+
+// TestSeries_Rebucket 测试按天重新分桶及多账号配额合并
+func TestSeries_Rebucket(t *testing.T) {
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	rows := []*models.AccountMetric{
+		{AccountID: "a", BucketStart: day, Requests: 4, Errors: 1, LatencyMsSum: 400, UsageCurrent: f64(1), UsageLimit: f64(50)},
+		{AccountID: "a", BucketStart: day + 3600, Requests: 6, LatencyMsSum: 600, UsageCurrent: f64(3), UsageLimit: f64(50)},
+		{AccountID: "b", BucketStart: day + 7200, Requests: 0, UsageCurrent: f64(10), UsageLimit: f64(50)},
+		{AccountID: "a", BucketStart: day + 86400, Requests: 1, LatencyMsSum: 50},
+	}
+
+	points := Series(rows, 24*time.Hour)
+	if len(points) != 2 {
+		t.Fatalf("期望 2 个数据点，实际 %d", len(points))
+	}
+	p := points[0]
+	if p.Time != day || p.Requests != 10 || p.Errors != 1 || p.AvgLatencyMs != 100 || p.ErrorRate != 0.1 {
+		t.Errorf("按天聚合错误: %+v", p)
+	}
+	if p.UsageCurrent == nil || *p.UsageCurrent != 13 || *p.UsageLimit != 100 {
+		t.Errorf("配额应取各账号最后一次快照之和: %v/%v", p.UsageCurrent, p.UsageLimit)
+	}
+	if points[1].UsageCurrent != nil {
+		t.Error("没有配额快照的分桶不应返回配额")
+	}
+}
+
+// TestForecastExhaustion 测试耗尽预测（忽略配额重置）
+func TestForecastExhaustion(t *testing.T) {
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	start := now.Add(-10 * time.Hour).Unix()
+	rows := []*models.AccountMetric{
+		{AccountID: "a", BucketStart: start, UsageCurrent: f64(0)},
+		{AccountID: "a", BucketStart: start + 5*3600, UsageCurrent: f64(10)},
+		{AccountID: "b", BucketStart: start + 5*3600, UsageCurrent: f64(40)},
+		{AccountID: "b", BucketStart: start + 10*3600, UsageCurrent: f64(5)}, // 配额重置
+		{AccountID: "a", BucketStart: start + 10*3600, UsageCurrent: f64(20)},
+	}
+	quotas := []Quota{{"a", 20, 50}, {"b", 5, 50}}
+
+	f := ForecastExhaustion(rows, quotas, now)
+	if f.Remaining != 75 || f.WindowHours != 10 || f.BurnPerHour != 2 {
+		t.Fatalf("预测参数错误: %+v", f)
+	}
+	if math.Abs(f.HoursUntilEmpty-37.5) > 1e-9 || f.EmptyAt != now.Add(37*time.Hour+30*time.Minute).Unix() {
+		t.Errorf("耗尽时间错误: %+v", f)
+	}
+
+	if f := ForecastExhaustion(rows[:1], quotas, now); f.EmptyAt != 0 {
+		t.Error("只有一个快照时不应给出耗尽时间")
+	}
+}
@@ -0,0 +1,46 @@
+// Package mockupstream 提供本地模拟上游服务，用于在不访问 AWS 的情况下端到端测试代理
+// 支持 Amazon Q 对话（AWS Event Stream 二进制帧）、getUsageLimits、OIDC 设备授权与令牌刷新、Kiro 社交登录刷新
+// @author ygw
+package mockupstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+)
+
+// headerTypeString Event Stream 头部值类型：字符串
+const headerTypeString = 7
+
+// EncodeEvent 将事件编码为 AWS Event Stream 二进制帧
+// 帧格式：总长度(4) + 头部长度(4) + 前导 CRC(4) + 头部 + payload + 消息 CRC(4)，均为大端序
+func EncodeEvent(eventType string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers bytes.Buffer
+	for _, h := range [][2]string{
+		{":event-type", eventType},
+		{":content-type", "application/json"},
+		{":message-type", "event"},
+	} {
+		headers.WriteByte(byte(len(h[0])))
+		headers.WriteString(h[0])
+		headers.WriteByte(headerTypeString)
+		binary.Write(&headers, binary.BigEndian, uint16(len(h[1])))
+		headers.WriteString(h[1])
+	}
+
+	total := 12 + headers.Len() + len(body) + 4
+	msg := make([]byte, 0, total)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(total))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(headers.Len()))
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg[:8]))
+	msg = append(msg, headers.Bytes()...)
+	msg = append(msg, body...)
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+	return msg, nil
+}
@@ -0,0 +1,111 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event 模拟上游发送的单个事件
+type Event struct {
+	Type    string                 // 事件类型，如 assistantResponseEvent、toolUseEvent
+	Payload map[string]interface{} // 事件内容（JSON 对象）
+}
+
+// Scenario 一次对话请求的脚本
+// Status 非 0 时直接返回该状态码和 Body（模拟限流、封控等错误），否则按顺序发送 Events
+type Scenario struct {
+	Name            string
+	Status          int           // 错误状态码
+	Body            string        // 错误响应体
+	Events          []Event       // 流式事件
+	EventDelay      time.Duration // 事件之间的间隔
+	DisconnectAfter int           // 发送该数量的事件后直接断开连接（模拟中途断流），0 表示正常结束
+}
+
+// TextEvent 文本回复事件
+func TextEvent(content string) Event {
+	return Event{Type: "assistantResponseEvent", Payload: map[string]interface{}{"content": content}}
+}
+
+// ToolUseEvents 工具调用事件（开始、参数、结束三段）
+func ToolUseEvents(toolUseID, name string, input interface{}) []Event {
+	args, _ := json.Marshal(input)
+	return []Event{
+		{Type: "toolUseEvent", Payload: map[string]interface{}{"toolUseId": toolUseID, "name": name}},
+		{Type: "toolUseEvent", Payload: map[string]interface{}{"toolUseId": toolUseID, "name": name, "input": string(args)}},
+		{Type: "toolUseEvent", Payload: map[string]interface{}{"toolUseId": toolUseID, "name": name, "stop": true}},
+	}
+}
+
+// MeteringEvent 计费事件
+func MeteringEvent(credits float64) Event {
+	return Event{Type: "meteringEvent", Payload: map[string]interface{}{"unit": "credit", "usage": credits}}
+}
+
+// TextScenario 纯文本回复，每个参数作为一个增量事件发送
+func TextScenario(chunks ...string) Scenario {
+	sc := Scenario{Name: "text"}
+	for _, c := range chunks {
+		sc.Events = append(sc.Events, TextEvent(c))
+	}
+	sc.Events = append(sc.Events, MeteringEvent(0.01))
+	return sc
+}
+
+// ThinkingScenario 先输出 <thinking> 思考内容，再输出正文
+func ThinkingScenario(thinking, text string) Scenario {
+	return Scenario{Name: "thinking", Events: []Event{
+		TextEvent("<thinking>"),
+		TextEvent(thinking),
+		TextEvent("</thinking>"),
+		TextEvent(text),
+		MeteringEvent(0.01),
+	}}
+}
+
+// ToolUseScenario 先输出文本，再发起一次工具调用
+func ToolUseScenario(text, toolUseID, name string, input interface{}) Scenario {
+	sc := Scenario{Name: "tool_use"}
+	if text != "" {
+		sc.Events = append(sc.Events, TextEvent(text))
+	}
+	sc.Events = append(sc.Events, ToolUseEvents(toolUseID, name, input)...)
+	sc.Events = append(sc.Events, MeteringEvent(0.01))
+	return sc
+}
+
+// ThrottlingScenario 上游限流（模型容量不足）
+func ThrottlingScenario() Scenario {
+	return Scenario{
+		Name:   "throttling",
+		Status: 429,
+		Body:   `{"__type":"ThrottlingException","message":"I am experiencing high traffic, please try again shortly.","reason":"INSUFFICIENT_MODEL_CAPACITY"}`,
+	}
+}
+
+// SuspendedScenario 账号被临时封控
+func SuspendedScenario() Scenario {
+	return Scenario{
+		Name:   "suspended",
+		Status: 403,
+		Body:   `{"__type":"AccessDeniedException","message":"Your User ID temporarily is suspended.","reason":"TEMPORARILY_SUSPENDED"}`,
+	}
+}
+
+// QuotaExceededScenario 月度配额用尽
+func QuotaExceededScenario() Scenario {
+	return Scenario{
+		Name:   "quota_exceeded",
+		Status: 402,
+		Body:   `{"__type":"ServiceQuotaExceededException","message":"You have reached the limit.","reason":"MONTHLY_REQUEST_COUNT"}`,
+	}
+}
+
+// DisconnectScenario 发送部分文本后中途断开连接
+func DisconnectScenario(chunks ...string) Scenario {
+	sc := TextScenario(chunks...)
+	sc.Name = "disconnect"
+	sc.Events = sc.Events[:len(chunks)]
+	sc.DisconnectAfter = len(chunks)
+	return sc
+}
@@ -0,0 +1,312 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-api/internal/config"
+)
+
+// RecordedRequest 模拟上游收到的对话请求
+type RecordedRequest struct {
+	Target        string // X-Amz-Target 请求头
+	Authorization string // Authorization 请求头
+	Body          []byte // 请求体
+}
+
+// Server 模拟上游服务
+// 所有上游（Amazon Q、OIDC、Kiro）共用同一地址，配合 Upstream() 生成的配置使用
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	scenarios []Scenario             // 待执行的对话脚本（先进先出）
+	fallback  Scenario               // 脚本队列为空时使用的默认脚本
+	requests  []RecordedRequest      // 已收到的对话请求
+	polls     map[string]int         // 设备授权轮询次数（按 deviceCode）
+	pending   int                    // 设备授权返回 authorization_pending 的次数
+	usage     map[string]interface{} // getUsageLimits 响应
+	usageErr  *Scenario              // getUsageLimits 错误响应
+	refreshes int                    // 令牌刷新次数
+	tokenSeq  int                    // 令牌序号
+}
+
+// New 启动模拟上游服务，调用方负责 Close
+// @author ygw
+func New() *Server {
+	s := &Server{
+		fallback: TextScenario("Hello", " from mock upstream."),
+		polls:    make(map[string]int),
+		usage:    DefaultUsageLimits(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", s.handleChat)
+	mux.HandleFunc("GET /getUsageLimits", s.handleUsageLimits)
+	mux.HandleFunc("POST /client/register", s.handleRegister)
+	mux.HandleFunc("POST /device_authorization", s.handleDeviceAuthorization)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("POST /refreshToken", s.handleSocialRefresh)
+	mux.HandleFunc("HEAD /{$}", func(w http.ResponseWriter, r *http.Request) {})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Upstream 返回指向模拟上游的地址配置
+func (s *Server) Upstream() config.UpstreamConfig {
+	return config.UpstreamConfig{
+		AmazonQURL:       s.URL,
+		OIDCURL:          s.URL,
+		KiroAuthURL:      s.URL,
+		CodeWhispererURL: s.URL,
+	}
+}
+
+// Enqueue 追加对话脚本，每个对话请求按顺序消费一个
+func (s *Server) Enqueue(scenarios ...Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = append(s.scenarios, scenarios...)
+}
+
+// SetDefault 设置脚本队列为空时使用的默认脚本
+func (s *Server) SetDefault(sc Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = sc
+}
+
+// SetPendingPolls 设置设备授权轮询返回 authorization_pending 的次数（模拟用户尚未完成授权）
+func (s *Server) SetPendingPolls(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = n
+}
+
+// SetUsageLimits 设置 getUsageLimits 的响应
+func (s *Server) SetUsageLimits(usage map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = usage
+	s.usageErr = nil
+}
+
+// SetUsageError 让 getUsageLimits 返回错误（如 SuspendedScenario()），传 nil 恢复正常
+func (s *Server) SetUsageError(sc *Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usageErr = sc
+}
+
+// Requests 返回已收到的对话请求
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest(nil), s.requests...)
+}
+
+// Refreshes 返回令牌刷新次数（OIDC refresh_token 与 Kiro 社交登录刷新合计）
+func (s *Server) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// DefaultUsageLimits 默认配额响应：Pro 订阅，已用 10 / 1000
+func DefaultUsageLimits() map[string]interface{} {
+	return map[string]interface{}{
+		"userInfo":         map[string]interface{}{"email": "mock@example.com", "userId": "mock-user"},
+		"subscriptionInfo": map[string]interface{}{"subscriptionTitle": "KIRO PRO", "type": "Q_DEVELOPER_STANDALONE_PRO"},
+		"usageBreakdownList": []interface{}{map[string]interface{}{
+			"resourceType":              "AGENTIC_REQUEST",
+			"currentUsage":              10,
+			"usageLimit":                1000,
+			"currentUsageWithPrecision": 10.0,
+			"usageLimitWithPrecision":   1000.0,
+		}},
+		"daysUntilReset": 15,
+		"nextDateReset":  float64(time.Now().AddDate(0, 0, 15).Unix()),
+	}
+}
+
+// handleChat 处理 GenerateAssistantResponse：按脚本返回错误或 Event Stream 事件流
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, RecordedRequest{
+		Target:        r.Header.Get("X-Amz-Target"),
+		Authorization: r.Header.Get("Authorization"),
+		Body:          body,
+	})
+	sc := s.fallback
+	if len(s.scenarios) > 0 {
+		sc = s.scenarios[0]
+		s.scenarios = s.scenarios[1:]
+	}
+	s.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeJSON(w, 403, map[string]interface{}{"__type": "UnauthorizedException", "message": "missing bearer token"})
+		return
+	}
+	if sc.Status != 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(sc.Status)
+		io.WriteString(w, sc.Body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+	w.WriteHeader(200)
+	flusher, _ := w.(http.Flusher)
+	for i, ev := range sc.Events {
+		if sc.DisconnectAfter > 0 && i >= sc.DisconnectAfter {
+			break
+		}
+		frame, err := EncodeEvent(ev.Type, ev.Payload)
+		if err != nil {
+			return
+		}
+		if _, err := w.Write(frame); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if sc.EventDelay > 0 {
+			time.Sleep(sc.EventDelay)
+		}
+	}
+
+	if sc.DisconnectAfter > 0 {
+		// 不发送分块结束标记直接关闭连接，客户端读取时得到 unexpected EOF
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+			}
+		}
+	}
+}
+
+// handleUsageLimits 处理配额查询
+func (s *Server) handleUsageLimits(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	usage, usageErr := s.usage, s.usageErr
+	s.mu.Unlock()
+
+	if usageErr != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(usageErr.Status)
+		io.WriteString(w, usageErr.Body)
+		return
+	}
+	writeJSON(w, 200, usage)
+}
+
+// handleRegister 处理 OIDC 客户端注册
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]interface{}{
+		"clientId":              "mock-client-" + s.nextSeq(),
+		"clientSecret":          "mock-secret",
+		"clientSecretExpiresAt": time.Now().Add(90 * 24 * time.Hour).Unix(),
+	})
+}
+
+// handleDeviceAuthorization 处理设备授权
+func (s *Server) handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	seq := s.nextSeq()
+	writeJSON(w, 200, map[string]interface{}{
+		"deviceCode":              "mock-device-" + seq,
+		"userCode":                "MOCK-" + seq,
+		"verificationUri":         s.URL + "/device",
+		"verificationUriComplete": s.URL + "/device?user_code=MOCK-" + seq,
+		"interval":                1,
+		"expiresIn":               600,
+	})
+}
+
+// handleToken 处理 OIDC 令牌请求（设备码换令牌、refresh_token 刷新）
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GrantType    string `json:"grantType"`
+		DeviceCode   string `json:"deviceCode"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]interface{}{"error": "invalid_request"})
+		return
+	}
+
+	switch req.GrantType {
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		s.mu.Lock()
+		s.polls[req.DeviceCode]++
+		pending := s.polls[req.DeviceCode] <= s.pending
+		s.mu.Unlock()
+		if pending {
+			writeJSON(w, 400, map[string]interface{}{"error": "authorization_pending"})
+			return
+		}
+	case "refresh_token":
+		if req.RefreshToken == "" {
+			writeJSON(w, 400, map[string]interface{}{"error": "invalid_grant"})
+			return
+		}
+		s.mu.Lock()
+		s.refreshes++
+		s.mu.Unlock()
+	default:
+		writeJSON(w, 400, map[string]interface{}{"error": "unsupported_grant_type"})
+		return
+	}
+	s.writeTokens(w)
+}
+
+// handleSocialRefresh 处理 Kiro 社交登录令牌刷新
+func (s *Server) handleSocialRefresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		writeJSON(w, 401, map[string]interface{}{"message": "Invalid refresh token"})
+		return
+	}
+	s.mu.Lock()
+	s.refreshes++
+	s.mu.Unlock()
+	s.writeTokens(w)
+}
+
+// writeTokens 签发一组新令牌
+func (s *Server) writeTokens(w http.ResponseWriter) {
+	seq := s.nextSeq()
+	writeJSON(w, 200, map[string]interface{}{
+		"accessToken":  "mock-access-" + seq,
+		"refreshToken": "mock-refresh-" + seq,
+		"tokenType":    "Bearer",
+		"expiresIn":    3600,
+	})
+}
+
+// nextSeq 返回递增序号（用于生成唯一的客户端 ID、设备码和令牌）
+func (s *Server) nextSeq() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenSeq++
+	return fmt.Sprintf("%d", s.tokenSeq)
+}
+
+// writeJSON 写出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
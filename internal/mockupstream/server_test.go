@@ -0,0 +1,93 @@
+package mockupstream_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"claude-api/internal/amazonq"
+	"claude-api/internal/auth"
+	"claude-api/internal/config"
+	"claude-api/internal/mockupstream"
+)
+
+// collect 发送一次对话请求并收集事件流
+func collect(t *testing.T, client *amazonq.Client) ([]amazonq.EventInfo, error) {
+	t.Helper()
+	ctx := context.Background()
+	resp, err := client.SendChatRequest(ctx, "eu-central-1", "tok", "machine", "acc", map[string]interface{}{"conversationState": map[string]interface{}{}}, "")
+	if err != nil {
+		return nil, err
+	}
+	events, errs := amazonq.StreamEventGenerator(ctx, resp)
+	var out []amazonq.EventInfo
+	for ev := range events {
+		out = append(out, ev)
+	}
+	return out, <-errs
+}
+
+// TestMockUpstream 测试模拟上游的事件流脚本、错误脚本和 OIDC 设备授权流程
+func TestMockUpstream(t *testing.T) {
+	mock := mockupstream.New()
+	defer mock.Close()
+	auth.SetUpstream(mock.Upstream())
+	defer auth.SetUpstream(config.DefaultUpstream())
+
+	client := amazonq.NewClient(config.Load())
+	mock.Enqueue(
+		mockupstream.ThinkingScenario("let me think", "answer"),
+		mockupstream.ToolUseScenario("", "tool-1", "get_weather", map[string]string{"city": "Paris"}),
+		mockupstream.ThrottlingScenario(),
+		mockupstream.SuspendedScenario(),
+		mockupstream.DisconnectScenario("partial"),
+	)
+
+	events, err := collect(t, client)
+	if err != nil || len(events) != 5 || events[1].Payload["content"] != "let me think" {
+		t.Fatalf("thinking 脚本事件错误: %v %+v", err, events)
+	}
+
+	events, err = collect(t, client)
+	if err != nil || events[0].EventType != "toolUseEvent" || events[1].Payload["input"] != `{"city":"Paris"}` || events[2].Payload["stop"] != true {
+		t.Fatalf("工具调用脚本事件错误: %v %+v", err, events)
+	}
+
+	if _, err := collect(t, client); !amazonq.IsNonRetriable(err) || !strings.Contains(err.Error(), "繁忙") {
+		t.Errorf("限流脚本应返回不可重试错误, 实际 %v", err)
+	}
+	if _, err := collect(t, client); !amazonq.IsNonRetriable(err) || amazonq.IsRequestError(err) {
+		t.Errorf("封控脚本应返回可换号的不可重试错误, 实际 %v", err)
+	}
+	if events, err := collect(t, client); err == nil || len(events) != 1 {
+		t.Errorf("断流脚本应在 1 个事件后报错, 实际 %d 个事件, 错误 %v", len(events), err)
+	}
+
+	reqs := mock.Requests()
+	if len(reqs) != 5 || reqs[0].Authorization != "Bearer tok" || !strings.HasSuffix(reqs[0].Target, "GenerateAssistantResponse") {
+		t.Errorf("记录的请求错误: %+v", reqs)
+	}
+
+	// OIDC 设备授权与刷新
+	oidc := auth.NewOIDCClient(config.Load())
+	ctx := context.Background()
+	clientID, secret, err := oidc.RegisterClient(ctx, "", "machine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := oidc.DeviceAuthorize(ctx, "", "", clientID, secret, "machine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := oidc.PollToken(ctx, "", clientID, secret, dev["deviceCode"].(string), "machine", 1, 60)
+	if err != nil || tokens["accessToken"] == "" {
+		t.Fatalf("设备授权轮询失败: %v", err)
+	}
+	if _, _, err := oidc.RefreshAccessToken(ctx, "", clientID, secret, tokens["refreshToken"].(string), "machine"); err != nil || mock.Refreshes() != 1 {
+		t.Errorf("令牌刷新失败: %v, 次数 %d", err, mock.Refreshes())
+	}
+
+	if quota, err := client.GetUsageLimits(ctx, "", "tok", "machine", ""); err != nil || quota["usageBreakdownList"] == nil {
+		t.Errorf("配额查询失败: %v", err)
+	}
+}
@@ -29,6 +29,9 @@ type Account struct {
 	Email             *string         `gorm:"size:255;index" json:"email"`
 	AuthMethod        *string         `gorm:"column:auth_method;size:50" json:"auth_method"`
 	Region            *string         `gorm:"size:50;default:'us-east-1'" json:"region"`
+	StartURL          *string         `gorm:"column:start_url;size:255" json:"start_url"`    // IdC 起始地址，为空时使用 Builder ID
+	ProxyID           *int64          `gorm:"column:proxy_id;index" json:"proxy_id"`         // 显式绑定的代理 ID，为空时按代理池策略选择
+	StickyProxyID     *int64          `gorm:"column:sticky_proxy_id" json:"sticky_proxy_id"` // 粘性策略首次分配的代理 ID（该代理被摘除后重新分配）
 	MachineID         *string         `gorm:"column:machine_id;size:64" json:"machine_id"`
 	Password          *string         `gorm:"column:password;size:255" json:"password"`
 	Username          *string         `gorm:"column:username;size:255" json:"username"`
@@ -37,7 +40,8 @@ type Account struct {
 	UsageLimit        float64         `gorm:"column:usage_limit;default:0" json:"usage_limit"`
 	SubscriptionType  *string         `gorm:"column:subscription_type;size:50" json:"subscription_type"`
 	QuotaRefreshedAt  *string         `gorm:"column:quota_refreshed_at;size:50" json:"quota_refreshed_at"`
-	TokenExpiry       *int64          `gorm:"column:token_expiry" json:"token_expiry"` // 有效时间（Unix时间戳）@author ygw
+	TokenExpiry       *int64          `gorm:"column:token_expiry" json:"token_expiry"` // 访问令牌过期时间（Unix时间戳），由刷新响应的 expiresIn 计算，为空时按上次刷新时间估算 @author ygw
+	TrialExpiry       *int64          `gorm:"column:trial_expiry" json:"trial_expiry"` // 免费试用到期时间（Unix时间戳），由配额查询的 freeTrialExpiry 更新
 }
 
 // TableName 指定表名
@@ -69,6 +73,8 @@ type AccountUpdate struct {
 	Email        *string                `json:"email"`
 	AuthMethod   *string                `json:"authMethod"`
 	Region       *string                `json:"region"`
+	StartURL     *string                `json:"startUrl"`
+	ProxyID      *int64                 `json:"proxyId"` // 0 表示解除绑定
 	QUserID      *string                `json:"qUserId"`
 	MachineID    *string                `json:"machineId"`
 }
@@ -89,6 +95,8 @@ type DirectImportAccount struct {
 	Password     *string `json:"password"`
 	Username     *string `json:"username"`
 	AddedTime    *string `json:"added_time"`
+	Region       *string `json:"region"`
+	StartURL     *string `json:"startUrl"`
 }
 
 // DirectImportRequest 直接导入账号请求（支持批量）
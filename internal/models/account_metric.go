@@ -0,0 +1,22 @@
+package models
+
+// AccountMetric 账号指标小时快照（请求计数、耗时、token 与配额）
+// 与 Account 上的累计计数不同，重置账号统计不会清除历史快照
+// @author ygw
+type AccountMetric struct {
+	ID           int64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID    string   `gorm:"column:account_id;size:36;not null;uniqueIndex:idx_account_metric_bucket" json:"account_id"`
+	BucketStart  int64    `gorm:"column:bucket_start;not null;uniqueIndex:idx_account_metric_bucket;index" json:"bucket_start"` // 小时分桶起始 Unix 秒
+	Requests     int64    `gorm:"column:requests;default:0" json:"requests"`
+	Errors       int64    `gorm:"column:error_count;default:0" json:"error_count"`
+	LatencyMsSum int64    `gorm:"column:latency_ms_sum;default:0" json:"latency_ms_sum"`
+	InputTokens  int64    `gorm:"column:input_tokens;default:0" json:"input_tokens"`
+	OutputTokens int64    `gorm:"column:output_tokens;default:0" json:"output_tokens"`
+	UsageCurrent *float64 `gorm:"column:usage_current" json:"usage_current,omitempty"` // 分桶内最后一次配额快照
+	UsageLimit   *float64 `gorm:"column:usage_limit" json:"usage_limit,omitempty"`
+}
+
+// TableName 指定表名
+func (AccountMetric) TableName() string {
+	return "account_metrics"
+}
@@ -0,0 +1,26 @@
+package models
+
+// PayloadCapture 请求载荷采集记录（ID 由服务端生成，通过 LogID 关联 RequestLog.ID）
+// 三段载荷均为 gzip 压缩后的内容，入站请求和 Amazon Q 载荷已脱敏
+// @author ygw
+type PayloadCapture struct {
+	ID                string  `gorm:"primaryKey;size:36" json:"id"`
+	LogID             string  `gorm:"column:log_id;size:36;index" json:"log_id"`
+	CreatedAt         string  `gorm:"column:created_at;size:50;index" json:"created_at"`
+	Path              string  `gorm:"size:255" json:"path"`
+	UserID            *string `gorm:"column:user_id;size:36;index" json:"user_id,omitempty"`
+	AccountID         *string `gorm:"column:account_id;size:36" json:"account_id,omitempty"`
+	Model             *string `gorm:"size:100" json:"model,omitempty"`
+	Reason            string  `gorm:"size:20" json:"reason"` // user / sampled
+	InboundRequest    []byte  `gorm:"column:inbound_request" json:"-"`
+	AmazonQPayload    []byte  `gorm:"column:amazonq_payload" json:"-"`
+	UpstreamEvents    []byte  `gorm:"column:upstream_events" json:"-"`
+	OriginalSize      int64   `gorm:"column:original_size;default:0" json:"original_size"`
+	CompressedSize    int64   `gorm:"column:compressed_size;default:0" json:"compressed_size"`
+	UpstreamTruncated bool    `gorm:"column:upstream_truncated;default:false" json:"upstream_truncated"`
+}
+
+// TableName 指定表名
+func (PayloadCapture) TableName() string {
+	return "payload_captures"
+}
@@ -0,0 +1,40 @@
+package models
+
+// CoordCounter 多实例共享计数器（限流窗口桶、轮询索引等）
+// @author ygw
+type CoordCounter struct {
+	Key       string `gorm:"column:counter_key;primaryKey;size:191" json:"key"`
+	Value     int64  `gorm:"column:value;not null;default:0" json:"value"`
+	ExpiresAt int64  `gorm:"column:expires_at;not null;default:0;index" json:"expires_at"` // Unix 毫秒，0 表示不过期
+}
+
+// TableName 指定表名
+func (CoordCounter) TableName() string {
+	return "coord_counters"
+}
+
+// CoordLock 多实例分布式锁
+// @author ygw
+type CoordLock struct {
+	Name      string `gorm:"column:lock_name;primaryKey;size:191" json:"name"`
+	Owner     string `gorm:"column:owner;size:64;not null" json:"owner"`
+	ExpiresAt int64  `gorm:"column:expires_at;not null;index" json:"expires_at"` // Unix 毫秒
+}
+
+// TableName 指定表名
+func (CoordLock) TableName() string {
+	return "coord_locks"
+}
+
+// CoordPresence 多实例共享的在线成员（如在线 IP）
+// @author ygw
+type CoordPresence struct {
+	Group    string `gorm:"column:group_name;primaryKey;size:64" json:"group"`
+	Member   string `gorm:"column:member;primaryKey;size:128" json:"member"`
+	LastSeen int64  `gorm:"column:last_seen;not null;index" json:"last_seen"` // Unix 毫秒
+}
+
+// TableName 指定表名
+func (CoordPresence) TableName() string {
+	return "coord_presence"
+}
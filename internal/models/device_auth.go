@@ -0,0 +1,50 @@
+package models
+
+// 设备授权会话状态
+const (
+	DeviceAuthPending   = "pending"   // 等待用户授权
+	DeviceAuthCreating  = "creating"  // 已授权，正在创建账号
+	DeviceAuthCompleted = "completed" // 已授权并创建账号
+	DeviceAuthTimeout   = "timeout"   // 设备码已过期
+	DeviceAuthError     = "error"     // 授权失败
+	DeviceAuthCancelled = "cancelled" // 已取消
+)
+
+// DeviceAuthSession 批量添加账号的 OIDC 设备授权会话（持久化，重启后继续轮询）
+// @author ygw
+type DeviceAuthSession struct {
+	ID                      string  `gorm:"primaryKey;size:36" json:"id"`
+	BatchID                 string  `gorm:"column:batch_id;size:36;index" json:"batch_id"`                               // 批次 ID
+	ClientID                string  `gorm:"column:client_id;size:255" json:"-"`                                          // OIDC 客户端 ID
+	ClientSecret            string  `gorm:"column:client_secret;type:text" json:"-"`                                     // OIDC 客户端密钥
+	DeviceCode              string  `gorm:"column:device_code;type:text" json:"-"`                                       // 设备码
+	UserCode                string  `gorm:"column:user_code;size:50" json:"user_code"`                                   // 用户码
+	VerificationURIComplete string  `gorm:"column:verification_uri_complete;type:text" json:"verification_uri_complete"` // 授权地址（含用户码）
+	Interval                int     `gorm:"column:poll_interval" json:"interval"`                                        // 轮询间隔（秒）
+	ExpiresAt               string  `gorm:"column:expires_at;size:50" json:"expires_at"`                                 // 设备码过期时间
+	Label                   *string `gorm:"column:label;size:255" json:"label"`                                          // 创建账号的标签
+	Enabled                 bool    `gorm:"column:enabled;default:true" json:"enabled"`                                  // 创建账号是否启用
+	Status                  string  `gorm:"column:status;size:20;index" json:"status"`                                   // pending/creating/completed/timeout/error/cancelled
+	Error                   *string `gorm:"column:error;type:text" json:"error"`                                         // 失败原因
+	AccountID               *string `gorm:"column:account_id;size:36" json:"account_id"`                                 // 创建的账号 ID
+	MachineID               string  `gorm:"column:machine_id;size:64" json:"-"`                                          // Kiro 设备标识
+	Region                  string  `gorm:"column:region;size:50" json:"region"`                                         // 授权所在区域
+	StartURL                string  `gorm:"column:start_url;size:255" json:"start_url"`                                  // IdC 起始地址
+	CreatedAt               string  `gorm:"column:created_at;size:50" json:"created_at"`
+	UpdatedAt               string  `gorm:"column:updated_at;size:50" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DeviceAuthSession) TableName() string {
+	return "device_auth_sessions"
+}
+
+// DeviceAuthBatchCreate 批量发起设备授权请求
+// @author ygw
+type DeviceAuthBatchCreate struct {
+	Count       int     `json:"count" binding:"required"` // 发起的设备授权数量
+	LabelPrefix *string `json:"labelPrefix"`              // 账号标签前缀，创建的账号标签为 "前缀 #序号"
+	Enabled     *bool   `json:"enabled"`
+	Region      string  `json:"region"`
+	StartURL    string  `json:"startUrl"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "strings"
+
+// NotifyChannel 通知渠道配置
+// @author ygw
+type NotifyChannel struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string `gorm:"column:name;size:100" json:"name"`                 // 渠道名称
+	Type      string `gorm:"column:type;size:20;not null" json:"type"`         // webhook/slack/dingtalk/feishu/telegram
+	URL       string `gorm:"column:url;type:text" json:"url"`                  // 投递地址（telegram 可留空使用官方 API）
+	Secret    string `gorm:"column:secret;type:text" json:"secret,omitempty"`  // 签名密钥（telegram 为 bot token）
+	ChatID    string `gorm:"column:chat_id;size:100" json:"chat_id,omitempty"` // telegram 会话 ID
+	Events    string `gorm:"column:events;type:text" json:"events"`            // 订阅的事件类型（逗号分隔，空表示全部）
+	Enabled   bool   `gorm:"column:enabled;default:true" json:"enabled"`       // 是否启用
+	CreatedAt string `gorm:"column:created_at;size:50" json:"created_at"`
+	UpdatedAt string `gorm:"column:updated_at;size:50" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (NotifyChannel) TableName() string {
+	return "notify_channels"
+}
+
+// Subscribes 判断渠道是否订阅了指定事件类型
+func (c *NotifyChannel) Subscribes(eventType string) bool {
+	if strings.TrimSpace(c.Events) == "" {
+		return true
+	}
+	for _, e := range strings.Split(c.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyChannelCreate 创建通知渠道请求
+// @author ygw
+type NotifyChannelCreate struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type" binding:"required"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret"`
+	ChatID  string   `json:"chat_id"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// NotifyChannelUpdate 更新通知渠道请求
+// @author ygw
+type NotifyChannelUpdate struct {
+	Name    *string   `json:"name"`
+	Type    *string   `json:"type"`
+	URL     *string   `json:"url"`
+	Secret  *string   `json:"secret"`
+	ChatID  *string   `json:"chat_id"`
+	Events  *[]string `json:"events"`
+	Enabled *bool     `json:"enabled"`
+}
@@ -10,6 +10,8 @@ type Proxy struct {
 	Weight    int    `gorm:"column:weight;default:1" json:"weight"`      // 权重（用于加权轮换）
 	CreatedAt string `gorm:"column:created_at;size:50" json:"created_at"`
 	UpdatedAt string `gorm:"column:updated_at;size:50" json:"updated_at"`
+
+	SubscriptionID *int64 `gorm:"column:subscription_id;index" json:"subscription_id,omitempty"` // 来源订阅 ID，手动添加的代理为空
 }
 
 // TableName 指定表名
@@ -17,6 +19,30 @@ func (Proxy) TableName() string {
 	return "proxies"
 }
 
+// ProxySubscription 代理订阅源：定期拉取代理列表并与代理表同步
+// @author ygw
+type ProxySubscription struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string `gorm:"column:name;size:100" json:"name"`                           // 订阅名称（同步的代理以此命名）
+	Source      string `gorm:"column:source;type:text;not null" json:"source"`             // 订阅地址（http/https URL，或订阅文件目录内的文件路径）
+	Scheme      string `gorm:"column:scheme;size:20" json:"scheme"`                        // 列表中未写协议的行使用的协议
+	Interval    int    `gorm:"column:interval_minutes;default:60" json:"interval_minutes"` // 同步间隔（分钟）
+	Enabled     bool   `gorm:"column:enabled;default:true" json:"enabled"`                 // 是否启用
+	LastSyncAt  string `gorm:"column:last_sync_at;size:50" json:"last_sync_at"`            // 最近同步时间
+	LastError   string `gorm:"column:last_error;type:text" json:"last_error"`              // 最近同步错误
+	LastAdded   int    `gorm:"column:last_added" json:"last_added"`                        // 最近同步新增数
+	LastRemoved int    `gorm:"column:last_removed" json:"last_removed"`                    // 最近同步移除数
+	LastKept    int    `gorm:"column:last_kept" json:"last_kept"`                          // 最近同步保留数
+	LastInvalid int    `gorm:"column:last_invalid" json:"last_invalid"`                    // 最近同步无效行数
+	CreatedAt   string `gorm:"column:created_at;size:50" json:"created_at"`
+	UpdatedAt   string `gorm:"column:updated_at;size:50" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ProxySubscription) TableName() string {
+	return "proxy_subscriptions"
+}
+
 // ProxyCreate 创建代理请求
 // @author ygw
 type ProxyCreate struct {
@@ -34,3 +60,33 @@ type ProxyUpdate struct {
 	Enabled *bool   `json:"enabled"`
 	Weight  *int    `json:"weight"`
 }
+
+// ProxyImport 批量导入代理请求
+// @author ygw
+type ProxyImport struct {
+	Text    string `json:"text" binding:"required"` // 代理列表（换行分隔）
+	Scheme  string `json:"scheme"`                  // 未写协议的行使用的协议，默认 http
+	Name    string `json:"name"`                    // 代理名称（可选）
+	Enabled *bool  `json:"enabled"`
+	Weight  *int   `json:"weight"`
+}
+
+// ProxySubscriptionCreate 创建代理订阅请求
+// @author ygw
+type ProxySubscriptionCreate struct {
+	Name     string `json:"name"`
+	Source   string `json:"source" binding:"required"`
+	Scheme   string `json:"scheme"`
+	Interval *int   `json:"interval_minutes"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// ProxySubscriptionUpdate 更新代理订阅请求
+// @author ygw
+type ProxySubscriptionUpdate struct {
+	Name     *string `json:"name"`
+	Source   *string `json:"source"`
+	Scheme   *string `json:"scheme"`
+	Interval *int    `json:"interval_minutes"`
+	Enabled  *bool   `json:"enabled"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// 用量报表分组维度
+const (
+	ReportGroupUser  = "user"
+	ReportGroupModel = "model"
+	ReportGroupDay   = "day"
+	ReportGroupMonth = "month"
+)
+
+// 用量报表数据来源
+const (
+	ReportSourceLogs  = "logs"  // request_logs：支持按模型分组和时区，受日志保留天数限制
+	ReportSourceUsage = "usage" // user_token_usage：长期保留，按服务器本地日期统计，不含模型
+)
+
+// UsageReportRow 用量报表的一行聚合结果
+// 未参与分组的维度字段为空
+type UsageReportRow struct {
+	Day          string  `json:"day,omitempty"`   // YYYY-MM-DD
+	Month        string  `json:"month,omitempty"` // YYYY-MM
+	UserID       string  `json:"user_id,omitempty"`
+	UserName     string  `json:"user_name,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Requests     int64   `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	TotalTokens  int64   `json:"total_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
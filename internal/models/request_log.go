@@ -4,6 +4,7 @@ package models
 // 注意：移除了 not null 约束以兼容旧数据迁移
 type RequestLog struct {
 	ID            string  `gorm:"primaryKey;size:36" json:"id"`
+	RequestID     *string `gorm:"column:request_id;size:36;index" json:"request_id,omitempty"` // x-request-id（可由客户端传入，仅用于关联）
 	Timestamp     string  `gorm:"size:50;index:idx_logs_timestamp;index:idx_logs_ip_time,priority:2;index:idx_logs_account_time,priority:2;index:idx_logs_endpoint,priority:2;index:idx_logs_success,priority:2" json:"timestamp"`
 	ClientIP      string  `gorm:"column:client_ip;size:45;index:idx_logs_ip_time,priority:1" json:"client_ip"`
 	Method        string  `gorm:"size:10" json:"method"`
@@ -22,10 +23,16 @@ type RequestLog struct {
 	DurationMs    int64   `gorm:"column:duration_ms" json:"duration_ms"`
 	ErrorMessage  *string `gorm:"column:error_message;type:text" json:"error_message,omitempty"`
 	UserAgent     *string `gorm:"column:user_agent;size:500" json:"user_agent,omitempty"`
+	// 上下文压缩结果（未压缩时为零值）
+	OriginalInputTokens   int     `gorm:"column:original_input_tokens;default:0" json:"original_input_tokens,omitempty"` // 压缩前的输入 token
+	SummaryBlocks         int     `gorm:"column:summary_blocks;default:0" json:"summary_blocks,omitempty"`
+	CompressionCacheHit   bool    `gorm:"column:compression_cache_hit;default:false" json:"compression_cache_hit,omitempty"`
+	CompressionStrategies *string `gorm:"column:compression_strategies;size:255" json:"compression_strategies,omitempty"` // 实际生效的策略
 	CostUSD       float64 `gorm:"-" json:"cost_usd"` // 美元成本（不存储到数据库，动态计算）
 	// 用户归属信息（不存储到数据库，动态查询）
 	UserName     *string `gorm:"-" json:"user_name,omitempty"`     // 用户名
 	UserType     *string `gorm:"-" json:"user_type,omitempty"`     // 用户类型：admin/vip/normal
+	HasCapture   bool    `gorm:"-" json:"has_capture"`             // 是否有载荷采集（可查看与重放）
 }
 
 // CalculateCost 计算请求的美元成本
@@ -97,6 +104,7 @@ type VisitorIP struct {
 	// IP配置信息（从ip_configs表关联）
 	Notes             *string `json:"notes,omitempty"`              // 备注
 	RateLimitRPM      int     `json:"rate_limit_rpm"`               // 每分钟请求频率限制，0表示不限制
+	RateLimitTPM      int     `json:"rate_limit_tpm"`               // 每分钟 token 限制，0表示不限制
 	DailyRequestLimit int     `json:"daily_request_limit"`          // 每日请求次数限制，0表示不限制
 }
 
@@ -106,6 +114,7 @@ type IPConfig struct {
 	IP                string  `gorm:"primaryKey;size:45" json:"ip"`
 	Notes             *string `gorm:"type:text" json:"notes,omitempty"`                  // 备注
 	RateLimitRPM      int     `gorm:"default:0" json:"rate_limit_rpm"`                   // 每分钟请求频率限制，0表示不限制
+	RateLimitTPM      int     `gorm:"default:0" json:"rate_limit_tpm"`                   // 每分钟 token 限制，0表示不限制
 	DailyRequestLimit int     `gorm:"default:0" json:"daily_request_limit"`              // 每日请求次数限制，0表示不限制
 	CreatedAt         string  `gorm:"column:created_at;size:50;not null" json:"created_at"`
 	UpdatedAt         string  `gorm:"column:updated_at;size:50;not null" json:"updated_at"`
@@ -120,6 +129,7 @@ func (IPConfig) TableName() string {
 type IPConfigUpdate struct {
 	Notes             *string `json:"notes"`
 	RateLimitRPM      *int    `json:"rate_limit_rpm"`
+	RateLimitTPM      *int    `json:"rate_limit_tpm"`
 	DailyRequestLimit *int    `json:"daily_request_limit"`
 }
 
@@ -52,6 +52,9 @@ type Settings struct {
 	// 智能压缩相关配置
 	CompressionEnabled bool   `json:"compressionEnabled"` // 是否启用智能压缩
 	CompressionModel   string `json:"compressionModel"`   // 压缩使用的模型
+	// 压缩策略链（按顺序执行，为空时只使用 LLM 摘要），按模型覆盖时键为模型名子串
+	CompressionStrategies      []string            `json:"compressionStrategies"`
+	CompressionModelStrategies map[string][]string `json:"compressionModelStrategies"`
 	// 公告配置
 	AnnouncementEnabled bool   `json:"announcementEnabled"` // 是否启用公告
 	AnnouncementText    string `json:"announcementText"`    // 公告内容
@@ -61,6 +64,15 @@ type Settings struct {
 	// 性能优化配置（合并了配额刷新和状态检查）
 	QuotaRefreshConcurrency int `json:"quotaRefreshConcurrency"` // 配额刷新并发数 (1-50)
 	QuotaRefreshInterval    int `json:"quotaRefreshInterval"`    // 配额刷新间隔（秒，60-600）
+	// 载荷采集配置（用户单独开启的采集不受采样率影响）
+	CaptureSampleRate   float64  `json:"captureSampleRate"`   // 全局采样率 (0-1)，0 表示关闭
+	CaptureRedactImages bool     `json:"captureRedactImages"` // 是否将图片替换为占位符
+	CaptureRedactKeys   []string `json:"captureRedactKeys"`   // 额外脱敏的 JSON 字段名
+	// 通知配置（渠道在 /v2/notifications/channels 管理）
+	NotifyMinValidAccounts int `json:"notifyMinValidAccounts"` // 正常账号数低于该值时告警，0 表示关闭
+	NotifyDedupMinutes     int `json:"notifyDedupMinutes"`     // 相同事件的去重窗口（分钟）
+	// 全局每分钟 token 限制（所有请求合计），0 表示不限制
+	GlobalRateLimitTPM int `json:"globalRateLimitTPM"`
 }
 
 // SettingsUpdate 表示更新设置的数据
@@ -84,8 +96,10 @@ type SettingsUpdate struct {
 	ProxyPoolEnabled  *bool   `json:"proxyPoolEnabled"`
 	ProxyPoolStrategy *string `json:"proxyPoolStrategy"`
 	// 智能压缩相关配置
-	CompressionEnabled *bool   `json:"compressionEnabled"`
-	CompressionModel   *string `json:"compressionModel"`
+	CompressionEnabled         *bool                `json:"compressionEnabled"`
+	CompressionModel           *string              `json:"compressionModel"`
+	CompressionStrategies      *[]string            `json:"compressionStrategies"`
+	CompressionModelStrategies *map[string][]string `json:"compressionModelStrategies"`
 	// 公告配置
 	AnnouncementEnabled *bool   `json:"announcementEnabled"`
 	AnnouncementText    *string `json:"announcementText"`
@@ -95,6 +109,15 @@ type SettingsUpdate struct {
 	// 性能优化配置（合并了配额刷新和状态检查）
 	QuotaRefreshConcurrency *int `json:"quotaRefreshConcurrency"`
 	QuotaRefreshInterval    *int `json:"quotaRefreshInterval"`
+	// 载荷采集配置
+	CaptureSampleRate   *float64  `json:"captureSampleRate"`
+	CaptureRedactImages *bool     `json:"captureRedactImages"`
+	CaptureRedactKeys   *[]string `json:"captureRedactKeys"`
+	// 通知配置
+	NotifyMinValidAccounts *int `json:"notifyMinValidAccounts"`
+	NotifyDedupMinutes     *int `json:"notifyDedupMinutes"`
+	// 全局 token 限流
+	GlobalRateLimitTPM *int `json:"globalRateLimitTPM"`
 }
 
 // 支持的压缩模型列表
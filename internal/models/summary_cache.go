@@ -0,0 +1,17 @@
+package models
+
+// SummaryCacheEntry 上下文压缩摘要缓存（数据库存储，多实例共享）
+// Data 为完整的 ConversationCache JSON，其余字段用于构建内存索引
+// @author ygw
+type SummaryCacheEntry struct {
+	PrefixHash         string `gorm:"column:prefix_hash;primaryKey;size:64" json:"prefix_hash"`
+	TotalCompressedMsg int    `gorm:"column:total_compressed_msg;not null;default:0" json:"total_compressed_msg"`
+	BlockIDs           string `gorm:"column:block_ids;type:text" json:"block_ids"` // 摘要块 ID 列表（JSON 数组）
+	Data               []byte `gorm:"column:data" json:"-"`
+	UpdatedAt          int64  `gorm:"column:updated_at;not null;index" json:"updated_at"` // Unix 毫秒
+}
+
+// TableName 指定表名
+func (SummaryCacheEntry) TableName() string {
+	return "summary_caches"
+}
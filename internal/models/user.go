@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // User 表示系统用户
 // @author ygw
 type User struct {
@@ -13,14 +15,20 @@ type User struct {
 	IsVip            bool    `gorm:"column:is_vip;default:false" json:"is_vip"` // VIP用户标识 @author ygw
 	DailyQuota       int     `gorm:"column:daily_quota;default:0" json:"daily_quota"`
 	MonthlyQuota     int     `gorm:"column:monthly_quota;default:0" json:"monthly_quota"`
-	RequestQuota     int     `gorm:"column:request_quota;default:0" json:"request_quota"`         // 每日请求次数限制，0表示不限制 @author ygw
-	RateLimitRPM     int     `gorm:"column:rate_limit_rpm;default:0" json:"rate_limit_rpm"`       // 每分钟请求频率限制，0表示不限制 @author ygw
+	RequestQuota     int     `gorm:"column:request_quota;default:0" json:"request_quota"`           // 每日请求次数限制，0表示不限制 @author ygw
+	RateLimitRPM     int     `gorm:"column:rate_limit_rpm;default:0" json:"rate_limit_rpm"`         // 每分钟请求频率限制，0表示不限制 @author ygw
+	RateLimitTPM     int     `gorm:"column:rate_limit_tpm;default:0" json:"rate_limit_tpm"`         // 每分钟 token 限制（输入+输出），0表示不限制
+	DailyBudgetUSD   float64 `gorm:"column:daily_budget_usd;default:0" json:"daily_budget_usd"`     // 每日消费预算（美元），0表示不限制
+	MonthlyBudgetUSD float64 `gorm:"column:monthly_budget_usd;default:0" json:"monthly_budget_usd"` // 月度消费预算（美元），0表示不限制
 	TotalTokensUsed  int64   `gorm:"column:total_tokens_used;default:0" json:"total_tokens_used"`
-	TotalRequests    int64   `gorm:"column:total_requests;default:0" json:"total_requests"`       // 总请求次数 @author ygw
-	TotalCostUSD     float64 `gorm:"column:total_cost_usd;default:0" json:"total_cost_usd"`       // 总消费金额（美元）@author ygw
+	TotalRequests    int64   `gorm:"column:total_requests;default:0" json:"total_requests"` // 总请求次数 @author ygw
+	TotalCostUSD     float64 `gorm:"column:total_cost_usd;default:0" json:"total_cost_usd"` // 总消费金额（美元）@author ygw
 	LastResetDaily   *string `gorm:"column:last_reset_daily;size:50" json:"last_reset_daily,omitempty"`
 	LastResetMonthly *string `gorm:"column:last_reset_monthly;size:50" json:"last_reset_monthly,omitempty"`
 	Notes            *string `gorm:"type:text" json:"notes,omitempty"`
+	CapturePayloads  bool    `gorm:"column:capture_payloads;default:false" json:"capture_payloads"` // 是否采集该用户的请求载荷（用于排查与重放）
+	// 压缩策略链（逗号分隔，为空时使用系统设置）
+	CompressionStrategies string `gorm:"column:compression_strategies;size:255" json:"compression_strategies"`
 }
 
 // TableName 指定表名
@@ -35,11 +43,61 @@ type UserCreate struct {
 	Email        *string `json:"email"`
 	DailyQuota   *int    `json:"daily_quota"`
 	MonthlyQuota *int    `json:"monthly_quota"`
-	RequestQuota *int    `json:"request_quota"` // 每日请求次数限制 @author ygw
+	RequestQuota *int    `json:"request_quota"`  // 每日请求次数限制 @author ygw
 	RateLimitRPM *int    `json:"rate_limit_rpm"` // 每分钟请求频率限制 @author ygw
+	RateLimitTPM *int    `json:"rate_limit_tpm"` // 每分钟 token 限制
 	Enabled      *bool   `json:"enabled"`
 	IsVip        *bool   `json:"is_vip"` // VIP用户标识 @author ygw
 	Notes        *string `json:"notes"`
+	// 每日 / 月度消费预算（美元）
+	DailyBudgetUSD   *float64 `json:"daily_budget_usd"`
+	MonthlyBudgetUSD *float64 `json:"monthly_budget_usd"`
+}
+
+// NewUser 根据创建请求构造用户：默认启用，未设置的配额、限制和预算为 0（不限制）
+// @param id 用户 ID
+// @param apiKey 生成的 API key
+// @author ygw
+func NewUser(id, apiKey string, req *UserCreate) *User {
+	now := time.Now().Format(time.RFC3339)
+	user := &User{
+		ID:        id,
+		Name:      req.Name,
+		Email:     req.Email,
+		APIKey:    apiKey,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Enabled:   true,
+		Notes:     req.Notes,
+	}
+	if req.Enabled != nil {
+		user.Enabled = *req.Enabled
+	}
+	if req.IsVip != nil {
+		user.IsVip = *req.IsVip
+	}
+	if req.DailyQuota != nil {
+		user.DailyQuota = *req.DailyQuota
+	}
+	if req.MonthlyQuota != nil {
+		user.MonthlyQuota = *req.MonthlyQuota
+	}
+	if req.RequestQuota != nil {
+		user.RequestQuota = *req.RequestQuota
+	}
+	if req.RateLimitRPM != nil {
+		user.RateLimitRPM = *req.RateLimitRPM
+	}
+	if req.RateLimitTPM != nil {
+		user.RateLimitTPM = *req.RateLimitTPM
+	}
+	if req.DailyBudgetUSD != nil {
+		user.DailyBudgetUSD = *req.DailyBudgetUSD
+	}
+	if req.MonthlyBudgetUSD != nil {
+		user.MonthlyBudgetUSD = *req.MonthlyBudgetUSD
+	}
+	return user
 }
 
 // UserUpdate 表示更新用户的请求体
@@ -49,11 +107,19 @@ type UserUpdate struct {
 	Email        *string `json:"email"`
 	DailyQuota   *int    `json:"daily_quota"`
 	MonthlyQuota *int    `json:"monthly_quota"`
-	RequestQuota *int    `json:"request_quota"` // 每日请求次数限制 @author ygw
+	RequestQuota *int    `json:"request_quota"`  // 每日请求次数限制 @author ygw
 	RateLimitRPM *int    `json:"rate_limit_rpm"` // 每分钟请求频率限制 @author ygw
+	RateLimitTPM *int    `json:"rate_limit_tpm"` // 每分钟 token 限制
 	Enabled      *bool   `json:"enabled"`
 	IsVip        *bool   `json:"is_vip"` // VIP用户标识 @author ygw
 	Notes        *string `json:"notes"`
+	// 是否采集请求载荷
+	CapturePayloads *bool `json:"capture_payloads"`
+	// 压缩策略链（逗号分隔，空字符串表示使用系统设置）
+	CompressionStrategies *string `json:"compression_strategies"`
+	// 每日 / 月度消费预算（美元），0 表示不限制
+	DailyBudgetUSD   *float64 `json:"daily_budget_usd"`
+	MonthlyBudgetUSD *float64 `json:"monthly_budget_usd"`
 }
 
 // UserTokenUsage 表示用户每日 Token 使用量
@@ -67,6 +133,37 @@ type UserTokenUsage struct {
 	RequestCount int64  `gorm:"column:request_count;default:0" json:"request_count"`
 }
 
+// UserQuotaUsage 用户当前配额周期内的用量（用于配额检查和限流响应头）
+type UserQuotaUsage struct {
+	DailyRequests  int64   // 今日请求次数
+	DailyTokens    int64   // 今日 token 用量
+	MonthlyTokens  int64   // 本月 token 用量
+	DailyCostUSD   float64 // 当前每日预算周期内的消费（美元）
+	MonthlyCostUSD float64 // 当前月度预算周期内的消费（美元）
+}
+
+// 消费累计周期
+const (
+	SpendPeriodDaily   = "daily"
+	SpendPeriodMonthly = "monthly"
+)
+
+// UserSpend 用户在一个预算周期内的消费累计
+// 周期按预算时区和月度重置日划分，每个请求结束后累加其美元成本
+type UserSpend struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      string     `gorm:"column:user_id;size:36;not null;uniqueIndex:idx_user_spend_period" json:"user_id"`
+	Period      string     `gorm:"size:10;not null;uniqueIndex:idx_user_spend_period" json:"period"`                           // daily / monthly
+	PeriodStart string     `gorm:"column:period_start;size:10;not null;uniqueIndex:idx_user_spend_period" json:"period_start"` // 周期起始日期 YYYY-MM-DD（预算时区）
+	CostUSD     float64    `gorm:"column:cost_usd;default:0" json:"cost_usd"`
+	WarnedAt    *time.Time `gorm:"column:warned_at" json:"warned_at,omitempty"` // 本周期已发送预算预警的时间，每个周期只预警一次
+}
+
+// TableName 指定表名
+func (UserSpend) TableName() string {
+	return "user_spend"
+}
+
 // TableName 指定表名
 func (UserTokenUsage) TableName() string {
 	return "user_token_usage"
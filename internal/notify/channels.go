@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-api/internal/models"
+)
+
+// 渠道类型
+const (
+	ChannelWebhook  = "webhook"  // 通用 Webhook（HMAC-SHA256 签名）
+	ChannelSlack    = "slack"    // Slack Incoming Webhook
+	ChannelDingTalk = "dingtalk" // 钉钉自定义机器人
+	ChannelFeishu   = "feishu"   // 飞书自定义机器人
+	ChannelTelegram = "telegram" // Telegram Bot
+)
+
+// 通用 Webhook 签名请求头
+const (
+	HeaderSignature = "X-Signature-256"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderEvent     = "X-Event-Type"
+)
+
+// TelegramAPIBase Telegram Bot API 地址（渠道 URL 为空时使用）
+const TelegramAPIBase = "https://api.telegram.org"
+
+// ValidChannelType 判断渠道类型是否支持
+func ValidChannelType(t string) bool {
+	switch t {
+	case ChannelWebhook, ChannelSlack, ChannelDingTalk, ChannelFeishu, ChannelTelegram:
+		return true
+	}
+	return false
+}
+
+// Sign 计算通用 Webhook 签名：hex(HMAC-SHA256(secret, timestamp + "." + body))
+// 接收方使用相同算法校验 X-Signature-256 请求头（格式为 "sha256=<hex>"）
+// @param secret 签名密钥
+// @param timestamp Unix 秒级时间戳
+// @param body 请求体
+// @return string 签名
+// @author ygw
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildRequest 按渠道类型构造 HTTP 请求
+func buildRequest(ctx context.Context, ch *models.NotifyChannel, ev Event, now time.Time) (*http.Request, error) {
+	var (
+		target = ch.URL
+		body   []byte
+		err    error
+	)
+
+	switch ch.Type {
+	case ChannelWebhook:
+		body, err = json.Marshal(ev)
+	case ChannelSlack:
+		body, err = json.Marshal(map[string]string{"text": FormatText(ev)})
+	case ChannelDingTalk:
+		body, err = json.Marshal(map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": ev.Title,
+				"text":  formatMarkdown(ev),
+			},
+		})
+		if ch.Secret != "" {
+			target, err = dingTalkSignedURL(ch.URL, ch.Secret, now)
+		}
+	case ChannelFeishu:
+		payload := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": FormatText(ev)},
+		}
+		if ch.Secret != "" {
+			ts := strconv.FormatInt(now.Unix(), 10)
+			payload["timestamp"] = ts
+			payload["sign"] = feishuSign(ch.Secret, ts)
+		}
+		body, err = json.Marshal(payload)
+	case ChannelTelegram:
+		base := strings.TrimRight(ch.URL, "/")
+		if base == "" {
+			base = TelegramAPIBase
+		}
+		target = base + "/bot" + ch.Secret + "/sendMessage"
+		body, err = json.Marshal(map[string]interface{}{
+			"chat_id":                  ch.ChatID,
+			"text":                     FormatText(ev),
+			"disable_web_page_preview": true,
+		})
+	default:
+		return nil, fmt.Errorf("不支持的渠道类型: %s", ch.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("构造通知请求失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("构造通知请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if ch.Type == ChannelWebhook {
+		ts := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(HeaderTimestamp, ts)
+		req.Header.Set(HeaderEvent, string(ev.Type))
+		if ch.Secret != "" {
+			req.Header.Set(HeaderSignature, Sign(ch.Secret, ts, body))
+		}
+	}
+	return req, nil
+}
+
+// checkResponse 检查渠道响应（IM 平台在 HTTP 200 时也可能返回业务错误码）
+func checkResponse(channelType string, resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+
+	switch channelType {
+	case ChannelDingTalk:
+		var r struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}
+		if json.Unmarshal(data, &r) == nil && r.ErrCode != 0 {
+			return fmt.Errorf("钉钉返回错误 %d: %s", r.ErrCode, r.ErrMsg)
+		}
+	case ChannelFeishu:
+		var r struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.Unmarshal(data, &r) == nil && r.Code != 0 {
+			return fmt.Errorf("飞书返回错误 %d: %s", r.Code, r.Msg)
+		}
+	case ChannelTelegram:
+		var r struct {
+			OK          bool   `json:"ok"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil || !r.OK {
+			return fmt.Errorf("Telegram 返回错误: %s", r.Description)
+		}
+	}
+	return nil
+}
+
+// dingTalkSignedURL 钉钉加签：sign = urlencode(base64(HMAC-SHA256(secret, timestamp + "\n" + secret)))
+func dingTalkSignedURL(rawURL, secret string, now time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("钉钉地址格式错误: %w", err)
+	}
+	ts := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	q := u.Query()
+	q.Set("timestamp", ts)
+	q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// feishuSign 飞书加签：以 timestamp + "\n" + secret 为密钥对空串做 HMAC-SHA256 后 base64
+func feishuSign(secret, ts string) string {
+	mac := hmac.New(sha256.New, []byte(ts+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// formatMarkdown 钉钉 markdown 文本
+func formatMarkdown(ev Event) string {
+	var b strings.Builder
+	b.WriteString("### " + ev.Title + "\n\n")
+	b.WriteString(ev.Message + "\n\n")
+	for _, k := range sortedKeys(ev.Fields) {
+		b.WriteString("- **" + k + "**: " + ev.Fields[k] + "\n")
+	}
+	b.WriteString("\n> " + strings.ToUpper(ev.Level) + " · " + ev.Time)
+	return b.String()
+}
+
+// sortedKeys 返回排序后的键，保证输出稳定
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// truncate 截断字符串
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,284 @@
+// Package notify 账号池健康事件通知（Webhook / Slack / 钉钉 / 飞书 / Telegram）
+// 事件异步投递，支持失败重试和去重窗口
+// @author ygw
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+)
+
+// EventType 事件类型
+type EventType string
+
+const (
+	EventAccountStatusChanged EventType = "account.status_changed" // 账号状态变更
+	EventAccountRefreshFailed EventType = "account.refresh_failed" // 令牌刷新失败
+	EventPoolLowAccounts      EventType = "pool.low_accounts"      // 可用账号数低于阈值
+	EventUserQuotaExceeded    EventType = "user.quota_exceeded"    // 用户配额用尽
+	EventUserBudgetWarning    EventType = "user.budget_warning"    // 用户消费超过预算预警阈值
+	EventIPBlocked            EventType = "ip.blocked"             // IP 被封禁
+)
+
+// 事件级别
+const (
+	LevelInfo     = "info"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// Event 通知事件
+type Event struct {
+	Type     EventType         `json:"type"`
+	Level    string            `json:"level"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Time     string            `json:"time"`
+	DedupKey string            `json:"-"` // 去重键，为空时使用 Type+Message
+}
+
+// key 返回去重键
+func (e *Event) key() string {
+	if e.DedupKey != "" {
+		return string(e.Type) + "|" + e.DedupKey
+	}
+	return string(e.Type) + "|" + e.Message
+}
+
+// Options 通知器配置
+type Options struct {
+	DedupWindow time.Duration // 去重窗口，同一事件在窗口内只发送一次
+	MaxRetries  int           // 单个渠道最大重试次数
+	RetryDelay  time.Duration // 首次重试间隔，之后指数退避
+	QueueSize   int           // 事件队列长度
+	Timeout     time.Duration // 单次投递超时
+}
+
+// DefaultOptions 默认配置
+func DefaultOptions() Options {
+	return Options{
+		DedupWindow: 10 * time.Minute,
+		MaxRetries:  3,
+		RetryDelay:  2 * time.Second,
+		QueueSize:   500,
+		Timeout:     10 * time.Second,
+	}
+}
+
+// Notifier 事件通知器
+type Notifier struct {
+	opts     Options
+	client   *http.Client
+	mu       sync.RWMutex
+	channels []*models.NotifyChannel
+	sentMu   sync.Mutex
+	lastSent map[string]time.Time
+	queue    chan Event
+	wg       sync.WaitGroup
+	closed   bool // 受 mu 保护
+}
+
+// New 创建通知器并启动投递协程
+// @param opts 通知器配置
+// @return *Notifier 通知器
+// @author ygw
+func New(opts Options) *Notifier {
+	def := DefaultOptions()
+	if opts.DedupWindow < 0 {
+		opts.DedupWindow = 0
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = def.MaxRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = def.RetryDelay
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = def.QueueSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = def.Timeout
+	}
+
+	n := &Notifier{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		lastSent: make(map[string]time.Time),
+		queue:    make(chan Event, opts.QueueSize),
+	}
+	n.wg.Add(1)
+	go n.worker()
+	return n
+}
+
+// SetChannels 替换通知渠道列表（只保留启用的渠道）
+func (n *Notifier) SetChannels(channels []*models.NotifyChannel) {
+	enabled := make([]*models.NotifyChannel, 0, len(channels))
+	for _, ch := range channels {
+		if ch.Enabled {
+			enabled = append(enabled, ch)
+		}
+	}
+	n.mu.Lock()
+	n.channels = enabled
+	n.mu.Unlock()
+}
+
+// SetDedupWindow 更新去重窗口
+func (n *Notifier) SetDedupWindow(d time.Duration) {
+	n.sentMu.Lock()
+	n.opts.DedupWindow = d
+	n.sentMu.Unlock()
+}
+
+// Notify 提交事件（非阻塞）；去重窗口内的重复事件和队列满时的事件会被丢弃
+// @param ev 事件
+// @return bool 是否已入队
+// @author ygw
+func (n *Notifier) Notify(ev Event) bool {
+	if n == nil {
+		return false
+	}
+	n.mu.RLock()
+	hasChannels := len(n.channels) > 0
+	n.mu.RUnlock()
+	if !hasChannels {
+		return false
+	}
+
+	if ev.Time == "" {
+		ev.Time = models.CurrentTime()
+	}
+	if ev.Level == "" {
+		ev.Level = LevelWarning
+	}
+
+	now := time.Now()
+	key := ev.key()
+	n.sentMu.Lock()
+	defer n.sentMu.Unlock()
+	if last, ok := n.lastSent[key]; ok && n.opts.DedupWindow > 0 && now.Sub(last) < n.opts.DedupWindow {
+		logger.Debug("[通知] 去重窗口内跳过事件: %s", key)
+		return false
+	}
+
+	// 入队成功后才记录发送时间，被丢弃的事件不影响窗口内的后续事件
+	n.mu.RLock()
+	queued := false
+	if !n.closed {
+		select {
+		case n.queue <- ev:
+			queued = true
+		default:
+			logger.Warn("[通知] 事件队列已满，丢弃事件: %s", ev.Type)
+		}
+	}
+	n.mu.RUnlock()
+	if !queued {
+		return false
+	}
+
+	n.lastSent[key] = now
+	// 顺便清理过期的去重记录
+	if len(n.lastSent) > 1000 {
+		for k, t := range n.lastSent {
+			if now.Sub(t) >= n.opts.DedupWindow {
+				delete(n.lastSent, k)
+			}
+		}
+	}
+	return true
+}
+
+// Close 停止投递协程（等待队列中的事件和待重试的投递处理完成）
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// worker 投递协程
+func (n *Notifier) worker() {
+	defer n.wg.Done()
+	for ev := range n.queue {
+		n.mu.RLock()
+		channels := n.channels
+		n.mu.RUnlock()
+
+		for _, ch := range channels {
+			if ch.Subscribes(string(ev.Type)) {
+				n.deliver(ch, ev, 0, n.opts.RetryDelay)
+			}
+		}
+	}
+}
+
+// deliver 投递一次，失败时按指数退避在定时器中重试，不阻塞投递协程和其他渠道
+func (n *Notifier) deliver(ch *models.NotifyChannel, ev Event, attempt int, delay time.Duration) {
+	err := n.Send(context.Background(), ch, ev)
+	if err == nil {
+		return
+	}
+	if attempt >= n.opts.MaxRetries {
+		logger.Warn("[通知] 渠道 %s (%s) 投递失败: %v", ch.Name, ch.Type, err)
+		return
+	}
+	logger.Debug("[通知] 渠道 %s 第 %d 次投递失败: %v", ch.Name, attempt+1, err)
+
+	n.wg.Add(1)
+	time.AfterFunc(delay, func() {
+		defer n.wg.Done()
+		n.deliver(ch, ev, attempt+1, delay*2)
+	})
+}
+
+// Send 同步投递单个事件到指定渠道（不重试、不去重，用于测试发送）
+// @param ctx 上下文
+// @param ch 渠道
+// @param ev 事件
+// @return error 错误信息
+// @author ygw
+func (n *Notifier) Send(ctx context.Context, ch *models.NotifyChannel, ev Event) error {
+	if ev.Time == "" {
+		ev.Time = models.CurrentTime()
+	}
+	req, err := buildRequest(ctx, ch, ev, time.Now())
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(ch.Type, resp)
+}
+
+// FormatText 生成事件的纯文本描述（各 IM 渠道共用）
+func FormatText(ev Event) string {
+	var b strings.Builder
+	b.WriteString("[" + strings.ToUpper(ev.Level) + "] " + ev.Title + "\n")
+	b.WriteString(ev.Message)
+	if len(ev.Fields) > 0 {
+		b.WriteString("\n")
+		for _, k := range sortedKeys(ev.Fields) {
+			b.WriteString("\n" + k + ": " + ev.Fields[k])
+		}
+	}
+	b.WriteString("\n\n" + ev.Time)
+	return b.String()
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"claude-api/internal/models"
+)
+
+// sink 本地 HTTP 接收端，记录收到的请求
+type sink struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	failN    int32 // 前 N 次请求返回 500
+	hits     int32
+}
+
+func (s *sink) handler(resp string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&s.hits, 1) <= atomic.LoadInt32(&s.failN) {
+			w.WriteHeader(500)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		s.mu.Unlock()
+		w.Write([]byte(resp))
+	}
+}
+
+func (s *sink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("等待超时")
+}
+
+// TestWebhook_SignatureRetryDedup 测试通用 Webhook 签名、失败重试和去重窗口
+func TestWebhook_SignatureRetryDedup(t *testing.T) {
+	s := &sink{failN: 2}
+	srv := httptest.NewServer(s.handler("ok"))
+	defer srv.Close()
+
+	n := New(Options{DedupWindow: time.Minute, MaxRetries: 3, RetryDelay: time.Millisecond})
+	defer n.Close()
+	n.SetChannels([]*models.NotifyChannel{{Name: "hook", Type: ChannelWebhook, URL: srv.URL, Secret: "s3cret", Enabled: true}})
+
+	ev := Event{Type: EventAccountStatusChanged, Title: "t", Message: "账号 a 状态变更", DedupKey: "a"}
+	if !n.Notify(ev) {
+		t.Fatal("首次事件应入队")
+	}
+	if n.Notify(ev) {
+		t.Error("去重窗口内重复事件不应入队")
+	}
+	waitFor(t, func() bool { return s.count() == 1 })
+
+	if got := atomic.LoadInt32(&s.hits); got != 3 {
+		t.Errorf("应重试至成功（共 3 次请求），实际 %d 次", got)
+	}
+
+	s.mu.Lock()
+	req, body := s.requests[0], s.bodies[0]
+	s.mu.Unlock()
+	ts := req.Header.Get(HeaderTimestamp)
+	if want := Sign("s3cret", ts, body); req.Header.Get(HeaderSignature) != want {
+		t.Errorf("签名不匹配: %s != %s", req.Header.Get(HeaderSignature), want)
+	}
+	var got Event
+	if err := json.Unmarshal(body, &got); err != nil || got.Type != EventAccountStatusChanged {
+		t.Errorf("Webhook 载荷错误: %s", body)
+	}
+}
+
+// TestNotify_DroppedEventNotDeduped 测试队列满被丢弃的事件不占用去重窗口
+func TestNotify_DroppedEventNotDeduped(t *testing.T) {
+	release := make(chan struct{})
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+	}))
+	defer srv.Close()
+
+	n := New(Options{DedupWindow: time.Minute, QueueSize: 1})
+	defer n.Close()
+	n.SetChannels([]*models.NotifyChannel{{Name: "hook", Type: ChannelWebhook, URL: srv.URL, Enabled: true}})
+
+	// 第一个事件阻塞在投递中，第二个占满队列，第三个被丢弃
+	n.Notify(Event{Type: EventIPBlocked, Message: "a"})
+	waitFor(t, func() bool { return atomic.LoadInt32(&hits) == 1 })
+	if !n.Notify(Event{Type: EventIPBlocked, Message: "b"}) {
+		t.Fatal("队列未满时应入队")
+	}
+	dropped := Event{Type: EventIPBlocked, Message: "c"}
+	if n.Notify(dropped) {
+		t.Fatal("队列已满时应丢弃")
+	}
+	close(release)
+	waitFor(t, func() bool { return atomic.LoadInt32(&hits) == 2 })
+	if !n.Notify(dropped) {
+		t.Error("被丢弃的事件不应触发去重")
+	}
+}
+
+// TestNotify_RetryDoesNotBlock 测试一个渠道退避重试时不阻塞其他渠道的投递
+func TestNotify_RetryDoesNotBlock(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(500) }))
+	defer bad.Close()
+	good := &sink{}
+	goodSrv := httptest.NewServer(good.handler("ok"))
+	defer goodSrv.Close()
+
+	n := New(Options{MaxRetries: 2, RetryDelay: 300 * time.Millisecond})
+	defer n.Close()
+	n.SetChannels([]*models.NotifyChannel{
+		{Name: "bad", Type: ChannelWebhook, URL: bad.URL, Enabled: true},
+		{Name: "good", Type: ChannelWebhook, URL: goodSrv.URL, Enabled: true},
+	})
+
+	start := time.Now()
+	n.Notify(Event{Type: EventIPBlocked, Message: "1"})
+	n.Notify(Event{Type: EventIPBlocked, Message: "2"})
+	waitFor(t, func() bool { return good.count() == 2 })
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Errorf("其他渠道的投递不应等待退避重试，耗时 %v", elapsed)
+	}
+}
+
+// TestChannelFormats 测试各 IM 渠道的载荷格式和业务错误码
+func TestChannelFormats(t *testing.T) {
+	ev := Event{Type: EventPoolLowAccounts, Level: LevelCritical, Title: "可用账号不足", Message: "仅剩 1 个", Fields: map[string]string{"threshold": "3"}}
+	n := New(Options{})
+	defer n.Close()
+
+	cases := []struct {
+		ch      *models.NotifyChannel
+		resp    string
+		check   func(r *http.Request, body string) bool
+		wantErr bool
+	}{
+		{&models.NotifyChannel{Type: ChannelSlack}, "ok", func(r *http.Request, body string) bool {
+			return strings.Contains(body, `"text"`) && strings.Contains(body, "threshold: 3")
+		}, false},
+		{&models.NotifyChannel{Type: ChannelDingTalk, Secret: "SEC1"}, `{"errcode":0}`, func(r *http.Request, body string) bool {
+			return strings.Contains(body, `"msgtype":"markdown"`) && r.URL.Query().Get("sign") != "" && r.URL.Query().Get("timestamp") != ""
+		}, false},
+		{&models.NotifyChannel{Type: ChannelDingTalk}, `{"errcode":310000,"errmsg":"sign not match"}`, nil, true},
+		{&models.NotifyChannel{Type: ChannelFeishu, Secret: "fs"}, `{"code":0}`, func(r *http.Request, body string) bool {
+			return strings.Contains(body, `"msg_type":"text"`) && strings.Contains(body, `"sign"`)
+		}, false},
+		{&models.NotifyChannel{Type: ChannelTelegram, Secret: "123:abc", ChatID: "42"}, `{"ok":true}`, func(r *http.Request, body string) bool {
+			return r.URL.Path == "/bot123:abc/sendMessage" && strings.Contains(body, `"chat_id":"42"`)
+		}, false},
+		{&models.NotifyChannel{Type: ChannelTelegram, Secret: "123:abc", ChatID: "42"}, `{"ok":false,"description":"chat not found"}`, nil, true},
+	}
+
+	for _, tc := range cases {
+		var gotReq *http.Request
+		var gotBody string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			gotReq, gotBody = r, string(b)
+			w.Write([]byte(tc.resp))
+		}))
+		tc.ch.URL = srv.URL
+
+		err := n.Send(t.Context(), tc.ch, ev)
+		srv.Close()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: 错误不符合预期: %v", tc.ch.Type, err)
+			continue
+		}
+		if tc.check != nil && !tc.check(gotReq, gotBody) {
+			t.Errorf("%s: 载荷格式错误: %s %s", tc.ch.Type, gotReq.URL, gotBody)
+		}
+	}
+}
+
+// TestSubscribes 测试渠道事件订阅过滤
+func TestSubscribes(t *testing.T) {
+	ch := &models.NotifyChannel{Events: "pool.low_accounts, ip.blocked"}
+	if !ch.Subscribes(string(EventIPBlocked)) || ch.Subscribes(string(EventUserQuotaExceeded)) {
+		t.Error("事件订阅过滤错误")
+	}
+	if !(&models.NotifyChannel{}).Subscribes(string(EventUserQuotaExceeded)) {
+		t.Error("未配置事件时应订阅全部")
+	}
+}
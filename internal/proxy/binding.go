@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"claude-api/internal/models"
+)
+
+// StrategySticky 粘性策略：账号首次使用时按账号 ID 做一致性哈希（rendezvous hashing）选出代理并持久化，
+// 之后固定使用该代理；只有该代理被禁用、删除或摘除时才重新哈希，且只迁移该代理上的账号
+const StrategySticky = "sticky"
+
+// SetBindings 替换全部显式绑定（账号 ID -> 代理 ID）
+// 显式绑定在任何策略下都优先生效，绑定的代理不可用时按当前策略选择
+// @param bindings 账号绑定关系
+// @author ygw
+func (p *ProxyPool) SetBindings(bindings map[string]int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bindings = make(map[string]int64, len(bindings))
+	for accountID, proxyID := range bindings {
+		if proxyID > 0 {
+			p.bindings[accountID] = proxyID
+		}
+	}
+}
+
+// Bind 设置单个账号的显式绑定，proxyID 为 0 时解除绑定
+// @param accountID 账号ID
+// @param proxyID 代理ID
+// @author ygw
+func (p *ProxyPool) Bind(accountID string, proxyID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if proxyID <= 0 {
+		delete(p.bindings, accountID)
+		return
+	}
+	if p.bindings == nil {
+		p.bindings = make(map[string]int64)
+	}
+	p.bindings[accountID] = proxyID
+}
+
+// SetStickyAssignments 替换全部已持久化的粘性分配（账号 ID -> 代理 ID）
+// @param assignments 粘性分配关系
+// @author ygw
+func (p *ProxyPool) SetStickyAssignments(assignments map[string]int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sticky = make(map[string]int64, len(assignments))
+	for accountID, proxyID := range assignments {
+		if proxyID > 0 {
+			p.sticky[accountID] = proxyID
+		}
+	}
+}
+
+// OnAssign 设置粘性分配回调，账号首次分配或因代理被摘除而重新分配时调用
+// @param fn 回调函数，参数为账号 ID 和新分配的代理 ID
+// @author ygw
+func (p *ProxyPool) OnAssign(fn func(accountID string, proxyID int64)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onAssign = fn
+}
+
+// assign 记录新的粘性分配并触发回调（调用方不得持有锁）
+func (p *ProxyPool) assign(accountID string, proxyID int64) {
+	p.mu.Lock()
+	if p.sticky[accountID] == proxyID {
+		p.mu.Unlock()
+		return
+	}
+	if p.sticky == nil {
+		p.sticky = make(map[string]int64)
+	}
+	p.sticky[accountID] = proxyID
+	onAssign := p.onAssign
+	p.mu.Unlock()
+
+	if onAssign != nil {
+		onAssign(accountID, proxyID)
+	}
+}
+
+// Assigned 返回账号当前固定使用的代理 ID（显式绑定或粘性策略）
+// 其他策略下未绑定的账号每次请求都可能换代理，返回 0
+// @param accountID 账号ID
+// @author ygw
+func (p *ProxyPool) Assigned(accountID string) int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if proxy, _ := p.pinned(p.candidates(time.Now()), accountID); proxy != nil {
+		return proxy.ID
+	}
+	return 0
+}
+
+// candidates 可选代理：启用且未被摘除的代理；全部被摘除时返回全部启用的代理，避免请求全部失败（调用方持有锁）
+func (p *ProxyPool) candidates(now time.Time) []*models.Proxy {
+	var enabled, healthy []*models.Proxy
+	for _, proxy := range p.proxies {
+		if proxy.Enabled {
+			enabled = append(enabled, proxy)
+			if p.health[proxy.URL].available(now) {
+				healthy = append(healthy, proxy)
+			}
+		}
+	}
+	if len(healthy) > 0 {
+		return healthy
+	}
+	return enabled
+}
+
+// pinned 返回账号固定使用的代理：优先显式绑定，其次粘性策略已持久化的分配，最后为哈希结果；都没有时返回 nil（调用方持有锁）
+// fresh 为 true 表示结果来自重新哈希，调用方需要记录该分配
+func (p *ProxyPool) pinned(candidates []*models.Proxy, accountID string) (proxy *models.Proxy, fresh bool) {
+	if accountID == "" || len(candidates) == 0 {
+		return nil, false
+	}
+	if id, ok := p.bindings[accountID]; ok {
+		if proxy := findProxy(candidates, id); proxy != nil {
+			return proxy, false
+		}
+	}
+	if p.strategy != StrategySticky {
+		return nil, false
+	}
+	if id, ok := p.sticky[accountID]; ok {
+		if proxy := findProxy(candidates, id); proxy != nil {
+			return proxy, false
+		}
+	}
+	return rendezvous(candidates, accountID), true
+}
+
+// findProxy 按 ID 查找代理，不在列表中时返回 nil
+func findProxy(candidates []*models.Proxy, id int64) *models.Proxy {
+	for _, proxy := range candidates {
+		if proxy.ID == id {
+			return proxy
+		}
+	}
+	return nil
+}
+
+// rendezvous 最高随机权重哈希：每个代理按 hash(账号ID, 代理ID) 打分，取最高分
+// 代理增减时只有分配到该代理的账号会迁移；按代理 ID 计算，修改代理地址不影响分配
+func rendezvous(candidates []*models.Proxy, accountID string) *models.Proxy {
+	var best *models.Proxy
+	var bestScore uint64
+	for _, proxy := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(accountID))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(proxy.ID, 10)))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = proxy, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"claude-api/internal/models"
+)
+
+// TestStickyBinding 测试粘性策略的稳定性、摘除时的最小迁移和显式绑定
+func TestStickyBinding(t *testing.T) {
+	proxies := []*models.Proxy{
+		{ID: 1, URL: "http://a:1", Enabled: true, Weight: 1},
+		{ID: 2, URL: "http://b:1", Enabled: true, Weight: 1},
+		{ID: 3, URL: "http://c:1", Enabled: true, Weight: 1},
+	}
+	pool := NewProxyPool(StrategySticky)
+	pool.Reload(proxies)
+	persisted := make(map[string]int64)
+	pool.OnAssign(func(accountID string, proxyID int64) { persisted[accountID] = proxyID })
+
+	before := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		acc := fmt.Sprintf("acc-%d", i)
+		base, _ := pool.Select(acc)
+		before[acc] = base
+		for j := 0; j < 3; j++ {
+			if again, _ := pool.Select(acc); again != base {
+				t.Fatalf("同一账号应固定使用同一代理: %s != %s", again, base)
+			}
+		}
+	}
+
+	if len(persisted) != len(before) {
+		t.Fatalf("每个账号的首次分配应回调持久化一次，实际 %d 个", len(persisted))
+	}
+
+	// 新建代理池（模拟重启）并新增代理：已持久化的分配不变，不会因重新哈希而迁移
+	restarted := NewProxyPool(StrategySticky)
+	restarted.Reload(append(proxies[:3:3], &models.Proxy{ID: 4, URL: "http://d:1", Enabled: true, Weight: 1}))
+	restarted.SetStickyAssignments(persisted)
+	restarted.OnAssign(func(accountID string, proxyID int64) {
+		t.Errorf("已持久化的账号不应重新分配: %s", accountID)
+	})
+	for acc, base := range before {
+		if got, _ := restarted.Select(acc); got != base {
+			t.Fatalf("重启后分配应不变: %s %s != %s", acc, got, base)
+		}
+	}
+
+	// 摘除 b 后只有原本在 b 上的账号迁移
+	for i := 0; i < FailureThreshold; i++ {
+		pool.ReportFailure("http://b:1", errors.New("timeout"))
+	}
+	for acc, base := range before {
+		got, _ := pool.Select(acc)
+		if base != "http://b:1" && got != base {
+			t.Errorf("未受影响的账号不应迁移: %s %s -> %s", acc, base, got)
+		}
+		if got == "http://b:1" {
+			t.Errorf("被摘除的代理不应被选中: %s", acc)
+		}
+		if base == "http://b:1" && persisted[acc] == 2 {
+			t.Errorf("迁移后的分配应重新持久化: %s", acc)
+		}
+	}
+
+	// 代理恢复后，已迁移的账号保持新的分配
+	pool.ReportSuccess("http://b:1")
+	for acc, base := range before {
+		if got, _ := pool.Select(acc); base == "http://b:1" && got == base {
+			t.Errorf("已迁移的账号不应回到原代理: %s", acc)
+		}
+	}
+
+	// 显式绑定优先于哈希，绑定的代理被禁用时按策略迁移
+	pool.Bind("acc-0", 3)
+	if base, _ := pool.Select("acc-0"); base != "http://c:1" || pool.Assigned("acc-0") != 3 {
+		t.Errorf("显式绑定未生效: %s", base)
+	}
+	pool.Reload([]*models.Proxy{proxies[0], proxies[1], {ID: 3, URL: "http://c:1", Enabled: false, Weight: 1}})
+	if base, _ := pool.Select("acc-0"); base == "http://c:1" {
+		t.Error("绑定的代理被禁用后不应再使用")
+	}
+
+	// 轮询策略下显式绑定同样生效，未绑定的账号没有固定代理
+	pool.SetStrategy("round_robin")
+	pool.SetBindings(map[string]int64{"acc-1": 2})
+	for i := 0; i < 5; i++ {
+		if base, _ := pool.Select("acc-1"); base != "http://b:1" {
+			t.Errorf("轮询策略下显式绑定应生效: %s", base)
+		}
+	}
+	if pool.Assigned("acc-2") != 0 {
+		t.Error("轮询策略下未绑定账号不应有固定代理")
+	}
+}
@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// 健康检查参数
+const (
+	FailureThreshold   = 3                // 连续失败该次数后摘除
+	BaseEjectDuration  = 30 * time.Second // 首次摘除时长，之后每次翻倍
+	MaxEjectDuration   = 10 * time.Minute // 最长摘除时长
+	ProbeTimeout       = 10 * time.Second // 单次探测超时
+	referenceLatencyMs = 200              // 加权策略的参考延迟，低于该值不降权
+	healthCheckSession = "health-check"   // 探测含 % 占位符的代理时使用的 Session
+	healthTimeFormat   = "2006-01-02T15:04:05Z07:00"
+)
+
+// Health 代理健康状态（运行时状态，不落库）
+type Health struct {
+	Healthy             bool   `json:"healthy"`                 // 当前是否参与选择
+	LatencyMs           int64  `json:"latency_ms"`              // 最近一次成功探测的延迟，-1 表示未知
+	ConsecutiveFailures int    `json:"consecutive_failures"`    // 连续失败次数（主动探测和请求失败合计）
+	Ejections           int    `json:"ejections"`               // 连续摘除次数，用于计算退避时长
+	EjectedUntil        string `json:"ejected_until,omitempty"` // 摘除截止时间
+	LastCheck           string `json:"last_check,omitempty"`    // 最近一次主动探测时间
+	LastError           string `json:"last_error,omitempty"`    // 最近一次失败原因
+
+	ejectedUntil time.Time
+}
+
+// newHealth 初始健康状态
+func newHealth() *Health {
+	return &Health{Healthy: true, LatencyMs: -1}
+}
+
+// available 当前是否可被选择（未摘除或摘除已到期）
+func (h *Health) available(now time.Time) bool {
+	return h == nil || h.ejectedUntil.IsZero() || !now.Before(h.ejectedUntil)
+}
+
+// snapshot 返回用于展示的副本
+func (h *Health) snapshot(now time.Time) *Health {
+	cp := *h
+	cp.Healthy = h.available(now)
+	if cp.Healthy {
+		cp.EjectedUntil = ""
+	}
+	return &cp
+}
+
+// recordFailure 记录一次失败，连续失败达到阈值时按指数退避摘除
+// 返回本次是否触发摘除
+func (h *Health) recordFailure(err error, now time.Time) bool {
+	h.ConsecutiveFailures++
+	if err != nil {
+		h.LastError = err.Error()
+	}
+	// 已摘除且未到期的代理不重复摘除
+	if h.ConsecutiveFailures < FailureThreshold || !h.available(now) {
+		return false
+	}
+	d := BaseEjectDuration << h.Ejections
+	if d > MaxEjectDuration || d <= 0 {
+		d = MaxEjectDuration
+	}
+	h.Ejections++
+	h.ejectedUntil = now.Add(d)
+	h.EjectedUntil = h.ejectedUntil.Format(healthTimeFormat)
+	return true
+}
+
+// recordSuccess 记录一次成功，清除失败计数和摘除状态
+func (h *Health) recordSuccess() {
+	h.ConsecutiveFailures = 0
+	h.Ejections = 0
+	h.ejectedUntil = time.Time{}
+	h.EjectedUntil = ""
+	h.LastError = ""
+}
+
+// effectiveWeight 按延迟折算后的权重：延迟超过参考值时按比例降低，未知延迟不降权
+// 权重为 0 的代理不参与加权选择，折算后仍保持为 0
+func effectiveWeight(weight int, h *Health) int {
+	if weight <= 0 {
+		return 0
+	}
+	if h == nil || h.LatencyMs <= referenceLatencyMs {
+		return weight * 1000
+	}
+	w := weight * 1000 * referenceLatencyMs / int(h.LatencyMs)
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// ReportFailure 记录经由该代理的请求失败（被动检查）
+// @param base 代理池中的原始地址
+// @param err 失败原因
+// @return bool 本次是否触发摘除
+// @author ygw
+func (p *ProxyPool) ReportFailure(base string, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.health[base]
+	if !ok {
+		return false
+	}
+	return h.recordFailure(err, time.Now())
+}
+
+// ReportSuccess 记录经由该代理的请求成功（被动检查）
+// @param base 代理池中的原始地址
+// @author ygw
+func (p *ProxyPool) ReportSuccess(base string) {
+	// 快速路径：状态正常时无需加写锁
+	p.mu.RLock()
+	h, ok := p.health[base]
+	clean := !ok || (h.ConsecutiveFailures == 0 && h.ejectedUntil.IsZero())
+	p.mu.RUnlock()
+	if clean {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if h, ok := p.health[base]; ok {
+		h.recordSuccess()
+	}
+}
+
+// RecordProbe 记录一次主动探测结果
+// @param base 代理池中的原始地址
+// @param latency 探测延迟
+// @param err 探测错误，nil 表示成功
+// @return bool 本次是否触发摘除
+// @author ygw
+func (p *ProxyPool) RecordProbe(base string, latency time.Duration, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.health[base]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	h.LastCheck = now.Format(healthTimeFormat)
+	if err != nil {
+		return h.recordFailure(err, now)
+	}
+	h.LatencyMs = latency.Milliseconds()
+	h.recordSuccess()
+	return false
+}
+
+// Health 返回代理的健康状态，代理不在池中时返回 nil
+// @param base 代理池中的原始地址
+// @author ygw
+func (p *ProxyPool) Health(base string) *Health {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if h, ok := p.health[base]; ok {
+		return h.snapshot(time.Now())
+	}
+	return nil
+}
+
+// EnabledURLs 返回启用的代理原始地址（用于主动探测）
+// @author ygw
+func (p *ProxyPool) EnabledURLs() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var urls []string
+	for _, proxy := range p.proxies {
+		if proxy.Enabled {
+			urls = append(urls, proxy.URL)
+		}
+	}
+	return urls
+}
+
+// Probe 通过代理建立到目标地址的隧道并测量延迟
+// http/https 代理发送 CONNECT 请求，socks5 代理完成握手和 CONNECT
+// 含 % 占位符的代理使用固定 Session 派生后探测
+// @param ctx 上下文
+// @param proxyURL 代理原始地址
+// @param target 目标地址（host:port）
+// @return time.Duration 从开始连接到隧道建立的耗时
+// @author ygw
+func Probe(ctx context.Context, proxyURL, target string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	u, err := url.Parse(DeriveProxyURL(proxyURL, healthCheckSession))
+	if err != nil {
+		return 0, fmt.Errorf("代理地址格式错误: %w", err)
+	}
+
+	start := time.Now()
+	switch u.Scheme {
+	case "socks5":
+		dialer, err := xproxy.FromURL(u, xproxy.Direct)
+		if err != nil {
+			return 0, fmt.Errorf("SOCKS5 代理配置失败: %w", err)
+		}
+		cd, ok := dialer.(xproxy.ContextDialer)
+		if !ok {
+			return 0, fmt.Errorf("SOCKS5 代理不支持上下文")
+		}
+		conn, err := cd.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+	case "http", "https":
+		if err := probeConnect(ctx, u, target); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+	}
+	return time.Since(start), nil
+}
+
+// probeConnect 通过 HTTP 代理发送 CONNECT 请求，期望 2xx 响应
+func probeConnect(ctx context.Context, u *url.URL, target string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("代理 TLS 握手失败: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("代理 CONNECT 失败: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-api/internal/models"
+)
+
+// TestProxyHealth 测试连续失败摘除、退避翻倍、全部摘除时的回退和按延迟降权
+func TestProxyHealth(t *testing.T) {
+	pool := NewProxyPool("round_robin")
+	pool.Reload([]*models.Proxy{
+		{ID: 1, URL: "http://a:1", Enabled: true, Weight: 1},
+		{ID: 2, URL: "http://b:1", Enabled: true, Weight: 1},
+	})
+
+	fail := errors.New("connection refused")
+	for i := 1; i < FailureThreshold; i++ {
+		if pool.ReportFailure("http://a:1", fail) {
+			t.Fatalf("第 %d 次失败不应摘除", i)
+		}
+	}
+	if !pool.ReportFailure("http://a:1", fail) {
+		t.Fatal("连续失败达到阈值应摘除")
+	}
+	for i := 0; i < 10; i++ {
+		if base, _ := pool.Select("acc"); base != "http://b:1" {
+			t.Fatalf("被摘除的代理不应被选中: %s", base)
+		}
+	}
+	h := pool.Health("http://a:1")
+	if h.Healthy || h.Ejections != 1 || h.LastError != fail.Error() {
+		t.Errorf("健康状态错误: %+v", h)
+	}
+
+	// 摘除到期后再次失败，摘除时长翻倍
+	now := time.Now()
+	pool.mu.Lock()
+	ha := pool.health["http://a:1"]
+	ha.ejectedUntil = now.Add(-time.Second)
+	if !ha.recordFailure(fail, now) || ha.ejectedUntil.Sub(now) != 2*BaseEjectDuration {
+		t.Errorf("第二次摘除时长应为 %v, 实际 %v", 2*BaseEjectDuration, ha.ejectedUntil.Sub(now))
+	}
+	pool.mu.Unlock()
+
+	// 全部摘除时仍返回代理
+	for i := 0; i < FailureThreshold; i++ {
+		pool.ReportFailure("http://b:1", fail)
+	}
+	if base, _ := pool.Select("acc"); base == "" {
+		t.Error("全部摘除时应回退到启用的代理")
+	}
+
+	// 成功后恢复
+	pool.ReportSuccess("http://a:1")
+	if h := pool.Health("http://a:1"); !h.Healthy || h.ConsecutiveFailures != 0 || h.Ejections != 0 {
+		t.Errorf("成功后应恢复: %+v", h)
+	}
+
+	// 重新加载保留健康状态
+	pool.Reload([]*models.Proxy{{ID: 2, URL: "http://b:1", Enabled: true, Weight: 1}})
+	if h := pool.Health("http://b:1"); h.Healthy {
+		t.Error("重新加载不应清除摘除状态")
+	}
+	if pool.Health("http://a:1") != nil {
+		t.Error("已移除的代理不应有健康状态")
+	}
+
+	if w := effectiveWeight(2, &Health{LatencyMs: 100}); w != 2000 {
+		t.Errorf("低延迟不应降权: %d", w)
+	}
+	if w := effectiveWeight(2, &Health{LatencyMs: 800}); w != 500 {
+		t.Errorf("800ms 应降为 1/4: %d", w)
+	}
+	if w := effectiveWeight(1, nil); w != 1000 {
+		t.Errorf("未知延迟不应降权: %d", w)
+	}
+	if w := effectiveWeight(0, &Health{LatencyMs: 100}); w != 0 {
+		t.Errorf("权重为 0 的代理折算后应仍为 0: %d", w)
+	}
+
+	weighted := NewProxyPool("weighted")
+	weighted.Reload([]*models.Proxy{
+		{ID: 1, URL: "http://a:1", Enabled: true, Weight: 0},
+		{ID: 2, URL: "http://b:1", Enabled: true, Weight: 1},
+	})
+	for i := 0; i < 50; i++ {
+		if url, _ := weighted.Select(""); url != "http://b:1" {
+			t.Fatalf("weighted 策略下权重为 0 的代理不应被选中: %s", url)
+		}
+	}
+}
+
+// TestProbe 测试通过 HTTP 代理的 CONNECT 探测
+func TestProbe(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	var auth string
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Proxy-Authorization")
+		if r.Method != http.MethodConnect || r.Host == "blocked:443" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxySrv.Close()
+
+	ctx := context.Background()
+	proxyURL := strings.Replace(proxySrv.URL, "http://", "http://user:pass@", 1)
+	if _, err := Probe(ctx, proxyURL, target.Addr().String()); err != nil {
+		t.Fatalf("探测应成功: %v", err)
+	}
+	if !strings.HasPrefix(auth, "Basic ") {
+		t.Errorf("应发送代理认证头, 实际 %q", auth)
+	}
+	if _, err := Probe(ctx, proxySrv.URL, "blocked:443"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("CONNECT 被拒绝应返回错误, 实际 %v", err)
+	}
+	if _, err := Probe(ctx, "http://127.0.0.1:1", "example.com:443"); err == nil {
+		t.Error("代理不可达应返回错误")
+	}
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 导入结果状态
+const (
+	ImportCreated   = "created"   // 新建
+	ImportExisting  = "existing"  // 已存在（保留）
+	ImportDuplicate = "duplicate" // 列表内重复
+	ImportInvalid   = "invalid"   // 格式错误
+)
+
+// ImportLine 代理列表单行的解析结果
+type ImportLine struct {
+	Line   int    `json:"line"`            // 行号（从 1 开始）
+	Input  string `json:"input"`           // 原始内容
+	URL    string `json:"url,omitempty"`   // 规范化后的代理地址
+	Status string `json:"status"`          // created/existing/duplicate/invalid
+	Error  string `json:"error,omitempty"` // 错误原因
+	ID     int64  `json:"id,omitempty"`    // 代理 ID
+}
+
+// ParseProxyLine 将一行代理配置规范化为代理地址
+// 支持格式：完整 URL、host:port、host:port:user:pass、user:pass@host:port
+// @param line 单行内容
+// @param scheme 未指定协议时使用的协议（http/https/socks5），为空时使用 http
+// @return string 规范化后的代理地址
+// @author ygw
+func ParseProxyLine(line, scheme string) (string, error) {
+	line = strings.TrimSpace(line)
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	// 凭证按原样拼接不做转义，保留用户名中的 % Session 占位符（转义产生的 %XX 会被误当作占位符）
+	var proxyURL string
+	parts := strings.SplitN(line, ":", 4)
+	switch {
+	case strings.Contains(line, "://"):
+		proxyURL = line
+	case strings.HasPrefix(line, "["): // IPv6 [host]:port
+		proxyURL = scheme + "://" + line
+	case len(parts) == 4 && isPort(parts[1]):
+		proxyURL = scheme + "://" + parts[2] + ":" + parts[3] + "@" + net.JoinHostPort(parts[0], parts[1])
+	case strings.Contains(line, "@"):
+		proxyURL = scheme + "://" + line
+	case len(parts) == 2:
+		proxyURL = scheme + "://" + net.JoinHostPort(parts[0], parts[1])
+	default:
+		return "", fmt.Errorf("无法识别的代理格式（支持 URL、host:port、host:port:user:pass）")
+	}
+
+	if err := ValidateProxyURL(proxyURL); err != nil {
+		return "", err
+	}
+	return proxyURL, nil
+}
+
+// ParseProxyList 逐行解析代理列表，跳过空行和 # 开头的注释
+// 列表内重复的地址标记为 duplicate，格式错误的行标记为 invalid，其余行 Status 为空由调用方填写
+// @param text 代理列表（换行分隔）
+// @param scheme 未指定协议时使用的协议
+// @return []ImportLine 每行的解析结果
+// @author ygw
+func ParseProxyList(text, scheme string) []ImportLine {
+	var lines []ImportLine
+	seen := make(map[string]bool)
+	for i, raw := range strings.Split(text, "\n") {
+		input := strings.TrimSpace(raw)
+		if input == "" || strings.HasPrefix(input, "#") {
+			continue
+		}
+		line := ImportLine{Line: i + 1, Input: input}
+		proxyURL, err := ParseProxyLine(input, scheme)
+		switch {
+		case err != nil:
+			line.Status = ImportInvalid
+			line.Error = err.Error()
+		case seen[proxyURL]:
+			line.URL = proxyURL
+			line.Status = ImportDuplicate
+		default:
+			line.URL = proxyURL
+			seen[proxyURL] = true
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// isPort 判断是否为合法端口号
+func isPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// ValidScheme 判断是否为支持的代理协议
+func ValidScheme(scheme string) bool {
+	return scheme == "" || scheme == "http" || scheme == "https" || scheme == "socks5"
+}
@@ -9,26 +9,32 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // ProxyPool 代理池管理器
 // @author ygw
 type ProxyPool struct {
-	proxies  []*models.Proxy
-	mu       sync.RWMutex
-	index    uint32
-	strategy string
+	proxies   []*models.Proxy
+	mu        sync.RWMutex
+	index     uint32
+	strategy  string
+	onRemoved func(urls []string)                   // 代理被删除、禁用或修改地址时回调（参数为原始代理地址）
+	health    map[string]*Health                    // 健康状态（按原始代理地址）
+	bindings  map[string]int64                      // 显式绑定（账号ID -> 代理ID）
+	sticky    map[string]int64                      // 粘性策略已持久化的分配（账号ID -> 代理ID）
+	onAssign  func(accountID string, proxyID int64) // 粘性策略产生新分配时回调（用于持久化）
 }
 
 // NewProxyPool 创建代理池
-// @param strategy 选择策略: round_robin, random, weighted
+// @param strategy 选择策略: round_robin, random, weighted, sticky
 // @return *ProxyPool 代理池实例
 // @author ygw
 func NewProxyPool(strategy string) *ProxyPool {
 	if strategy == "" {
 		strategy = "round_robin"
 	}
-	return &ProxyPool{strategy: strategy}
+	return &ProxyPool{strategy: strategy, health: make(map[string]*Health)}
 }
 
 // GetProxy 获取代理地址
@@ -36,19 +42,34 @@ func NewProxyPool(strategy string) *ProxyPool {
 // @return string 派生后的代理地址，空字符串表示无可用代理
 // @author ygw
 func (p *ProxyPool) GetProxy(accountID string) string {
+	_, derived := p.Select(accountID)
+	return derived
+}
+
+// Select 选择代理，同时返回原始地址和派生地址
+// @param accountID 账号ID，用于 Session 派生
+// @return base 代理池中的原始地址（可能包含 % 占位符）
+// @return derived 派生后的代理地址，均为空字符串表示无可用代理
+// @author ygw
+func (p *ProxyPool) Select(accountID string) (base, derived string) {
 	p.mu.RLock()
-	defer p.mu.RUnlock()
 
-	// 过滤启用的代理
-	var enabled []*models.Proxy
-	for _, proxy := range p.proxies {
-		if proxy.Enabled {
-			enabled = append(enabled, proxy)
-		}
-	}
+	// 过滤启用且未被摘除的代理；全部被摘除时仍在启用的代理中选择，避免请求全部失败
+	enabled := p.candidates(time.Now())
 	if len(enabled) == 0 {
-		return ""
+		p.mu.RUnlock()
+		return "", ""
+	}
+
+	// 显式绑定或粘性策略：账号固定使用同一代理
+	if selected, fresh := p.pinned(enabled, accountID); selected != nil {
+		p.mu.RUnlock()
+		if fresh {
+			p.assign(accountID, selected.ID)
+		}
+		return selected.URL, DeriveProxyURL(selected.URL, accountID)
 	}
+	defer p.mu.RUnlock()
 
 	var selected *models.Proxy
 	switch p.strategy {
@@ -61,24 +82,24 @@ func (p *ProxyPool) GetProxy(accountID string) string {
 		selected = enabled[idx%uint32(len(enabled))]
 	}
 
-	return DeriveProxyURL(selected.URL, accountID)
+	return selected.URL, DeriveProxyURL(selected.URL, accountID)
 }
 
-// selectWeighted 加权随机选择
+// selectWeighted 加权随机选择（权重按探测延迟折算，延迟越高被选中概率越低）
 // @param proxies 代理列表
 // @return *models.Proxy 选中的代理
 // @author ygw
 func (p *ProxyPool) selectWeighted(proxies []*models.Proxy) *models.Proxy {
 	totalWeight := 0
 	for _, proxy := range proxies {
-		totalWeight += proxy.Weight
+		totalWeight += effectiveWeight(proxy.Weight, p.health[proxy.URL])
 	}
 	if totalWeight == 0 {
 		return proxies[0]
 	}
 	r := rand.Intn(totalWeight)
 	for _, proxy := range proxies {
-		r -= proxy.Weight
+		r -= effectiveWeight(proxy.Weight, p.health[proxy.URL])
 		if r < 0 {
 			return proxy
 		}
@@ -91,8 +112,45 @@ func (p *ProxyPool) selectWeighted(proxies []*models.Proxy) *models.Proxy {
 // @author ygw
 func (p *ProxyPool) Reload(proxies []*models.Proxy) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	// 找出不再可用的代理地址（被删除、禁用或修改了地址）
+	current := make(map[string]bool)
+	for _, proxy := range proxies {
+		if proxy.Enabled {
+			current[proxy.URL] = true
+		}
+	}
+	var removed []string
+	for _, proxy := range p.proxies {
+		if proxy.Enabled && !current[proxy.URL] {
+			removed = append(removed, proxy.URL)
+		}
+	}
 	p.proxies = proxies
+	// 保留仍在池中的代理的健康状态
+	health := make(map[string]*Health, len(proxies))
+	for _, proxy := range proxies {
+		if h, ok := p.health[proxy.URL]; ok {
+			health[proxy.URL] = h
+		} else {
+			health[proxy.URL] = newHealth()
+		}
+	}
+	p.health = health
+	onRemoved := p.onRemoved
+	p.mu.Unlock()
+
+	if len(removed) > 0 && onRemoved != nil {
+		onRemoved(removed)
+	}
+}
+
+// OnRemoved 设置代理移除回调，Reload 发现代理被删除、禁用或修改地址时调用
+// @param fn 回调函数，参数为被移除的原始代理地址
+// @author ygw
+func (p *ProxyPool) OnRemoved(fn func(urls []string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onRemoved = fn
 }
 
 // SetStrategy 设置选择策略
@@ -4,8 +4,11 @@
 package ratelimit
 
 import (
+	"context"
 	"sync"
 	"time"
+
+	"claude-api/internal/logger"
 )
 
 // SlidingWindowLimiter 滑动窗口限流器
@@ -120,6 +123,40 @@ func (l *SlidingWindowLimiter) GetCount(key string) int {
 	return count
 }
 
+// timing 计算重试等待时间和额度完全恢复时间
+// retryAfter: 窗口内请求数降到 limit 以下（可再发一次请求）所需时间，未超限时为 0
+// reset: 窗口内最后一次请求滑出窗口所需时间
+func (l *SlidingWindowLimiter) timing(key string, limit int) (retryAfter, reset time.Duration) {
+	l.mu.RLock()
+	entry, exists := l.entries[key]
+	l.mu.RUnlock()
+	if !exists {
+		return 0, 0
+	}
+
+	now := time.Now().UnixNano()
+	windowStart := now - int64(l.windowSize)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	// 时间戳按追加顺序递增
+	var valid []int64
+	for _, ts := range entry.timestamps {
+		if ts > windowStart {
+			valid = append(valid, ts)
+		}
+	}
+	if len(valid) == 0 {
+		return 0, 0
+	}
+	reset = time.Duration(valid[len(valid)-1] + int64(l.windowSize) - now)
+	if limit > 0 && len(valid) >= limit {
+		retryAfter = time.Duration(valid[len(valid)-limit] + int64(l.windowSize) - now)
+	}
+	return retryAfter, reset
+}
+
 // Reset 重置指定key的计数
 func (l *SlidingWindowLimiter) Reset(key string) {
 	l.mu.Lock()
@@ -200,18 +237,39 @@ func (l *SlidingWindowLimiter) Stats() map[string]interface{} {
 
 // RateLimitResult 限流检查结果
 type RateLimitResult struct {
-	Allowed   bool   // 是否允许
-	Count     int    // 当前请求数
-	Limit     int    // 限制数
-	Remaining int    // 剩余配额
-	Key       string // 限流键
-	Type      string // 限流类型（ip/apikey）
+	Allowed    bool          // 是否允许
+	Count      int           // 当前请求数
+	Limit      int           // 限制数
+	Remaining  int           // 剩余配额
+	Key        string        // 限流键
+	Type       string        // 限流类型（ip/apikey）
+	RetryAfter time.Duration // 被拒绝时建议的重试等待时间
+	Reset      time.Duration // 额度完全恢复所需时间
+}
+
+// SharedCounter 多实例共享的滑动窗口计数（由协调后端实现）
+type SharedCounter interface {
+	// Allow 在窗口内计入 n 个单位，超出 limit 时拒绝且不计入
+	Allow(ctx context.Context, key string, n, limit int) (bool, int, error)
+	// Add 直接调整窗口内计数（不做限制检查）
+	Add(ctx context.Context, key string, n int) error
+	// Count 返回窗口内当前总量
+	Count(ctx context.Context, key string) (int, error)
+	// Reset 清空窗口计数
+	Reset(ctx context.Context, key string) error
 }
 
+// sharedTimeout 共享计数操作超时，超时或出错时回退到本地计数
+const sharedTimeout = 2 * time.Second
+
 // DualLimiter 双重限流器（IP + API Key）
+// 设置共享计数后各实例共用计数，未设置时为单实例内存计数
 type DualLimiter struct {
 	ipLimiter     *SlidingWindowLimiter
 	apiKeyLimiter *SlidingWindowLimiter
+
+	sharedIP     SharedCounter
+	sharedAPIKey SharedCounter
 }
 
 // NewDualLimiter 创建双重限流器
@@ -222,50 +280,100 @@ func NewDualLimiter(windowSize time.Duration) *DualLimiter {
 	}
 }
 
+// SetShared 设置多实例共享计数（nil 表示使用本地内存计数）
+// @author ygw
+func (d *DualLimiter) SetShared(ip, apiKey SharedCounter) {
+	d.sharedIP = ip
+	d.sharedAPIKey = apiKey
+}
+
+// sharedAllow 优先使用共享计数，共享计数不可用时回退到本地计数
+func sharedAllow(shared SharedCounter, local *SlidingWindowLimiter, key string, limit int) RateLimitResult {
+	result := RateLimitResult{Limit: limit, Key: key}
+	if shared != nil && limit > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		allowed, count, err := shared.Allow(ctx, key, 1, limit)
+		if err == nil {
+			result.Allowed, result.Count = allowed, count
+			result.Remaining = limit - count
+			if result.Remaining < 0 {
+				result.Remaining = 0
+			}
+			// 共享窗口只有聚合计数，按超出比例估算等待时间
+			result.Reset = local.windowSize
+			if !allowed {
+				result.RetryAfter = local.windowSize
+				if count > 0 {
+					result.RetryAfter = time.Duration(float64(local.windowSize) * float64(count-limit+1) / float64(count))
+				}
+			}
+			return result
+		}
+		logger.Warn("共享限流计数不可用，回退到本地计数: %v", err)
+	}
+	result.Allowed, result.Count, result.Remaining = local.Allow(key, limit)
+	result.RetryAfter, result.Reset = local.timing(key, limit)
+	if result.Allowed {
+		result.RetryAfter = 0
+	}
+	return result
+}
+
+// sharedCount 优先读取共享计数
+func sharedCount(shared SharedCounter, local *SlidingWindowLimiter, key string) int {
+	if shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		if n, err := shared.Count(ctx, key); err == nil {
+			return n
+		}
+	}
+	return local.GetCount(key)
+}
+
+// sharedReset 同时清空共享计数和本地计数
+func sharedReset(shared SharedCounter, local *SlidingWindowLimiter, key string) {
+	if shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		shared.Reset(ctx, key)
+	}
+	local.Reset(key)
+}
+
 // CheckIP 检查IP限流
 func (d *DualLimiter) CheckIP(ip string, limit int) RateLimitResult {
-	allowed, count, remaining := d.ipLimiter.Allow(ip, limit)
-	return RateLimitResult{
-		Allowed:   allowed,
-		Count:     count,
-		Limit:     limit,
-		Remaining: remaining,
-		Key:       ip,
-		Type:      "ip",
-	}
+	result := sharedAllow(d.sharedIP, d.ipLimiter, ip, limit)
+	result.Type = "ip"
+	return result
 }
 
 // CheckAPIKey 检查API Key限流
 func (d *DualLimiter) CheckAPIKey(apiKey string, limit int) RateLimitResult {
-	allowed, count, remaining := d.apiKeyLimiter.Allow(apiKey, limit)
-	return RateLimitResult{
-		Allowed:   allowed,
-		Count:     count,
-		Limit:     limit,
-		Remaining: remaining,
-		Key:       apiKey,
-		Type:      "apikey",
-	}
+	result := sharedAllow(d.sharedAPIKey, d.apiKeyLimiter, apiKey, limit)
+	result.Type = "apikey"
+	return result
 }
 
 // GetIPCount 获取IP当前请求数
 func (d *DualLimiter) GetIPCount(ip string) int {
-	return d.ipLimiter.GetCount(ip)
+	return sharedCount(d.sharedIP, d.ipLimiter, ip)
 }
 
 // GetAPIKeyCount 获取API Key当前请求数
 func (d *DualLimiter) GetAPIKeyCount(apiKey string) int {
-	return d.apiKeyLimiter.GetCount(apiKey)
+	return sharedCount(d.sharedAPIKey, d.apiKeyLimiter, apiKey)
 }
 
 // ResetIP 重置IP计数
 func (d *DualLimiter) ResetIP(ip string) {
-	d.ipLimiter.Reset(ip)
+	sharedReset(d.sharedIP, d.ipLimiter, ip)
 }
 
 // ResetAPIKey 重置API Key计数
 func (d *DualLimiter) ResetAPIKey(apiKey string) {
-	d.apiKeyLimiter.Reset(apiKey)
+	sharedReset(d.sharedAPIKey, d.apiKeyLimiter, apiKey)
 }
 
 // Stop 停止双重限流器
@@ -3,6 +3,8 @@
 package ratelimit
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -324,3 +326,101 @@ func TestSlidingWindowLimiter_SlidingBehavior(t *testing.T) {
 		t.Errorf("滑动窗口内计数应为3，实际为%d", count)
 	}
 }
+
+// fakeShared 测试用共享计数（所有 DualLimiter 共用同一份计数，可模拟后端故障）
+type fakeShared struct {
+	mu     sync.Mutex
+	counts map[string]int
+	fail   bool
+}
+
+func (f *fakeShared) Allow(ctx context.Context, key string, n, limit int) (bool, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return false, 0, errors.New("后端不可用")
+	}
+	if f.counts[key]+n > limit {
+		return false, f.counts[key], nil
+	}
+	f.counts[key] += n
+	return true, f.counts[key], nil
+}
+
+func (f *fakeShared) Add(ctx context.Context, key string, n int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("后端不可用")
+	}
+	f.counts[key] += n
+	return nil
+}
+
+func (f *fakeShared) Count(ctx context.Context, key string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[key], nil
+}
+
+func (f *fakeShared) Reset(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.counts, key)
+	return nil
+}
+
+// TestDualLimiter_Shared 测试多个实例共用计数，后端故障时回退到本地计数
+func TestDualLimiter_Shared(t *testing.T) {
+	shared := &fakeShared{counts: make(map[string]int)}
+	a := NewDualLimiter(time.Minute)
+	b := NewDualLimiter(time.Minute)
+	defer a.Stop()
+	defer b.Stop()
+	a.SetShared(shared, shared)
+	b.SetShared(shared, shared)
+
+	for i := 0; i < 3; i++ {
+		a.CheckIP("10.0.0.1", 5)
+		b.CheckIP("10.0.0.1", 5)
+	}
+	if r := a.CheckIP("10.0.0.1", 5); r.Allowed {
+		t.Error("两个实例合计超过限制后应拒绝")
+	}
+	if n := b.GetIPCount("10.0.0.1"); n != 5 {
+		t.Errorf("共享计数应为 5，实际 %d", n)
+	}
+
+	shared.fail = true
+	if r := a.CheckIP("10.0.0.1", 5); !r.Allowed || r.Count != 1 {
+		t.Errorf("后端故障时应回退到本地计数: %+v", r)
+	}
+}
+
+// TestDualLimiter_RetryAfter 测试拒绝时给出窗口内的重试等待时间
+func TestDualLimiter_RetryAfter(t *testing.T) {
+	d := NewDualLimiter(time.Second)
+	defer d.Stop()
+
+	d.CheckAPIKey("k", 2)
+	time.Sleep(200 * time.Millisecond)
+	d.CheckAPIKey("k", 2)
+	r := d.CheckAPIKey("k", 2)
+	if r.Allowed {
+		t.Fatal("超过限制应拒绝")
+	}
+	// 最早的请求约 800ms 后滑出窗口
+	if r.RetryAfter <= 600*time.Millisecond || r.RetryAfter > 800*time.Millisecond {
+		t.Errorf("重试等待时间应约为 800ms，实际 %v", r.RetryAfter)
+	}
+	if r.Reset <= r.RetryAfter || r.Reset > time.Second {
+		t.Errorf("完全恢复时间应晚于重试时间: %v", r.Reset)
+	}
+
+	shared := &fakeShared{counts: make(map[string]int)}
+	d.SetShared(shared, shared)
+	d.CheckIP("ip", 1)
+	if r := d.CheckIP("ip", 1); r.Allowed || r.RetryAfter != time.Second {
+		t.Errorf("共享计数按比例估算等待时间: %+v", r)
+	}
+}
@@ -0,0 +1,296 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"claude-api/internal/logger"
+)
+
+// TokenLimiter 按 token 数量限流（TPM）
+// 请求进入时按预估输入 token 预占额度，响应结束后按实际用量修正
+// @author ygw
+type TokenLimiter struct {
+	mu          sync.RWMutex
+	windowSize  time.Duration
+	entries     map[string]*tokenEntry
+	shared      SharedCounter
+	stopCleanup chan struct{}
+}
+
+// tokenEntry 单个限流键的用量记录
+type tokenEntry struct {
+	mu    sync.Mutex
+	items []*tokenItem
+}
+
+// tokenItem 一次预占（修正后 n 为实际用量）
+type tokenItem struct {
+	ts int64 // 预占时间（Unix纳秒）
+	n  int
+}
+
+// TokenResult token 限流检查结果
+type TokenResult struct {
+	Allowed    bool          // 是否允许
+	Used       int           // 窗口内已用量（允许时包含本次预占）
+	Limit      int           // 窗口内限额
+	Remaining  int           // 剩余额度
+	RetryAfter time.Duration // 被拒绝时建议的重试等待时间
+	Reset      time.Duration // 额度完全恢复所需时间
+}
+
+// NewTokenLimiter 创建 token 限流器
+// windowSize: 窗口大小，默认60秒
+func NewTokenLimiter(windowSize time.Duration) *TokenLimiter {
+	if windowSize <= 0 {
+		windowSize = 60 * time.Second
+	}
+	l := &TokenLimiter{
+		windowSize:  windowSize,
+		entries:     make(map[string]*tokenEntry),
+		stopCleanup: make(chan struct{}),
+	}
+	go l.cleanupLoop()
+	return l
+}
+
+// SetShared 设置多实例共享计数（nil 表示使用本地内存计数）
+func (l *TokenLimiter) SetShared(shared SharedCounter) {
+	l.shared = shared
+}
+
+// Reserve 预占 tokens 个 token
+// 单次预占量不超过 limit，避免超大请求在窗口空闲时也永远无法通过
+// limit<=0 表示不限制，此时返回的 Reservation 为 nil（对 nil 调用 Reconcile 是安全的）
+func (l *TokenLimiter) Reserve(key string, tokens, limit int) (TokenResult, *Reservation) {
+	if limit <= 0 {
+		return TokenResult{Allowed: true, Remaining: -1}, nil
+	}
+	if tokens < 0 {
+		tokens = 0
+	}
+	if tokens > limit {
+		tokens = limit
+	}
+
+	if l.shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		allowed, used, err := l.shared.Allow(ctx, key, tokens, limit)
+		if err == nil {
+			res := TokenResult{Allowed: allowed, Used: used, Limit: limit, Remaining: limit - used, Reset: l.windowSize}
+			if res.Remaining < 0 {
+				res.Remaining = 0
+			}
+			if !allowed {
+				// 共享窗口只有聚合计数，按超出比例估算等待时间
+				res.RetryAfter = l.windowSize
+				if used > 0 {
+					res.RetryAfter = time.Duration(float64(l.windowSize) * float64(used+tokens-limit) / float64(used))
+				}
+				if res.RetryAfter < time.Second {
+					res.RetryAfter = time.Second
+				}
+				return res, nil
+			}
+			return res, &Reservation{limiter: l, key: key, reserved: tokens, shared: true}
+		}
+		logger.Warn("共享 token 限流计数不可用，回退到本地计数: %v", err)
+	}
+	return l.reserveLocal(key, tokens, limit)
+}
+
+// reserveLocal 使用本地内存计数预占
+func (l *TokenLimiter) reserveLocal(key string, tokens, limit int) (TokenResult, *Reservation) {
+	now := time.Now().UnixNano()
+	windowStart := now - int64(l.windowSize)
+
+	l.mu.Lock()
+	entry, exists := l.entries[key]
+	if !exists {
+		entry = &tokenEntry{}
+		l.entries[key] = entry
+	}
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	valid := entry.items[:0]
+	used := 0
+	for _, it := range entry.items {
+		if it.ts > windowStart {
+			valid = append(valid, it)
+			used += it.n
+		}
+	}
+	entry.items = valid
+
+	res := TokenResult{Limit: limit}
+	if used+tokens > limit {
+		// 等待最早的若干次预占滑出窗口，直到剩余额度足够
+		need := used + tokens - limit
+		for _, it := range entry.items {
+			need -= it.n
+			if need <= 0 {
+				res.RetryAfter = time.Duration(it.ts + int64(l.windowSize) - now)
+				break
+			}
+		}
+		if res.RetryAfter < time.Second {
+			res.RetryAfter = time.Second
+		}
+		res.Used = used
+		res.Remaining = limit - used
+		if res.Remaining < 0 {
+			res.Remaining = 0
+		}
+		res.Reset = time.Duration(entry.items[len(entry.items)-1].ts + int64(l.windowSize) - now)
+		return res, nil
+	}
+
+	item := &tokenItem{ts: now, n: tokens}
+	entry.items = append(entry.items, item)
+	res.Allowed = true
+	res.Used = used + tokens
+	res.Remaining = limit - res.Used
+	res.Reset = l.windowSize
+	return res, &Reservation{limiter: l, key: key, reserved: tokens, entry: entry, item: item}
+}
+
+// Used 返回窗口内已用 token 数
+func (l *TokenLimiter) Used(key string) int {
+	if l.shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		if n, err := l.shared.Count(ctx, key); err == nil {
+			return n
+		}
+	}
+	l.mu.RLock()
+	entry, exists := l.entries[key]
+	l.mu.RUnlock()
+	if !exists {
+		return 0
+	}
+	windowStart := time.Now().UnixNano() - int64(l.windowSize)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	used := 0
+	for _, it := range entry.items {
+		if it.ts > windowStart {
+			used += it.n
+		}
+	}
+	return used
+}
+
+// Reset 清空指定 key 的用量
+func (l *TokenLimiter) Reset(key string) {
+	if l.shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		l.shared.Reset(ctx, key)
+	}
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
+
+// cleanupLoop 后台清理过期数据
+func (l *TokenLimiter) cleanupLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.cleanup()
+		case <-l.stopCleanup:
+			return
+		}
+	}
+}
+
+// cleanup 删除窗口内已无用量的条目
+func (l *TokenLimiter) cleanup() {
+	windowStart := time.Now().UnixNano() - int64(l.windowSize)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, entry := range l.entries {
+		entry.mu.Lock()
+		valid := entry.items[:0]
+		for _, it := range entry.items {
+			if it.ts > windowStart {
+				valid = append(valid, it)
+			}
+		}
+		entry.items = valid
+		empty := len(valid) == 0
+		entry.mu.Unlock()
+		if empty {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Stop 停止后台清理
+func (l *TokenLimiter) Stop() {
+	close(l.stopCleanup)
+}
+
+// Stats 返回统计信息
+func (l *TokenLimiter) Stats() map[string]interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return map[string]interface{}{
+		"window_size_seconds": l.windowSize.Seconds(),
+		"active_keys":         len(l.entries),
+	}
+}
+
+// Reservation 一次 token 预占，响应结束后按实际用量修正
+type Reservation struct {
+	limiter  *TokenLimiter
+	key      string
+	reserved int
+	shared   bool
+	entry    *tokenEntry
+	item     *tokenItem
+	once     sync.Once
+}
+
+// Reconcile 按实际用量修正预占量（多次调用只生效一次）
+// @param actual 实际消耗的 token 数（请求失败时传 0 即释放预占）
+func (r *Reservation) Reconcile(actual int) {
+	if r == nil {
+		return
+	}
+	if actual < 0 {
+		actual = 0
+	}
+	r.once.Do(func() {
+		if !r.shared {
+			// 预占已滑出窗口时修改不再影响计数
+			r.entry.mu.Lock()
+			r.item.n = actual
+			r.entry.mu.Unlock()
+			return
+		}
+		delta := actual - r.reserved
+		if delta == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		if err := r.limiter.shared.Add(ctx, r.key, delta); err != nil {
+			logger.Warn("修正共享 token 用量失败: %s - %v", r.key, err)
+		}
+	})
+}
+
+// Release 释放预占（等同于 Reconcile(0)）
+func (r *Reservation) Release() {
+	r.Reconcile(0)
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTokenLimiter_ReserveAndReconcile 测试预占、拒绝和按实际用量修正
+func TestTokenLimiter_ReserveAndReconcile(t *testing.T) {
+	l := NewTokenLimiter(time.Minute)
+	defer l.Stop()
+
+	res, r1 := l.Reserve("user-1", 600, 1000)
+	if !res.Allowed || res.Used != 600 || res.Remaining != 400 {
+		t.Fatalf("应允许预占 600: %+v", res)
+	}
+	res, r2 := l.Reserve("user-1", 600, 1000)
+	if res.Allowed || r2 != nil {
+		t.Fatalf("超过限额应拒绝: %+v", res)
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+		t.Errorf("重试等待时间应在窗口内: %v", res.RetryAfter)
+	}
+
+	// 实际用量少于预估，释放差额
+	r1.Reconcile(300)
+	r1.Reconcile(900) // 重复修正不生效
+	if n := l.Used("user-1"); n != 300 {
+		t.Errorf("修正后用量应为 300，实际 %d", n)
+	}
+	if res, _ := l.Reserve("user-1", 600, 1000); !res.Allowed {
+		t.Errorf("修正后应允许: %+v", res)
+	}
+
+	// 超大请求在窗口空闲时按限额预占
+	if res, r := l.Reserve("user-2", 5000, 1000); !res.Allowed || res.Used != 1000 {
+		t.Errorf("窗口空闲时超大请求应允许: %+v", res)
+	} else {
+		r.Release()
+	}
+	if n := l.Used("user-2"); n != 0 {
+		t.Errorf("释放后用量应为 0，实际 %d", n)
+	}
+
+	// 不限制
+	if res, r := l.Reserve("user-3", 100, 0); !res.Allowed || r != nil {
+		t.Errorf("limit=0 应不限制: %+v", res)
+	}
+	var nilRes *Reservation
+	nilRes.Reconcile(100)
+}
+
+// TestTokenLimiter_WindowExpiry 测试窗口过期后额度恢复
+func TestTokenLimiter_WindowExpiry(t *testing.T) {
+	l := NewTokenLimiter(100 * time.Millisecond)
+	defer l.Stop()
+
+	l.Reserve("k", 100, 100)
+	if res, _ := l.Reserve("k", 1, 100); res.Allowed {
+		t.Fatal("额度用完后应拒绝")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if res, _ := l.Reserve("k", 100, 100); !res.Allowed {
+		t.Error("窗口过期后应恢复额度")
+	}
+}
+
+// TestTokenLimiter_Shared 测试共享计数下的预占修正和故障回退
+func TestTokenLimiter_Shared(t *testing.T) {
+	shared := &fakeShared{counts: make(map[string]int)}
+	a := NewTokenLimiter(time.Minute)
+	b := NewTokenLimiter(time.Minute)
+	defer a.Stop()
+	defer b.Stop()
+	a.SetShared(shared)
+	b.SetShared(shared)
+
+	_, r := a.Reserve("global", 800, 1000)
+	if res, _ := b.Reserve("global", 500, 1000); res.Allowed || res.RetryAfter < time.Second {
+		t.Errorf("两个实例合计超限应拒绝并给出等待时间: %+v", res)
+	}
+	r.Reconcile(200)
+	if n := b.Used("global"); n != 200 {
+		t.Errorf("修正后共享用量应为 200，实际 %d", n)
+	}
+	if res, _ := b.Reserve("global", 500, 1000); !res.Allowed {
+		t.Errorf("修正后应允许: %+v", res)
+	}
+
+	shared.fail = true
+	if res, r := a.Reserve("global", 500, 1000); !res.Allowed || res.Used != 500 {
+		t.Errorf("后端故障时应回退到本地计数: %+v", res)
+	} else {
+		r.Reconcile(100)
+	}
+}
@@ -0,0 +1,273 @@
+// Package redis 最小化的 Redis 协议（RESP2）客户端，兼容 Redis / Valkey / KeyDB 等服务
+// 仅实现本项目用到的命令，连接通过简单连接池复用
+// @author ygw
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNil 键不存在（RESP 空回复）
+var ErrNil = errors.New("redis: nil")
+
+// Error 服务端返回的错误回复
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// 默认参数
+const (
+	defaultDialTimeout = 5 * time.Second
+	defaultIOTimeout   = 5 * time.Second
+	defaultPoolSize    = 10
+)
+
+// Client Redis 客户端（并发安全）
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+
+	pool   chan *conn
+	mu     sync.Mutex
+	closed bool
+}
+
+// conn 单个连接
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+// NewClient 根据 URL 创建客户端（不会立即建立连接）
+// URL 格式：redis://[[user]:password@]host[:port][/db]
+// @param rawURL 连接地址
+// @return *Client 客户端
+// @author ygw
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Redis 地址失败: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("不支持的 Redis 地址协议: %s", u.Scheme)
+	}
+	c := &Client{addr: u.Host, pool: make(chan *conn, defaultPoolSize)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+		if c.password == "" {
+			// redis://secret@host 形式视为仅密码
+			c.password, c.username = c.username, ""
+		}
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if c.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("Redis 数据库编号无效: %s", path)
+		}
+	}
+	return c, nil
+}
+
+// Addr 返回服务地址
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Close 关闭所有空闲连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.pool)
+	for cn := range c.pool {
+		cn.nc.Close()
+	}
+	return nil
+}
+
+// Do 执行命令并返回回复
+// 回复类型：简单字符串/批量字符串为 string，整数为 int64，数组为 []interface{}，空回复返回 ErrNil
+// @author ygw
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, args)
+	if err != nil {
+		var replyErr Error
+		if errors.Is(err, ErrNil) || errors.As(err, &replyErr) {
+			// 协议层面完整的回复，连接仍可复用
+			c.put(cn)
+		} else {
+			cn.nc.Close()
+		}
+		return nil, err
+	}
+	c.put(cn)
+	return reply, nil
+}
+
+// get 从连接池取出连接，池为空时新建
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn, ok := <-c.pool:
+		if ok {
+			return cn, nil
+		}
+		return nil, errors.New("redis: 客户端已关闭")
+	default:
+	}
+	return c.dial(ctx)
+}
+
+// put 归还连接，池已满或已关闭时直接关闭
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cn.nc.Close()
+		return
+	}
+	select {
+	case c.pool <- cn:
+	default:
+		cn.nc.Close()
+	}
+}
+
+// dial 建立新连接并完成认证和选库
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: defaultDialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+	cn := &conn{nc: nc, r: bufio.NewReader(nc)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.do(ctx, args); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("Redis 认证失败: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.do(ctx, []string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("Redis 选择数据库失败: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+// do 在单个连接上发送命令并读取回复
+func (cn *conn) do(ctx context.Context, args []string) (interface{}, error) {
+	deadline := time.Now().Add(defaultIOTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	cn.nc.SetDeadline(deadline)
+
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, err := io.WriteString(cn.nc, b.String()); err != nil {
+		return nil, err
+	}
+	return ReadReply(cn.r)
+}
+
+// ReadReply 读取一个 RESP 回复（服务端错误以 Error 返回）
+// 数组中包含错误元素时会读完整个数组后返回第一个错误；其余错误表示协议异常，连接不可再复用
+// @author ygw
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: 空回复")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		// 元素为错误回复时继续读完整个数组，保证连接上不残留未读数据
+		items := make([]interface{}, n)
+		var replyErr error
+		for i := range items {
+			item, err := ReadReply(r)
+			if err != nil && !errors.Is(err, ErrNil) {
+				var e Error
+				if !errors.As(err, &e) {
+					return nil, err
+				}
+				if replyErr == nil {
+					replyErr = err
+				}
+			}
+			items[i] = item // 数组中的空元素为 nil
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: 未知回复类型 %q", line[0])
+}
+
+// readLine 读取以 \r\n 结尾的一行
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestReadReply 测试各类 RESP 回复的解析
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    interface{}
+		wantErr error
+	}{
+		{"简单字符串", "+OK\r\n", "OK", nil},
+		{"错误", "-ERR bad\r\n", nil, Error("ERR bad")},
+		{"整数", ":42\r\n", int64(42), nil},
+		{"批量字符串", "$5\r\nhello\r\n", "hello", nil},
+		{"空批量字符串", "$0\r\n\r\n", "", nil},
+		{"空回复", "$-1\r\n", nil, ErrNil},
+		{"空数组", "*-1\r\n", nil, ErrNil},
+		{"数组", "*3\r\n+a\r\n:1\r\n$-1\r\n", []interface{}{"a", int64(1), nil}, nil},
+		{"嵌套数组", "*2\r\n*1\r\n$1\r\nx\r\n:2\r\n", []interface{}{[]interface{}{"x"}, int64(2)}, nil},
+		{"数组中的错误", "*3\r\n:1\r\n-ERR first\r\n-ERR second\r\n", nil, Error("ERR first")},
+		{"嵌套数组中的错误", "*2\r\n*2\r\n-ERR inner\r\n+ok\r\n:3\r\n", nil, Error("ERR inner")},
+	}
+	for _, tt := range tests {
+		// 每个回复后追加一个哨兵回复，检查回复是否被完整读取
+		r := bufio.NewReader(strings.NewReader(tt.raw + "+NEXT\r\n"))
+		got, err := ReadReply(r)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: 期望错误 %v，实际 %v", tt.name, tt.wantErr, err)
+			}
+		} else if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 期望 %#v，实际 %#v (%v)", tt.name, tt.want, got, err)
+		}
+		if next, err := ReadReply(r); next != "NEXT" {
+			t.Errorf("%s: 回复未被完整读取，后续读到 %#v (%v)", tt.name, next, err)
+		}
+	}
+
+	for _, raw := range []string{"", "\r\n", "?x\r\n", ":abc\r\n", "$abc\r\n", "$5\r\nab", "*2\r\n+a\r\n"} {
+		if _, err := ReadReply(bufio.NewReader(strings.NewReader(raw))); err == nil {
+			t.Errorf("异常回复 %q 应返回错误", raw)
+		}
+	}
+}
+
+// scriptServer 按顺序返回预设回复的测试服务器，记录建立的连接数
+func scriptServer(t *testing.T, replies ...string) (*Client, *int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var conns, next int32
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func() {
+				defer nc.Close()
+				r := bufio.NewReader(nc)
+				for {
+					if _, err := ReadReply(r); err != nil {
+						return
+					}
+					i := int(atomic.AddInt32(&next, 1)) - 1
+					if i >= len(replies) {
+						return
+					}
+					nc.Write([]byte(replies[i]))
+				}
+			}()
+		}
+	}()
+	c, err := NewClient("redis://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, &conns
+}
+
+// TestDo_ConnectionReuse 测试错误回复后连接仍可复用，协议异常后连接被丢弃
+func TestDo_ConnectionReuse(t *testing.T) {
+	ctx := context.Background()
+	c, conns := scriptServer(t, "*2\r\n-ERR inner\r\n:1\r\n", "-ERR top\r\n", "$-1\r\n", "+PONG\r\n")
+	if _, err := c.Do(ctx, "EXEC"); !errors.Is(err, Error("ERR inner")) {
+		t.Fatalf("应返回数组中的错误，实际 %v", err)
+	}
+	if _, err := c.Do(ctx, "BAD"); !errors.Is(err, Error("ERR top")) {
+		t.Fatalf("应返回服务端错误，实际 %v", err)
+	}
+	if _, err := c.Do(ctx, "GET", "k"); !errors.Is(err, ErrNil) {
+		t.Fatalf("应返回 ErrNil，实际 %v", err)
+	}
+	if reply, err := c.Do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("后续命令应读到自己的回复，实际 %#v (%v)", reply, err)
+	}
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Errorf("完整的错误回复后应复用连接，实际建立 %d 个连接", n)
+	}
+
+	c, conns = scriptServer(t, "?garbage\r\n", "+PONG\r\n")
+	if _, err := c.Do(ctx, "PING"); err == nil {
+		t.Fatal("未知回复类型应返回错误")
+	}
+	if reply, err := c.Do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("协议异常后应重新建立连接，实际 %#v (%v)", reply, err)
+	}
+	if n := atomic.LoadInt32(conns); n != 2 {
+		t.Errorf("协议异常后应丢弃连接，实际建立 %d 个连接", n)
+	}
+}
@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Ping 检查连接
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get 读取字符串值，键不存在时返回 ErrNil
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	return toString(reply)
+}
+
+// Set 写入字符串值（ttl 为 0 表示不过期）
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del 删除键，返回实际删除的数量
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	reply, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	return toInt(reply)
+}
+
+// HSet 写入哈希字段
+func (c *Client) HSet(ctx context.Context, key, field, value string) error {
+	_, err := c.Do(ctx, "HSET", key, field, value)
+	return err
+}
+
+// HDel 删除哈希字段
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
+	_, err := c.Do(ctx, append([]string{"HDEL", key}, fields...)...)
+	return err
+}
+
+// HGetAll 读取哈希的全部字段
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	reply, err := c.Do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items)%2 != 0 {
+		return nil, fmt.Errorf("redis: HGETALL 回复格式错误")
+	}
+	result := make(map[string]string, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		k, _ := items[i].(string)
+		v, _ := items[i+1].(string)
+		result[k] = v
+	}
+	return result, nil
+}
+
+// toString 将回复转换为字符串
+func toString(reply interface{}) (string, error) {
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis: 期望字符串回复，实际 %T", reply)
+	}
+	return s, nil
+}
+
+// toInt 将回复转换为整数
+func toInt(reply interface{}) (int64, error) {
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("redis: 期望整数回复，实际 %T", reply)
+}
+
+// SetNX 键不存在时写入（ttl 为 0 表示不过期），返回是否写入
+func (c *Client) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	if errors.Is(err, ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// IncrBy 原子增加整数值，返回新值
+func (c *Client) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	reply, err := c.Do(ctx, "INCRBY", key, strconv.FormatInt(delta, 10))
+	if err != nil {
+		return 0, err
+	}
+	return toInt(reply)
+}
+
+// PExpire 设置键的过期时间
+func (c *Client) PExpire(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := c.Do(ctx, "PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
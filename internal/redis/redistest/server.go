@@ -0,0 +1,313 @@
+// Package redistest 测试用的内存 Redis 协议服务器（仅实现本项目用到的命令）
+// @author ygw
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"claude-api/internal/redis"
+)
+
+// entry 键值（字符串或哈希）
+type entry struct {
+	str      string
+	hash     map[string]string
+	expireAt time.Time
+}
+
+// Server 内存 Redis 服务器
+type Server struct {
+	ln       net.Listener
+	password string
+
+	mu   sync.Mutex
+	data map[string]*entry
+}
+
+// NewServer 启动服务器，测试结束时自动关闭
+// @param password 非空时要求客户端 AUTH
+func NewServer(t testing.TB, password string) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试 Redis 失败: %v", err)
+	}
+	s := &Server{ln: ln, password: password, data: make(map[string]*entry)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// URL 返回连接地址
+func (s *Server) URL() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.ln.Addr().String()
+	}
+	return "redis://" + s.ln.Addr().String()
+}
+
+// Client 创建连接到该服务器的客户端
+func (s *Server) Client(t testing.TB) *redis.Client {
+	t.Helper()
+	c, err := redis.NewClient(s.URL())
+	if err != nil {
+		t.Fatalf("创建 Redis 客户端失败: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// Keys 返回当前未过期的键数量
+func (s *Server) Keys() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k := range s.data {
+		if s.lookupLocked(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	authed := s.password == ""
+	for {
+		reply, err := redis.ReadReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, it := range items {
+			args[i], _ = it.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		var out string
+		switch {
+		case cmd == "AUTH":
+			if args[len(args)-1] == s.password {
+				authed = true
+				out = "+OK\r\n"
+			} else {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		default:
+			s.mu.Lock()
+			out = s.exec(cmd, args[1:])
+			s.mu.Unlock()
+		}
+		if _, err := nc.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+// lookupLocked 查找未过期的键（过期键会被删除）
+func (s *Server) lookupLocked(key string) *entry {
+	e := s.data[key]
+	if e == nil {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !time.Now().Before(e.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+// exec 执行命令并返回 RESP 编码的回复（需持有锁）
+func (s *Server) exec(cmd string, args []string) string {
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		e := s.lookupLocked(args[0])
+		if e == nil {
+			return "$-1\r\n"
+		}
+		if e.hash != nil {
+			return wrongType()
+		}
+		return bulk(e.str)
+	case "SET":
+		if len(args) < 2 {
+			return errArgs(cmd)
+		}
+		e := &entry{str: args[1]}
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "PX", "EX":
+				if i+1 >= len(args) {
+					return errArgs(cmd)
+				}
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || n <= 0 {
+					return "-ERR invalid expire time\r\n"
+				}
+				unit := time.Millisecond
+				if strings.ToUpper(args[i]) == "EX" {
+					unit = time.Second
+				}
+				e.expireAt = time.Now().Add(time.Duration(n) * unit)
+				i++
+			case "NX":
+				if s.lookupLocked(args[0]) != nil {
+					return "$-1\r\n"
+				}
+			}
+		}
+		s.data[args[0]] = e
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if s.lookupLocked(k) != nil {
+				delete(s.data, k)
+				n++
+			}
+		}
+		return integer(int64(n))
+	case "INCRBY":
+		if len(args) != 2 {
+			return errArgs(cmd)
+		}
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		e := s.lookupLocked(args[0])
+		if e == nil {
+			e = &entry{str: "0"}
+			s.data[args[0]] = e
+		} else if e.hash != nil {
+			return wrongType()
+		}
+		n, err := strconv.ParseInt(e.str, 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		n += delta
+		e.str = strconv.FormatInt(n, 10)
+		return integer(n)
+	case "PEXPIRE":
+		if len(args) != 2 {
+			return errArgs(cmd)
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		e := s.lookupLocked(args[0])
+		if e == nil {
+			return integer(0)
+		}
+		e.expireAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return integer(1)
+	case "HSET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return errArgs(cmd)
+		}
+		e := s.lookupLocked(args[0])
+		if e == nil {
+			e = &entry{hash: make(map[string]string)}
+			s.data[args[0]] = e
+		} else if e.hash == nil {
+			return wrongType()
+		}
+		added := 0
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := e.hash[args[i]]; !ok {
+				added++
+			}
+			e.hash[args[i]] = args[i+1]
+		}
+		return integer(int64(added))
+	case "HDEL":
+		if len(args) < 2 {
+			return errArgs(cmd)
+		}
+		e := s.lookupLocked(args[0])
+		if e == nil {
+			return integer(0)
+		}
+		if e.hash == nil {
+			return wrongType()
+		}
+		n := 0
+		for _, f := range args[1:] {
+			if _, ok := e.hash[f]; ok {
+				delete(e.hash, f)
+				n++
+			}
+		}
+		if len(e.hash) == 0 {
+			delete(s.data, args[0])
+		}
+		return integer(int64(n))
+	case "HGETALL":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		e := s.lookupLocked(args[0])
+		if e == nil {
+			return "*0\r\n"
+		}
+		if e.hash == nil {
+			return wrongType()
+		}
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("*%d\r\n", len(e.hash)*2))
+		for k, v := range e.hash {
+			b.WriteString(bulk(k))
+			b.WriteString(bulk(v))
+		}
+		return b.String()
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func integer(n int64) string {
+	return ":" + strconv.FormatInt(n, 10) + "\r\n"
+}
+
+func errArgs(cmd string) string {
+	return fmt.Sprintf("-ERR wrong number of arguments for '%s' command\r\n", strings.ToLower(cmd))
+}
+
+func wrongType() string {
+	return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+}
@@ -0,0 +1,353 @@
+// Package refresh 提供按令牌过期时间驱动的主动刷新调度
+// 每个账号按过期时间减去提前量和随机抖动排入最小堆，到期后在并发上限内刷新，失败按账号指数退避
+// @author ygw
+package refresh
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Func 刷新单个账号的令牌，返回新令牌的过期时间
+type Func func(ctx context.Context, accountID string) (time.Time, error)
+
+// Config 调度参数
+type Config struct {
+	Lead          time.Duration // 至少提前多久刷新
+	Jitter        time.Duration // 在提前量之外再随机提前 [0, Jitter)，避免同时过期的账号同时刷新
+	OverdueSpread time.Duration // 已过刷新时间的账号在 [0, OverdueSpread) 内随机分散执行
+	Concurrency   int           // 同时刷新的账号数
+	BaseBackoff   time.Duration // 首次失败后的重试间隔，之后每次翻倍
+	MaxBackoff    time.Duration // 最长重试间隔
+}
+
+// DefaultConfig 默认调度参数：在过期前 5~15 分钟刷新
+func DefaultConfig() Config {
+	return Config{
+		Lead:          5 * time.Minute,
+		Jitter:        10 * time.Minute,
+		OverdueSpread: time.Minute,
+		Concurrency:   5,
+		BaseBackoff:   30 * time.Second,
+		MaxBackoff:    30 * time.Minute,
+	}
+}
+
+// idleWait 堆为空时的最长等待时间（有新任务时会被唤醒）
+const idleWait = time.Hour
+
+// Scheduler 令牌刷新调度器
+type Scheduler struct {
+	mu       sync.Mutex
+	cfg      Config
+	refresh  Func
+	queue    itemHeap
+	items    map[string]*item // 账号ID -> 调度项（包括执行中的）
+	failures map[string]int   // 账号ID -> 连续失败次数
+	inFlight int
+	wake     chan struct{}
+	rnd      *rand.Rand
+	now      func() time.Time
+	stats    counters
+}
+
+// item 调度项
+type item struct {
+	accountID string
+	due       time.Time // 计划刷新时间
+	expiresAt time.Time // 当前令牌过期时间（零值表示未知）
+	index     int       // 堆中位置，-1 表示执行中
+}
+
+// New 创建调度器，调用 Run 后开始执行
+// @param cfg 调度参数，零值字段使用默认值
+// @param fn 刷新函数
+// @author ygw
+func New(cfg Config, fn Func) *Scheduler {
+	def := DefaultConfig()
+	if cfg.Lead <= 0 {
+		cfg.Lead = def.Lead
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+	if cfg.OverdueSpread < 0 {
+		cfg.OverdueSpread = 0
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = def.Concurrency
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.MaxBackoff < cfg.BaseBackoff {
+		cfg.MaxBackoff = cfg.BaseBackoff
+	}
+	return &Scheduler{
+		cfg:      cfg,
+		refresh:  fn,
+		items:    make(map[string]*item),
+		failures: make(map[string]int),
+		wake:     make(chan struct{}, 1),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:      time.Now,
+		stats:    newCounters(),
+	}
+}
+
+// SetConcurrency 调整刷新并发数
+func (s *Scheduler) SetConcurrency(n int) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.cfg.Concurrency = n
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Schedule 记录账号令牌的过期时间并安排下一次刷新（令牌刚刷新成功时调用，会清除失败计数）
+// @param accountID 账号ID
+// @param expiresAt 令牌过期时间，零值表示未知（立即刷新）
+// @author ygw
+func (s *Scheduler) Schedule(accountID string, expiresAt time.Time) {
+	s.mu.Lock()
+	delete(s.failures, accountID)
+	s.put(accountID, expiresAt, s.dueFor(expiresAt))
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Window 提前刷新窗口：剩余有效期小于该值的令牌已处于（或即将进入）刷新计划内
+func (s *Scheduler) Window() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.Lead + s.cfg.Jitter
+}
+
+// RefreshSoon 让账号尽快刷新（在 OverdueSpread 内），不清除失败退避
+func (s *Scheduler) RefreshSoon(accountID string) {
+	s.mu.Lock()
+	if it, ok := s.items[accountID]; ok && it.index < 0 {
+		s.mu.Unlock()
+		return // 正在刷新
+	}
+	due := s.now()
+	if it, ok := s.items[accountID]; ok {
+		if s.failures[accountID] > 0 || !it.due.After(due) {
+			s.mu.Unlock()
+			return // 退避中或已到期
+		}
+		s.put(accountID, it.expiresAt, due)
+	} else {
+		s.put(accountID, time.Time{}, due)
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Sync 与当前账号集合对齐：新账号按过期时间加入，不在集合中的账号移除，已有账号保持原计划
+// @param accounts 账号ID -> 令牌过期时间
+// @author ygw
+func (s *Scheduler) Sync(accounts map[string]time.Time) {
+	s.mu.Lock()
+	for id, it := range s.items {
+		if _, ok := accounts[id]; !ok {
+			s.remove(it)
+		}
+	}
+	for id, expiresAt := range accounts {
+		if _, ok := s.items[id]; !ok {
+			s.put(id, expiresAt, s.dueFor(expiresAt))
+		}
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Remove 取消账号的刷新计划
+func (s *Scheduler) Remove(accountID string) {
+	s.mu.Lock()
+	if it, ok := s.items[accountID]; ok {
+		s.remove(it)
+	}
+	s.mu.Unlock()
+}
+
+// RecordLead 记录一次成功刷新时距令牌过期的剩余时间（负数表示已过期才刷新）
+func (s *Scheduler) RecordLead(lead time.Duration) {
+	s.mu.Lock()
+	s.stats.recordLead(lead)
+	s.mu.Unlock()
+}
+
+// RecordBlocking 记录一次请求路径上的同步刷新（令牌已过期，无法避免）
+func (s *Scheduler) RecordBlocking() {
+	s.mu.Lock()
+	s.stats.blocking++
+	s.mu.Unlock()
+}
+
+// Run 执行调度循环，直到 ctx 取消
+// @author ygw
+func (s *Scheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(idleWait)
+	defer timer.Stop()
+
+	for {
+		wait := s.dispatch(ctx)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// dispatch 启动所有已到期的刷新（不超过并发上限），返回距下一个到期项的等待时间
+func (s *Scheduler) dispatch(ctx context.Context) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for len(s.queue) > 0 && s.inFlight < s.cfg.Concurrency && !s.queue[0].due.After(now) {
+		it := heap.Pop(&s.queue).(*item)
+		s.inFlight++
+		go s.execute(ctx, it)
+	}
+	if len(s.queue) == 0 || s.inFlight >= s.cfg.Concurrency {
+		return idleWait // 刷新完成时会唤醒
+	}
+	return s.queue[0].due.Sub(now)
+}
+
+// execute 执行一次刷新，成功后按新过期时间重新排期，失败则指数退避
+func (s *Scheduler) execute(ctx context.Context, it *item) {
+	expiresAt, err := s.refresh(ctx, it.accountID)
+
+	s.mu.Lock()
+	s.inFlight--
+	if err != nil {
+		s.stats.failure++
+	} else {
+		s.stats.success++
+	}
+	// 执行期间被移除或已被重新排期（如刷新函数内部调用了 Schedule）时不再处理
+	if s.items[it.accountID] == it && it.index < 0 {
+		if err == nil {
+			delete(s.failures, it.accountID)
+			s.put(it.accountID, expiresAt, s.dueFor(expiresAt))
+		} else {
+			s.failures[it.accountID]++
+			s.put(it.accountID, it.expiresAt, s.now().Add(s.backoff(s.failures[it.accountID])))
+		}
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// dueFor 计算刷新时间：过期时间 - 提前量 - 随机抖动；已过该时间的分散到 OverdueSpread 内（调用方持有锁）
+func (s *Scheduler) dueFor(expiresAt time.Time) time.Time {
+	now := s.now()
+	if !expiresAt.IsZero() {
+		due := expiresAt.Add(-s.cfg.Lead - s.randDuration(s.cfg.Jitter))
+		if due.After(now) {
+			return due
+		}
+	}
+	return now.Add(s.randDuration(s.cfg.OverdueSpread))
+}
+
+// backoff 第 n 次连续失败后的重试间隔（带 ±25% 抖动）（调用方持有锁）
+func (s *Scheduler) backoff(n int) time.Duration {
+	d := s.cfg.BaseBackoff
+	for i := 1; i < n && d < s.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.cfg.MaxBackoff {
+		d = s.cfg.MaxBackoff
+	}
+	return d - d/4 + s.randDuration(d/2)
+}
+
+// randDuration 返回 [0, d) 内的随机时长（调用方持有锁）
+func (s *Scheduler) randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(s.rnd.Int63n(int64(d)))
+}
+
+// put 新增或更新调度项（调用方持有锁）
+func (s *Scheduler) put(accountID string, expiresAt, due time.Time) {
+	it, ok := s.items[accountID]
+	if !ok {
+		it = &item{accountID: accountID, index: -1}
+		s.items[accountID] = it
+	}
+	it.expiresAt, it.due = expiresAt, due
+	if it.index >= 0 {
+		heap.Fix(&s.queue, it.index)
+	} else {
+		heap.Push(&s.queue, it)
+	}
+}
+
+// remove 删除调度项（调用方持有锁）
+func (s *Scheduler) remove(it *item) {
+	if it.index >= 0 {
+		heap.Remove(&s.queue, it.index)
+	}
+	delete(s.items, it.accountID)
+	delete(s.failures, it.accountID)
+}
+
+// notify 唤醒调度循环
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// itemHeap 按计划刷新时间排序的最小堆
+type itemHeap []*item
+
+func (h itemHeap) Len() int           { return len(h) }
+func (h itemHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h itemHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *itemHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+	return it
+}
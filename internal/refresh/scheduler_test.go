@@ -0,0 +1,105 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDueFor 测试刷新时间的提前量、抖动和过期令牌的分散
+func TestDueFor(t *testing.T) {
+	s := New(Config{Lead: 5 * time.Minute, Jitter: 10 * time.Minute, OverdueSpread: time.Minute}, nil)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	expiresAt := now.Add(time.Hour)
+	for i := 0; i < 200; i++ {
+		due := s.dueFor(expiresAt)
+		if lead := expiresAt.Sub(due); lead < 5*time.Minute || lead >= 15*time.Minute {
+			t.Fatalf("提前量应在 [5m, 15m) 内, 实际 %v", lead)
+		}
+		if due := s.dueFor(now.Add(time.Minute)); due.Before(now) || !due.Before(now.Add(time.Minute)) {
+			t.Fatalf("已过刷新时间的应分散到 1 分钟内, 实际 %v", due.Sub(now))
+		}
+	}
+	if due := s.dueFor(time.Time{}); due.Sub(now) >= time.Minute {
+		t.Errorf("未知过期时间应尽快刷新, 实际 %v", due.Sub(now))
+	}
+
+	for n, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 20: 30 * time.Minute} {
+		if d := s.backoff(n); d < want*3/4 || d > want*5/4 {
+			t.Errorf("第 %d 次失败的退避应约为 %v, 实际 %v", n, want, d)
+		}
+	}
+}
+
+// TestSchedulerRun 测试并发上限、成功后按新过期时间排期、失败退避和 Sync
+func TestSchedulerRun(t *testing.T) {
+	var running, maxRunning int32
+	var calls sync.Map
+	release := make(chan struct{})
+	s := New(Config{Lead: time.Minute, Jitter: 0, OverdueSpread: 0, Concurrency: 2}, func(ctx context.Context, id string) (time.Time, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		calls.Store(id, true)
+		if id == "bad" {
+			return time.Time{}, errors.New("invalid_grant")
+		}
+		return time.Now().Add(time.Hour), nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	past := time.Now().Add(-time.Minute)
+	s.Sync(map[string]time.Time{"a": past, "b": past, "c": past, "bad": past, "later": time.Now().Add(time.Hour)})
+	for i := 0; i < 4; i++ {
+		release <- struct{}{}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Stats().Success+s.Stats().Failure < 4 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	st := s.Stats()
+	if st.Success != 3 || st.Failure != 1 || st.Backoff != 1 {
+		t.Fatalf("统计错误: %+v", st)
+	}
+	if maxRunning > 2 {
+		t.Errorf("并发不应超过 2, 实际 %d", maxRunning)
+	}
+	if _, ok := calls.Load("later"); ok {
+		t.Error("未到期的账号不应刷新")
+	}
+
+	s.mu.Lock()
+	if due := s.items["a"].due; time.Until(due) < 58*time.Minute {
+		t.Errorf("成功后应按新过期时间排期, 实际 %v 后", time.Until(due))
+	}
+	if due := s.items["bad"].due; time.Until(due) < 20*time.Second || time.Until(due) > 40*time.Second {
+		t.Errorf("失败后应退避约 30s, 实际 %v 后", time.Until(due))
+	}
+	s.mu.Unlock()
+
+	s.Sync(map[string]time.Time{"a": {}})
+	if st := s.Stats(); st.Scheduled != 1 || st.Backoff != 0 {
+		t.Errorf("Sync 应移除不在集合中的账号: %+v", st)
+	}
+
+	s.RecordLead(10 * time.Minute)
+	s.RecordLead(-time.Second)
+	if st := s.Stats(); st.LeadTime["10-15m"] != 1 || st.LeadTime["expired"] != 1 || st.LeadMinSecs != -1 {
+		t.Errorf("提前量分布错误: %+v", st)
+	}
+}
@@ -0,0 +1,103 @@
+package refresh
+
+import "time"
+
+// leadBuckets 刷新提前量分布的区间上限（最后一个区间无上限）
+var leadBuckets = []struct {
+	name  string
+	upper time.Duration
+}{
+	{"expired", 0},
+	{"0-1m", time.Minute},
+	{"1-5m", 5 * time.Minute},
+	{"5-10m", 10 * time.Minute},
+	{"10-15m", 15 * time.Minute},
+	{"15-30m", 30 * time.Minute},
+	{"30m+", 0},
+}
+
+// counters 累计统计（由 Scheduler.mu 保护）
+type counters struct {
+	success  int64
+	failure  int64
+	blocking int64
+	leads    map[string]int64
+	leadSum  time.Duration
+	leadN    int64
+	leadMin  time.Duration
+}
+
+func newCounters() counters {
+	leads := make(map[string]int64, len(leadBuckets))
+	for _, b := range leadBuckets {
+		leads[b.name] = 0
+	}
+	return counters{leads: leads}
+}
+
+// recordLead 记录一次刷新提前量
+func (c *counters) recordLead(lead time.Duration) {
+	c.leads[leadBucket(lead)]++
+	c.leadSum += lead
+	if c.leadN == 0 || lead < c.leadMin {
+		c.leadMin = lead
+	}
+	c.leadN++
+}
+
+// leadBucket 返回提前量所属区间
+func leadBucket(lead time.Duration) string {
+	if lead < 0 {
+		return leadBuckets[0].name
+	}
+	for _, b := range leadBuckets[1 : len(leadBuckets)-1] {
+		if lead < b.upper {
+			return b.name
+		}
+	}
+	return leadBuckets[len(leadBuckets)-1].name
+}
+
+// Stats 调度器统计
+type Stats struct {
+	Scheduled   int              `json:"scheduled"`          // 已排期的账号数
+	InFlight    int              `json:"in_flight"`          // 正在刷新的账号数
+	Backoff     int              `json:"backoff"`            // 处于失败退避中的账号数
+	Concurrency int              `json:"concurrency"`        // 刷新并发数
+	NextDue     string           `json:"next_due,omitempty"` // 最近一次计划刷新时间
+	Success     int64            `json:"success"`            // 调度刷新成功次数
+	Failure     int64            `json:"failure"`            // 调度刷新失败次数
+	Blocking    int64            `json:"blocking"`           // 请求路径上的同步刷新次数（令牌已过期）
+	LeadTime    map[string]int64 `json:"lead_time"`          // 成功刷新时距令牌过期的剩余时间分布
+	LeadAvgSecs float64          `json:"lead_avg_seconds"`   // 平均提前量（秒）
+	LeadMinSecs float64          `json:"lead_min_seconds"`   // 最小提前量（秒，负数表示过期后才刷新）
+}
+
+// Stats 返回当前统计
+// @author ygw
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Stats{
+		Scheduled:   len(s.items),
+		InFlight:    s.inFlight,
+		Backoff:     len(s.failures),
+		Concurrency: s.cfg.Concurrency,
+		Success:     s.stats.success,
+		Failure:     s.stats.failure,
+		Blocking:    s.stats.blocking,
+		LeadTime:    make(map[string]int64, len(s.stats.leads)),
+	}
+	if len(s.queue) > 0 {
+		st.NextDue = s.queue[0].due.Format(time.RFC3339)
+	}
+	for k, v := range s.stats.leads {
+		st.LeadTime[k] = v
+	}
+	if s.stats.leadN > 0 {
+		st.LeadAvgSecs = (s.stats.leadSum / time.Duration(s.stats.leadN)).Seconds()
+		st.LeadMinSecs = s.stats.leadMin.Seconds()
+	}
+	return st
+}
@@ -0,0 +1,314 @@
+package ssocache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/database"
+	"claude-api/internal/logger"
+	"claude-api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// 导入结果状态
+const (
+	StatusImported   = "imported"   // 已创建账号
+	StatusValid      = "valid"      // 验证通过（预览模式，未创建）
+	StatusDuplicate  = "duplicate"  // 账号已存在
+	StatusInvalid    = "invalid"    // 凭证验证失败
+	StatusFailed     = "failed"     // 保存失败
+	StatusLimit      = "limit"      // 已达账号数量上限
+	StatusUnverified = "unverified" // 预览模式下缓存的 accessToken 已失效，未刷新验证
+)
+
+// errRefreshSkipped 预览模式下不刷新令牌（刷新可能轮换 refreshToken，使本地缓存中的令牌失效）
+var errRefreshSkipped = errors.New("缓存的 accessToken 已失效，预览模式不刷新令牌（刷新可能轮换 refreshToken），实际导入时再验证")
+
+// Result 单个凭证的导入结果
+type Result struct {
+	Source     string `json:"source"`
+	AuthMethod string `json:"authMethod"`
+	Status     string `json:"status"`
+	Email      string `json:"email,omitempty"`
+	UserID     string `json:"userId,omitempty"`
+	AccountID  string `json:"accountId,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+}
+
+// Importer 验证凭证并创建账号
+type Importer struct {
+	DB          *database.DB
+	Kiro        *auth.KiroClient
+	OIDC        *auth.OIDCClient
+	MaxAccounts int
+	DryRun      bool // 只验证和查重，不创建账号
+}
+
+// Import 逐个验证凭证并创建账号
+// 优先用缓存中的 accessToken 获取用户信息验证；失效时社交登录凭证使用 KiroClient.VerifyAndGetUserInfo 刷新验证，
+// IdC 凭证使用 OIDC 刷新后获取用户信息
+// 按 Q 用户 ID 查重（数据库中已有的账号和本批次中先出现的凭证），获取不到用户信息时按 refreshToken / clientId 查重
+// 刷新轮换了 refreshToken 但未创建账号时，新令牌写回现有账号或导入备份表，不会丢弃
+// @return []*Result 与 creds 一一对应的结果
+// @author ygw
+func (im *Importer) Import(ctx context.Context, creds []*Credential) ([]*Result, error) {
+	count, err := im.DB.GetAccountCount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取账号数量失败: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	results := make([]*Result, 0, len(creds))
+	for _, cred := range creds {
+		res := &Result{Source: cred.Source, AuthMethod: cred.AuthMethod}
+		results = append(results, res)
+		if ctx.Err() != nil {
+			res.Status, res.Error = StatusFailed, ctx.Err().Error()
+			continue
+		}
+		if !im.DryRun && count >= im.MaxAccounts {
+			res.Status, res.Error = StatusLimit, fmt.Sprintf("账号数量已达上限 %d", im.MaxAccounts)
+			continue
+		}
+		if !auth.ValidRegion(cred.Region) {
+			res.Status, res.Error = StatusInvalid, "无效的区域: "+cred.Region
+			continue
+		}
+		region := auth.NormalizeRegion(cred.Region)
+		machineID := auth.GenerateKiroMachineID()
+
+		verified, err := im.verify(ctx, cred, region, machineID)
+		if errors.Is(err, errRefreshSkipped) {
+			res.Status, res.Error = StatusUnverified, err.Error()
+			continue
+		}
+		if err != nil {
+			logger.Warn("[SSO缓存导入] %s 验证失败: %v", cred.Source, err)
+			res.Status, res.Error = StatusInvalid, err.Error()
+			continue
+		}
+		if verified.RefreshToken == "" {
+			verified.RefreshToken = cred.RefreshToken
+		}
+		if verified.UserInfo != nil {
+			res.Email, res.UserID = verified.UserInfo.Email, verified.UserInfo.UserID
+		}
+
+		// 查重：优先按 Q 用户 ID，获取不到用户信息时按凭证本身
+		var keys []string
+		var existing *models.Account
+		if res.UserID != "" {
+			keys = []string{"user:" + res.UserID}
+			existing, err = im.DB.GetAccountByQUserID(ctx, res.UserID)
+		} else {
+			clientID := ""
+			if cred.AuthMethod == AuthIdC {
+				clientID = cred.ClientID
+				keys = append(keys, "client:"+clientID)
+			}
+			keys = append(keys, "token:"+cred.RefreshToken)
+			res.Warning = "未能获取用户信息，按 refreshToken / clientId 查重"
+			existing, err = im.DB.GetAccountByCredential(ctx, cred.RefreshToken, clientID)
+		}
+		if err != nil {
+			res.Status, res.Error = StatusFailed, fmt.Sprintf("查重失败: %v", err)
+			im.keepRotated(ctx, cred, verified, res, nil)
+			continue
+		}
+		duplicate := ""
+		for _, key := range keys {
+			if seen[key] {
+				duplicate = "与本批次中的其他凭证属于同一账号"
+			}
+		}
+		if existing != nil {
+			duplicate, res.AccountID = "账号已存在（重复）", existing.ID
+		}
+		if duplicate != "" {
+			res.Status, res.Error = StatusDuplicate, duplicate
+			im.keepRotated(ctx, cred, verified, res, existing)
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = true
+		}
+
+		if im.DryRun {
+			res.Status = StatusValid
+			continue
+		}
+
+		account := newAccount(cred, verified, res, region, machineID)
+		if err := im.DB.CreateAccount(ctx, account); err != nil {
+			res.Status, res.Error = StatusFailed, fmt.Sprintf("保存账号失败: %v", err)
+			im.keepRotated(ctx, cred, verified, res, nil)
+			continue
+		}
+		im.saveBackup(ctx, cred, verified, res, account.ID)
+
+		count++
+		res.Status, res.AccountID = StatusImported, account.ID
+		if verified.RefreshToken != cred.RefreshToken {
+			res.Warning = "refreshToken 已被轮换，本地缓存中的令牌可能已失效"
+		}
+		logger.Info("[SSO缓存导入] 已导入 %s - Email: %s, UserID: %s", cred.Source, res.Email, res.UserID)
+	}
+	return results, nil
+}
+
+// verify 验证凭证并获取用户信息
+// 优先用缓存中的 accessToken 获取用户信息，不消耗 refreshToken；失效时才刷新令牌（预览模式下返回 errRefreshSkipped）
+// 刷新成功但用户信息获取失败时仍视为有效，与 Token 导入一致
+func (im *Importer) verify(ctx context.Context, cred *Credential, region, machineID string) (*auth.VerifyTokenResult, error) {
+	if cred.AccessToken != "" {
+		userInfo, err := im.Kiro.GetUserInfo(ctx, region, cred.AccessToken, machineID)
+		if err == nil {
+			return &auth.VerifyTokenResult{
+				Success:      true,
+				AccessToken:  cred.AccessToken,
+				RefreshToken: cred.RefreshToken,
+				UserInfo:     userInfo,
+			}, nil
+		}
+		logger.Debug("[SSO缓存导入] %s 缓存的 accessToken 不可用，改为刷新令牌: %v", cred.Source, err)
+	}
+	if im.DryRun {
+		return nil, errRefreshSkipped
+	}
+
+	if cred.AuthMethod == AuthSocial {
+		result, err := im.Kiro.VerifyAndGetUserInfo(ctx, region, cred.RefreshToken, machineID)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Success {
+			return nil, fmt.Errorf("社交登录刷新失败: %s", result.Error)
+		}
+		return result, nil
+	}
+
+	accessToken, refreshToken, expiresIn, err := im.OIDC.RefreshAccessTokenWithExpiry(ctx, region, cred.ClientID, cred.ClientSecret, cred.RefreshToken, machineID)
+	if err != nil {
+		return nil, fmt.Errorf("IdC 刷新失败: %w", err)
+	}
+	userInfo, err := im.Kiro.GetUserInfo(ctx, region, accessToken, machineID)
+	if err != nil {
+		logger.Warn("[SSO缓存导入] %s 获取用户信息失败: %v", cred.Source, err)
+	}
+	return &auth.VerifyTokenResult{
+		Success:      true,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    expiresIn,
+		UserInfo:     userInfo,
+	}, nil
+}
+
+// keepRotated 刷新轮换了 refreshToken 但未创建账号时保存新令牌，避免丢弃后本地缓存和数据库中都没有可用令牌
+// 现有账号使用的正是被轮换的令牌时直接更新该账号，否则写入导入备份表
+func (im *Importer) keepRotated(ctx context.Context, cred *Credential, verified *auth.VerifyTokenResult, res *Result, existing *models.Account) {
+	if verified.RefreshToken == cred.RefreshToken {
+		return
+	}
+	if existing != nil && existing.RefreshToken != nil && *existing.RefreshToken == cred.RefreshToken {
+		var expiresAt int64
+		if verified.ExpiresIn > 0 {
+			expiresAt = time.Now().Add(time.Duration(verified.ExpiresIn) * time.Second).Unix()
+		}
+		err := im.DB.UpdateTokensWithExpiry(ctx, existing.ID, verified.AccessToken, verified.RefreshToken, "success", expiresAt)
+		if err == nil {
+			res.Warning = "refreshToken 已被轮换，已更新现有账号的令牌"
+			logger.Warn("[SSO缓存导入] %s refreshToken 已被轮换，已更新现有账号 %s", cred.Source, existing.ID)
+			return
+		}
+		logger.Error("[SSO缓存导入] %s 更新现有账号令牌失败: %v", cred.Source, err)
+	}
+	accountID := ""
+	if existing != nil {
+		accountID = existing.ID
+	}
+	im.saveBackup(ctx, cred, verified, res, accountID)
+	res.Warning = "refreshToken 已被轮换，本地缓存中的令牌可能已失效，新令牌已保存到导入备份记录"
+	logger.Warn("[SSO缓存导入] %s refreshToken 已被轮换，新令牌已保存到导入备份记录", cred.Source)
+}
+
+// newAccount 根据验证结果构造账号
+func newAccount(cred *Credential, verified *auth.VerifyTokenResult, res *Result, region, machineID string) *models.Account {
+	label := res.Email
+	if label == "" {
+		label = "SSO导入_" + strings.TrimSuffix(cred.Source, ".json")
+	}
+	clientID, clientSecret, authMethod := cred.ClientID, cred.ClientSecret, AuthIdC
+	if cred.AuthMethod == AuthSocial {
+		// 社交登录账号使用占位 clientId，刷新时据此选择 Kiro 刷新接口
+		clientID = fmt.Sprintf("social-%s", uuid.New().String()[:8])
+		clientSecret = "social-token"
+		authMethod = AuthSocial
+	}
+
+	now := models.CurrentTime()
+	account := &models.Account{
+		ID:                uuid.New().String(),
+		Label:             &label,
+		ClientID:          clientID,
+		ClientSecret:      clientSecret,
+		RefreshToken:      &verified.RefreshToken,
+		AccessToken:       &verified.AccessToken,
+		LastRefreshTime:   &now,
+		LastRefreshStatus: strPtr("success"),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		Enabled:           true,
+		QUserID:           strPtr(res.UserID),
+		Email:             strPtr(res.Email),
+		AuthMethod:        &authMethod,
+		Region:            &region,
+		MachineID:         &machineID,
+	}
+	if cred.StartURL != "" && cred.StartURL != auth.DefaultStartURL {
+		account.StartURL = strPtr(cred.StartURL)
+	}
+	if verified.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(verified.ExpiresIn) * time.Second).Unix()
+		account.TokenExpiry = &expiresAt
+	}
+	return account
+}
+
+// saveBackup 保存到 imported_accounts 备份表（失败不影响导入结果），accountID 为空表示未关联账号
+func (im *Importer) saveBackup(ctx context.Context, cred *Credential, verified *auth.VerifyTokenResult, res *Result, accountID string) {
+	rawResponse, _ := json.Marshal(verified)
+	backup := &database.ImportedAccount{
+		ID:                   uuid.New().String(),
+		OriginalRefreshToken: cred.RefreshToken,
+		Email:                strPtr(res.Email),
+		QUserID:              strPtr(res.UserID),
+		AccessToken:          &verified.AccessToken,
+		NewRefreshToken:      &verified.RefreshToken,
+		ImportedAt:           models.CurrentTime(),
+		RawResponse:          strPtr(string(rawResponse)),
+		ImportSource:         "sso_cache",
+	}
+	if accountID != "" {
+		backup.AccountID = &accountID
+	}
+	if verified.UserInfo != nil {
+		backup.SubscriptionType = strPtr(verified.UserInfo.SubscriptionType)
+		backup.UsageCurrent = verified.UserInfo.UsageCurrent
+		backup.UsageLimit = verified.UserInfo.UsageLimit
+	}
+	if err := im.DB.CreateImportedAccount(ctx, backup); err != nil {
+		logger.Warn("[SSO缓存导入] 保存备份记录失败（账号已成功创建）- %s: %v", cred.Source, err)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,79 @@
+package ssocache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-api/internal/auth"
+	"claude-api/internal/config"
+	"claude-api/internal/database"
+	"claude-api/internal/models"
+)
+
+// TestImport_CredentialDedup 测试获取不到用户信息时按 refreshToken / clientId 在数据库和本批次中查重
+func TestImport_CredentialDedup(t *testing.T) {
+	cfg := &config.Config{Database: config.DatabaseConfig{Type: config.DatabaseTypeSQLite, SQLite: config.SQLiteConfig{Path: ":memory:"}}}
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	// 本地上游：OIDC 刷新返回原 refreshToken（不轮换），用户信息查询失败，走凭证查重
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			json.NewEncoder(w).Encode(map[string]interface{}{"accessToken": "at", "refreshToken": payload["refreshToken"], "expiresIn": 3600})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+	up := config.DefaultUpstream()
+	up.OIDCURL = upstream.URL
+	up.AmazonQURL = upstream.URL
+	auth.SetUpstream(up)
+	defer auth.SetUpstream(config.DefaultUpstream())
+
+	existingToken := "rt-existing"
+	existing := &models.Account{ID: "acc-existing", ClientID: "cid-existing", ClientSecret: "cs", RefreshToken: &existingToken, Enabled: true, CreatedAt: models.CurrentTime(), UpdatedAt: models.CurrentTime()}
+	if err := db.CreateAccount(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := func(source, clientID, refreshToken string) *Credential {
+		return &Credential{Source: source, AuthMethod: AuthIdC, ClientID: clientID, ClientSecret: "cs", RefreshToken: refreshToken, Region: "us-east-1"}
+	}
+	im := &Importer{DB: db, Kiro: auth.NewKiroClient(cfg), OIDC: auth.NewOIDCClient(cfg), MaxAccounts: 100}
+	results, err := im.Import(ctx, []*Credential{
+		cred("same-client.json", "cid-existing", "rt-other"),
+		cred("same-token.json", "cid-new", "rt-existing"),
+		cred("fresh.json", "cid-fresh", "rt-fresh"),
+		cred("fresh-copy.json", "cid-fresh-2", "rt-fresh"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ status, accountID string }{
+		{StatusDuplicate, existing.ID},
+		{StatusDuplicate, existing.ID},
+		{StatusImported, ""},
+		{StatusDuplicate, ""},
+	}
+	for i, w := range want {
+		res := results[i]
+		if res.Status != w.status || (w.accountID != "" && res.AccountID != w.accountID) {
+			t.Errorf("%s: 期望 %s (%s)，实际 %s (%s) %s", res.Source, w.status, w.accountID, res.Status, res.AccountID, res.Error)
+		}
+	}
+	if n, err := db.GetAccountCount(ctx); err != nil || n != 2 {
+		t.Errorf("应只新建 1 个账号，实际共 %d 个 (%v)", n, err)
+	}
+}
@@ -0,0 +1,176 @@
+// Package ssocache 从 Kiro / AWS SSO 缓存目录（~/.aws/sso/cache）导入账号凭证
+// 缓存目录中的令牌文件（kiro-auth-token.json、AWS CLI 的 SSO 令牌文件）与客户端注册文件配对后，
+// 逐个验证并创建账号
+// @author ygw
+package ssocache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 认证方式
+const (
+	AuthSocial = "social" // Kiro 社交登录（GitHub / Google），使用 Kiro 刷新接口
+	AuthIdC    = "IdC"    // Builder ID / IAM Identity Center，使用 OIDC 刷新接口
+)
+
+// maxFileSize 单个缓存文件的大小上限
+const maxFileSize = 1 << 20
+
+// File 缓存目录中的一个文件
+type File struct {
+	Name string // 文件名（不含目录）
+	Data []byte
+}
+
+// Credential 一组配对完成、可用于导入的凭证
+type Credential struct {
+	Source           string `json:"source"`                     // 令牌文件名
+	RegistrationFile string `json:"registrationFile,omitempty"` // 配对的客户端注册文件名
+	AuthMethod       string `json:"authMethod"`
+	Provider         string `json:"provider,omitempty"`
+	RefreshToken     string `json:"-"`
+	AccessToken      string `json:"-"`
+	ClientID         string `json:"-"`
+	ClientSecret     string `json:"-"`
+	Region           string `json:"region,omitempty"`
+	StartURL         string `json:"startUrl,omitempty"`
+}
+
+// Skipped 未能使用的文件及原因
+type Skipped struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// cacheEntry 缓存文件中可能出现的字段（Kiro 令牌、AWS CLI SSO 令牌和客户端注册文件的并集）
+type cacheEntry struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	ClientIDHash string `json:"clientIdHash"`
+	AuthMethod   string `json:"authMethod"`
+	Provider     string `json:"provider"`
+	Region       string `json:"region"`
+	StartURL     string `json:"startUrl"`
+}
+
+// DefaultDir 默认缓存目录 ~/.aws/sso/cache
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".aws", "sso", "cache")
+	}
+	return filepath.Join(home, ".aws", "sso", "cache")
+}
+
+// ReadDir 读取缓存目录下的所有 JSON 文件（不递归）
+// @param dir 缓存目录，为空时使用 DefaultDir
+// @author ygw
+func ReadDir(dir string) ([]File, error) {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存目录失败: %w", err)
+	}
+
+	var files []File
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".json") {
+			continue
+		}
+		if info, err := e.Info(); err != nil || info.Size() > maxFileSize {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取缓存文件失败: %w", err)
+		}
+		files = append(files, File{Name: e.Name(), Data: data})
+	}
+	return files, nil
+}
+
+// Parse 解析缓存文件并将令牌与客户端注册配对
+// 配对规则：
+// 1. 令牌文件自带 clientId / clientSecret（AWS CLI SSO 令牌）→ 直接使用
+// 2. 令牌文件带 clientIdHash（kiro-auth-token.json）→ 使用同名的 <clientIdHash>.json 注册文件
+// 3. 社交登录令牌无需客户端注册
+// 同一 refreshToken 出现多次时只保留第一个
+// @return creds 可导入的凭证（按文件名排序）
+// @return skipped 无法使用的令牌文件及原因（客户端注册文件和无关文件不计入）
+// @author ygw
+func Parse(files []File) ([]*Credential, []Skipped) {
+	sorted := append([]File(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var tokens []File
+	parsed := make(map[string]*cacheEntry, len(sorted))
+	registrations := make(map[string]string) // 注册文件名（不含扩展名）-> 文件名
+	var skipped []Skipped
+	for _, f := range sorted {
+		var e cacheEntry
+		if err := json.Unmarshal(f.Data, &e); err != nil {
+			skipped = append(skipped, Skipped{File: f.Name, Reason: "不是有效的 JSON 文件"})
+			continue
+		}
+		parsed[f.Name] = &e
+		switch {
+		case e.RefreshToken != "":
+			tokens = append(tokens, f)
+		case e.ClientID != "" && e.ClientSecret != "":
+			registrations[strings.TrimSuffix(f.Name, filepath.Ext(f.Name))] = f.Name
+		}
+	}
+
+	var creds []*Credential
+	seen := make(map[string]bool)
+	for _, f := range tokens {
+		e := parsed[f.Name]
+		if seen[e.RefreshToken] {
+			skipped = append(skipped, Skipped{File: f.Name, Reason: "refreshToken 与其他文件重复"})
+			continue
+		}
+
+		cred := &Credential{
+			Source:       f.Name,
+			Provider:     e.Provider,
+			RefreshToken: e.RefreshToken,
+			AccessToken:  e.AccessToken,
+			Region:       e.Region,
+			StartURL:     e.StartURL,
+		}
+		switch {
+		case e.ClientID != "" && e.ClientSecret != "":
+			cred.AuthMethod = AuthIdC
+			cred.ClientID, cred.ClientSecret = e.ClientID, e.ClientSecret
+		case e.ClientIDHash != "":
+			name, ok := registrations[e.ClientIDHash]
+			if !ok {
+				skipped = append(skipped, Skipped{File: f.Name, Reason: fmt.Sprintf("缺少客户端注册文件 %s.json", e.ClientIDHash)})
+				continue
+			}
+			reg := parsed[name]
+			cred.AuthMethod = AuthIdC
+			cred.RegistrationFile = name
+			cred.ClientID, cred.ClientSecret = reg.ClientID, reg.ClientSecret
+		case strings.EqualFold(e.AuthMethod, AuthIdC):
+			skipped = append(skipped, Skipped{File: f.Name, Reason: "IdC 令牌缺少 clientIdHash，无法找到客户端注册"})
+			continue
+		default:
+			cred.AuthMethod = AuthSocial
+		}
+
+		seen[e.RefreshToken] = true
+		creds = append(creds, cred)
+	}
+	return creds, skipped
+}
@@ -0,0 +1,73 @@
+package ssocache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParse 测试令牌与客户端注册文件的配对
+func TestParse(t *testing.T) {
+	files := []File{
+		{Name: "kiro-auth-token.json", Data: []byte(`{"accessToken":"a1","refreshToken":"r1","authMethod":"IdC","provider":"BuilderId","clientIdHash":"abc123","region":"us-east-1"}`)},
+		{Name: "abc123.json", Data: []byte(`{"clientId":"cid","clientSecret":"csecret","expiresAt":"2030-01-01T00:00:00Z"}`)},
+		{Name: "social.json", Data: []byte(`{"accessToken":"a2","refreshToken":"r2","authMethod":"social","provider":"Github"}`)},
+		{Name: "cli-token.json", Data: []byte(`{"startUrl":"https://corp.awsapps.com/start","region":"eu-central-1","accessToken":"a3","refreshToken":"r3","clientId":"cid3","clientSecret":"cs3"}`)},
+		{Name: "orphan.json", Data: []byte(`{"refreshToken":"r4","authMethod":"IdC","clientIdHash":"missing"}`)},
+		{Name: "z-copy.json", Data: []byte(`{"refreshToken":"r2","authMethod":"social"}`)},
+		{Name: "broken.json", Data: []byte(`{not json`)},
+		{Name: "botocore-client-id-us-east-1.json", Data: []byte(`{"clientId":"x","clientSecret":"y"}`)},
+	}
+
+	creds, skipped := Parse(files)
+	if len(creds) != 3 {
+		t.Fatalf("应解析出 3 个凭证, 实际 %d: %+v", len(creds), creds)
+	}
+	bySource := make(map[string]*Credential)
+	for _, c := range creds {
+		bySource[c.Source] = c
+	}
+
+	kiro := bySource["kiro-auth-token.json"]
+	if kiro == nil || kiro.AuthMethod != AuthIdC || kiro.ClientID != "cid" || kiro.ClientSecret != "csecret" || kiro.RegistrationFile != "abc123.json" {
+		t.Errorf("Kiro IdC 令牌应与注册文件配对: %+v", kiro)
+	}
+	if social := bySource["social.json"]; social == nil || social.AuthMethod != AuthSocial || social.ClientID != "" {
+		t.Errorf("社交登录令牌不需要客户端注册: %+v", social)
+	}
+	if cli := bySource["cli-token.json"]; cli == nil || cli.AuthMethod != AuthIdC || cli.ClientID != "cid3" || cli.Region != "eu-central-1" || cli.StartURL != "https://corp.awsapps.com/start" {
+		t.Errorf("AWS CLI 令牌应使用内联的客户端凭证: %+v", cli)
+	}
+
+	reasons := make(map[string]string)
+	for _, s := range skipped {
+		reasons[s.File] = s.Reason
+	}
+	for _, name := range []string{"orphan.json", "z-copy.json", "broken.json"} {
+		if reasons[name] == "" {
+			t.Errorf("%s 应被跳过: %+v", name, skipped)
+		}
+	}
+	if _, ok := reasons["botocore-client-id-us-east-1.json"]; ok || len(skipped) != 3 {
+		t.Errorf("未被引用的客户端注册文件不应计入跳过: %+v", skipped)
+	}
+}
+
+// TestReadDir 测试只读取目录下的 JSON 文件
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "kiro-auth-token.json"), []byte(`{"refreshToken":"r"}`), 0600)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600)
+	os.Mkdir(filepath.Join(dir, "sub.json"), 0700)
+
+	files, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "kiro-auth-token.json" {
+		t.Errorf("应只读取 1 个 JSON 文件, 实际 %+v", files)
+	}
+	if _, err := ReadDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("目录不存在时应返回错误")
+	}
+}
@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"claude-api/internal/thinking"
 	"claude-api/internal/tokenizer"
 	"encoding/json"
 	"fmt"
@@ -73,6 +74,16 @@ func BuildThinkingBlockDelta(index int, thinking string) string {
 	return sseFormat("content_block_delta", data)
 }
 
+// BuildSignatureDelta 构建 thinking 块的 signature_delta 事件（在 content_block_stop 之前发送）
+func BuildSignatureDelta(index int, signature string) string {
+	data := map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]interface{}{"type": "signature_delta", "signature": signature},
+	}
+	return sseFormat("content_block_delta", data)
+}
+
 // BuildContentBlockStop 构建 content_block_stop 事件
 func BuildContentBlockStop(index int) string {
 	data := map[string]interface{}{
@@ -166,6 +177,10 @@ type ClaudeStreamHandler struct {
 	InThinkBlock         bool
 	ThinkBuffer          string
 	PendingStartTagChars int
+	// Thinking 预算截断与内容累计（为 nil 时不限制预算）
+	Thinking *thinking.Session
+	// Signer 非空时在每个 thinking 块结束前发送 signature_delta
+	Signer *thinking.Signer
 	// token 计数（基于流式 delta 事件，更准确）
 	// 根据 anthropic-tokenizer 项目，每个流式 delta 对应一个 token
 	OutputDeltaCount int
@@ -377,6 +392,7 @@ func (h *ClaudeStreamHandler) HandleEvent(eventType string, payload map[string]i
 	case "assistantResponseEnd":
 		// 关闭任何打开的块
 		if h.ContentBlockStarted && !h.ContentBlockStopSent {
+			events = append(events, h.thinkingSignature()...)
 			events = append(events, BuildContentBlockStop(h.ContentBlockIndex))
 			h.ContentBlockStopSent = true
 		}
@@ -459,6 +475,7 @@ func (h *ClaudeStreamHandler) processThinkBuffer() []string {
 					h.ContentBlockStarted = true
 					h.ContentBlockStopSent = false
 					h.InThinkBlock = true
+					h.thinkingSession().Reset()
 					h.PendingStartTagChars = len(ThinkingStartTag) - pending
 					h.ThinkBuffer = ""
 					break
@@ -512,6 +529,7 @@ func (h *ClaudeStreamHandler) processThinkBuffer() []string {
 				h.ContentBlockStarted = true
 				h.ContentBlockStopSent = false
 				h.InThinkBlock = true
+				h.thinkingSession().Reset()
 				h.PendingStartTagChars = 0
 			}
 		} else {
@@ -524,20 +542,21 @@ func (h *ClaudeStreamHandler) processThinkBuffer() []string {
 				if emitLen <= 0 {
 					break
 				}
-				thinkingChunk := h.ThinkBuffer[:emitLen]
+				thinkingChunk := h.thinkingSession().Accept(h.ThinkBuffer[:emitLen])
 				if thinkingChunk != "" {
 					events = append(events, BuildThinkingBlockDelta(h.ContentBlockIndex, thinkingChunk))
 				}
 				h.ThinkBuffer = h.ThinkBuffer[emitLen:]
 			} else {
 				// 找到结束标签
-				thinkingChunk := h.ThinkBuffer[:thinkEnd]
+				thinkingChunk := h.thinkingSession().Accept(h.ThinkBuffer[:thinkEnd])
 				if thinkingChunk != "" {
 					events = append(events, BuildThinkingBlockDelta(h.ContentBlockIndex, thinkingChunk))
 				}
 				h.ThinkBuffer = h.ThinkBuffer[thinkEnd+len(ThinkingEndTag):]
 
-				// 关闭 thinking 块
+				// 关闭 thinking 块（先发送签名）
+				events = append(events, h.thinkingSignature()...)
 				events = append(events, BuildContentBlockStop(h.ContentBlockIndex))
 				h.ContentBlockStopSent = true
 				h.ContentBlockStartSent = false
@@ -549,6 +568,22 @@ func (h *ClaudeStreamHandler) processThinkBuffer() []string {
 	return events
 }
 
+// thinkingSession 返回 thinking 会话（未设置时创建不限预算的会话）
+func (h *ClaudeStreamHandler) thinkingSession() *thinking.Session {
+	if h.Thinking == nil {
+		h.Thinking = thinking.NewSession(0)
+	}
+	return h.Thinking
+}
+
+// thinkingSignature 当前处于 thinking 块时返回签名事件（未配置签名器时为空）
+func (h *ClaudeStreamHandler) thinkingSignature() []string {
+	if !h.InThinkBlock || h.Signer == nil {
+		return nil
+	}
+	return []string{BuildSignatureDelta(h.ContentBlockIndex, h.Signer.Sign(h.thinkingSession().Text()))}
+}
+
 // Finish 返回最终的 SSE 事件
 func (h *ClaudeStreamHandler) Finish() string {
 	// 如果响应已结束（message_stop 已在 assistantResponseEnd 中发送），跳过
@@ -560,6 +595,7 @@ func (h *ClaudeStreamHandler) Finish() string {
 
 	// 确保最后一个块已关闭
 	if h.ContentBlockStarted && !h.ContentBlockStopSent {
+		result += strings.Join(h.thinkingSignature(), "")
 		result += BuildContentBlockStop(h.ContentBlockIndex)
 		h.ContentBlockStopSent = true
 	}
@@ -3,6 +3,9 @@ package stream
 import (
 	"strings"
 	"testing"
+
+	"claude-api/internal/thinking"
+	"claude-api/internal/tokenizer"
 )
 
 // =============================================================================
@@ -577,3 +580,80 @@ func TestHandleEvent_AssistantResponseEvent_ClosesToolUse(t *testing.T) {
 		t.Error("应发送 content_block_stop 关闭工具块")
 	}
 }
+
+// =============================================================================
+// thinking 签名与预算测试
+// =============================================================================
+
+// TestHandleEvent_ThinkingSignature 测试 thinking 块结束前发送 signature_delta
+func TestHandleEvent_ThinkingSignature(t *testing.T) {
+	signer := thinking.NewSigner([]byte("test-key"))
+	handler := NewClaudeStreamHandler("claude-sonnet-4", 100)
+	handler.Thinking = thinking.NewSession(0)
+	handler.Signer = signer
+
+	handler.HandleEvent("initial-response", map[string]interface{}{})
+	events := handler.HandleEvent("assistantResponseEvent", map[string]interface{}{
+		"content": "<thinking>先想一想</thinking>答案",
+	})
+	events = append(events, handler.HandleEvent("assistantResponseEnd", map[string]interface{}{})...)
+	all := strings.Join(events, "")
+
+	sigIdx := strings.Index(all, "signature_delta")
+	if sigIdx == -1 {
+		t.Fatalf("thinking 块应发送 signature_delta，实际: %s", all)
+	}
+	if stopIdx := strings.Index(all, "content_block_stop"); stopIdx < sigIdx {
+		t.Error("signature_delta 应在 thinking 块的 content_block_stop 之前")
+	}
+	if !strings.Contains(all, signer.Sign("先想一想")) {
+		t.Error("签名应覆盖完整的 thinking 内容")
+	}
+	if strings.Count(all, "signature_delta") != 1 {
+		t.Error("文本块不应发送 signature_delta")
+	}
+}
+
+// TestUnifiedStreamHandler_ThinkingSignature 测试控制台流在 thinking 段落结束时发送签名
+func TestUnifiedStreamHandler_ThinkingSignature(t *testing.T) {
+	signer := thinking.NewSigner([]byte("test-key"))
+	handler := NewUnifiedStreamHandler("claude-sonnet-4", "conv", 100)
+	handler.Signer = signer
+
+	events := handler.HandleEvent("assistantResponseEvent", map[string]interface{}{"content": "<thinking>先想"})
+	events = append(events, handler.HandleEvent("assistantResponseEvent", map[string]interface{}{"content": "一想</thinking>答案"})...)
+	all := strings.Join(events, "")
+	if !strings.Contains(all, "event: thinking_signature") || !strings.Contains(all, signer.Sign("先想一想")) {
+		t.Fatalf("thinking 段落结束时应发送完整内容的签名，实际: %s", all)
+	}
+	if strings.Index(all, "thinking_signature") > strings.Index(all, "answer_delta") {
+		t.Error("签名应在回答内容之前发送")
+	}
+
+	// 未闭合的 thinking 段落在 done 之前补发签名
+	handler = NewUnifiedStreamHandler("claude-sonnet-4", "conv", 100)
+	handler.Signer = signer
+	handler.HandleEvent("assistantResponseEvent", map[string]interface{}{"content": "<thinking>未完"})
+	done := handler.Finish("stop")
+	if !strings.Contains(done, signer.Sign("未完")) || strings.Index(done, "thinking_signature") > strings.Index(done, "event: done") {
+		t.Errorf("未闭合的 thinking 段落应在 done 之前发送签名，实际: %s", done)
+	}
+}
+
+// TestHandleEvent_ThinkingBudget 测试 thinking 内容按预算截断
+func TestHandleEvent_ThinkingBudget(t *testing.T) {
+	handler := NewClaudeStreamHandler("claude-sonnet-4", 100)
+	handler.Thinking = thinking.NewSession(thinking.MinBudgetTokens)
+
+	handler.HandleEvent("initial-response", map[string]interface{}{})
+	long := strings.Repeat("thinking hard about it ", 2000)
+	handler.HandleEvent("assistantResponseEvent", map[string]interface{}{"content": "<thinking>" + long})
+	handler.HandleEvent("assistantResponseEvent", map[string]interface{}{"content": "</thinking>done"})
+
+	if !handler.Thinking.Truncated() {
+		t.Fatal("超出预算时应截断 thinking")
+	}
+	if n := tokenizer.CountTokens(handler.Thinking.Text()); n > thinking.MinBudgetTokens {
+		t.Errorf("thinking 输出 %d token，超出预算 %d", n, thinking.MinBudgetTokens)
+	}
+}
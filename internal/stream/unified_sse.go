@@ -3,6 +3,7 @@ package stream
 import (
 	"encoding/json"
 	"fmt"
+	"claude-api/internal/thinking"
 	"claude-api/internal/tokenizer"
 	"strings"
 )
@@ -20,10 +21,13 @@ type UnifiedStreamHandler struct {
 	ConversationID string
 	ResponseID     string
 	InputTokens    int
+	// Signer 非空时在每个 thinking 段落结束时发送 thinking_signature 事件
+	Signer *thinking.Signer
 
 	// 内部状态
 	outputBuffer         []string
 	thinkingBuffer       string
+	thinkingText         strings.Builder // 当前 thinking 段落已输出的内容（用于签名）
 	inThinking           bool
 	metaSent             bool
 	pendingStartTagChars int
@@ -84,6 +88,12 @@ func (h *UnifiedStreamHandler) done(reason string) string {
 	}
 	h.doneSent = true
 
+	// 未闭合的 thinking 段落在结束前补发签名
+	var signature string
+	if h.inThinking {
+		signature = h.signatureEvent()
+	}
+
 	// 使用流式 delta 计数作为输出 token 数
 	// 根据 anthropic-tokenizer 项目，每个流式事件对应一个 token
 	outputTokens := h.outputDeltaCount
@@ -96,7 +106,7 @@ func (h *UnifiedStreamHandler) done(reason string) string {
 		}
 	}
 
-	return buildUnifiedEvent("done", map[string]interface{}{
+	return signature + buildUnifiedEvent("done", map[string]interface{}{
 		"type":          "done",
 		"finish_reason": reason,
 		"usage": map[string]int{
@@ -141,6 +151,19 @@ func (h *UnifiedStreamHandler) Finish(reason string) string {
 	return h.done(reason)
 }
 
+// signatureEvent 结束当前 thinking 段落，返回其签名事件（未配置签名器或段落为空时返回空串）
+func (h *UnifiedStreamHandler) signatureEvent() string {
+	text := h.thinkingText.String()
+	h.thinkingText.Reset()
+	if h.Signer == nil || text == "" {
+		return ""
+	}
+	return buildUnifiedEvent("thinking_signature", map[string]interface{}{
+		"type":      "thinking_signature",
+		"signature": h.Signer.Sign(text),
+	})
+}
+
 // flushThinkingBuffer 解析 thinking 标签，输出对应事件
 func (h *UnifiedStreamHandler) flushThinkingBuffer() []string {
 	var events []string
@@ -207,6 +230,7 @@ func (h *UnifiedStreamHandler) flushThinkingBuffer() []string {
 				}
 				thinkChunk := h.thinkingBuffer[:emitLen]
 				if thinkChunk != "" {
+					h.thinkingText.WriteString(thinkChunk)
 					events = append(events, buildUnifiedEvent("thinking_delta", map[string]interface{}{
 						"type": "thinking_delta",
 						"text": thinkChunk,
@@ -219,6 +243,7 @@ func (h *UnifiedStreamHandler) flushThinkingBuffer() []string {
 			} else {
 				thinkChunk := h.thinkingBuffer[:end]
 				if thinkChunk != "" {
+					h.thinkingText.WriteString(thinkChunk)
 					events = append(events, buildUnifiedEvent("thinking_delta", map[string]interface{}{
 						"type": "thinking_delta",
 						"text": thinkChunk,
@@ -226,6 +251,9 @@ func (h *UnifiedStreamHandler) flushThinkingBuffer() []string {
 				}
 				h.thinkingBuffer = h.thinkingBuffer[end+len(ThinkingEndTag):]
 				h.inThinking = false
+				if sig := h.signatureEvent(); sig != "" {
+					events = append(events, sig)
+				}
 				h.pendingStartTagChars = 0
 			}
 		}
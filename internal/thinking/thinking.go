@@ -0,0 +1,234 @@
+// Package thinking 扩展思考（extended thinking）支持：
+// thinking 块签名与校验、budget_tokens 截断、客户端回传的历史 thinking / redacted_thinking 处理
+// @author ygw
+package thinking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"claude-api/internal/models"
+	"claude-api/internal/tokenizer"
+)
+
+// 块类型
+const (
+	BlockThinking         = "thinking"
+	BlockRedactedThinking = "redacted_thinking"
+)
+
+// MinBudgetTokens budget_tokens 最小值（与 Claude API 一致）
+const MinBudgetTokens = 1024
+
+// signaturePrefix 签名版本前缀，便于以后更换算法
+const signaturePrefix = "v1."
+
+// Signer thinking 块签名器（服务端 HMAC-SHA256）
+type Signer struct {
+	key []byte
+}
+
+// NewSigner 创建签名器
+// @param key 签名密钥（建议 32 字节随机值）
+// @return *Signer 签名器
+// @author ygw
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: append([]byte(nil), key...)}
+}
+
+// Sign 计算 thinking 内容的签名
+func (s *Signer) Sign(thinking string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(thinking))
+	return signaturePrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验 thinking 内容与签名是否匹配
+func (s *Signer) Verify(thinking, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	want := s.Sign(thinking)
+	return hmac.Equal([]byte(want), []byte(signature))
+}
+
+// ParseBudget 从请求的 thinking 配置中读取 budget_tokens（未设置返回 0）
+// 小于 MinBudgetTokens 的值按 MinBudgetTokens 处理
+// @param cfg 请求中的 thinking 字段
+// @return int 预算 token 数
+// @author ygw
+func ParseBudget(cfg interface{}) int {
+	m, ok := cfg.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	var budget int
+	switch v := m["budget_tokens"].(type) {
+	case float64:
+		budget = int(v)
+	case int:
+		budget = v
+	}
+	if budget <= 0 {
+		return 0
+	}
+	if budget < MinBudgetTokens {
+		budget = MinBudgetTokens
+	}
+	return budget
+}
+
+// Session 单次响应中的 thinking 状态：累计内容、执行预算截断、生成签名
+type Session struct {
+	budget    int
+	tokens    int
+	truncated bool
+	text      strings.Builder
+}
+
+// NewSession 创建 thinking 会话
+// @param budget 预算 token 数（0 表示不限制）
+func NewSession(budget int) *Session {
+	return &Session{budget: budget}
+}
+
+// Accept 追加 thinking 片段，返回预算内允许输出的部分（超出预算后返回空串）
+// @param chunk thinking 片段
+// @return string 允许输出的片段
+// @author ygw
+func (s *Session) Accept(chunk string) string {
+	if chunk == "" || s.truncated {
+		return ""
+	}
+	if s.budget <= 0 {
+		s.text.WriteString(chunk)
+		return chunk
+	}
+
+	n := tokenizer.CountTokens(chunk)
+	if s.tokens+n <= s.budget {
+		s.tokens += n
+		s.text.WriteString(chunk)
+		return chunk
+	}
+
+	// 超出预算：按剩余 token 比例截断到字符边界
+	s.truncated = true
+	remain := s.budget - s.tokens
+	if remain <= 0 {
+		return ""
+	}
+	// 二分查找不超过剩余预算的最长前缀，避免逐字符回退时反复计算整段 token
+	runes := []rune(chunk)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if tokenizer.CountTokens(string(runes[:mid])) <= remain {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	part := string(runes[:lo])
+	s.tokens += tokenizer.CountTokens(part)
+	s.text.WriteString(part)
+	return part
+}
+
+// Truncated 是否因预算被截断
+func (s *Session) Truncated() bool {
+	return s.truncated
+}
+
+// Text 返回已输出的 thinking 内容
+func (s *Session) Text() string {
+	return s.text.String()
+}
+
+// Reset 开始新的 thinking 块（预算在整个响应内共享）
+func (s *Session) Reset() {
+	s.text.Reset()
+}
+
+// Split 从完整回答文本中拆出 <thinking> 段落（用于非流式响应）
+// @param text 上游返回的完整文本
+// @param startTag 开始标签
+// @param endTag 结束标签
+// @return []string thinking 段落
+// @return string 去除 thinking 后的回答文本
+// @author ygw
+func Split(text, startTag, endTag string) ([]string, string) {
+	var thoughts []string
+	var rest strings.Builder
+	for {
+		start := strings.Index(text, startTag)
+		if start == -1 {
+			rest.WriteString(text)
+			break
+		}
+		rest.WriteString(text[:start])
+		text = text[start+len(startTag):]
+		end := strings.Index(text, endTag)
+		if end == -1 {
+			// 未闭合的 thinking 视为到结尾
+			thoughts = append(thoughts, text)
+			break
+		}
+		thoughts = append(thoughts, text[:end])
+		text = text[end+len(endTag):]
+	}
+	return thoughts, strings.TrimLeft(rest.String(), "\r\n")
+}
+
+// PrepareHistory 处理客户端回传的历史 thinking 块
+//   - 本服务签发的 thinking 块原样保留
+//   - 无法校验的 thinking 块（其他服务或其他密钥签发、配置了签名器时未带签名）无法证明来源，从历史中移除，不发送给上游
+//   - redacted_thinking 块内容不透明，无法还原给上游，从历史中移除
+//
+// @param messages 请求消息（原地修改）
+// @param signer 签名器
+// @return int 移除的 thinking 和 redacted_thinking 块数量
+// @return error redacted_thinking 块格式错误时返回错误
+// @author ygw
+func PrepareHistory(messages []models.ClaudeMessage, signer *Signer) (int, error) {
+	removed := 0
+	for i := range messages {
+		if messages[i].Role != "assistant" {
+			continue
+		}
+		blocks, ok := messages[i].Content.([]interface{})
+		if !ok {
+			continue
+		}
+		kept := blocks[:0]
+		for idx, block := range blocks {
+			m, ok := block.(map[string]interface{})
+			if !ok {
+				kept = append(kept, block)
+				continue
+			}
+			switch m["type"] {
+			case BlockRedactedThinking:
+				if _, ok := m["data"].(string); !ok {
+					return removed, fmt.Errorf("messages[%d].content[%d]: redacted_thinking 块缺少 data", i, idx)
+				}
+				removed++
+				continue
+			case BlockThinking:
+				sig, _ := m["signature"].(string)
+				text, _ := m["thinking"].(string)
+				verified := sig == "" && signer == nil || sig != "" && signer != nil && signer.Verify(text, sig)
+				if !verified {
+					removed++
+					continue
+				}
+			}
+			kept = append(kept, block)
+		}
+		messages[i].Content = kept
+	}
+	return removed, nil
+}
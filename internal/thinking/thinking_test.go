@@ -0,0 +1,128 @@
+package thinking
+
+import (
+	"strings"
+	"testing"
+
+	"claude-api/internal/models"
+	"claude-api/internal/tokenizer"
+)
+
+// TestSigner_SignVerify 测试签名与校验
+func TestSigner_SignVerify(t *testing.T) {
+	s := NewSigner([]byte("key-a"))
+	sig := s.Sign("思考内容")
+	if !strings.HasPrefix(sig, signaturePrefix) {
+		t.Fatalf("签名应带版本前缀: %s", sig)
+	}
+	if !s.Verify("思考内容", sig) {
+		t.Error("同一密钥应校验通过")
+	}
+	if s.Verify("被篡改的内容", sig) {
+		t.Error("内容被修改后不应校验通过")
+	}
+	if NewSigner([]byte("key-b")).Verify("思考内容", sig) {
+		t.Error("不同密钥不应校验通过")
+	}
+	if s.Verify("思考内容", strings.TrimPrefix(sig, signaturePrefix)) {
+		t.Error("缺少版本前缀不应校验通过")
+	}
+}
+
+// TestParseBudget 测试 budget_tokens 解析
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		cfg  interface{}
+		want int
+	}{
+		{nil, 0},
+		{true, 0},
+		{map[string]interface{}{"type": "enabled"}, 0},
+		{map[string]interface{}{"type": "enabled", "budget_tokens": float64(8000)}, 8000},
+		{map[string]interface{}{"budget_tokens": float64(100)}, MinBudgetTokens},
+		{map[string]interface{}{"budget_tokens": 2048}, 2048},
+	}
+	for _, tt := range tests {
+		if got := ParseBudget(tt.cfg); got != tt.want {
+			t.Errorf("ParseBudget(%v) = %d, 期望 %d", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+// TestSession_Accept 测试预算截断（预算在多个块之间共享）
+func TestSession_Accept(t *testing.T) {
+	s := NewSession(MinBudgetTokens)
+	chunk := strings.Repeat("word ", 300)
+	total := 0
+	for i := 0; i < 10; i++ {
+		total += tokenizer.CountTokens(s.Accept(chunk))
+		if i == 4 {
+			s.Reset()
+		}
+	}
+	if !s.Truncated() {
+		t.Fatal("超出预算后应标记截断")
+	}
+	if total > MinBudgetTokens || total < MinBudgetTokens-10 {
+		t.Errorf("输出 token 数 %d 应接近预算 %d", total, MinBudgetTokens)
+	}
+	if s.Accept("more") != "" {
+		t.Error("截断后不应再输出")
+	}
+
+	unlimited := NewSession(0)
+	if unlimited.Accept(chunk) != chunk || unlimited.Text() != chunk {
+		t.Error("不限预算时应原样输出")
+	}
+}
+
+// TestSplit 测试拆分 thinking 段落
+func TestSplit(t *testing.T) {
+	thoughts, rest := Split("<thinking>a</thinking>\n答案<thinking>b", "<thinking>", "</thinking>")
+	if len(thoughts) != 2 || thoughts[0] != "a" || thoughts[1] != "b" {
+		t.Errorf("thinking 段落错误: %q", thoughts)
+	}
+	if rest != "答案" {
+		t.Errorf("回答文本错误: %q", rest)
+	}
+
+	thoughts, rest = Split("没有思考", "<thinking>", "</thinking>")
+	if len(thoughts) != 0 || rest != "没有思考" {
+		t.Errorf("无 thinking 时应原样返回: %q %q", thoughts, rest)
+	}
+}
+
+// TestPrepareHistory 测试历史 thinking 块处理
+func TestPrepareHistory(t *testing.T) {
+	signer := NewSigner([]byte("key"))
+	messages := []models.ClaudeMessage{
+		{Role: "user", Content: "问题"},
+		{Role: "assistant", Content: []interface{}{
+			map[string]interface{}{"type": "thinking", "thinking": "签名的思考", "signature": signer.Sign("签名的思考")},
+			map[string]interface{}{"type": "thinking", "thinking": "旧客户端的思考"},
+			map[string]interface{}{"type": "thinking", "thinking": "其他服务的思考", "signature": "EqQBCkYIBxgCKkA"},
+			map[string]interface{}{"type": "thinking", "thinking": "伪造", "signature": signer.Sign("原文")},
+			map[string]interface{}{"type": "redacted_thinking", "data": "opaque"},
+			map[string]interface{}{"type": "text", "text": "回答"},
+		}},
+	}
+
+	removed, err := PrepareHistory(messages, signer)
+	if err != nil {
+		t.Fatalf("合法历史不应报错: %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("应移除无法校验的 thinking 块和 redacted_thinking 块，实际移除 %d 个", removed)
+	}
+	blocks := messages[1].Content.([]interface{})
+	if len(blocks) != 2 || blocks[0].(map[string]interface{})["thinking"] != "签名的思考" || blocks[1].(map[string]interface{})["type"] != "text" {
+		t.Errorf("应只保留签名的 thinking 块和文本块: %v", blocks)
+	}
+
+	bad := []models.ClaudeMessage{
+		{Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "redacted_thinking"}}},
+	}
+	if _, err := PrepareHistory(bad, signer); err == nil {
+		t.Error("缺少 data 的 redacted_thinking 应报错")
+	}
+}
@@ -0,0 +1,207 @@
+// Package tracing 基于 OpenTelemetry 的请求链路追踪
+// 未配置 OTLP 端点时使用 no-op 实现，不产生任何开销
+// @author ygw
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"claude-api/internal/config"
+	"claude-api/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName 追踪器名称
+const TracerName = "claude-api"
+
+// 链路各阶段的 Span 名称
+const (
+	SpanAccountSelect = "account.select"       // 账号选择
+	SpanAccountReady  = "account.ensure_ready" // 被动刷新令牌
+	SpanSummary       = "compressor.summary"   // 压缩摘要调用
+	SpanUpstream      = "amazonq.send_chat"    // 上游 SendChatRequest
+	SpanStreamConvert = "stream.convert"       // 上游事件流转换
+)
+
+// Span 属性键
+var (
+	AttrAccountID    = attribute.Key("claude_api.account_id")
+	AttrModel        = attribute.Key("claude_api.model")
+	AttrRetry        = attribute.Key("claude_api.retry")
+	AttrInputTokens  = attribute.Key("claude_api.input_tokens")
+	AttrOutputTokens = attribute.Key("claude_api.output_tokens")
+	AttrStream       = attribute.Key("claude_api.stream")
+	AttrUserID       = attribute.Key("claude_api.user_id")
+)
+
+// ShutdownFunc 关闭追踪器，刷新未导出的 Span
+type ShutdownFunc func(ctx context.Context) error
+
+// noopShutdown 未启用追踪时的关闭函数
+func noopShutdown(context.Context) error { return nil }
+
+func init() {
+	// 无论是否启用导出，都使用 W3C traceparent 传播，保证上下文可透传
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Init 根据配置初始化全局 TracerProvider
+// 未启用或未配置端点时保持 OpenTelemetry 默认的 no-op 实现
+// @param ctx 上下文
+// @param cfg 追踪配置
+// @return ShutdownFunc 关闭函数
+// @return error 错误信息
+// @author ygw
+func Init(ctx context.Context, cfg config.TracingConfig) (ShutdownFunc, error) {
+	if !cfg.Enabled || cfg.Endpoint == "" {
+		return noopShutdown, nil
+	}
+
+	opts := []otlptracehttp.Option{}
+	if strings.Contains(cfg.Endpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return noopShutdown, fmt.Errorf("创建 OTLP 导出器失败: %w", err)
+	}
+
+	tp := newProvider(cfg, sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(tp)
+	logger.Info("链路追踪已启用 - OTLP 端点: %s, 采样率: %.2f", cfg.Endpoint, cfg.SampleRatio)
+	return tp.Shutdown, nil
+}
+
+// InitWithExporter 使用指定导出器初始化全局 TracerProvider（同步导出，主要用于测试）
+// @param exporter Span 导出器，如 tracetest.NewInMemoryExporter()
+// @return ShutdownFunc 关闭函数
+// @author ygw
+func InitWithExporter(exporter sdktrace.SpanExporter) ShutdownFunc {
+	tp := newProvider(config.TracingConfig{SampleRatio: 1}, sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown
+}
+
+// newProvider 创建 TracerProvider
+func newProvider(cfg config.TracingConfig, opt sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = TracerName
+	}
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	return sdktrace.NewTracerProvider(
+		opt,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
+
+// Tracer 获取全局追踪器
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Start 开始一个内部 Span
+// @param ctx 父上下文
+// @param name Span 名称
+// @param attrs Span 属性
+// @return context.Context 携带新 Span 的上下文
+// @return trace.Span 新 Span，调用方负责 End
+// @author ygw
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 Span，如果有错误则记录错误并设置状态
+// @param span Span
+// @param err 阶段错误（可为 nil）
+// @author ygw
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetAttributes 给上下文中的当前 Span 追加属性
+func SetAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// Middleware 入站请求追踪中间件
+// 从请求头提取 W3C traceparent，创建服务端根 Span 并写回请求上下文
+// @param pathPrefixes 需要追踪的路径前缀，为空则追踪所有请求
+// @return gin.HandlerFunc 中间件
+// @author ygw
+func Middleware(pathPrefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if len(pathPrefixes) > 0 {
+			matched := false
+			for _, prefix := range pathPrefixes {
+				if strings.HasPrefix(path, prefix) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				c.Next()
+				return
+			}
+		}
+
+		parent := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := Tracer().Start(parent, c.Request.Method+" "+path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.URLPath(path),
+				semconv.ClientAddress(c.ClientIP()),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+		if msg, ok := c.Get("error_message"); ok {
+			if s, ok := msg.(string); ok && s != "" {
+				span.SetAttributes(attribute.String("error.message", s))
+			}
+		}
+	}
+}
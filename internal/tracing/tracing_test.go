@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"claude-api/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// findSpan 按名称查找已导出的 Span
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+// hasAttr 检查 Span 是否包含指定属性
+func hasAttr(span *tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, a := range span.Attributes {
+		if a.Key == kv.Key && a.Value == kv.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// TestMiddleware_PropagatesTraceparent 测试入站 traceparent 透传到各阶段 Span
+func TestMiddleware_PropagatesTraceparent(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := InitWithExporter(exporter)
+	defer shutdown(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware("/v1/"))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		_, span := Start(c.Request.Context(), SpanAccountSelect, AttrRetry.Int(1))
+		span.SetAttributes(AttrAccountID.String("acc-1"))
+		End(span, nil)
+
+		_, span = Start(c.Request.Context(), SpanUpstream, AttrModel.String("claude-sonnet-4"))
+		End(span, errors.New("upstream failed"))
+
+		SetAttributes(c.Request.Context(), AttrInputTokens.Int(42))
+		c.Status(http.StatusOK)
+	})
+	r.GET("/v2/settings", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// 非追踪路径不应产生 Span
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/settings", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("期望导出 3 个 Span，实际 %d 个", len(spans))
+	}
+
+	root := findSpan(spans, "POST /v1/messages")
+	if root == nil {
+		t.Fatal("未找到服务端根 Span")
+	}
+	if got := root.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("根 Span 未继承入站 traceparent: %s", got)
+	}
+	if root.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("根 Span 的父 Span 错误: %s", root.Parent.SpanID())
+	}
+	if !hasAttr(root, AttrInputTokens.Int(42)) {
+		t.Error("根 Span 缺少 input_tokens 属性")
+	}
+
+	sel := findSpan(spans, SpanAccountSelect)
+	if sel == nil || sel.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Fatal("账号选择 Span 未挂在根 Span 下")
+	}
+	if !hasAttr(sel, AttrAccountID.String("acc-1")) || !hasAttr(sel, AttrRetry.Int(1)) {
+		t.Errorf("账号选择 Span 属性缺失: %v", sel.Attributes)
+	}
+
+	up := findSpan(spans, SpanUpstream)
+	if up == nil || up.Status.Code != codes.Error {
+		t.Error("上游 Span 应记录错误状态")
+	}
+}
+
+// TestInit_NoopByDefault 测试未配置端点时为 no-op
+func TestInit_NoopByDefault(t *testing.T) {
+	shutdown, err := Init(context.Background(), config.Load().Tracing)
+	if err != nil {
+		t.Fatalf("默认配置初始化失败: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("no-op 关闭失败: %v", err)
+	}
+}
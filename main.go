@@ -16,6 +16,7 @@ import (
 	"claude-api/internal/config"
 	"claude-api/internal/database"
 	"claude-api/internal/logger"
+	"claude-api/internal/tracing"
 	"runtime"
 	"syscall"
 	"time"
@@ -27,20 +28,30 @@ import (
 var Version = "dev"
 
 func main() {
+	// serve 子命令与不带子命令相同，启动服务器；其他管理子命令执行后直接退出
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	} else if handled, err := runCommand(args); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 解析命令行参数
 	portFlag := flag.Int("port", 0, "服务器监听端口（优先级最高，0 表示使用系统配置或默认值 62311）")
 	flag.IntVar(portFlag, "p", 0, "服务器监听端口（-port 的简写）")
 	noBrowserFlag := flag.Bool("no-browser", false, "禁用启动时自动打开浏览器")
 	dataDirFlag := flag.String("data-dir", "", "数据目录路径（存放数据库和日志，不指定则使用当前工作目录）")
-	flag.Parse()
-
-	// 设置时区为北京时间（UTC+8）
-	loc, err := time.LoadLocation("Asia/Shanghai")
-	if err != nil {
-		log.Printf("警告: 加载时区失败，使用 UTC+8: %v", err)
-		loc = time.FixedZone("CST", 8*3600)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), cliUsage+"服务器启动参数:\n")
+		flag.PrintDefaults()
 	}
-	time.Local = loc
+	flag.CommandLine.Parse(args)
+
+	initTimezone()
 
 	// 确定数据目录（仅当通过 -data-dir 参数指定时才使用）
 	// 命令行版本：不指定 -data-dir，使用当前工作目录
@@ -77,6 +88,9 @@ func main() {
 		logger.Warn("加载配置文件失败，使用默认配置: %v", err)
 		cfg = config.Load()
 	}
+	if err := cfg.ApplyEnv(); err != nil {
+		logger.Warn("环境变量上游地址无效，已忽略: %v", err)
+	}
 
 	// 记录配置来源
 	filePort := cfg.Server.Port
@@ -92,9 +106,22 @@ func main() {
 		logger.Info("从配置文件读取调试模式: 已开启")
 	}
 
+	// 应用日志格式与轮转配置
+	logger.Configure(logger.Options{
+		Format:        cfg.Log.Format,
+		MaxSizeMB:     cfg.Log.MaxSizeMB,
+		RetentionDays: cfg.Log.RetentionDays,
+	})
+
 	// 设置调试日志（从配置文件读取，默认关闭）
 	logger.SetDebugEnabled(fileDebug)
 
+	// 初始化链路追踪（未配置 OTLP 端点时为 no-op）
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Warn("初始化链路追踪失败，已禁用: %v", err)
+	}
+
 	// 保存命令行指定的端口，用于后续判断
 	cliPort := *portFlag
 	logger.Info("配置已加载 - 默认端口: %d, 配置文件端口: %d, 命令行端口: %d, 控制台: %v", cfg.Port, filePort, cliPort, cfg.EnableConsole)
@@ -195,13 +222,24 @@ func main() {
 		logger.Info("已禁用自动打开浏览器")
 	}
 
-	// 后台令牌刷新任务已关闭，改为被动刷新策略
-	// 当请求进来时按需刷新令牌和配额，对用户无感知
-	// go server.BackgroundTokenRefresh(context.Background())
+	// 启动令牌刷新调度（按访问令牌过期时间提前刷新，请求路径只在令牌已过期时同步刷新）
+	go server.BackgroundTokenScheduler(context.Background())
 
 	// 启动缓存系统（账号池、设置缓存的后台刷新）
 	server.StartCaches(context.Background())
 
+	// 启动月度用量报表任务（配置 reports.dir 后生效）
+	go server.BackgroundMonthlyReports(context.Background())
+
+	// 启动代理健康检查任务（启用代理池后生效）
+	go server.BackgroundProxyHealthCheck(context.Background())
+
+	// 启动代理订阅同步任务（按各订阅的同步间隔拉取）
+	go server.BackgroundProxySubscriptions(context.Background())
+
+	// 恢复重启前未完成的批量设备授权会话
+	server.ResumeDeviceAuthSessions(context.Background())
+
 	// 启动后台检查任务（账号超限、日志清理、远程验证、在线IP清理）
 	quit := make(chan os.Signal, 1)
 
@@ -283,11 +321,26 @@ func main() {
 		logger.Error("服务器强制关闭: %v", err)
 	}
 
+	// 刷新未导出的追踪数据
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("关闭链路追踪失败: %v", err)
+	}
+
 	logger.Info("=== Claude 无限畅享版 %s 服务器已停止 ===", Version)
 	logger.Close()
 	log.Println("服务器已退出")
 }
 
+// initTimezone 设置时区为北京时间（UTC+8）
+func initTimezone() {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		log.Printf("警告: 加载时区失败，使用 UTC+8: %v", err)
+		loc = time.FixedZone("CST", 8*3600)
+	}
+	time.Local = loc
+}
+
 // openBrowser 自动打开浏览器访问管理页面
 func openBrowser(host string, port int) {
 	// 如果监听 0.0.0.0，使用 localhost 访问